@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// BorrowedReport lists all loans with book and member.
+func (c *Client) BorrowedReport(ctx context.Context) ([]BorrowingDetail, error) {
+	return get[[]BorrowingDetail](ctx, c, "/reports/borrowed", nil)
+}
+
+// AuditQuery filters the audit log, empty fields match everything. From and
+// To are days, YYYY-MM-DD.
+type AuditQuery struct {
+	Actor     string
+	Action    AuditAction
+	Entity    AuditEntity
+	EntityID  string
+	BookID    int
+	MemberID  int
+	RequestID string
+	From      string
+	To        string
+	Offset    int
+	Limit     int // 0 uses the backend's default
+}
+
+func (q AuditQuery) values() url.Values {
+	v := page(q.Offset, q.Limit)
+
+	set := func(key, value string) {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+
+	set("actor", q.Actor)
+	set("action", string(q.Action))
+	set("entity", string(q.Entity))
+	set("entity_id", q.EntityID)
+	set("request_id", q.RequestID)
+	set("from", q.From)
+	set("to", q.To)
+
+	if q.BookID > 0 {
+		v.Set("book_id", strconv.Itoa(q.BookID))
+	}
+
+	if q.MemberID > 0 {
+		v.Set("member_id", strconv.Itoa(q.MemberID))
+	}
+
+	return v
+}
+
+// Audit returns a page of the audit log, newest first.
+func (c *Client) Audit(ctx context.Context, q AuditQuery) (*AuditPage, error) {
+	v, err := get[AuditPage](ctx, c, "/audit", q.values())
+	if err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+// RunArchive anonymizes members deleted longer than the archive period.
+func (c *Client) RunArchive(ctx context.Context) (*ArchiveResult, error) {
+	return call[ArchiveResult](ctx, c, http.MethodPost, "/jobs/archive", nil)
+}
+
+// RunRetention unlinks returned loans older than the retention period from
+// their members, or only reports how many it would on a dry run.
+func (c *Client) RunRetention(ctx context.Context, dryRun bool) (*RetentionReport, error) {
+	var report RetentionReport
+
+	req := request{method: http.MethodPost, path: "/jobs/retention", query: url.Values{"dry_run": {strconv.FormatBool(dryRun)}}}
+	if err := c.do(ctx, req, &report); err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
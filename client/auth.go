@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/tliefheid/go-ils/internal/model"
+)
+
+// Login logs a staff user in. Use the token of the session with WithToken.
+func (c *Client) Login(ctx context.Context, username, password string) (*StaffSession, error) {
+	return call[StaffSession](ctx, c, http.MethodPost, "/auth/login", model.StaffLoginRequest{Username: username, Password: password})
+}
+
+// OIDCNonce returns a nonce to start a single sign-on with. The backend
+// accepts it once, in LoginOIDC.
+func (c *Client) OIDCNonce(ctx context.Context) (*OIDCNonce, error) {
+	return call[OIDCNonce](ctx, c, http.MethodPost, "/auth/oidc/nonce", nil)
+}
+
+// LoginOIDC logs a staff user in with the ID token of a single sign-on and
+// the nonce the login was started with.
+func (c *Client) LoginOIDC(ctx context.Context, idToken, nonce string) (*StaffSession, error) {
+	return call[StaffSession](ctx, c, http.MethodPost, "/auth/oidc", model.OIDCLoginRequest{IDToken: idToken, Nonce: nonce})
+}
+
+// Logout ends the staff session.
+func (c *Client) Logout(ctx context.Context) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/auth/logout"}, nil)
+}
+
+// Me returns the logged in staff user.
+func (c *Client) Me(ctx context.Context) (*StaffUser, error) {
+	return getOne[StaffUser](ctx, c, "/auth/me")
+}
+
+// ChangePassword changes the password of the logged in staff user. The
+// backend ends all their sessions.
+func (c *Client) ChangePassword(ctx context.Context, current, password string) error {
+	return c.do(ctx, request{method: http.MethodPut, path: "/auth/password", body: model.PasswordRequest{Current: current, Password: password}}, nil)
+}
+
+func (c *Client) ListStaff(ctx context.Context) ([]StaffUser, error) {
+	return get[[]StaffUser](ctx, c, "/staff", nil)
+}
+
+// AddStaff creates a staff user, req.Password is required.
+func (c *Client) AddStaff(ctx context.Context, req StaffUserRequest) (*StaffUser, error) {
+	return call[StaffUser](ctx, c, http.MethodPost, "/staff", req)
+}
+
+// EditStaff changes a staff user, the password is kept.
+func (c *Client) EditStaff(ctx context.Context, staffID int, req StaffUserRequest) (*StaffUser, error) {
+	req.Password = ""
+	return call[StaffUser](ctx, c, http.MethodPut, "/staff/"+id(staffID), req)
+}
+
+// SetStaffPassword sets the password of another staff user.
+func (c *Client) SetStaffPassword(ctx context.Context, staffID int, password string) error {
+	return c.do(ctx, request{method: http.MethodPut, path: "/staff/" + id(staffID) + "/password", body: model.PasswordRequest{Password: password}}, nil)
+}
+
+func (c *Client) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	return get[[]APIKey](ctx, c, "/apikeys", nil)
+}
+
+// AddAPIKey creates an API key. The response is the only time its secret
+// is shown.
+func (c *Client) AddAPIKey(ctx context.Context, req APIKeyRequest) (*NewAPIKey, error) {
+	return call[NewAPIKey](ctx, c, http.MethodPost, "/apikeys", req)
+}
+
+func (c *Client) RevokeAPIKey(ctx context.Context, keyID int) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/apikeys/" + id(keyID) + "/revoke"}, nil)
+}
+
+// RotateAPIKey replaces the secret of an API key, the old one stops
+// working.
+func (c *Client) RotateAPIKey(ctx context.Context, keyID int) (*NewAPIKey, error) {
+	return call[NewAPIKey](ctx, c, http.MethodPost, "/apikeys/"+id(keyID)+"/rotate", nil)
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// LookupISBN looks up book data by ISBN at Open Library. The book is not
+// added to the catalogue.
+func (c *Client) LookupISBN(ctx context.Context, isbn string) (*Book, error) {
+	if isbn == "" {
+		return nil, errMissing("ISBN")
+	}
+
+	return getOne[Book](ctx, c, "/isbn/"+url.PathEscape(isbn))
+}
+
+func (c *Client) ListBooks(ctx context.Context) ([]Book, error) {
+	return get[[]Book](ctx, c, "/books", nil)
+}
+
+// SearchBooks searches books by title, author or ISBN.
+func (c *Client) SearchBooks(ctx context.Context, q string) ([]Book, error) {
+	return get[[]Book](ctx, c, "/books/search", search(q))
+}
+
+func (c *Client) AddBook(ctx context.Context, b Book) (*Book, error) {
+	return call[Book](ctx, c, http.MethodPost, "/books", b)
+}
+
+// BookByISBN finds the book with an ISBN in the catalogue.
+func (c *Client) BookByISBN(ctx context.Context, isbn string) (*Book, error) {
+	if isbn == "" {
+		return nil, errMissing("ISBN")
+	}
+
+	return getOne[Book](ctx, c, "/books/isbn/"+url.PathEscape(isbn))
+}
+
+// ListDeletedBooks lists deleted books that can be restored.
+func (c *Client) ListDeletedBooks(ctx context.Context) ([]Book, error) {
+	return get[[]Book](ctx, c, "/books/deleted", nil)
+}
+
+func (c *Client) GetBook(ctx context.Context, bookID int) (*Book, error) {
+	return getOne[Book](ctx, c, "/books/"+id(bookID))
+}
+
+// BookHistory returns a page of the audit entries of a book, its loans and
+// holds. A limit of 0 uses the backend's default.
+func (c *Client) BookHistory(ctx context.Context, bookID, offset, limit int) (*AuditPage, error) {
+	v, err := get[AuditPage](ctx, c, "/books/"+id(bookID)+"/history", page(offset, limit))
+	if err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+// UpdateBook saves b. It fails with ErrVersionConflict when the book
+// changed since b.Version; a zero version saves unconditionally.
+func (c *Client) UpdateBook(ctx context.Context, b Book) error {
+	return c.do(ctx, request{method: http.MethodPut, path: "/books/" + id(b.ID), body: b, ifMatch: b.Version}, nil)
+}
+
+// DeleteBook deletes a book, it stays restorable. A version other than 0
+// fails with ErrVersionConflict when the book changed since.
+func (c *Client) DeleteBook(ctx context.Context, bookID, version int) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: "/books/" + id(bookID), ifMatch: version}, nil)
+}
+
+func (c *Client) RestoreBook(ctx context.Context, bookID int) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/books/" + id(bookID) + "/restore"}, nil)
+}
+
+// page sets the offset and limit of a paged request, leaving out zeros.
+func page(offset, limit int) url.Values {
+	q := url.Values{}
+	if offset > 0 {
+		q.Set("offset", strconv.Itoa(offset))
+	}
+
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+
+	return q
+}
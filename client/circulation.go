@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/tliefheid/go-ils/internal/model"
+)
+
+// Borrow lends a book to a member, identified by member ID or card number.
+func (c *Client) Borrow(ctx context.Context, req BorrowRequest) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/borrow", body: req}, nil)
+}
+
+func (c *Client) ListBorrowings(ctx context.Context) ([]BorrowingDetail, error) {
+	return get[[]BorrowingDetail](ctx, c, "/borrow", nil)
+}
+
+func (c *Client) GetBorrowing(ctx context.Context, borrowingID int) (*BorrowingDetail, error) {
+	return getOne[BorrowingDetail](ctx, c, "/borrow/"+id(borrowingID))
+}
+
+// Return returns a loan.
+func (c *Client) Return(ctx context.Context, borrowingID int) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/returns/" + id(borrowingID)}, nil)
+}
+
+func (c *Client) MemberBlocks(ctx context.Context, memberID int) ([]MemberBlock, error) {
+	return get[[]MemberBlock](ctx, c, "/members/"+id(memberID)+"/blocks", nil)
+}
+
+// AddBlock blocks a member from borrowing.
+func (c *Client) AddBlock(ctx context.Context, memberID int, req BlockRequest) (*MemberBlock, error) {
+	return call[MemberBlock](ctx, c, http.MethodPost, "/members/"+id(memberID)+"/blocks", req)
+}
+
+// LiftBlock lifts a block before it expires, on behalf of the caller.
+func (c *Client) LiftBlock(ctx context.Context, memberID, blockID int) error {
+	path := "/members/" + id(memberID) + "/blocks/" + id(blockID) + "/lift"
+	return c.do(ctx, request{method: http.MethodPost, path: path}, nil)
+}
+
+func (c *Client) MemberHolds(ctx context.Context, memberID int) ([]Hold, error) {
+	return get[[]Hold](ctx, c, "/members/"+id(memberID)+"/holds", nil)
+}
+
+// PlaceHold places a hold on a book for a member.
+func (c *Client) PlaceHold(ctx context.Context, memberID, bookID int) (*Hold, error) {
+	return call[Hold](ctx, c, http.MethodPost, "/members/"+id(memberID)+"/holds", model.HoldRequest{BookID: bookID})
+}
+
+func (c *Client) CancelHold(ctx context.Context, memberID, holdID int) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/members/" + id(memberID) + "/holds/" + id(holdID) + "/cancel"}, nil)
+}
+
+func (c *Client) MemberFines(ctx context.Context, memberID int) ([]Fine, error) {
+	return get[[]Fine](ctx, c, "/members/"+id(memberID)+"/fines", nil)
+}
+
+// PayFine records a fine as paid.
+func (c *Client) PayFine(ctx context.Context, memberID, fineID int) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/members/" + id(memberID) + "/fines/" + id(fineID) + "/pay"}, nil)
+}
@@ -0,0 +1,359 @@
+// Package client is a typed Go client for the go-ils backend API. It is what
+// the web frontend uses, and it is there for scripts and partner systems too.
+//
+//	c := client.New("http://localhost:8080")
+//	session, err := c.Login(ctx, "admin", password)
+//	if err != nil {
+//		return err
+//	}
+//
+//	c = c.WithToken(session.Token)
+//	books, err := c.SearchBooks(ctx, "tolkien")
+//
+// Requests the backend refuses return an *Error with the problem details of
+// the response; errors.Is matches it against ErrNotFound, ErrValidation and
+// the other sentinel errors.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults of a new client.
+const (
+	DefaultTimeout = 15 * time.Second
+	DefaultRetries = 2
+	DefaultBackoff = 200 * time.Millisecond
+)
+
+// Client calls the backend API. It is safe for concurrent use; WithToken
+// returns a copy that authenticates as someone else.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	token   string
+	header  http.Header
+	retries int
+	backoff time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sends the requests with hc, for example one with a custom
+// transport. Its timeout is kept unless WithTimeout is given after it.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		copied := *hc
+		c.http = &copied
+	}
+}
+
+// WithTimeout limits how long a request may take, including reading the
+// response, per attempt. Zero means no limit.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.http.Timeout = d
+	}
+}
+
+// WithRetries retries idempotent requests up to n times when the backend
+// cannot be reached or a proxy in front of it answers 502, 503 or 504,
+// waiting backoff before the first retry and twice as long before every next
+// one. A 503 problem from the backend itself is not retried, the request may
+// have taken effect before it timed out.
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = n
+		c.backoff = backoff
+	}
+}
+
+// WithHeader sends a header with every request.
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.header.Set(key, value)
+	}
+}
+
+// New returns a client for the backend at baseURL, such as
+// "http://localhost:8080".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    &http.Client{Timeout: DefaultTimeout},
+		header:  http.Header{},
+		retries: DefaultRetries,
+		backoff: DefaultBackoff,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// WithToken returns a copy of the client that sends token, of a staff
+// session, an API key or a patron session, as bearer token.
+func (c *Client) WithToken(token string) *Client {
+	copied := *c
+	copied.token = token
+
+	return &copied
+}
+
+// RequestIDHeader carries the ID of the request a call is made for, so the
+// backend logs it under the same ID.
+const RequestIDHeader = "X-Request-Id"
+
+// WithRequestID returns a copy of the client that sends id as the request
+// ID, such as the ID of the incoming request the calls are made for. An
+// empty id leaves it to the backend to assign one.
+func (c *Client) WithRequestID(id string) *Client {
+	copied := *c
+	copied.header = c.header.Clone()
+
+	if id == "" {
+		copied.header.Del(RequestIDHeader)
+	} else {
+		copied.header.Set(RequestIDHeader, id)
+	}
+
+	return &copied
+}
+
+// ForwardedForHeader carries the address of the client a call is made for,
+// so the backend counts failed logins against it rather than the caller.
+const ForwardedForHeader = "X-Forwarded-For"
+
+// WithForwardedFor returns a copy of the client that sends addr as the
+// address of the client the calls are made for, such as the remote address
+// of the incoming request. The backend believes it only from trusted
+// proxies.
+func (c *Client) WithForwardedFor(addr string) *Client {
+	copied := *c
+	copied.header = c.header.Clone()
+
+	if addr == "" {
+		copied.header.Del(ForwardedForHeader)
+	} else {
+		copied.header.Set(ForwardedForHeader, addr)
+	}
+
+	return &copied
+}
+
+// request is a call of the API. path is escaped already.
+type request struct {
+	method  string
+	path    string
+	query   url.Values
+	body    any
+	ifMatch int // record version the change is based on, 0 for none
+}
+
+// idempotent reports whether the request may be sent again after a failure
+// without changing its outcome.
+func (r request) idempotent() bool {
+	switch r.method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// do sends req and decodes the JSON response into out unless it is nil.
+func (c *Client) do(ctx context.Context, req request, out any) error {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s %s response: %w", req.method, req.path, err)
+	}
+
+	return nil
+}
+
+// send sends req, retrying idempotent requests, and returns the successful
+// response; the caller closes its body.
+func (c *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	var payload []byte
+
+	if req.body != nil {
+		var err error
+
+		payload, err = json.Marshal(req.body)
+		if err != nil {
+			return nil, fmt.Errorf("encode %s %s request: %w", req.method, req.path, err)
+		}
+	}
+
+	uri := c.baseURL + req.path
+	if len(req.query) > 0 {
+		uri += "?" + req.query.Encode()
+	}
+
+	attempts := 1
+	if req.idempotent() {
+		attempts += c.retries
+	}
+
+	wait := c.backoff
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.attempt(ctx, req, uri, payload)
+
+		retry := attempt < attempts && ctx.Err() == nil && (err != nil || retryable(resp))
+		if !retry {
+			if err != nil {
+				return nil, err
+			}
+
+			if resp.StatusCode >= http.StatusBadRequest {
+				defer resp.Body.Close()
+				return nil, responseError(resp)
+			}
+
+			return resp, nil
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+
+		wait *= 2
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, req request, uri string, payload []byte) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	hreq, err := http.NewRequestWithContext(ctx, req.method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range c.header {
+		hreq.Header[k] = v
+	}
+
+	hreq.Header.Set("Accept", "application/json")
+
+	if payload != nil {
+		hreq.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.token != "" {
+		hreq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	if req.ifMatch > 0 {
+		hreq.Header.Set("If-Match", `"`+strconv.Itoa(req.ifMatch)+`"`)
+	}
+
+	return c.http.Do(hreq)
+}
+
+// retryable reports whether a response is worth another attempt: a proxy in
+// front of the backend cannot reach it for the moment. The backend answers
+// its own timeouts with a 503 problem, after the handler may have changed
+// something.
+func retryable(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return true
+	case http.StatusServiceUnavailable:
+		mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		return mediaType != "application/problem+json"
+	default:
+		return false
+	}
+}
+
+// Download is a file the backend sends, such as a card PDF. Close it when
+// done.
+type Download struct {
+	Body               io.ReadCloser
+	ContentType        string
+	ContentDisposition string
+}
+
+func (d *Download) Close() error {
+	return d.Body.Close()
+}
+
+// download fetches a file at path.
+func (c *Client) download(ctx context.Context, path string) (*Download, error) {
+	resp, err := c.send(ctx, request{method: http.MethodGet, path: path})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Download{
+		Body:               resp.Body,
+		ContentType:        resp.Header.Get("Content-Type"),
+		ContentDisposition: resp.Header.Get("Content-Disposition"),
+	}, nil
+}
+
+// responseError reads the problem details of a refused request. A body that
+// is not one, such as the error page of a proxy, becomes the detail.
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	e := &Error{StatusCode: resp.StatusCode}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == ProblemContentType || mediaType == "application/json" {
+		if err := json.Unmarshal(body, &e.Problem); err == nil && e.Code != "" {
+			return e
+		}
+	}
+
+	e.Problem = Problem{Status: resp.StatusCode, Title: http.StatusText(resp.StatusCode), Detail: strings.TrimSpace(string(body))}
+
+	return e
+}
+
+// id formats a numeric path parameter.
+func id(n int) string {
+	return strconv.Itoa(n)
+}
+
+// errMissing is returned for a required argument that is empty, before
+// anything is sent.
+func errMissing(what string) error {
+	return errors.New("client: missing " + what)
+}
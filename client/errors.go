@@ -0,0 +1,75 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Sentinel errors an *Error matches with errors.Is.
+var (
+	// ErrUnauthorized means the token is missing, expired or revoked; the
+	// caller has to log in again.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden means the token does not grant the permission.
+	ErrForbidden = errors.New("forbidden")
+	ErrNotFound  = errors.New("not found")
+	// ErrConflict means the request conflicts with the state of the
+	// record, such as deleting a book that is lent out.
+	ErrConflict = errors.New("conflict")
+	// ErrVersionConflict means the record changed since the version the
+	// change was based on; reload it and try again.
+	ErrVersionConflict = errors.New("version conflict")
+	// ErrValidation means fields of the request are invalid, see
+	// Error.Fields.
+	ErrValidation = errors.New("validation failed")
+)
+
+// Error is a request the backend refused, with its problem details.
+type Error struct {
+	StatusCode int
+	Problem
+}
+
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return e.Problem.Error()
+	}
+
+	// not problem details, such as the error page of a proxy
+	if e.Detail == "" {
+		return e.Title
+	}
+
+	return e.Title + ": " + e.Detail
+}
+
+// Is matches the sentinel error of the response status or problem code.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrVersionConflict:
+		return e.StatusCode == http.StatusPreconditionFailed
+	case ErrValidation:
+		return e.Code == "validation_failed"
+	default:
+		return false
+	}
+}
+
+// FieldErrors returns the message per invalid field, keyed by the json field
+// name, when err is a failed validation.
+func FieldErrors(err error) (map[string]string, bool) {
+	var e *Error
+	if !errors.As(err, &e) || !errors.Is(e, ErrValidation) {
+		return nil, false
+	}
+
+	return e.Fields, true
+}
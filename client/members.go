@@ -0,0 +1,143 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/tliefheid/go-ils/internal/model"
+)
+
+func (c *Client) ListMembers(ctx context.Context) ([]Member, error) {
+	return get[[]Member](ctx, c, "/members", nil)
+}
+
+// SearchMembers searches members by name, email or card number.
+func (c *Client) SearchMembers(ctx context.Context, q string) ([]Member, error) {
+	return get[[]Member](ctx, c, "/members/search", search(q))
+}
+
+// ListDeletedMembers lists deleted members that can be restored.
+func (c *Client) ListDeletedMembers(ctx context.Context) ([]Member, error) {
+	return get[[]Member](ctx, c, "/members/deleted", nil)
+}
+
+func (c *Client) AddMember(ctx context.Context, m Member) (*Member, error) {
+	return call[Member](ctx, c, http.MethodPost, "/members", m)
+}
+
+func (c *Client) GetMember(ctx context.Context, memberID int) (*Member, error) {
+	return getOne[Member](ctx, c, "/members/"+id(memberID))
+}
+
+// MemberHistory returns a page of the audit entries of a member and their
+// loans, cards, blocks, holds and fines. A limit of 0 uses the backend's
+// default.
+func (c *Client) MemberHistory(ctx context.Context, memberID, offset, limit int) (*AuditPage, error) {
+	v, err := get[AuditPage](ctx, c, "/members/"+id(memberID)+"/history", page(offset, limit))
+	if err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+// UpdateMember saves m. It fails with ErrVersionConflict when the member
+// changed since m.Version; a zero version saves unconditionally.
+func (c *Client) UpdateMember(ctx context.Context, m Member) error {
+	return c.do(ctx, request{method: http.MethodPut, path: "/members/" + id(m.ID), body: m, ifMatch: m.Version}, nil)
+}
+
+// DeleteMember deletes a member, they stay restorable until archived. A
+// version other than 0 fails with ErrVersionConflict when the member changed
+// since.
+func (c *Client) DeleteMember(ctx context.Context, memberID, version int) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: "/members/" + id(memberID), ifMatch: version}, nil)
+}
+
+func (c *Client) RestoreMember(ctx context.Context, memberID int) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/members/" + id(memberID) + "/restore"}, nil)
+}
+
+// ExportMember downloads everything stored about a member as a zip of JSON
+// and CSV files.
+func (c *Client) ExportMember(ctx context.Context, memberID int) (*Download, error) {
+	return c.download(ctx, "/members/"+id(memberID)+"/export")
+}
+
+// EraseMember erases the personal data of a member.
+func (c *Client) EraseMember(ctx context.Context, memberID int, req ErasureRequest) (*ErasureRecord, error) {
+	return call[ErasureRecord](ctx, c, http.MethodPost, "/members/"+id(memberID)+"/erase", req)
+}
+
+// RenewMembership renews the membership for a term of the member's
+// category.
+func (c *Client) RenewMembership(ctx context.Context, memberID int) (*Member, error) {
+	return call[Member](ctx, c, http.MethodPost, "/members/"+id(memberID)+"/membership/renew", nil)
+}
+
+// SetPIN sets the PIN the member logs in to the patron portal with.
+func (c *Client) SetPIN(ctx context.Context, memberID int, pin string) error {
+	return c.do(ctx, request{method: http.MethodPut, path: "/members/" + id(memberID) + "/pin", body: model.SetPINRequest{PIN: pin}}, nil)
+}
+
+func (c *Client) ListErasures(ctx context.Context) ([]ErasureRecord, error) {
+	return get[[]ErasureRecord](ctx, c, "/erasures", nil)
+}
+
+func (c *Client) MemberCards(ctx context.Context, memberID int) ([]Card, error) {
+	return get[[]Card](ctx, c, "/members/"+id(memberID)+"/cards", nil)
+}
+
+// IssueCard issues a new card to a member, retiring the active one. An
+// empty expiresAt, YYYY-MM-DD, uses the configured validity.
+func (c *Client) IssueCard(ctx context.Context, memberID int, expiresAt string) (*Card, error) {
+	return call[Card](ctx, c, http.MethodPost, "/members/"+id(memberID)+"/cards", IssueCardRequest{ExpiresAt: expiresAt})
+}
+
+func (c *Client) GetCard(ctx context.Context, number string) (*Card, error) {
+	if number == "" {
+		return nil, errMissing("card number")
+	}
+
+	return getOne[Card](ctx, c, "/cards/"+url.PathEscape(number))
+}
+
+// ReplaceCard retires a card as lost or replaced and issues a replacement.
+func (c *Client) ReplaceCard(ctx context.Context, number string, reason CardStatus) (*Card, error) {
+	if number == "" {
+		return nil, errMissing("card number")
+	}
+
+	return call[Card](ctx, c, http.MethodPost, "/cards/"+url.PathEscape(number)+"/replace", ReplaceCardRequest{Reason: reason})
+}
+
+// CardPDF downloads a printable card with barcode.
+func (c *Client) CardPDF(ctx context.Context, number string) (*Download, error) {
+	if number == "" {
+		return nil, errMissing("card number")
+	}
+
+	return c.download(ctx, "/cards/"+url.PathEscape(number)+"/pdf")
+}
+
+func (c *Client) ListCategories(ctx context.Context) ([]MembershipCategory, error) {
+	return get[[]MembershipCategory](ctx, c, "/categories", nil)
+}
+
+func (c *Client) GetCategory(ctx context.Context, code string) (*MembershipCategory, error) {
+	if code == "" {
+		return nil, errMissing("category code")
+	}
+
+	return getOne[MembershipCategory](ctx, c, "/categories/"+url.PathEscape(code))
+}
+
+// UpdateCategory changes the rules of the membership category cat.Code.
+func (c *Client) UpdateCategory(ctx context.Context, cat MembershipCategory) error {
+	if cat.Code == "" {
+		return errMissing("category code")
+	}
+
+	return c.do(ctx, request{method: http.MethodPut, path: "/categories/" + url.PathEscape(cat.Code), body: cat}, nil)
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/tliefheid/go-ils/internal/model"
+)
+
+// PatronLogin logs a member in to the patron portal. Use the token of the
+// session with WithToken for the other Patron methods.
+func (c *Client) PatronLogin(ctx context.Context, cardNumber, pin string) (*PatronSession, error) {
+	return call[PatronSession](ctx, c, http.MethodPost, "/patron/login", model.PatronLoginRequest{CardNumber: cardNumber, PIN: pin})
+}
+
+// PatronLogout ends the patron session.
+func (c *Client) PatronLogout(ctx context.Context) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/patron/logout"}, nil)
+}
+
+// PatronMe returns the logged in member.
+func (c *Client) PatronMe(ctx context.Context) (*Member, error) {
+	return getOne[Member](ctx, c, "/patron/me")
+}
+
+// PatronUpdateContact changes the contact details of the logged in member
+// and returns the saved member.
+func (c *Client) PatronUpdateContact(ctx context.Context, contact ContactDetails) (*Member, error) {
+	return call[Member](ctx, c, http.MethodPut, "/patron/me/contact", contact)
+}
+
+// PatronLoans lists the open loans of the logged in member.
+func (c *Client) PatronLoans(ctx context.Context) ([]BorrowingDetail, error) {
+	return get[[]BorrowingDetail](ctx, c, "/patron/loans", nil)
+}
+
+// PatronRenew renews a loan of the logged in member.
+func (c *Client) PatronRenew(ctx context.Context, loanID int) (*Borrowing, error) {
+	return call[Borrowing](ctx, c, http.MethodPost, "/patron/loans/"+id(loanID)+"/renew", nil)
+}
+
+// PatronHolds lists the holds of the logged in member.
+func (c *Client) PatronHolds(ctx context.Context) ([]Hold, error) {
+	return get[[]Hold](ctx, c, "/patron/holds", nil)
+}
+
+// PatronPlaceHold places a hold on a book for the logged in member.
+func (c *Client) PatronPlaceHold(ctx context.Context, bookID int) (*Hold, error) {
+	return call[Hold](ctx, c, http.MethodPost, "/patron/holds", model.HoldRequest{BookID: bookID})
+}
+
+// PatronCancelHold cancels a hold of the logged in member.
+func (c *Client) PatronCancelHold(ctx context.Context, holdID int) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/patron/holds/" + id(holdID) + "/cancel"}, nil)
+}
+
+// PatronFines lists the fines of the logged in member.
+func (c *Client) PatronFines(ctx context.Context) ([]Fine, error) {
+	return get[[]Fine](ctx, c, "/patron/fines", nil)
+}
+
+// PatronSearchBooks searches the catalogue as a patron.
+func (c *Client) PatronSearchBooks(ctx context.Context, q string) ([]Book, error) {
+	return get[[]Book](ctx, c, "/patron/books", search(q))
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Health reports whether the backend is up.
+func (c *Client) Health(ctx context.Context) error {
+	return c.do(ctx, request{method: http.MethodGet, path: "/health"}, nil)
+}
+
+// Problems lists the error codes the backend answers with.
+func (c *Client) Problems(ctx context.Context) ([]Problem, error) {
+	var problems []Problem
+	err := c.do(ctx, request{method: http.MethodGet, path: "/problems"}, &problems)
+
+	return problems, err
+}
+
+// get fetches path and decodes the response into a new T.
+func get[T any](ctx context.Context, c *Client, path string, query url.Values) (T, error) {
+	var v T
+	err := c.do(ctx, request{method: http.MethodGet, path: path, query: query}, &v)
+
+	return v, err
+}
+
+// getOne fetches a single record at path.
+func getOne[T any](ctx context.Context, c *Client, path string) (*T, error) {
+	v, err := get[T](ctx, c, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+// call sends body with method to path and decodes the response, a single
+// record, into a new T.
+func call[T any](ctx context.Context, c *Client, method, path string, body any) (*T, error) {
+	var v T
+	if err := c.do(ctx, request{method: method, path: path, body: body}, &v); err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+// search sets the search terms of a search request.
+func search(q string) url.Values {
+	return url.Values{"q": {q}}
+}
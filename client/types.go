@@ -0,0 +1,69 @@
+package client
+
+import "github.com/tliefheid/go-ils/internal/model"
+
+// The types of the API, shared with the backend.
+type (
+	Problem = model.Problem
+
+	Book            = model.Book
+	Member          = model.Member
+	Address         = model.Address
+	Borrowing       = model.Borrowing
+	BorrowingDetail = model.BorrowingDetail
+	Card            = model.Card
+	CardStatus      = model.CardStatus
+
+	MembershipCategory = model.MembershipCategory
+	MemberBlock        = model.MemberBlock
+	BlockKind          = model.BlockKind
+	Hold               = model.Hold
+	HoldStatus         = model.HoldStatus
+	Fine               = model.Fine
+	MemberExport       = model.MemberExport
+	ErasureRecord      = model.ErasureRecord
+	ArchiveResult      = model.ArchiveResult
+	RetentionReport    = model.RetentionReport
+
+	StaffUser    = model.StaffUser
+	StaffRole    = model.StaffRole
+	StaffSession = model.StaffSession
+	OIDCNonce    = model.OIDCNonce
+	APIKey       = model.APIKey
+	APIKeyScope  = model.APIKeyScope
+	NewAPIKey    = model.NewAPIKey
+
+	AuditEntry  = model.AuditEntry
+	AuditPage   = model.AuditPage
+	AuditAction = model.AuditAction
+	AuditEntity = model.AuditEntity
+
+	BorrowRequest      = model.BorrowRequest
+	IssueCardRequest   = model.IssueCardRequest
+	ReplaceCardRequest = model.ReplaceCardRequest
+	BlockRequest       = model.BlockRequest
+	ErasureRequest     = model.ErasureRequest
+	StaffUserRequest   = model.StaffUserRequest
+	APIKeyRequest      = model.APIKeyRequest
+	ContactDetails     = model.ContactDetails
+	PatronSession      = model.PatronSession
+)
+
+// ProblemContentType is the media type of problem details.
+const ProblemContentType = model.ProblemContentType
+
+const (
+	RoleAdmin     = model.RoleAdmin
+	RoleLibrarian = model.RoleLibrarian
+	RoleVolunteer = model.RoleVolunteer
+	RoleReadOnly  = model.RoleReadOnly
+
+	ScopeCatalogRead = model.ScopeCatalogRead
+	ScopeCirculation = model.ScopeCirculation
+	ScopeAdmin       = model.ScopeAdmin
+
+	CardActive   = model.CardActive
+	CardLost     = model.CardLost
+	CardReplaced = model.CardReplaced
+	CardExpired  = model.CardExpired
+)
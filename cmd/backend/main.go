@@ -2,106 +2,227 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
-	"log"
-	"net/http"
+	"log/slog"
 	"time"
 
 	"github.com/tliefheid/go-ils/internal/backend"
+	"github.com/tliefheid/go-ils/internal/config"
+	"github.com/tliefheid/go-ils/internal/logging"
 	"github.com/tliefheid/go-ils/internal/repository/postgres"
+	"github.com/tliefheid/go-ils/internal/server"
+	"github.com/tliefheid/go-ils/internal/sip2"
+	"github.com/tliefheid/go-ils/internal/tracing"
 )
 
-type Config struct {
-	DBHost     string
-	DBPort     string
-	DBUser     string
-	DBPassword string
-	DBName     string
-	HTTP       string
-}
+func main() {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	printConfig := fs.Bool("print-config", false, "print the effective configuration, secrets redacted, and exit")
 
-func LoadConfig() Config {
-	return Config{
-		DBHost:     getEnv("DB_HOST", "localhost"),
-		DBPort:     getEnv("DB_PORT", "5432"),
-		DBUser:     getEnv("DB_USER", "postgres"),
-		DBPassword: getEnv("DB_PASSWORD", "password"),
-		DBName:     getEnv("DB_NAME", "library"),
-		HTTP:       getEnv("HTTP", ":8080"),
+	cfg := config.DefaultBackend()
+	if err := config.Load(fs, os.Args[1:], &cfg); err != nil {
+		fatal("invalid configuration", err)
 	}
-}
 
-func getEnv(key, fallback string) string {
-	if value, ok := os.LookupEnv(key); ok {
-		return value
+	if *printConfig {
+		if err := config.Print(os.Stdout, &cfg); err != nil {
+			fatal("printing configuration failed", err)
+		}
+
+		return
 	}
 
-	return fallback
-}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	logger, err := logging.New(os.Stderr, cfg.Log.Level, cfg.Log.Format)
+	if err != nil {
+		fatal("invalid logging configuration", err)
+	}
+
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing.Config("go-ils-backend"))
+	if err != nil {
+		fatal("invalid tracing configuration", err)
+	}
+
+	runner, err := server.New(cfg.Server.Runner())
+	if err != nil {
+		fatal("invalid server configuration", err)
+	}
+
+	// hooks run last registered first, so the traces of the shutdown
+	// itself are flushed
+	runner.OnShutdown(func(ctx context.Context) error {
+		if err := shutdownTracing(ctx); err != nil {
+			return fmt.Errorf("flush traces: %w", err)
+		}
+
+		return nil
+	})
 
-func (c Config) DSN() string {
-	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", c.DBHost, c.DBPort, c.DBUser, c.DBPassword, c.DBName)
+	if err := run(ctx, cfg, runner); err != nil {
+		fatal("backend failed", err)
+	}
 }
 
-func main() {
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer cancel()
+// run serves the backend until ctx is done. When setting it up fails, the
+// shutdown hooks registered so far still run, so traces are flushed and
+// the database closed.
+func run(ctx context.Context, cfg config.Backend, runner *server.Runner) error {
+	// a failing SIP2 server stops the backend too
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
 
-	cfg := LoadConfig()
+	h, err := setup(ctx, stop, cfg, runner)
+	if err != nil {
+		runner.Close()
+		return err
+	}
+
+	if err := runner.Run(ctx, h); err != nil {
+		return err
+	}
 
-	db, err := postgres.NewStore(cfg.DSN())
+	if err := context.Cause(ctx); !errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	return nil
+}
+
+// setup opens the database and starts the services the runner serves,
+// registering what they need to stop. fail stops the backend when the SIP2
+// server fails.
+func setup(ctx context.Context, fail context.CancelCauseFunc, cfg config.Backend, runner *server.Runner) (http.Handler, error) {
+	db, err := postgres.NewStore(ctx, postgres.Config{
+		DSN:             cfg.DB.DSN(),
+		QueryTimeout:    seconds(cfg.DB.QueryTimeoutSeconds),
+		MaxOpenConns:    cfg.DB.MaxOpenConns,
+		MaxIdleConns:    cfg.DB.MaxIdleConns,
+		ConnMaxLifetime: seconds(cfg.DB.ConnMaxLifetimeSeconds),
+		ConnMaxIdleTime: seconds(cfg.DB.ConnMaxIdleTimeSeconds),
+	})
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		return nil, fmt.Errorf("connect to database: %w", err)
 	}
 
-	defer func() {
+	runner.OnShutdown(func(context.Context) error {
 		if err := db.Close(); err != nil {
-			log.Printf("Error closing DB: %v", err)
+			return fmt.Errorf("close database: %w", err)
 		}
-	}()
+
+		return nil
+	})
 
 	s, err := backend.New(backend.Config{
-		Repository: db,
+		Repository:       db,
+		RequestTimeout:   seconds(cfg.RequestTimeoutSeconds),
+		LibraryName:      cfg.Library.Name,
+		CardFormat:       cfg.Library.CardFormat(),
+		CardValidity:     days(cfg.Library.CardValidityDays),
+		OverdueBlockDays: cfg.Policy.OverdueBlockDays,
+		ArchiveAfter:     days(cfg.Policy.ArchiveAfterDays),
+		LoanRetention:    days(cfg.Policy.LoanRetentionDays),
+		RetentionDryRun:  cfg.Policy.RetentionDryRun,
+		FinePerDay:       cfg.Policy.FinePerDayCents,
+		PatronSession:    time.Duration(cfg.Auth.PatronSessionHours) * time.Hour,
+		StaffSession:     time.Duration(cfg.Auth.StaffSessionHours) * time.Hour,
+		OIDCIssuer:       cfg.OIDC.Issuer,
+		OIDCClientID:     cfg.OIDC.ClientID,
+		OIDCGroupsClaim:  cfg.OIDC.GroupsClaim,
+		OIDCRoleGroups:   cfg.OIDC.RoleGroups(),
+		TrustedProxies:   cfg.Auth.Proxies(),
 	})
 	if err != nil {
-		log.Fatalf("Failed to initialize backend service: %v", err)
+		return nil, fmt.Errorf("initialize backend service: %w", err)
 	}
 
-	err = db.Migrate("migrations.sql")
-	if err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
+	if err := db.Migrate(ctx); err != nil {
+		return nil, fmt.Errorf("run migrations: %w", err)
 	}
 
-	fmt.Println("Library ILS Backend - Go API running on ", cfg.HTTP)
+	if err := s.BootstrapAdmin(ctx, cfg.Auth.AdminUsername, cfg.Auth.AdminPassword); err != nil {
+		return nil, fmt.Errorf("create admin account: %w", err)
+	}
+
+	runner.OnDrain(s.Drain)
+	runner.Go(s.RunJobs)
 
-	srv := &http.Server{
-		Addr:    cfg.HTTP,
-		Handler: s.Mux(),
+	if cfg.SIP2.Addr != "" {
+		if err := startSIP2(cfg.SIP2, s, runner, fail); err != nil {
+			return nil, err
+		}
 	}
 
-	defer func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		srv.SetKeepAlivesEnabled(false)
+	return s.Mux(), nil
+}
 
-		if err := srv.Shutdown(ctx); err != nil {
-			log.Printf("Error shutting down server: %v", err)
+// startSIP2 listens for self checks before the backend starts serving, so
+// a port in use fails the start, and serves them while the runner runs.
+func startSIP2(cfg config.SIP2, s *backend.Service, runner *server.Runner, fail context.CancelCauseFunc) error {
+	sipSrv, err := sip2.NewServer(sip2.Config{
+		Addr:     cfg.Addr,
+		Username: cfg.User,
+		Password: cfg.Password,
+		Handler:  s.SIP2Handler(cfg.Institution),
+	})
+	if err != nil {
+		return fmt.Errorf("initialize SIP2 server: %w", err)
+	}
+
+	l, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("start SIP2 server: %w", err)
+	}
+
+	runner.Go(func(ctx context.Context) {
+		slog.Info("starting SIP2 server", "addr", l.Addr().String())
+
+		served := make(chan error, 1)
+
+		go func() {
+			served <- sipSrv.Serve(l)
+		}()
+
+		select {
+		case <-ctx.Done():
+		case err := <-served:
+			fail(fmt.Errorf("SIP2 server failed: %w", err))
 		}
-	}()
 
-	go func() {
-		fmt.Println("Starting server on", cfg.HTTP)
+		ctx, cancel := context.WithTimeout(context.Background(), runner.ShutdownTimeout())
+		defer cancel()
 
-		if err := http.ListenAndServe(cfg.HTTP, srv.Handler); err != nil {
-			log.Fatalf("Server error: %v", err)
+		if err := sipSrv.Shutdown(ctx); err != nil {
+			slog.Error("shutting down SIP2 server failed", "err", err)
 		}
-	}()
+	})
+
+	return nil
+}
+
+// seconds turns a setting counted in seconds into a duration.
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
+
+// days turns a setting counted in days into a duration.
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
 
-	fmt.Println("wait for shutdown signal...")
-	<-ctx.Done()
-	fmt.Println("shutting down...")
+// fatal logs a failure to start and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }
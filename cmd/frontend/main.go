@@ -3,66 +3,95 @@ package main
 import (
 	"context"
 	"embed"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"github.com/nasermirzaei89/env"
+	"github.com/tliefheid/go-ils/internal/config"
 	"github.com/tliefheid/go-ils/internal/frontend"
+	"github.com/tliefheid/go-ils/internal/logging"
+	"github.com/tliefheid/go-ils/internal/server"
+	"github.com/tliefheid/go-ils/internal/tracing"
 )
 
 //go:embed assets/*.css assets/*.gohtml
 var resources embed.FS
 
 func main() {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	printConfig := fs.Bool("print-config", false, "print the effective configuration, secrets redacted, and exit")
+
+	cfg := config.DefaultFrontend()
+	if err := config.Load(fs, os.Args[1:], &cfg); err != nil {
+		fatal("invalid configuration", err)
+	}
+
+	if *printConfig {
+		if err := config.Print(os.Stdout, &cfg); err != nil {
+			fatal("printing configuration failed", err)
+		}
+
+		return
+	}
+
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	cfg := struct {
-		HTTP string
-	}{
-		HTTP: ":4000",
+	logger, err := logging.New(os.Stderr, cfg.Log.Level, cfg.Log.Format)
+	if err != nil {
+		fatal("invalid logging configuration", err)
 	}
-	s, err := frontend.New(frontend.Config{
-		BackendUri: env.GetString("BACKEND_URI", "http://localhost:8080"),
-	})
 
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing.Config("go-ils-frontend"))
 	if err != nil {
-		log.Fatalf("Failed to initialize backend service: %v", err)
+		fatal("invalid tracing configuration", err)
 	}
 
-	s.Mux().Handle("/assets/*", http.FileServer(http.FS(resources)))
+	runner, err := server.New(cfg.Server.Runner())
+	if err != nil {
+		fatal("invalid server configuration", err)
+	}
 
-	fmt.Println("Library ILS Frontend - Running on ", cfg.HTTP)
+	runner.OnShutdown(func(ctx context.Context) error {
+		if err := shutdownTracing(ctx); err != nil {
+			return fmt.Errorf("flush traces: %w", err)
+		}
 
-	srv := &http.Server{
-		Addr:    cfg.HTTP,
-		Handler: s.Mux(),
-	}
+		return nil
+	})
 
-	defer func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		srv.SetKeepAlivesEnabled(false)
+	s, err := frontend.New(frontend.Config{
+		BackendUri:       cfg.Backend.URI,
+		BackendTimeout:   time.Duration(cfg.Backend.TimeoutSeconds) * time.Second,
+		OIDCIssuer:       cfg.OIDC.Issuer,
+		OIDCClientID:     cfg.OIDC.ClientID,
+		OIDCClientSecret: cfg.OIDC.ClientSecret,
+		OIDCRedirectURL:  cfg.OIDC.RedirectURL,
+	})
 
-		if err := srv.Shutdown(ctx); err != nil {
-			log.Printf("Error shutting down server: %v", err)
-		}
-	}()
+	if err != nil {
+		runner.Close()
+		fatal("failed to initialize backend service", err)
+	}
 
-	go func() {
-		fmt.Println("Starting server on", cfg.HTTP)
+	s.Mux().Handle("/assets/*", http.FileServer(http.FS(resources)))
 
-		if err := http.ListenAndServe(cfg.HTTP, srv.Handler); err != nil {
-			log.Fatalf("Server error: %v", err)
-		}
-	}()
+	runner.OnDrain(s.Drain)
+
+	if err := runner.Run(ctx, s.Mux()); err != nil {
+		fatal("server failed", err)
+	}
+}
 
-	fmt.Println("wait for shutdown signal...")
-	<-ctx.Done()
-	fmt.Println("shutting down...")
+// fatal logs a failure to start and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }
@@ -0,0 +1,45 @@
+// Command mockoidc runs a local OpenID provider that logs in one configured
+// user without credentials, for trying single sign-on without a real
+// identity provider.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/tliefheid/go-ils/internal/oidc/mockoidc"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9000", "listen address")
+	issuer := flag.String("issuer", "", "issuer URL, http://<addr> when empty")
+	clientID := flag.String("client", "go-ils", "client id to accept")
+	subject := flag.String("sub", "mock-user", "subject of the user")
+	username := flag.String("username", "jdoe", "preferred username of the user")
+	name := flag.String("name", "Jane Doe", "name of the user")
+	email := flag.String("email", "jdoe@example.org", "email of the user")
+	groups := flag.String("groups", "ils-librarians", "comma separated groups of the user")
+	flag.Parse()
+
+	if *issuer == "" {
+		*issuer = "http://" + *addr
+	}
+
+	p, err := mockoidc.New(*issuer, *clientID, mockoidc.User{
+		Subject:           *subject,
+		Email:             *email,
+		Name:              *name,
+		PreferredUsername: *username,
+		Groups:            strings.Split(*groups, ","),
+	})
+	if err != nil {
+		log.Fatalf("Failed to create provider: %v", err)
+	}
+
+	fmt.Printf("Mock OpenID provider %s for client %s, logging in %s\n", *issuer, *clientID, *username)
+
+	log.Fatal(http.ListenAndServe(*addr, p))
+}
@@ -0,0 +1,113 @@
+// Command sip2client runs a scripted self check session against a SIP2
+// server: login, status, patron and item lookups, checkout, renew and
+// checkin. It exits non-zero when any step fails.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tliefheid/go-ils/internal/sip2"
+)
+
+type step struct {
+	name   string
+	req    *sip2.Message
+	expect string
+	ok     func(*sip2.Message) bool
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:6001", "SIP2 server address")
+	user := flag.String("user", "", "login user id (CN)")
+	password := flag.String("password", "", "login password (CO)")
+	institution := flag.String("institution", "library", "institution id (AO)")
+	patron := flag.String("patron", "", "patron card number (AA)")
+	pin := flag.String("pin", "", "patron PIN (AD)")
+	item := flag.String("item", "", "item identifier (AB)")
+	flag.Parse()
+
+	if *patron == "" || *pin == "" || *item == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c, err := sip2.Dial(*addr, 5*time.Second)
+	if err != nil {
+		log.Fatalf("Failed to connect: %v", err)
+	}
+
+	defer c.Close()
+
+	now := sip2.Timestamp(time.Now())
+	blank := strings.Repeat(" ", 18)
+	fixedOK := func(i int, v string) func(*sip2.Message) bool {
+		return func(m *sip2.Message) bool { return m.FixedAt(i, len(v)) == v }
+	}
+	fieldOK := func(id, v string) func(*sip2.Message) bool {
+		return func(m *sip2.Message) bool { return m.Get(id) == v }
+	}
+
+	steps := []step{
+		{"login", sip2.NewMessage(sip2.CodeLogin, "00").
+			Add(sip2.FieldLoginUserID, *user).
+			Add(sip2.FieldLoginPassword, *password).
+			Add(sip2.FieldLocationCode, "lobby"), sip2.CodeLoginResp, fixedOK(0, "1")},
+		{"sc status", sip2.NewMessage(sip2.CodeSCStatus, "0", "080", "2.00"), sip2.CodeACSStatus, fixedOK(0, "Y")},
+		{"patron status", sip2.NewMessage(sip2.CodePatronStatus, "000", now).
+			Add(sip2.FieldInstitutionID, *institution).
+			Add(sip2.FieldPatronID, *patron).
+			Add(sip2.FieldTerminalPassword, "").
+			Add(sip2.FieldPatronPassword, *pin), sip2.CodePatronStatusResp, fieldOK(sip2.FieldValidPatronPwd, "Y")},
+		{"item information", sip2.NewMessage(sip2.CodeItemInfo, now).
+			Add(sip2.FieldInstitutionID, *institution).
+			Add(sip2.FieldItemID, *item), sip2.CodeItemInfoResp, nil},
+		{"checkout", sip2.NewMessage(sip2.CodeCheckout, "N", "N", now, blank).
+			Add(sip2.FieldInstitutionID, *institution).
+			Add(sip2.FieldPatronID, *patron).
+			Add(sip2.FieldItemID, *item).
+			Add(sip2.FieldTerminalPassword, "").
+			Add(sip2.FieldPatronPassword, *pin), sip2.CodeCheckoutResp, fixedOK(0, "1")},
+		{"patron information", sip2.NewMessage(sip2.CodePatronInfo, "000", now, "  Y       ").
+			Add(sip2.FieldInstitutionID, *institution).
+			Add(sip2.FieldPatronID, *patron).
+			Add(sip2.FieldPatronPassword, *pin), sip2.CodePatronInfoResp, fieldOK(sip2.FieldValidPatronPwd, "Y")},
+		{"renew", sip2.NewMessage(sip2.CodeRenew, "N", "N", now, blank).
+			Add(sip2.FieldInstitutionID, *institution).
+			Add(sip2.FieldPatronID, *patron).
+			Add(sip2.FieldItemID, *item).
+			Add(sip2.FieldPatronPassword, *pin), sip2.CodeRenewResp, fixedOK(0, "1")},
+		{"checkin", sip2.NewMessage(sip2.CodeCheckin, "N", now, now).
+			Add(sip2.FieldCurrentLocation, "lobby").
+			Add(sip2.FieldInstitutionID, *institution).
+			Add(sip2.FieldItemID, *item), sip2.CodeCheckinResp, fixedOK(0, "1")},
+		{"end session", sip2.NewMessage(sip2.CodeEndSession, now).
+			Add(sip2.FieldInstitutionID, *institution).
+			Add(sip2.FieldPatronID, *patron), sip2.CodeEndSessionResp, fixedOK(0, "Y")},
+	}
+
+	failed := false
+
+	for _, st := range steps {
+		resp, err := c.Send(st.req)
+		if err != nil {
+			log.Fatalf("%s: %v", st.name, err)
+		}
+
+		status := "ok"
+		if resp.Code != st.expect || (st.ok != nil && !st.ok(resp)) {
+			status = "FAILED"
+			failed = true
+		}
+
+		fmt.Printf("%-20s %-6s %s\n", st.name, status, resp)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
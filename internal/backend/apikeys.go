@@ -0,0 +1,218 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/password"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+// apiKeyPrefix starts every API key, it tells keys apart from staff session
+// tokens.
+const apiKeyPrefix = "ils_"
+
+const apiKeyKey contextKey = "apikey"
+
+// apiKey returns the API key the request was authenticated with.
+func apiKey(r *http.Request) *model.APIKey {
+	k, _ := r.Context().Value(apiKeyKey).(*model.APIKey)
+	return k
+}
+
+// newAPIKey returns a random key, the prefix shown to identify it and the
+// hash to store.
+func newAPIKey() (key, prefix, hash string, err error) {
+	token, _, err := password.NewToken()
+	if err != nil {
+		return "", "", "", err
+	}
+
+	key = apiKeyPrefix + token
+
+	return key, key[:len(apiKeyPrefix)+6], password.HashToken(key), nil
+}
+
+// authenticate accepts both API keys and staff sessions as bearer tokens.
+func (s *Service) authenticate(next http.Handler) http.Handler {
+	sessions := s.staffAuth(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if !strings.HasPrefix(token, apiKeyPrefix) {
+			sessions.ServeHTTP(w, r)
+			return
+		}
+
+		key, err := s.repository.UseAPIKey(r.Context(), password.HashToken(token))
+		if err != nil {
+			if !errors.Is(err, repository.ErrNotFound) {
+				slog.ErrorContext(r.Context(), "reading API key failed", "err", err)
+			}
+
+			writeUnauthorized(w, r)
+
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyKey, key)))
+	})
+}
+
+func (s *Service) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.repository.ListAPIKeys(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing API keys failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	writeJSON(w, keys)
+}
+
+func (s *Service) addAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req model.APIKeyRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	k := model.APIKey{
+		Name:      strings.TrimSpace(req.Name),
+		Scopes:    req.Scopes,
+		CreatedBy: staffUser(r).Username,
+	}
+
+	errs := map[string]string{}
+
+	if k.Name == "" {
+		errs["name"] = "Name is required."
+	}
+
+	if len(k.Scopes) == 0 {
+		errs["scopes"] = "Select at least one scope."
+	}
+
+	for _, sc := range k.Scopes {
+		if !sc.Valid() {
+			errs["scopes"] = fmt.Sprintf("Unknown scope %q.", sc)
+		}
+	}
+
+	if req.ExpiresAt != "" {
+		t, err := time.Parse(model.DateLayout, req.ExpiresAt)
+
+		switch {
+		case err != nil:
+			errs["expires_at"] = "Invalid date, use YYYY-MM-DD."
+		case !t.After(time.Now()):
+			errs["expires_at"] = "Expiry must be in the future."
+		default:
+			k.ExpiresAt = &t
+		}
+	}
+
+	if len(errs) > 0 {
+		writeInvalid(w, r, "Invalid API key", errs)
+		return
+	}
+
+	key, prefix, hash, err := newAPIKey()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "creating API key failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	k.Prefix = prefix
+
+	created, err := s.repository.AddAPIKey(r.Context(), k, hash)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "adding API key failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	s.audit(r.Context(), apiKeyEntry(model.AuditCreate, created.ID), nil, created)
+	writeJSONStatus(w, http.StatusCreated, model.NewAPIKey{APIKey: *created, Key: key})
+}
+
+func (s *Service) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid API key ID")
+		return
+	}
+
+	before, _ := s.repository.GetAPIKey(r.Context(), id)
+
+	err = s.repository.RevokeAPIKey(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "API key not found or already revoked")
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "revoking API key failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	after, _ := s.repository.GetAPIKey(r.Context(), id)
+	s.audit(r.Context(), apiKeyEntry(model.AuditUpdate, id), before, after)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rotateAPIKeyHandler gives a key a new secret and keeps its name, scopes
+// and expiry. The old secret stops working at once.
+func (s *Service) rotateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid API key ID")
+		return
+	}
+
+	key, prefix, hash, err := newAPIKey()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "creating API key failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	before, _ := s.repository.GetAPIKey(r.Context(), id)
+
+	rotated, err := s.repository.RotateAPIKey(r.Context(), id, prefix, hash)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "API key not found, revoked or expired")
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "rotating API key failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	s.audit(r.Context(), apiKeyEntry(model.AuditUpdate, id), before, rotated)
+	writeJSON(w, model.NewAPIKey{APIKey: *rotated, Key: key})
+}
+
+// apiKeyEntry audits a change to a key. Snapshots show the prefix only,
+// neither the key nor its hash is in the model.
+func apiKeyEntry(action model.AuditAction, id int) model.AuditEntry {
+	return model.AuditEntry{Action: action, Entity: model.EntityAPIKey, EntityID: auditID(id)}
+}
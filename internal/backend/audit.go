@@ -0,0 +1,206 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+// actorKey names the actor of changes made outside an authenticated HTTP
+// request, by SIP2 self checks and scheduled jobs.
+const actorKey contextKey = "actor"
+
+// maxAuditPage is the largest page of audit entries served at once.
+const maxAuditPage = 500
+
+// withActor returns a context whose changes are audited as actor.
+func withActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// actor names who makes the changes of ctx in the audit log.
+func actor(ctx context.Context) string {
+	if u, ok := ctx.Value(staffKey).(*model.StaffUser); ok {
+		return "staff:" + u.Username
+	}
+
+	if k, ok := ctx.Value(apiKeyKey).(*model.APIKey); ok {
+		return "apikey:" + k.Prefix
+	}
+
+	if m, ok := ctx.Value(patronKey).(*model.Member); ok {
+		return "patron:" + strconv.Itoa(m.ID)
+	}
+
+	if a, ok := ctx.Value(actorKey).(string); ok {
+		return a
+	}
+
+	return "system"
+}
+
+// audit appends a change to the audit log. before and after are snapshots
+// of the entity, nil when it did not exist before or after the change. A
+// failure to record is logged, the change itself has already been made.
+func (s *Service) audit(ctx context.Context, e model.AuditEntry, before, after interface{}) {
+	e.At = time.Now()
+	e.Actor = actor(ctx)
+	e.RequestID = middleware.GetReqID(ctx)
+
+	switch e.Entity {
+	case model.EntityBook:
+		e.BookID, _ = strconv.Atoi(e.EntityID)
+	case model.EntityMember:
+		e.MemberID, _ = strconv.Atoi(e.EntityID)
+	}
+
+	var err error
+
+	if e.Before, err = snapshot(before); err == nil {
+		e.After, err = snapshot(after)
+	}
+
+	if err == nil {
+		// the change is made, record it even when the request is cancelled
+		err = s.repository.AddAuditEntry(context.WithoutCancel(ctx), e)
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "recording audit entry failed", "action", e.Action, "entity", e.Entity, "entity_id", e.EntityID, "err", err)
+	}
+}
+
+func snapshot(v interface{}) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// auditID formats an entity ID for the audit log.
+func auditID(id int) string {
+	return strconv.Itoa(id)
+}
+
+// listAuditHandler serves the audit log, filtered by the query parameters
+// actor, action, entity, entity_id, book_id, member_id, request_id and the
+// dates from and to (YYYY-MM-DD, inclusive), paged with offset and limit.
+func (s *Service) listAuditHandler(w http.ResponseWriter, r *http.Request) {
+	s.serveAudit(w, r, nil)
+}
+
+// bookHistoryHandler serves the audit entries of a book and its loans and
+// holds, with the filters of the audit log.
+func (s *Service) bookHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid book ID")
+		return
+	}
+
+	s.serveAudit(w, r, func(f *repository.AuditFilter) { f.BookID = id })
+}
+
+// memberHistoryHandler serves the audit entries of a member and their
+// loans, cards, blocks, holds and fines.
+func (s *Service) memberHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid member ID")
+		return
+	}
+
+	s.serveAudit(w, r, func(f *repository.AuditFilter) { f.MemberID = id })
+}
+
+// serveAudit answers with a page of audit entries matching the query
+// parameters, narrowed by scope when not nil.
+func (s *Service) serveAudit(w http.ResponseWriter, r *http.Request, scope func(*repository.AuditFilter)) {
+	q := r.URL.Query()
+	errs := map[string]string{}
+
+	f := repository.AuditFilter{
+		Actor:     q.Get("actor"),
+		Action:    model.AuditAction(q.Get("action")),
+		Entity:    model.AuditEntity(q.Get("entity")),
+		EntityID:  q.Get("entity_id"),
+		RequestID: q.Get("request_id"),
+	}
+
+	number := func(name string, min, fallback int) int {
+		v := q.Get(name)
+		if v == "" {
+			return fallback
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil || n < min {
+			errs[name] = fmt.Sprintf("Use a whole number of at least %d.", min)
+		}
+
+		return n
+	}
+
+	date := func(name string) time.Time {
+		v := q.Get(name)
+		if v == "" {
+			return time.Time{}
+		}
+
+		t, err := time.ParseInLocation(model.DateLayout, v, time.Local)
+		if err != nil {
+			errs[name] = "Invalid date, use YYYY-MM-DD."
+		}
+
+		return t
+	}
+
+	f.BookID = number("book_id", 1, 0)
+	f.MemberID = number("member_id", 1, 0)
+	f.From = date("from")
+
+	if to := date("to"); !to.IsZero() {
+		f.To = to.AddDate(0, 0, 1)
+	}
+
+	offset := number("offset", 0, 0)
+	limit := number("limit", 1, 100)
+
+	if limit > maxAuditPage {
+		limit = maxAuditPage
+	}
+
+	if len(errs) > 0 {
+		writeInvalid(w, r, "Invalid audit filter", errs)
+		return
+	}
+
+	if scope != nil {
+		scope(&f)
+	}
+
+	entries, total, err := s.repository.ListAuditEntries(r.Context(), f, offset, limit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing audit entries failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	writeJSON(w, model.AuditPage{Entries: entries, Total: total, Offset: offset, Limit: limit})
+}
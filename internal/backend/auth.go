@@ -0,0 +1,427 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/password"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+const staffKey contextKey = "staff"
+
+// staffUser returns the staff user the request was authenticated as.
+func staffUser(r *http.Request) *model.StaffUser {
+	u, _ := r.Context().Value(staffKey).(*model.StaffUser)
+	return u
+}
+
+// staffAuth resolves the bearer token of a staff session and refuses
+// requests without one.
+func (s *Service) staffAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		user, err := s.repository.GetStaffSession(r.Context(), password.HashToken(token))
+		if err != nil {
+			if !errors.Is(err, repository.ErrNotFound) {
+				slog.ErrorContext(r.Context(), "reading staff session failed", "err", err)
+			}
+
+			writeUnauthorized(w, r)
+
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), staffKey, user)))
+	})
+}
+
+func writeUnauthorized(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	writeProblem(w, r, "unauthorized", "Log in to use the API")
+}
+
+// allowed reports whether the staff user's role or the API key's scopes
+// grant p.
+func allowed(r *http.Request, p model.Permission) bool {
+	if u := staffUser(r); u != nil {
+		return u.Role.Can(p)
+	}
+
+	if k := apiKey(r); k != nil {
+		return k.Can(p)
+	}
+
+	return false
+}
+
+// require refuses the request unless it is allowed p.
+func require(p model.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !allowed(r, p) {
+				writeProblem(w, r, "forbidden", fmt.Sprintf("This needs the %s permission", p))
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BootstrapAdmin creates the first admin account when there are no staff
+// users yet, so a new installation can be logged in to.
+func (s *Service) BootstrapAdmin(ctx context.Context, username, secret string) error {
+	n, err := s.repository.CountStaffUsers(ctx)
+	if err != nil || n > 0 {
+		return err
+	}
+
+	if secret == "" {
+		slog.WarnContext(ctx, "no staff users exist; set ADMIN_PASSWORD to create the first admin account")
+		return nil
+	}
+
+	u := model.StaffUser{Username: username, Name: "Administrator", Role: model.RoleAdmin}
+	if errs := u.Validate(); len(errs) > 0 {
+		return fmt.Errorf("invalid admin account: %v", errs)
+	}
+
+	hash, err := password.Hash(secret)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.repository.AddStaffUser(ctx, u, hash); err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "created admin account", "username", username)
+
+	return nil
+}
+
+func (s *Service) staffLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req model.StaffLoginRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	username := strings.TrimSpace(req.Username)
+	account, address := "staff:"+username, s.clientAddress(r)
+
+	if wait := s.logins.wait(account, address, time.Now()); wait > 0 {
+		writeTooManyAttempts(w, r, wait)
+		return
+	}
+
+	user, hash, err := s.repository.GetStaffLogin(r.Context(), username)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			slog.ErrorContext(r.Context(), "reading staff user failed", "err", err)
+		}
+
+		// unknown users take as long as wrong passwords
+		_ = password.VerifyNone(req.Password)
+		s.logins.failed(account, address, time.Now())
+		writeProblem(w, r, "invalid_credentials", "Invalid username or password")
+
+		return
+	}
+
+	if password.Verify(hash, req.Password) != nil {
+		s.logins.failed(account, address, time.Now())
+		writeProblem(w, r, "invalid_credentials", "Invalid username or password")
+
+		return
+	}
+
+	s.logins.succeeded(account)
+	s.startStaffSession(w, r, user)
+}
+
+// startStaffSession opens a session for user and answers with its token.
+func (s *Service) startStaffSession(w http.ResponseWriter, r *http.Request, user *model.StaffUser) {
+	token, tokenHash, err := password.NewToken()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "creating session token failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	expires := time.Now().Add(s.staffSession)
+
+	if err := s.repository.AddStaffSession(r.Context(), tokenHash, user.ID, expires); err != nil {
+		slog.ErrorContext(r.Context(), "adding staff session failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	writeJSON(w, model.StaffSession{Token: token, ExpiresAt: expires, User: *user})
+}
+
+func (s *Service) staffLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.repository.DeleteStaffSession(r.Context(), password.HashToken(bearerToken(r))); err != nil {
+		slog.ErrorContext(r.Context(), "deleting staff session failed", "err", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) staffMeHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, staffUser(r))
+}
+
+func (s *Service) changeOwnPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req model.PasswordRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	user := staffUser(r)
+	if user.SSO {
+		writeSSOAccount(w, r)
+		return
+	}
+
+	_, hash, err := s.repository.GetStaffLogin(r.Context(), user.Username)
+	if err != nil || password.Verify(hash, req.Current) != nil {
+		writeInvalid(w, r, "Invalid password", map[string]string{"current": "The current password is wrong."})
+
+		return
+	}
+
+	s.setStaffPassword(w, r, user.ID, req.Password)
+}
+
+func (s *Service) listStaffHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := s.repository.ListStaffUsers(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing staff users failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	writeJSON(w, users)
+}
+
+func (s *Service) addStaffHandler(w http.ResponseWriter, r *http.Request) {
+	var req model.StaffUserRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	u := model.StaffUser{
+		Username: strings.TrimSpace(req.Username),
+		Name:     strings.TrimSpace(req.Name),
+		Role:     req.Role,
+		Disabled: req.Disabled,
+	}
+
+	errs := u.Validate()
+	if len(req.Password) < model.MinPasswordLength {
+		errs["password"] = fmt.Sprintf("Use at least %d characters.", model.MinPasswordLength)
+	}
+
+	if len(errs) > 0 {
+		writeInvalid(w, r, "Invalid staff user", errs)
+		return
+	}
+
+	hash, err := password.Hash(req.Password)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "hashing password failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	created, err := s.repository.AddStaffUser(r.Context(), u, hash)
+	if errors.Is(err, repository.ErrDuplicate) {
+		writeInvalid(w, r, "Invalid staff user", map[string]string{"username": "This username is taken."})
+
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "adding staff user failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	s.audit(r.Context(), staffEntry(model.AuditCreate, created.ID), nil, created)
+	writeJSONStatus(w, http.StatusCreated, created)
+}
+
+func (s *Service) editStaffHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid staff user ID")
+		return
+	}
+
+	var req model.StaffUserRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	u, err := s.repository.GetStaffUser(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Staff user not found")
+		return
+	}
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	before := *u
+	u.Name = strings.TrimSpace(req.Name)
+	u.Role = req.Role
+	u.Disabled = req.Disabled
+
+	if errs := u.Validate(); len(errs) > 0 {
+		writeInvalid(w, r, "Invalid staff user", errs)
+		return
+	}
+
+	// admins cannot lock themselves out
+	if id == staffUser(r).ID && (u.Disabled || u.Role != model.RoleAdmin) {
+		writeProblem(w, r, "own_account", "You cannot disable your own account or remove your own admin role")
+
+		return
+	}
+
+	if err := s.repository.UpdateStaffUser(r.Context(), *u); err != nil {
+		slog.ErrorContext(r.Context(), "updating staff user failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	s.audit(r.Context(), staffEntry(model.AuditUpdate, id), before, u)
+	writeJSON(w, u)
+}
+
+func (s *Service) resetStaffPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid staff user ID")
+		return
+	}
+
+	var req model.PasswordRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	u, err := s.repository.GetStaffUser(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Staff user not found")
+		return
+	}
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if u.SSO {
+		writeSSOAccount(w, r)
+		return
+	}
+
+	s.setStaffPassword(w, r, id, req.Password)
+}
+
+// writeSSOAccount refuses passwords for users who log in with single
+// sign-on.
+func writeSSOAccount(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, "sso_account", "This account logs in with single sign-on and has no password")
+}
+
+// setStaffPassword validates, hashes and stores a new staff password.
+func (s *Service) setStaffPassword(w http.ResponseWriter, r *http.Request, id int, secret string) {
+	if len(secret) < model.MinPasswordLength {
+		writeInvalid(w, r, "Invalid password", map[string]string{"password": fmt.Sprintf("Use at least %d characters.", model.MinPasswordLength)})
+
+		return
+	}
+
+	hash, err := password.Hash(secret)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "hashing password failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	err = s.repository.SetStaffPassword(r.Context(), id, hash)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Staff user not found")
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "setting staff password failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	// the hash stays out of the log, only that the password changed
+	s.audit(r.Context(), staffEntry(model.AuditUpdate, id), nil, map[string]bool{"password_set": true})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func staffEntry(action model.AuditAction, id int) model.AuditEntry {
+	return model.AuditEntry{Action: action, Entity: model.EntityStaff, EntityID: auditID(id)}
+}
+
+// maxBodyBytes bounds a request body, far above any the API takes.
+const maxBodyBytes = 1 << 20
+
+// readJSON decodes the request body into v and answers 400 when it cannot,
+// or 413 when it is longer than maxBodyBytes.
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+
+	var tooLarge *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &tooLarge):
+		writeProblem(w, r, "body_too_large", fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit))
+		return false
+	case err != nil:
+		writeProblem(w, r, "bad_request", "Invalid request")
+		return false
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		writeProblem(w, r, "invalid_json", "Invalid JSON")
+		return false
+	}
+
+	return true
+}
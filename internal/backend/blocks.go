@@ -0,0 +1,256 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+// systemUser is recorded as the author of automatic blocks.
+const systemUser = "system"
+
+func (s *Service) listMemberBlocksHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid member ID")
+		return
+	}
+
+	blocks, err := s.repository.ListMemberBlocks(r.Context(), id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing blocks failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	writeJSON(w, blocks)
+}
+
+func (s *Service) addBlockHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid member ID")
+		return
+	}
+
+	var req model.BlockRequest
+
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	block := model.MemberBlock{
+		MemberID:  id,
+		Kind:      model.BlockManual,
+		Reason:    strings.TrimSpace(req.Reason),
+		CreatedBy: actor(r.Context()),
+	}
+
+	errs := map[string]string{}
+
+	if block.Reason == "" {
+		errs["reason"] = "Reason is required."
+	}
+
+	if req.ExpiresAt != "" {
+		t, err := time.Parse(model.DateLayout, req.ExpiresAt)
+		if err != nil {
+			errs["expires_at"] = "Invalid date, use YYYY-MM-DD."
+		} else {
+			block.ExpiresAt = &t
+		}
+	}
+
+	if len(errs) > 0 {
+		writeInvalid(w, r, "Invalid block", errs)
+		return
+	}
+
+	_, err = s.repository.GetMember(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Member not found")
+		return
+	}
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	created, err := s.repository.AddBlock(r.Context(), block)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "adding block failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	s.audit(r.Context(), blockEntry(model.AuditCreate, created), nil, created)
+
+	writeJSONStatus(w, http.StatusCreated, created)
+}
+
+func (s *Service) liftBlockHandler(w http.ResponseWriter, r *http.Request) {
+	memberID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || memberID <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid member ID")
+		return
+	}
+
+	blockID, err := strconv.Atoi(chi.URLParam(r, "blockID"))
+	if err != nil || blockID <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid block ID")
+		return
+	}
+
+	block, err := s.repository.GetBlock(r.Context(), blockID)
+	if errors.Is(err, repository.ErrNotFound) || err == nil && block.MemberID != memberID {
+		writeProblem(w, r, "not_found", "Block not found")
+		return
+	}
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = s.repository.LiftBlock(r.Context(), blockID, actor(r.Context()))
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "already_lifted", "Block is already lifted")
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "lifting block failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	after, _ := s.repository.GetBlock(r.Context(), blockID)
+	s.audit(r.Context(), blockEntry(model.AuditUpdate, block), block, after)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// activeBlocks returns the blocks of a member that are in force now.
+func (s *Service) activeBlocks(ctx context.Context, memberID int) ([]model.MemberBlock, error) {
+	blocks, err := s.repository.ListMemberBlocks(ctx, memberID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	active := blocks[:0]
+
+	for _, b := range blocks {
+		if b.Active(now) {
+			active = append(active, b)
+		}
+	}
+
+	return active, nil
+}
+
+// checkBlocks refreshes the automatic overdue block and refuses circulation
+// while any block is active.
+func (s *Service) checkBlocks(ctx context.Context, memberID int) error {
+	if err := s.updateOverdueBlock(ctx, memberID); err != nil {
+		return err
+	}
+
+	blocks, err := s.activeBlocks(ctx, memberID)
+	if err != nil {
+		return err
+	}
+
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	reasons := make([]string, len(blocks))
+	for i, b := range blocks {
+		reasons[i] = b.Reason
+	}
+
+	return &apiError{
+		Code:    "member_blocked",
+		Message: "Member is blocked: " + strings.Join(reasons, "; "),
+	}
+}
+
+// updateOverdueBlock places an automatic block on a member with a loan more
+// than overdueBlockDays past due, and lifts it once no such loan is left.
+func (s *Service) updateOverdueBlock(ctx context.Context, memberID int) error {
+	if s.overdueBlockDays <= 0 {
+		return nil
+	}
+
+	loans, err := s.repository.ListMemberBorrowings(ctx, memberID)
+	if err != nil {
+		return err
+	}
+
+	threshold := time.Now().AddDate(0, 0, -s.overdueBlockDays)
+	overdue := false
+
+	for _, l := range loans {
+		if l.Overdue(threshold) {
+			overdue = true
+			break
+		}
+	}
+
+	blocks, err := s.activeBlocks(ctx, memberID)
+	if err != nil {
+		return err
+	}
+
+	var existing *model.MemberBlock
+
+	for i := range blocks {
+		if blocks[i].Kind == model.BlockAutomatic {
+			existing = &blocks[i]
+			break
+		}
+	}
+
+	switch {
+	case overdue && existing == nil:
+		created, err := s.repository.AddBlock(ctx, model.MemberBlock{
+			MemberID:  memberID,
+			Kind:      model.BlockAutomatic,
+			Reason:    fmt.Sprintf("Items overdue by more than %d days", s.overdueBlockDays),
+			CreatedBy: systemUser,
+		})
+		if err != nil {
+			return err
+		}
+
+		s.audit(ctx, blockEntry(model.AuditCreate, created), nil, created)
+	case !overdue && existing != nil:
+		if err := s.repository.LiftBlock(ctx, existing.ID, systemUser); err != nil {
+			return err
+		}
+
+		after, _ := s.repository.GetBlock(ctx, existing.ID)
+		s.audit(ctx, blockEntry(model.AuditUpdate, existing), existing, after)
+	}
+
+	return nil
+}
+
+// blockEntry returns an audit entry about a block.
+func blockEntry(action model.AuditAction, b *model.MemberBlock) model.AuditEntry {
+	return model.AuditEntry{Action: action, Entity: model.EntityBlock, EntityID: auditID(b.ID), MemberID: b.MemberID}
+}
@@ -1,9 +1,9 @@
 package backend
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"log/slog"
 	"net/http"
 	"strconv"
 
@@ -13,9 +13,9 @@ import (
 )
 
 func (s *Service) listBooksHandler(w http.ResponseWriter, r *http.Request) {
-	books, err := s.repository.ListBooks()
+	books, err := s.repository.ListBooks(r.Context())
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		writeProblem(w, r, "internal_error", "")
 		return
 	}
 
@@ -25,62 +25,65 @@ func (s *Service) listBooksHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Service) searchBooks(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
 	if query == "" {
-		fmt.Println("Missing search query")
-		http.Error(w, "Missing search query", http.StatusBadRequest)
+		writeProblem(w, r, "bad_request", "Missing search query")
 
 		return
 	}
 
-	books, err := s.repository.SearchBooks(query)
+	books, err := s.repository.SearchBooks(r.Context(), query)
 	if err != nil {
-		fmt.Println("Error searching books:", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "searching books failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
 
 		return
 	}
 
-	fmt.Printf("len(books): %v\n", len(books))
-	fmt.Printf("books: %v\n", books)
 	writeJSON(w, books)
 }
 
 func (s *Service) getBookHandler(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing book ID", http.StatusBadRequest)
+		writeProblem(w, r, "bad_request", "Missing book ID")
 		return
 	}
 	// Convert id to int
 	idInt, err := strconv.Atoi(id)
 	if err != nil || idInt <= 0 {
-		http.Error(w, "Invalid book ID", http.StatusBadRequest)
+		writeProblem(w, r, "bad_request", "Invalid book ID")
+		return
+	}
+
+	book, err := s.repository.GetBook(r.Context(), idInt)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Book not found")
 		return
 	}
 
-	book, err := s.repository.GetBook(idInt)
 	if err != nil {
-		http.Error(w, "Book not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 
+	w.Header().Set("ETag", etag(book.Version))
 	writeJSON(w, book)
 }
 
 func (s *Service) isBookPresentHandler(w http.ResponseWriter, r *http.Request) {
 	isbn := chi.URLParam(r, "isbn")
 	if isbn == "" {
-		http.Error(w, "Missing ISBN", http.StatusBadRequest)
+		writeProblem(w, r, "bad_request", "Missing ISBN")
 		return
 	}
 
-	book, err := s.repository.SearchBookByISBN(isbn)
+	book, err := s.repository.SearchBookByISBN(r.Context(), isbn)
 	if err != nil {
 		if err == repository.ErrNotFound {
-			w.WriteHeader(http.StatusNotFound)
+			writeProblem(w, r, "book_not_found", "No book with ISBN "+isbn)
 			return
 		}
 
-		http.Error(w, "Book not found, "+err.Error(), http.StatusNotFound)
+		writeError(w, r, err)
 
 		return
 	}
@@ -89,65 +92,106 @@ func (s *Service) isBookPresentHandler(w http.ResponseWriter, r *http.Request) {
 }
 func (s *Service) addBookHandler(w http.ResponseWriter, r *http.Request) {
 	var b model.Book
-	// parse the request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+	if !readJSON(w, r, &b) {
 		return
 	}
 
-	if err := json.Unmarshal(body, &b); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if errs := b.Validate(); len(errs) > 0 {
+		writeInvalid(w, r, "Invalid book", errs)
 		return
 	}
 
-	err = s.repository.AddBook(b)
-	if err != nil {
-		fmt.Printf("add book: repository err: %v\n", err)
-
-		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+	id, err := s.repository.AddBook(r.Context(), b)
+	if errors.Is(err, repository.ErrDuplicate) {
+		writeProblem(w, r, "duplicate", "A book with ISBN "+b.ISBN+" already exists")
+		return
+	}
 
+	if err != nil {
+		writeError(w, r, fmt.Errorf("add book: %w", err))
 		return
 	}
 
+	b.ID = id
+	b.CopiesAvailable = b.CopiesTotal
+	s.audit(r.Context(), model.AuditEntry{Action: model.AuditCreate, Entity: model.EntityBook, EntityID: auditID(b.ID)}, nil, b)
+
 	writeJSON(w, b)
 }
 
 func (s *Service) editBookHandler(w http.ResponseWriter, r *http.Request) {
 	var b model.Book
 
-	body, err := io.ReadAll(r.Body)
+	if !readJSON(w, r, &b) {
+		return
+	}
+
+	// the URL names the book the If-Match tag belongs to
+	if id, err := strconv.Atoi(chi.URLParam(r, "id")); err == nil {
+		b.ID = id
+	}
+
+	if b.ID <= 0 {
+		writeProblem(w, r, "bad_request", "Missing book ID")
+
+		return
+	}
+
+	before, err := s.repository.GetBook(r.Context(), b.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Book not found")
+		return
+	}
+
 	if err != nil {
-		fmt.Printf("read body err: %v\n", err)
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		slog.ErrorContext(r.Context(), "fetching book failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
 
 		return
 	}
 
-	if err := json.Unmarshal(body, &b); err != nil {
-		fmt.Printf("unmarshal err: %v\n", err)
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	version, ok := ifMatch(r)
+	if !ok || (version != 0 && version != before.Version) {
+		writeConflict(w, r, "Book", before.Version)
+		return
+	}
+
+	errs := b.Validate()
+	if lent := before.CopiesTotal - before.CopiesAvailable; b.CopiesTotal < lent {
+		errs["copies_total"] = fmt.Sprintf("%d copies are lent out.", lent)
+	}
 
+	if len(errs) > 0 {
+		writeInvalid(w, r, "Invalid book", errs)
 		return
 	}
 
-	if b.ID < 0 {
-		fmt.Println("Missing book ID: ", b.ID)
-		http.Error(w, "Missing book ID", http.StatusBadRequest)
+	b.Version = version
+
+	err = s.repository.UpdateBook(r.Context(), b)
+	if errors.Is(err, repository.ErrConflict) {
+		writeConflict(w, r, "Book", s.bookVersion(r.Context(), b.ID))
 
 		return
 	}
 
-	fmt.Printf("update book: %+v\n", b)
+	if errors.Is(err, repository.ErrDuplicate) {
+		writeProblem(w, r, "duplicate", "A book with ISBN "+b.ISBN+" already exists")
+		return
+	}
 
-	err = s.repository.UpdateBook(b)
 	if err != nil {
-		fmt.Printf("update book: repository err: %v\n", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
-
+		writeError(w, r, fmt.Errorf("update book: %w", err))
 		return
 	}
 
+	after, _ := s.repository.GetBook(r.Context(), b.ID)
+	s.audit(r.Context(), model.AuditEntry{Action: model.AuditUpdate, Entity: model.EntityBook, EntityID: auditID(b.ID)}, before, after)
+
+	if after != nil {
+		w.Header().Set("ETag", etag(after.Version))
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -156,22 +200,68 @@ func (s *Service) deleteBookHandler(w http.ResponseWriter, r *http.Request) {
 
 	id, err := strconv.Atoi(idStr)
 	if err != nil || id == 0 {
-		http.Error(w, "Invalid book ID", http.StatusBadRequest)
+		writeProblem(w, r, "bad_request", "Invalid book ID")
+		return
+	}
+
+	version, ok := ifMatch(r)
+	if !ok {
+		writeConflict(w, r, "Book", s.bookVersion(r.Context(), id))
 		return
 	}
 
-	// First, delete all borrowings for this book (to avoid FK constraint errors)
-	err = s.repository.DeleteBorrowing(id)
+	before, _ := s.repository.GetBook(r.Context(), id)
+
+	err = s.repository.DeleteBook(r.Context(), id, version)
+	if errors.Is(err, repository.ErrConflict) {
+		writeConflict(w, r, "Book", s.bookVersion(r.Context(), id))
+		return
+	}
+
+	if err != nil {
+		writeDeleteError(w, r, "Book", err)
+		return
+	}
+
+	s.audit(r.Context(), model.AuditEntry{Action: model.AuditDelete, Entity: model.EntityBook, EntityID: auditID(id)}, before, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) listDeletedBooksHandler(w http.ResponseWriter, r *http.Request) {
+	books, err := s.repository.ListDeletedBooks(r.Context())
 	if err != nil {
-		http.Error(w, "Database error (borrowings)", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "listing deleted books failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	writeJSON(w, books)
+}
+
+func (s *Service) restoreBookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid book ID")
+		return
+	}
+
+	err = s.repository.RestoreBook(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Deleted book not found")
 		return
 	}
 
-	err = s.repository.DeleteBook(id)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "restoring book failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
 		return
 	}
 
+	after, _ := s.repository.GetBook(r.Context(), id)
+	s.audit(r.Context(), model.AuditEntry{Action: model.AuditRestore, Entity: model.EntityBook, EntityID: auditID(id)}, nil, after)
+
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -1,59 +1,73 @@
 package backend
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
 )
 
 func (s *Service) borrowBookHandler(w http.ResponseWriter, r *http.Request) {
 	var req model.BorrowRequest
 
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
-		return
-	}
-
-	if err := json.Unmarshal(body, &req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if !readJSON(w, r, &req) {
 		return
 	}
 
-	if req.BookID == "" || req.MemberID == "" {
-		http.Error(w, "Missing or invalid fields", http.StatusBadRequest)
+	if req.BookID == "" || (req.MemberID == "" && req.CardNumber == "") {
+		writeProblem(w, r, "bad_request", "Missing or invalid fields")
 		return
 	}
 
 	bookID, err := strconv.Atoi(req.BookID)
 	if err != nil || bookID <= 0 {
-		http.Error(w, "Invalid book ID", http.StatusBadRequest)
-		return
-	}
-
-	memberID, err := strconv.Atoi(req.MemberID)
-	if err != nil || memberID <= 0 {
-		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		writeProblem(w, r, "bad_request", "Invalid book ID")
 		return
 	}
 
-	borrow := model.Borrowing{
-		BookID:    bookID,
-		MemberID:  memberID,
-		IssueDate: time.Now(),
+	var member *model.Member
+
+	if req.CardNumber != "" {
+		member, err = s.memberByCard(r.Context(), req.CardNumber)
+
+		switch {
+		case isCardNotFound(err):
+			writeProblem(w, r, "unknown_card", "Unknown card number")
+			return
+		case errors.Is(err, errCardNotUsable):
+			writeProblem(w, r, "card_not_usable", err.Error())
+			return
+		case err != nil:
+			slog.ErrorContext(r.Context(), "looking up card failed", "err", err)
+			writeProblem(w, r, "internal_error", "")
+
+			return
+		}
+	} else {
+		memberID, err := strconv.Atoi(req.MemberID)
+		if err != nil || memberID <= 0 {
+			writeProblem(w, r, "bad_request", "Invalid member ID")
+			return
+		}
+
+		member, err = s.repository.GetMember(r.Context(), memberID)
+		if errors.Is(err, repository.ErrNotFound) {
+			writeProblem(w, r, "not_found", "Member not found")
+			return
+		}
+
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
 	}
 
-	err = s.repository.AddBorrowing(borrow)
-	if err != nil {
-		fmt.Println("Error adding borrowing:", err)
-		http.Error(w, "Failed to borrow book", http.StatusInternalServerError)
-
+	if _, err := s.checkout(r.Context(), member, bookID); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
@@ -61,10 +75,10 @@ func (s *Service) borrowBookHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Service) getBorrowingHandler(w http.ResponseWriter, r *http.Request) {
-	b, err := s.repository.ListBorrowings()
+	b, err := s.repository.ListBorrowings(r.Context())
 	if err != nil {
-		fmt.Println("Error fetching borrowings:", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "fetching borrowings failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
 
 		return
 	}
@@ -77,13 +91,18 @@ func (s *Service) getBorrowingDetailHandler(w http.ResponseWriter, r *http.Reque
 
 	id, err := strconv.Atoi(idStr)
 	if err != nil || id == 0 {
-		http.Error(w, "Invalid borrowing ID", http.StatusBadRequest)
+		writeProblem(w, r, "bad_request", "Invalid borrowing ID")
+		return
+	}
+
+	detail, err := s.repository.GetBorrowing(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Borrowing not found")
 		return
 	}
 
-	detail, err := s.repository.GetBorrowing(id)
 	if err != nil {
-		http.Error(w, "Borrowing not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 
@@ -0,0 +1,248 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tliefheid/go-ils/internal/card"
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+var errCardNotUsable = errors.New("card cannot be used")
+
+func (s *Service) listMemberCardsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid member ID")
+		return
+	}
+
+	cards, err := s.repository.ListMemberCards(r.Context(), id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing cards failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	writeJSON(w, cards)
+}
+
+func (s *Service) issueCardHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid member ID")
+		return
+	}
+
+	var req model.IssueCardRequest
+
+	// the body is optional, without one the card gets the configured validity
+	if r.ContentLength != 0 && !readJSON(w, r, &req) {
+		return
+	}
+
+	_, err = s.repository.GetMember(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Member not found")
+		return
+	}
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	c, err := s.newCard(r.Context(), id, req.ExpiresAt)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	created, err := s.repository.AddCard(r.Context(), *c)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "adding card failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	s.audit(r.Context(), cardEntry(model.AuditCreate, created), nil, created)
+
+	writeJSONStatus(w, http.StatusCreated, created)
+}
+
+func (s *Service) getCardHandler(w http.ResponseWriter, r *http.Request) {
+	c, err := s.repository.GetCardByNumber(r.Context(), chi.URLParam(r, "number"))
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Card not found")
+		return
+	}
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, c)
+}
+
+func (s *Service) replaceCardHandler(w http.ResponseWriter, r *http.Request) {
+	var req model.ReplaceCardRequest
+
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	if req.Reason != model.CardLost && req.Reason != model.CardReplaced {
+		writeProblem(w, r, "bad_request", "Reason must be lost or replaced")
+		return
+	}
+
+	old, err := s.repository.GetCardByNumber(r.Context(), chi.URLParam(r, "number"))
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Card not found")
+		return
+	}
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if old.Status != model.CardActive && old.Status != model.CardExpired {
+		writeProblem(w, r, "card_not_active", fmt.Sprintf("Card is already %s", old.Status))
+		return
+	}
+
+	c, err := s.newCard(r.Context(), old.MemberID, "")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	created, err := s.repository.ReplaceCard(r.Context(), old.ID, req.Reason, *c)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "replacing card failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	retired := *old
+	retired.Status = req.Reason
+	retired.ReplacedBy = &created.ID
+
+	s.audit(r.Context(), cardEntry(model.AuditUpdate, old), old, retired)
+	s.audit(r.Context(), cardEntry(model.AuditCreate, created), nil, created)
+
+	writeJSONStatus(w, http.StatusCreated, created)
+}
+
+// cardEntry returns an audit entry about a card.
+func cardEntry(action model.AuditAction, c *model.Card) model.AuditEntry {
+	return model.AuditEntry{Action: action, Entity: model.EntityCard, EntityID: auditID(c.ID), MemberID: c.MemberID}
+}
+
+func (s *Service) cardPDFHandler(w http.ResponseWriter, r *http.Request) {
+	c, err := s.repository.GetCardByNumber(r.Context(), chi.URLParam(r, "number"))
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Card not found")
+		return
+	}
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	member, err := s.repository.GetMember(r.Context(), c.MemberID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Member not found")
+		return
+	}
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	p := card.Printable{
+		Library:    s.libraryName,
+		MemberName: member.Name,
+		Number:     c.Number,
+	}
+
+	if c.ExpiresAt != nil {
+		p.ValidUntil = c.ExpiresAt.Format(model.DateLayout)
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="card-%s.pdf"`, c.Number))
+
+	if err := card.WritePDF(w, p); err != nil {
+		slog.ErrorContext(r.Context(), "writing card PDF failed", "err", err)
+	}
+}
+
+// newCard builds an unsaved card with a fresh number for a member.
+func (s *Service) newCard(ctx context.Context, memberID int, expiresAt string) (*model.Card, error) {
+	seq, err := s.repository.NextCardSequence(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	number, err := s.cardFormat.Generate(seq)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &model.Card{MemberID: memberID, Number: number, Status: model.CardActive}
+
+	switch {
+	case expiresAt != "":
+		t, err := time.Parse(model.DateLayout, expiresAt)
+		if err != nil {
+			return nil, invalid("Invalid card", map[string]string{"expires_at": "Invalid date, use YYYY-MM-DD."})
+		}
+
+		c.ExpiresAt = &t
+	case s.cardValidity > 0:
+		t := time.Now().Add(s.cardValidity)
+		c.ExpiresAt = &t
+	}
+
+	return c, nil
+}
+
+// memberByCard resolves a card number to its member. Lost, replaced and
+// expired cards are refused with errCardNotUsable.
+func (s *Service) memberByCard(ctx context.Context, number string) (*model.Member, error) {
+	c, err := s.repository.GetCardByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.Usable(time.Now()) {
+		return nil, fmt.Errorf("%w: card is %s", errCardNotUsable, c.Status)
+	}
+
+	member, err := s.repository.GetMember(ctx, c.MemberID)
+	if err != nil {
+		return nil, err
+	}
+
+	return member, nil
+}
+
+// isCardNotFound reports whether err means no card with that number exists.
+func isCardNotFound(err error) bool {
+	return errors.Is(err, repository.ErrNotFound)
+}
@@ -0,0 +1,148 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+const defaultCategory = "adult"
+
+func (s *Service) listCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	categories, err := s.repository.ListCategories(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing categories failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	writeJSON(w, categories)
+}
+
+func (s *Service) getCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	c, err := s.repository.GetCategory(r.Context(), chi.URLParam(r, "code"))
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Category not found")
+		return
+	}
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, c)
+}
+
+func (s *Service) editCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	var c model.MembershipCategory
+
+	if !readJSON(w, r, &c) {
+		return
+	}
+
+	c.Code = chi.URLParam(r, "code")
+
+	if errs := c.Validate(); len(errs) > 0 {
+		writeInvalid(w, r, "Invalid category", errs)
+		return
+	}
+
+	before, _ := s.repository.GetCategory(r.Context(), c.Code)
+
+	err := s.repository.UpdateCategory(r.Context(), c)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Category not found")
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "updating category failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	s.audit(r.Context(), model.AuditEntry{Action: model.AuditUpdate, Entity: model.EntityCategory, EntityID: c.Code}, before, c)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) renewMembershipHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid member ID")
+		return
+	}
+
+	member, err := s.repository.GetMember(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Member not found")
+		return
+	}
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	category, err := s.memberCategory(r.Context(), member)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "renewing membership failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	expires := membershipExpiry(member.MembershipExpires, category, time.Now())
+
+	if err := s.repository.RenewMembership(r.Context(), id, expires); err != nil {
+		slog.ErrorContext(r.Context(), "renewing membership failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	before := *member
+	member.MembershipExpires = expires.Format(model.DateLayout)
+
+	s.audit(r.Context(), memberEntry(model.AuditUpdate, id), before, member)
+
+	writeJSON(w, member)
+}
+
+// membershipExpiry extends a membership by the category's term. A running
+// membership is extended from its current expiry, a lapsed one from today.
+func membershipExpiry(current string, category *model.MembershipCategory, now time.Time) time.Time {
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	if t, err := time.Parse(model.DateLayout, current); err == nil && t.After(from) {
+		from = t
+	}
+
+	return from.AddDate(0, category.MembershipMonths, 0)
+}
+
+// checkMemberCategory fills in the default category and rejects unknown
+// ones, adding to the validation errors of the member.
+func (s *Service) checkMemberCategory(ctx context.Context, m *model.Member, errs map[string]string) (*model.MembershipCategory, error) {
+	if m.Category == "" {
+		m.Category = defaultCategory
+	}
+
+	category, err := s.repository.GetCategory(ctx, m.Category)
+	if errors.Is(err, repository.ErrNotFound) {
+		errs["category"] = "Unknown membership category."
+		return nil, nil
+	}
+
+	return category, err
+}
@@ -0,0 +1,264 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+// loans and holds refused by a circulation rule
+var (
+	errMembershipExpired = &apiError{Code: "membership_expired", Message: "Membership has expired"}
+	errLoanLimit         = &apiError{Code: "loan_limit_reached", Message: "Member has reached the maximum number of loans"}
+	errNoCopies          = &apiError{Code: "no_copies_available", Message: "No copies of this book are available"}
+	errBookNotFound      = &apiError{Code: "book_not_found", Message: "Book not found"}
+	errOnHold            = &apiError{Code: "on_hold", Message: "Another member is waiting for this book"}
+	errHoldLimit         = &apiError{Code: "hold_limit_reached", Message: "Member has reached the maximum number of holds"}
+	errDuplicateHold     = &apiError{Code: "already_on_hold", Message: "Member already has a hold on this book"}
+)
+
+// memberCategory returns the rules that apply to the member.
+func (s *Service) memberCategory(ctx context.Context, m *model.Member) (*model.MembershipCategory, error) {
+	c, err := s.repository.GetCategory(ctx, m.Category)
+	if err != nil {
+		return nil, fmt.Errorf("category %q of member %d: %w", m.Category, m.ID, err)
+	}
+
+	return c, nil
+}
+
+// checkout lends a book to a member after checking the membership, the
+// member's blocks and the loan limit of the member's category.
+func (s *Service) checkout(ctx context.Context, m *model.Member, bookID int) (*model.Borrowing, error) {
+	now := time.Now()
+
+	if m.MembershipExpired(now) {
+		return nil, errMembershipExpired
+	}
+
+	if err := s.checkBlocks(ctx, m.ID); err != nil {
+		return nil, err
+	}
+
+	category, err := s.memberCategory(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.lend(ctx, m.ID, bookID, now, category)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, loanEntry(model.AuditBorrow, loan.ID, bookID, m.ID), nil, loan)
+	s.metrics.checkouts.Inc()
+
+	return loan, nil
+}
+
+// loanEntry returns an audit entry about a loan.
+func loanEntry(action model.AuditAction, id, bookID, memberID int) model.AuditEntry {
+	return model.AuditEntry{Action: action, Entity: model.EntityLoan, EntityID: auditID(id), BookID: bookID, MemberID: memberID}
+}
+
+// renew restarts a loan of the member. The loan is closed and opened again in
+// one transaction, so the inventory stays balanced; it does not count against
+// the loan limit.
+func (s *Service) renew(ctx context.Context, m *model.Member, loan *model.BorrowingDetail) (*model.Borrowing, error) {
+	now := time.Now()
+
+	if m.MembershipExpired(now) {
+		return nil, errMembershipExpired
+	}
+
+	if err := s.checkBlocks(ctx, m.ID); err != nil {
+		return nil, err
+	}
+
+	category, err := s.memberCategory(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+
+	waiting, err := s.repository.CountWaitingHolds(ctx, loan.BookID, m.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if waiting > 0 {
+		return nil, errOnHold
+	}
+
+	renewed := &model.Borrowing{
+		BookID:    loan.BookID,
+		MemberID:  m.ID,
+		IssueDate: now,
+		DueDate:   now.Add(category.LoanPeriod()),
+	}
+
+	renewed.ID, err = s.repository.RenewBorrowing(ctx, loan.ID, *renewed)
+	if err != nil {
+		return nil, err
+	}
+
+	s.fineLateReturn(ctx, loan, now)
+
+	// one entry for the renewed loan, pointing at the loan it replaces
+	s.audit(ctx, loanEntry(model.AuditRenew, renewed.ID, loan.BookID, m.ID), loan, renewed)
+	s.metrics.renewals.Inc()
+
+	return renewed, nil
+}
+
+// checkin returns a loan, fines it when overdue and refreshes the member's
+// automatic block.
+func (s *Service) checkin(ctx context.Context, loan *model.BorrowingDetail) error {
+	if err := s.closeLoan(ctx, loan, time.Now()); err != nil {
+		return err
+	}
+
+	after, _ := s.repository.GetBorrowing(ctx, loan.ID)
+	s.audit(ctx, loanEntry(model.AuditReturn, loan.ID, loan.BookID, loan.MemberID), loan, after)
+	s.metrics.returns.Inc()
+
+	if err := s.updateOverdueBlock(ctx, loan.MemberID); err != nil {
+		slog.ErrorContext(ctx, "updating overdue block failed", "err", err)
+	}
+
+	return nil
+}
+
+// closeLoan returns a loan and fines every started day it is overdue.
+func (s *Service) closeLoan(ctx context.Context, loan *model.BorrowingDetail, now time.Time) error {
+	if err := s.repository.ReturnBorrowing(ctx, loan.ID); err != nil {
+		return err
+	}
+
+	s.fineLateReturn(ctx, loan, now)
+
+	return nil
+}
+
+// fineLateReturn fines every started day a loan returned at now is overdue.
+// A failure is logged, the loan is returned either way.
+func (s *Service) fineLateReturn(ctx context.Context, loan *model.BorrowingDetail, now time.Time) {
+	if s.finePerDay <= 0 || !loan.Overdue(now) {
+		return
+	}
+
+	days := int(now.Sub(*loan.DueDate).Hours()/24) + 1
+	id := loan.ID
+
+	fine := model.Fine{
+		MemberID:    loan.MemberID,
+		BorrowingID: &id,
+		AmountCents: days * s.finePerDay,
+		Reason:      fmt.Sprintf("%s returned %d days late", loan.BookTitle, days),
+	}
+
+	fineID, err := s.repository.AddFine(ctx, fine)
+	if err != nil {
+		slog.ErrorContext(ctx, "adding fine failed", "err", err)
+		return
+	}
+
+	fine.ID = fineID
+	s.audit(ctx, model.AuditEntry{Action: model.AuditCreate, Entity: model.EntityFine, EntityID: auditID(fineID), BookID: loan.BookID, MemberID: loan.MemberID}, nil, fine)
+}
+
+// placeHold queues a member for a book, within the hold limit of the
+// member's category.
+func (s *Service) placeHold(ctx context.Context, m *model.Member, bookID int) (*model.Hold, error) {
+	if m.MembershipExpired(time.Now()) {
+		return nil, errMembershipExpired
+	}
+
+	if err := s.checkBlocks(ctx, m.ID); err != nil {
+		return nil, err
+	}
+
+	category, err := s.memberCategory(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.repository.GetBook(ctx, bookID); err != nil {
+		return nil, errBookNotFound
+	}
+
+	holds, err := s.repository.ListMemberHolds(ctx, m.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	waiting := 0
+
+	for _, h := range holds {
+		if h.Status != model.HoldWaiting {
+			continue
+		}
+
+		if h.BookID == bookID {
+			return nil, errDuplicateHold
+		}
+
+		waiting++
+	}
+
+	if waiting >= category.MaxHolds {
+		return nil, errHoldLimit
+	}
+
+	hold, err := s.repository.AddHold(ctx, model.Hold{BookID: bookID, MemberID: m.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, holdEntry(model.AuditCreate, hold), nil, hold)
+
+	return hold, nil
+}
+
+// holdEntry returns an audit entry about a hold.
+func holdEntry(action model.AuditAction, h *model.Hold) model.AuditEntry {
+	return model.AuditEntry{Action: action, Entity: model.EntityHold, EntityID: auditID(h.ID), BookID: h.BookID, MemberID: h.MemberID}
+}
+
+func (s *Service) lend(ctx context.Context, memberID, bookID int, now time.Time, category *model.MembershipCategory) (*model.Borrowing, error) {
+	b := model.Borrowing{
+		BookID:    bookID,
+		MemberID:  memberID,
+		IssueDate: now,
+		DueDate:   now.Add(category.LoanPeriod()),
+	}
+
+	id, err := s.repository.AddBorrowing(ctx, b, category.MaxLoans)
+	if errors.Is(err, repository.ErrLoanLimit) {
+		return nil, errLoanLimit
+	}
+
+	if errors.Is(err, repository.ErrUnavailable) {
+		return nil, errNoCopies
+	}
+
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, errBookNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	b.ID = id
+
+	if err := s.repository.FulfillHold(ctx, memberID, bookID); err != nil {
+		slog.ErrorContext(ctx, "fulfilling hold failed", "err", err)
+	}
+
+	return &b, nil
+}
@@ -0,0 +1,21 @@
+package backend
+
+import (
+	"context"
+	"net/http"
+)
+
+// deadline cancels the context of a request once it takes longer than the
+// request timeout, which stops its queries and calls to other services.
+func (s *Service) deadline(next http.Handler) http.Handler {
+	if s.requestTimeout <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), s.requestTimeout)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,62 @@
+package backend
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// etag is the entity tag of a record version.
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ifMatch reads the version a change is based on from If-Match. It is 0,
+// change unconditionally, when the header is missing or "*". ok is false
+// for a tag that no version has, such as a weak tag.
+func ifMatch(r *http.Request) (version int, ok bool) {
+	tag := strings.TrimSpace(r.Header.Get("If-Match"))
+	if tag == "" || tag == "*" {
+		return 0, true
+	}
+
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(tag[1 : len(tag)-1])
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+
+	return version, true
+}
+
+// writeConflict refuses a change based on an outdated version with 412 and
+// the current version as ETag, so the client can reload and merge.
+func writeConflict(w http.ResponseWriter, r *http.Request, kind string, current int) {
+	if current > 0 {
+		w.Header().Set("ETag", etag(current))
+	}
+
+	writeProblem(w, r, "version_conflict", kind+" was changed by someone else since it was loaded")
+}
+
+// bookVersion is the current version of a book, 0 when it is gone.
+func (s *Service) bookVersion(ctx context.Context, id int) int {
+	if b, err := s.repository.GetBook(ctx, id); err == nil {
+		return b.Version
+	}
+
+	return 0
+}
+
+// memberVersion is the current version of a member, 0 when they are gone.
+func (s *Service) memberVersion(ctx context.Context, id int) int {
+	if m, err := s.repository.GetMember(ctx, id); err == nil {
+		return m.Version
+	}
+
+	return 0
+}
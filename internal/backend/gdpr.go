@@ -0,0 +1,248 @@
+package backend
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+func (s *Service) exportMemberHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid member ID")
+		return
+	}
+
+	export, err := s.memberExport(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Member not found")
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "exporting member failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="member-%d-export.zip"`, id))
+
+	if err := writeExportZip(w, export); err != nil {
+		slog.ErrorContext(r.Context(), "writing member export failed", "err", err)
+	}
+}
+
+func (s *Service) memberExport(ctx context.Context, id int) (*model.MemberExport, error) {
+	member, err := s.repository.GetMember(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	cards, err := s.repository.ListMemberCards(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, err := s.repository.ListMemberBlocks(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	loans, err := s.repository.ListMemberLoanHistory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	holds, err := s.repository.ListMemberHolds(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	fines, err := s.repository.ListMemberFines(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.MemberExport{
+		ExportedAt: time.Now(),
+		Member:     *member,
+		Cards:      cards,
+		Blocks:     blocks,
+		Loans:      loans,
+		Holds:      holds,
+		Fines:      fines,
+	}, nil
+}
+
+// writeExportZip writes the export as export.json and one CSV file per
+// record type.
+func writeExportZip(w io.Writer, e *model.MemberExport) error {
+	z := zip.NewWriter(w)
+
+	f, err := z.Create("export.json")
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(e); err != nil {
+		return err
+	}
+
+	m := e.Member
+	files := []struct {
+		name string
+		rows [][]string
+	}{
+		{"profile.csv", [][]string{
+			{"id", "given_name", "family_name", "email", "phone", "street", "postal_code", "city", "country",
+				"date_of_birth", "preferred_language", "notify_email", "notify_sms", "notify_post", "category",
+				"membership_expires", "keep_history"},
+			{strconv.Itoa(m.ID), m.GivenName, m.FamilyName, m.Email, m.Phone, m.Address.Street, m.Address.PostalCode,
+				m.Address.City, m.Address.Country, m.DateOfBirth, m.PreferredLanguage,
+				strconv.FormatBool(m.Notifications.Email), strconv.FormatBool(m.Notifications.SMS),
+				strconv.FormatBool(m.Notifications.Post), m.Category, m.MembershipExpires, strconv.FormatBool(m.KeepHistory)},
+		}},
+		{"loans.csv", loanRows(e.Loans)},
+		{"cards.csv", cardRows(e.Cards)},
+		{"blocks.csv", blockRows(e.Blocks)},
+		{"holds.csv", holdRows(e.Holds)},
+		{"fines.csv", fineRows(e.Fines)},
+	}
+
+	for _, file := range files {
+		f, err := z.Create(file.name)
+		if err != nil {
+			return err
+		}
+
+		cw := csv.NewWriter(f)
+		if err := cw.WriteAll(file.rows); err != nil {
+			return err
+		}
+	}
+
+	return z.Close()
+}
+
+func loanRows(loans []model.BorrowingDetail) [][]string {
+	rows := [][]string{{"id", "book_id", "title", "issue_date", "due_date", "return_date"}}
+
+	for _, l := range loans {
+		rows = append(rows, []string{strconv.Itoa(l.ID), strconv.Itoa(l.BookID), l.BookTitle,
+			formatTime(&l.IssueDate), formatTime(l.DueDate), formatTime(l.ReturnDate)})
+	}
+
+	return rows
+}
+
+func cardRows(cards []model.Card) [][]string {
+	rows := [][]string{{"number", "status", "issued_at", "expires_at"}}
+
+	for _, c := range cards {
+		rows = append(rows, []string{c.Number, string(c.Status), formatTime(&c.IssuedAt), formatTime(c.ExpiresAt)})
+	}
+
+	return rows
+}
+
+func blockRows(blocks []model.MemberBlock) [][]string {
+	rows := [][]string{{"kind", "reason", "created_by", "created_at", "expires_at", "lifted_at", "lifted_by"}}
+
+	for _, b := range blocks {
+		rows = append(rows, []string{string(b.Kind), b.Reason, b.CreatedBy, formatTime(&b.CreatedAt),
+			formatTime(b.ExpiresAt), formatTime(b.LiftedAt), b.LiftedBy})
+	}
+
+	return rows
+}
+
+func holdRows(holds []model.Hold) [][]string {
+	rows := [][]string{{"id", "book_id", "title", "status", "created_at", "closed_at"}}
+
+	for _, h := range holds {
+		rows = append(rows, []string{strconv.Itoa(h.ID), strconv.Itoa(h.BookID), h.BookTitle, string(h.Status),
+			formatTime(&h.CreatedAt), formatTime(h.ClosedAt)})
+	}
+
+	return rows
+}
+
+func fineRows(fines []model.Fine) [][]string {
+	rows := [][]string{{"id", "amount", "reason", "created_at", "paid_at"}}
+
+	for _, f := range fines {
+		rows = append(rows, []string{strconv.Itoa(f.ID), f.Amount(), f.Reason, formatTime(&f.CreatedAt), formatTime(f.PaidAt)})
+	}
+
+	return rows
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func (s *Service) eraseMemberHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid member ID")
+		return
+	}
+
+	var req model.ErasureRequest
+
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	record, err := s.repository.EraseMember(r.Context(), id, actor(r.Context()), strings.TrimSpace(req.Reason))
+
+	switch {
+	case errors.Is(err, repository.ErrOpenLoans):
+		writeProblem(w, r, "open_loans", "Member cannot be erased while items are outstanding")
+	case errors.Is(err, repository.ErrUnpaidFines):
+		writeProblem(w, r, "unpaid_fines", "Member cannot be erased while fines are unpaid")
+	case errors.Is(err, repository.ErrNotFound):
+		writeProblem(w, r, "not_found", "Member not found or already erased")
+	case err != nil:
+		slog.ErrorContext(r.Context(), "erasing member failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+	default:
+		// the snapshot is the erasure record, the member's data is gone
+		s.audit(r.Context(), memberEntry(model.AuditErase, id), nil, record)
+		writeJSON(w, record)
+	}
+}
+
+func (s *Service) listErasuresHandler(w http.ResponseWriter, r *http.Request) {
+	records, err := s.repository.ListErasures(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing erasures failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	writeJSON(w, records)
+}
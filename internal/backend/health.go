@@ -0,0 +1,43 @@
+package backend
+
+import (
+	"context"
+	"errors"
+
+	"github.com/tliefheid/go-ils/internal/health"
+)
+
+// errNotMigrated fails readiness until the migrations are applied.
+var errNotMigrated = errors.New("migrations not applied")
+
+// newHealth checks the database answers and holds the schema the backend
+// expects.
+func newHealth(s *Service) *health.Checker {
+	h := health.New(health.DefaultTimeout)
+
+	if s.repository == nil {
+		return h
+	}
+
+	h.Add("database", s.repository.Ping)
+	h.Add("migrations", func(ctx context.Context) error {
+		applied, err := s.repository.MigrationsApplied(ctx)
+		if err != nil {
+			return err
+		}
+
+		if !applied {
+			return errNotMigrated
+		}
+
+		return nil
+	})
+
+	return h
+}
+
+// Drain fails the readiness probe from now on, so load balancers stop
+// sending requests before the server shuts down.
+func (s *Service) Drain() {
+	s.health.Drain()
+}
@@ -0,0 +1,190 @@
+package backend
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+func (s *Service) listMemberHoldsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid member ID")
+		return
+	}
+
+	s.writeHolds(w, r, id)
+}
+
+func (s *Service) writeHolds(w http.ResponseWriter, r *http.Request, memberID int) {
+	holds, err := s.repository.ListMemberHolds(r.Context(), memberID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing holds failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	writeJSON(w, holds)
+}
+
+func (s *Service) placeHoldHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid member ID")
+		return
+	}
+
+	member, err := s.repository.GetMember(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Member not found")
+		return
+	}
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	s.placeHoldFor(w, r, member)
+}
+
+// placeHoldFor reads a HoldRequest and places the hold for member.
+func (s *Service) placeHoldFor(w http.ResponseWriter, r *http.Request, member *model.Member) {
+	var req model.HoldRequest
+
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	if req.BookID <= 0 {
+		writeProblem(w, r, "bad_request", "Missing book ID")
+		return
+	}
+
+	hold, err := s.placeHold(r.Context(), member, req.BookID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSONStatus(w, http.StatusCreated, hold)
+}
+
+func (s *Service) cancelHoldHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid member ID")
+		return
+	}
+
+	s.cancelHoldFor(w, r, id)
+}
+
+// cancelHoldFor cancels the hold in the URL if it belongs to memberID.
+func (s *Service) cancelHoldFor(w http.ResponseWriter, r *http.Request, memberID int) {
+	holdID, err := strconv.Atoi(chi.URLParam(r, "holdID"))
+	if err != nil || holdID <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid hold ID")
+		return
+	}
+
+	hold, err := s.repository.GetHold(r.Context(), holdID)
+	if errors.Is(err, repository.ErrNotFound) || err == nil && hold.MemberID != memberID {
+		writeProblem(w, r, "not_found", "Hold not found")
+		return
+	}
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = s.repository.CloseHold(r.Context(), holdID, model.HoldCancelled)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "hold_not_waiting", "Hold is no longer waiting")
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "cancelling hold failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	after, _ := s.repository.GetHold(r.Context(), holdID)
+	s.audit(r.Context(), holdEntry(model.AuditUpdate, hold), hold, after)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) listMemberFinesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid member ID")
+		return
+	}
+
+	s.writeFines(w, r, id)
+}
+
+func (s *Service) writeFines(w http.ResponseWriter, r *http.Request, memberID int) {
+	fines, err := s.repository.ListMemberFines(r.Context(), memberID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing fines failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	writeJSON(w, fines)
+}
+
+func (s *Service) payFineHandler(w http.ResponseWriter, r *http.Request) {
+	memberID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || memberID <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid member ID")
+		return
+	}
+
+	fineID, err := strconv.Atoi(chi.URLParam(r, "fineID"))
+	if err != nil || fineID <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid fine ID")
+		return
+	}
+
+	fine, err := s.repository.GetFine(r.Context(), fineID)
+	if errors.Is(err, repository.ErrNotFound) || err == nil && fine.MemberID != memberID {
+		writeProblem(w, r, "not_found", "Fine not found")
+		return
+	}
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = s.repository.PayFine(r.Context(), fineID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "already_paid", "Fine is already paid")
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "paying fine failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	after, _ := s.repository.GetFine(r.Context(), fineID)
+	s.audit(r.Context(), model.AuditEntry{Action: model.AuditUpdate, Entity: model.EntityFine, EntityID: auditID(fineID), MemberID: memberID}, fine, after)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,14 +1,21 @@
 package backend
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ISBN_Response struct {
@@ -62,31 +69,50 @@ type AuthorResponse struct {
 func (s *Service) isbnInfoHandler(w http.ResponseWriter, r *http.Request) {
 	isbn := chi.URLParam(r, "isbn")
 	if isbn == "" {
-		http.Error(w, "Missing isbn parameter", http.StatusBadRequest)
+		writeProblem(w, r, "bad_request", "Missing isbn parameter")
 		return
 	}
 
-	book, err := s.lookupByISBN(isbn)
+	book, err := s.lookupByISBN(r.Context(), isbn)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error fetching book info: %v", err), http.StatusBadRequest)
+		slog.ErrorContext(r.Context(), "looking up ISBN failed", "isbn", isbn, "err", err)
+		writeProblem(w, r, "upstream_error", "The ISBN could not be looked up")
+
 		return
 	}
 
 	writeJSON(w, book)
 }
 
-func (s *Service) lookupByISBN(isbn string) (*model.Book, error) {
-	book, err := s.repository.SearchBookByISBN(isbn)
+func (s *Service) lookupByISBN(ctx context.Context, isbn string) (book *model.Book, err error) {
+	start := time.Now()
+	result := isbnOpenLibrary
+
+	ctx, span := tracer.Start(ctx, "isbn.lookup", trace.WithAttributes(attribute.String("isbn", isbn)))
+
+	defer func() {
+		if err != nil {
+			result = isbnFailed
+
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "lookup failed")
+		}
+
+		span.SetAttributes(attribute.String("isbn.result", result))
+		span.End()
+		s.metrics.observeISBNLookup(start, result)
+	}()
+
+	book, err = s.repository.SearchBookByISBN(ctx, isbn)
 	if err == nil && book != nil {
-		fmt.Printf("Found book in local store: %+v\n", book)
+		slog.DebugContext(ctx, "found book in local store", "isbn", isbn, "book_id", book.ID)
+		result = isbnLocal
+
 		return book, nil
 	}
 
-	isbnInfo, err := lookupBook(isbn)
-	fmt.Printf("isbnInfo: %+v\n", isbnInfo)
-
+	isbnInfo, err := lookupBook(ctx, isbn)
 	if err != nil {
-		fmt.Printf("isbnInfo err: %v\n", err)
 		return nil, fmt.Errorf("error looking up book by ISBN: %v", err)
 	}
 
@@ -95,7 +121,7 @@ func (s *Service) lookupByISBN(isbn string) (*model.Book, error) {
 	if len(isbnInfo.Authors) > 0 {
 		authorKey := isbnInfo.Authors[0].Key
 
-		authorInfo, err := lookupAuthor(authorKey)
+		authorInfo, err := lookupAuthor(ctx, authorKey)
 		if err != nil {
 			return nil, fmt.Errorf("error looking up author: %v", err)
 		}
@@ -120,39 +146,55 @@ func (s *Service) lookupByISBN(isbn string) (*model.Book, error) {
 	return book, nil
 }
 
-func lookupBook(isbn string) (*ISBN_Response, error) {
-	url := fmt.Sprintf("https://openlibrary.org/isbn/%s.json", isbn)
+// openLibraryClient makes the calls to Open Library, traced as part of the
+// lookup.
+var openLibraryClient = &http.Client{Transport: tracing.Transport(nil)}
 
-	resp, err := http.Get(url)
-	if err != nil || resp.StatusCode != 200 {
-		return nil, fmt.Errorf("failed to fetch info from Open Library: status: %v, err: %v", resp.StatusCode, err)
-	}
-
-	defer resp.Body.Close()
+func lookupBook(ctx context.Context, isbn string) (*ISBN_Response, error) {
+	url := fmt.Sprintf("https://openlibrary.org/isbn/%s.json", isbn)
 
 	var isbnResp ISBN_Response
-	if err := json.NewDecoder(resp.Body).Decode(&isbnResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %v", err)
+	if err := getOpenLibrary(ctx, url, &isbnResp); err != nil {
+		return nil, fmt.Errorf("failed to fetch info from Open Library: %v", err)
 	}
 
 	return &isbnResp, nil
 }
 
-func lookupAuthor(authorKey string) (*AuthorResponse, error) {
+func lookupAuthor(ctx context.Context, authorKey string) (*AuthorResponse, error) {
 	authorKey = strings.TrimPrefix(authorKey, "/authors/")
 	url := fmt.Sprintf("https://openlibrary.org/authors/%s.json", authorKey)
 
-	resp, err := http.Get(url)
-	if err != nil || resp.StatusCode != 200 {
-		return nil, fmt.Errorf("failed to fetch author info: status: %v, err: %v", resp.StatusCode, err)
+	var author AuthorResponse
+	if err := getOpenLibrary(ctx, url, &author); err != nil {
+		return nil, fmt.Errorf("failed to fetch author info: %v", err)
+	}
+
+	return &author, nil
+}
+
+// getOpenLibrary fetches url and decodes the JSON response into out. The
+// request is abandoned when ctx is done.
+func getOpenLibrary(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := openLibraryClient.Do(req)
+	if err != nil {
+		return err
 	}
 
 	defer resp.Body.Close()
 
-	var author AuthorResponse
-	if err := json.NewDecoder(resp.Body).Decode(&author); err != nil {
-		return nil, fmt.Errorf("failed to decode author response: %v", err)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status: %v", resp.StatusCode)
 	}
 
-	return &author, nil
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return nil
 }
@@ -0,0 +1,105 @@
+package backend
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tliefheid/go-ils/internal/model"
+)
+
+// jobInterval is how often the scheduled jobs run.
+const jobInterval = 24 * time.Hour
+
+// archive anonymizes the members deleted longer than archiveAfter ago.
+func (s *Service) archive(ctx context.Context) (model.ArchiveResult, error) {
+	before := time.Now().Add(-s.archiveAfter)
+
+	n, err := s.repository.AnonymizeDeletedMembers(ctx, before)
+	if err != nil {
+		return model.ArchiveResult{}, err
+	}
+
+	return model.ArchiveResult{DeletedBefore: before, Anonymized: n}, nil
+}
+
+// retention anonymizes the loans returned longer than loanRetention ago.
+func (s *Service) retention(ctx context.Context, dryRun bool) (*model.RetentionReport, error) {
+	return s.repository.AnonymizeLoanHistory(ctx, time.Now().Add(-s.loanRetention), dryRun)
+}
+
+func (s *Service) retentionHandler(w http.ResponseWriter, r *http.Request) {
+	if s.loanRetention <= 0 {
+		writeProblem(w, r, "job_disabled", "Loan history retention is disabled")
+		return
+	}
+
+	dryRun, err := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	if err != nil && r.URL.Query().Get("dry_run") != "" {
+		writeProblem(w, r, "bad_request", "Invalid dry_run")
+		return
+	}
+
+	report, err := s.retention(r.Context(), dryRun)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "applying loan retention failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	writeJSON(w, report)
+}
+
+func (s *Service) archiveHandler(w http.ResponseWriter, r *http.Request) {
+	if s.archiveAfter <= 0 {
+		writeProblem(w, r, "job_disabled", "Archival is disabled")
+		return
+	}
+
+	result, err := s.archive(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "archiving members failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	writeJSON(w, result)
+}
+
+// RunJobs runs the scheduled maintenance jobs once a day until ctx is done.
+func (s *Service) RunJobs(ctx context.Context) {
+	ticker := time.NewTicker(jobInterval)
+	defer ticker.Stop()
+
+	for {
+		if s.archiveAfter > 0 {
+			result, err := s.archive(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "archiving members failed", "err", err)
+			} else if result.Anonymized > 0 {
+				slog.InfoContext(ctx, "anonymized deleted members", "count", result.Anonymized)
+			}
+		}
+
+		if s.loanRetention > 0 {
+			report, err := s.retention(ctx, s.retentionDryRun)
+			if err != nil {
+				slog.ErrorContext(ctx, "applying loan retention failed", "err", err)
+			} else {
+				slog.InfoContext(ctx, "applied loan retention", "dry_run", report.DryRun, "loans", report.Loans,
+					"fines", report.Fines, "holds", report.Holds,
+					"returned_before", report.ReturnedBefore.Format(model.DateLayout), "cohorts", report.Cohorts)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
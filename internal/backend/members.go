@@ -1,21 +1,24 @@
 package backend
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
 )
 
 // --- Member Handlers ---
 func (s *Service) listMembersHandler(w http.ResponseWriter, r *http.Request) {
-	members, err := s.repository.ListMemberss()
+	members, err := s.repository.ListMemberss(r.Context())
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		writeProblem(w, r, "internal_error", "")
 		return
 	}
 
@@ -25,103 +28,160 @@ func (s *Service) listMembersHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Service) searchMembers(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
 	if query == "" {
-		fmt.Println("Missing search query")
-		http.Error(w, "Missing search query", http.StatusBadRequest)
+		writeProblem(w, r, "bad_request", "Missing search query")
 
 		return
 	}
 
-	members, err := s.repository.SearchMembers(query)
+	members, err := s.repository.SearchMembers(r.Context(), query)
 	if err != nil {
-		fmt.Println("Error searching books:", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "searching members failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
 
 		return
 	}
 
-	fmt.Printf("len(members): %v\n", len(members))
-	fmt.Printf("members: %v\n", members)
 	writeJSON(w, members)
 }
 
 func (s *Service) getMemberHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	if idStr == "" {
-		http.Error(w, "Missing member ID", http.StatusBadRequest)
+		writeProblem(w, r, "bad_request", "Missing member ID")
 		return
 	}
 
 	id, err := strconv.Atoi(idStr)
 	if err != nil || id <= 0 {
-		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		writeProblem(w, r, "bad_request", "Invalid member ID")
+		return
+	}
+
+	member, err := s.repository.GetMember(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Member not found")
 		return
 	}
 
-	member, err := s.repository.GetMember(id)
 	if err != nil {
-		http.Error(w, "Member not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 
+	w.Header().Set("ETag", etag(member.Version))
 	writeJSON(w, member)
 }
 
 func (s *Service) addMemberHandler(w http.ResponseWriter, r *http.Request) {
 	var m model.Member
 
-	body, err := io.ReadAll(r.Body)
+	if !readJSON(w, r, &m) {
+		return
+	}
 
+	errs := m.Validate()
+
+	category, err := s.checkMemberCategory(r.Context(), &m, errs)
 	if err != nil {
-		fmt.Println("Error reading request body:", err)
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		slog.ErrorContext(r.Context(), "looking up category failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
 
 		return
 	}
 
-	if err := json.Unmarshal(body, &m); err != nil {
-		fmt.Println("Error unmarshalling JSON:", err)
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-
+	if len(errs) > 0 {
+		writeInvalid(w, r, "Invalid member", errs)
 		return
 	}
 
-	err = s.repository.AddMember(m)
+	m.Name = m.DisplayName()
+
+	if m.MembershipExpires == "" {
+		m.MembershipExpires = membershipExpiry("", category, time.Now()).Format(model.DateLayout)
+	}
+
+	m.ID, err = s.repository.AddMember(r.Context(), m)
 	if err != nil {
-		fmt.Println("Error adding member:", err)
-		http.Error(w, fmt.Sprintf("Failed to add member: %v", err), http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "adding member failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
 
 		return
 	}
 
-	fmt.Println("Successfully added member:", m)
+	after, _ := s.repository.GetMember(r.Context(), m.ID)
+	s.audit(r.Context(), memberEntry(model.AuditCreate, m.ID), nil, after)
+
 	writeJSON(w, m)
 }
 
 func (s *Service) editMemberHandler(w http.ResponseWriter, r *http.Request) {
 	var m model.Member
 
-	body, err := io.ReadAll(r.Body)
+	if !readJSON(w, r, &m) {
+		return
+	}
+
+	// the URL names the member the If-Match tag belongs to
+	if id, err := strconv.Atoi(chi.URLParam(r, "id")); err == nil {
+		m.ID = id
+	}
+
+	if m.ID <= 0 {
+		writeProblem(w, r, "bad_request", "Missing member ID")
+		return
+	}
+
+	before, err := s.repository.GetMember(r.Context(), m.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Member not found")
+		return
+	}
+
 	if err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		writeError(w, r, err)
+		return
+	}
+
+	errs := m.ValidateUpdate(*before)
+
+	if _, err := s.checkMemberCategory(r.Context(), &m, errs); err != nil {
+		slog.ErrorContext(r.Context(), "looking up category failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
 		return
 	}
 
-	if err := json.Unmarshal(body, &m); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if len(errs) > 0 {
+		writeInvalid(w, r, "Invalid member", errs)
 		return
 	}
 
-	if m.ID == 0 {
-		http.Error(w, "Missing member ID", http.StatusBadRequest)
+	version, ok := ifMatch(r)
+	if !ok || (version != 0 && version != before.Version) {
+		writeConflict(w, r, "Member", before.Version)
+		return
+	}
+
+	m.Version = version
+
+	err = s.repository.UpdateMember(r.Context(), m)
+	if errors.Is(err, repository.ErrConflict) {
+		writeConflict(w, r, "Member", s.memberVersion(r.Context(), m.ID))
 		return
 	}
 
-	err = s.repository.UpdateMember(m)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("update member: %w", err))
 		return
 	}
 
+	after, _ := s.repository.GetMember(r.Context(), m.ID)
+	s.audit(r.Context(), memberEntry(model.AuditUpdate, m.ID), before, after)
+
+	if after != nil {
+		w.Header().Set("ETag", etag(after.Version))
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -130,15 +190,86 @@ func (s *Service) deleteMemberHandler(w http.ResponseWriter, r *http.Request) {
 
 	id, err := strconv.Atoi(idStr)
 	if err != nil || id == 0 {
-		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		writeProblem(w, r, "bad_request", "Invalid member ID")
+		return
+	}
+
+	version, ok := ifMatch(r)
+	if !ok {
+		writeConflict(w, r, "Member", s.memberVersion(r.Context(), id))
+		return
+	}
+
+	before, _ := s.repository.GetMember(r.Context(), id)
+
+	err = s.repository.DeleteMember(r.Context(), id, version)
+	if errors.Is(err, repository.ErrConflict) {
+		writeConflict(w, r, "Member", s.memberVersion(r.Context(), id))
 		return
 	}
 
-	err = s.repository.DeleteMember(id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to delete member: %v", err), http.StatusInternalServerError)
+		writeDeleteError(w, r, "Member", err)
 		return
 	}
 
+	s.audit(r.Context(), memberEntry(model.AuditDelete, id), before, nil)
+
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (s *Service) listDeletedMembersHandler(w http.ResponseWriter, r *http.Request) {
+	members, err := s.repository.ListDeletedMembers(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing deleted members failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	writeJSON(w, members)
+}
+
+func (s *Service) restoreMemberHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid member ID")
+		return
+	}
+
+	err = s.repository.RestoreMember(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Deleted member not found or already anonymized")
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "restoring member failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	after, _ := s.repository.GetMember(r.Context(), id)
+	s.audit(r.Context(), memberEntry(model.AuditRestore, id), nil, after)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// memberEntry returns an audit entry about a member.
+func memberEntry(action model.AuditAction, id int) model.AuditEntry {
+	return model.AuditEntry{Action: action, Entity: model.EntityMember, EntityID: auditID(id)}
+}
+
+// writeDeleteError answers a failed soft delete of kind, a book or member.
+func writeDeleteError(w http.ResponseWriter, r *http.Request, kind string, err error) {
+	switch {
+	case errors.Is(err, repository.ErrOpenLoans):
+		writeProblem(w, r, "open_loans", kind+" cannot be deleted while it has open loans")
+	case errors.Is(err, repository.ErrNotFound):
+		writeProblem(w, r, "not_found", kind+" not found")
+	default:
+		slog.ErrorContext(r.Context(), "deleting failed", "kind", strings.ToLower(kind), "err", err)
+		writeProblem(w, r, "internal_error", "")
+	}
+}
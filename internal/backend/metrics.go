@@ -0,0 +1,99 @@
+package backend
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tliefheid/go-ils/internal/metrics"
+)
+
+// loanCountTimeout bounds the query counting the loans on a scrape.
+const loanCountTimeout = 5 * time.Second
+
+// serviceMetrics are the library's own metrics, next to the HTTP and
+// database ones.
+type serviceMetrics struct {
+	checkouts prometheus.Counter
+	renewals  prometheus.Counter
+	returns   prometheus.Counter
+
+	isbnLookups  *prometheus.CounterVec
+	isbnDuration prometheus.Histogram
+}
+
+func newServiceMetrics(reg *metrics.Registry) *serviceMetrics {
+	counter := func(name, help string) prometheus.Counter {
+		return prometheus.NewCounter(prometheus.CounterOpts{Namespace: metrics.Namespace, Name: name, Help: help})
+	}
+
+	m := &serviceMetrics{
+		checkouts: counter("checkouts_total", "Books lent, at the desk, by API or by SIP2."),
+		renewals:  counter("renewals_total", "Loans renewed."),
+		returns:   counter("returns_total", "Loans returned."),
+		isbnLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Name:      "isbn_lookups_total",
+			Help:      "ISBN lookups by result: found in the catalogue, found at Open Library or failed.",
+		}, []string{"result"}),
+		isbnDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metrics.Namespace,
+			Name:      "isbn_lookup_duration_seconds",
+			Help:      "Time taken to look up an ISBN.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+	}
+
+	reg.MustRegister(m.checkouts, m.renewals, m.returns, m.isbnLookups, m.isbnDuration)
+
+	return m
+}
+
+// Results of an ISBN lookup.
+const (
+	isbnLocal       = "catalogue"
+	isbnOpenLibrary = "openlibrary"
+	isbnFailed      = "failed"
+)
+
+// observeISBNLookup records a lookup that started at start.
+func (m *serviceMetrics) observeISBNLookup(start time.Time, result string) {
+	m.isbnLookups.WithLabelValues(result).Inc()
+	m.isbnDuration.Observe(time.Since(start).Seconds())
+}
+
+// loanCollector reports the open and overdue loans, counted on every
+// scrape.
+type loanCollector struct {
+	s       *Service
+	open    *prometheus.Desc
+	overdue *prometheus.Desc
+}
+
+func newLoanCollector(s *Service) *loanCollector {
+	return &loanCollector{
+		s:       s,
+		open:    prometheus.NewDesc(metrics.Namespace+"_loans_active", "Loans not returned.", nil, nil),
+		overdue: prometheus.NewDesc(metrics.Namespace+"_loans_overdue", "Loans not returned and past their due date.", nil, nil),
+	}
+}
+
+func (c *loanCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.open
+	ch <- c.overdue
+}
+
+func (c *loanCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), loanCountTimeout)
+	defer cancel()
+
+	open, overdue, err := c.s.repository.CountOpenBorrowings(ctx, time.Now())
+	if err != nil {
+		slog.ErrorContext(ctx, "counting loans for metrics failed", "err", err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(open))
+	ch <- prometheus.MustNewConstMetric(c.overdue, prometheus.GaugeValue, float64(overdue))
+}
@@ -0,0 +1,196 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/oidc"
+	"github.com/tliefheid/go-ils/internal/password"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+// oidcNonceLifetime is how long a single sign-on may take from the nonce to
+// the login.
+const oidcNonceLifetime = 10 * time.Minute
+
+// usernameInvalid matches what staff usernames may not contain.
+var usernameInvalid = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// oidcNonceHandler issues the nonce the frontend starts a single sign-on
+// with. Only its hash is stored, and oidcLoginHandler accepts it once.
+func (s *Service) oidcNonceHandler(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		writeProblem(w, r, "sso_disabled", "Single sign-on is not configured")
+		return
+	}
+
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "creating OIDC nonce failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	expires := time.Now().Add(oidcNonceLifetime)
+
+	if err := s.repository.AddOIDCNonce(r.Context(), password.HashToken(nonce), expires); err != nil {
+		slog.ErrorContext(r.Context(), "adding OIDC nonce failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	writeJSON(w, model.OIDCNonce{Nonce: nonce, ExpiresAt: expires})
+}
+
+// oidcLoginHandler logs a staff user in with an ID token the frontend got
+// from the identity provider. The token's groups decide the role, and users
+// are created on their first login.
+func (s *Service) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		writeProblem(w, r, "sso_disabled", "Single sign-on is not configured")
+		return
+	}
+
+	var req model.OIDCLoginRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	// the nonce ties the token to a login the backend issued the nonce
+	// for, and is consumed below so the token cannot be replayed
+	if req.IDToken == "" || req.Nonce == "" {
+		writeProblem(w, r, "bad_request", "ID token and nonce are required")
+		return
+	}
+
+	token, err := s.oidc.Verify(r.Context(), req.IDToken, req.Nonce)
+	if errors.Is(err, oidc.ErrInvalidToken) {
+		slog.WarnContext(r.Context(), "rejected ID token", "err", err)
+		writeProblem(w, r, "invalid_token", "The identity provider's token is not valid")
+
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "verifying ID token failed", "err", err)
+		writeProblem(w, r, "upstream_error", "Identity provider unavailable")
+
+		return
+	}
+
+	err = s.repository.ConsumeOIDCNonce(r.Context(), password.HashToken(req.Nonce))
+	if errors.Is(err, repository.ErrNotFound) {
+		slog.WarnContext(r.Context(), "rejected ID token with an unknown or used nonce")
+		writeProblem(w, r, "invalid_token", "The login expired or was already used, please try again")
+
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "consuming OIDC nonce failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	role, ok := s.oidcRole(token)
+	if !ok {
+		writeProblem(w, r, "no_role", "None of your groups gives access to the library system")
+
+		return
+	}
+
+	user, err := s.provisionStaffUser(r.Context(), token, role)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "provisioning staff user failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	if user.Disabled {
+		writeProblem(w, r, "disabled", "Your account is disabled")
+		return
+	}
+
+	s.startStaffSession(w, r, user)
+}
+
+// oidcRole maps the token's groups to the most privileged role one of them
+// is mapped to.
+func (s *Service) oidcRole(token *oidc.IDToken) (model.StaffRole, bool) {
+	groups := map[string]bool{}
+	for _, g := range token.Strings(s.oidcGroupsClaim) {
+		groups[g] = true
+	}
+
+	for _, role := range model.StaffRoles {
+		for _, g := range s.oidcRoleGroups[role] {
+			if groups[g] {
+				return role, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// provisionStaffUser creates or updates the user of the token. When the
+// username the token suggests is taken by another account, a suffix derived
+// from the subject keeps it apart.
+func (s *Service) provisionStaffUser(ctx context.Context, token *oidc.IDToken, role model.StaffRole) (*model.StaffUser, error) {
+	u := model.StaffUser{Username: oidcUsername(token), Name: token.Name, Role: role}
+	if u.Name == "" {
+		u.Name = u.Username
+	}
+
+	user, err := s.repository.ProvisionStaffUser(ctx, u, token.Subject)
+	if !errors.Is(err, repository.ErrDuplicate) {
+		return user, err
+	}
+
+	sum := sha256.Sum256([]byte(token.Subject))
+	suffix := "-" + hex.EncodeToString(sum[:3])
+
+	if len(u.Username)+len(suffix) > 32 {
+		u.Username = u.Username[:32-len(suffix)]
+	}
+
+	u.Username += suffix
+
+	return s.repository.ProvisionStaffUser(ctx, u, token.Subject)
+}
+
+// oidcUsername turns the preferred username, the email's local part or the
+// subject into a valid staff username.
+func oidcUsername(token *oidc.IDToken) string {
+	name := token.PreferredUsername
+	if name == "" {
+		name, _, _ = strings.Cut(token.Email, "@")
+	}
+
+	if name == "" {
+		name = token.Subject
+	}
+
+	name = strings.Trim(usernameInvalid.ReplaceAllString(strings.ToLower(name), "-"), "._-")
+	if len(name) > 32 {
+		name = name[:32]
+	}
+
+	for len(name) < 2 {
+		name += "0"
+	}
+
+	return name
+}
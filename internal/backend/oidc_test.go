@@ -0,0 +1,264 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/oidc/mockoidc"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+const testClientID = "frontend"
+
+// ssoStore keeps the nonces, users and sessions of single sign-ons, the
+// rest of the store is not used by these tests.
+type ssoStore struct {
+	repository.Store
+
+	mu       sync.Mutex
+	nonces   map[string]time.Time
+	users    map[string]*model.StaffUser
+	sessions int
+}
+
+func (st *ssoStore) Stats() sql.DBStats { return sql.DBStats{} }
+
+func (st *ssoStore) AddOIDCNonce(_ context.Context, nonceHash string, expires time.Time) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.nonces[nonceHash] = expires
+
+	return nil
+}
+
+func (st *ssoStore) ConsumeOIDCNonce(_ context.Context, nonceHash string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	expires, ok := st.nonces[nonceHash]
+	delete(st.nonces, nonceHash)
+
+	if !ok || time.Now().After(expires) {
+		return repository.ErrNotFound
+	}
+
+	return nil
+}
+
+func (st *ssoStore) ProvisionStaffUser(_ context.Context, u model.StaffUser, subject string) (*model.StaffUser, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if user, ok := st.users[subject]; ok {
+		user.Name, user.Role = u.Name, u.Role
+		return user, nil
+	}
+
+	u.ID = len(st.users) + 1
+	u.SSO = true
+	st.users[subject] = &u
+
+	return &u, nil
+}
+
+func (st *ssoStore) AddStaffSession(context.Context, string, int, time.Time) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.sessions++
+
+	return nil
+}
+
+// newSSOService returns a service trusting a mock provider that logs in a
+// librarian.
+func newSSOService(t *testing.T) (*Service, *ssoStore, *mockoidc.Provider) {
+	t.Helper()
+
+	provider, srv, err := mockoidc.NewServer(testClientID, mockoidc.User{
+		Subject:           "42",
+		Name:              "Ada Lovelace",
+		PreferredUsername: "ada",
+		Groups:            []string{"library-staff"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(srv.Close)
+
+	store := &ssoStore{nonces: map[string]time.Time{}, users: map[string]*model.StaffUser{}}
+
+	s, err := New(Config{
+		Repository:     store,
+		OIDCIssuer:     srv.URL,
+		OIDCClientID:   testClientID,
+		OIDCRoleGroups: map[model.StaffRole][]string{model.RoleLibrarian: {"library-staff"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, store, provider
+}
+
+// post sends body as JSON to the service and decodes the response into v.
+func post(t *testing.T, s *Service, path string, body, v any) int {
+	t.Helper()
+
+	var payload []byte
+
+	if body != nil {
+		var err error
+
+		if payload, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+	s.Mux().ServeHTTP(rec, req)
+
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("POST %s: decode %q: %v", path, rec.Body, err)
+	}
+
+	return rec.Code
+}
+
+func issueNonce(t *testing.T, s *Service) string {
+	t.Helper()
+
+	var nonce model.OIDCNonce
+	if code := post(t, s, "/auth/oidc/nonce", nil, &nonce); code != http.StatusOK || nonce.Nonce == "" {
+		t.Fatalf("issuing nonce: status %d, nonce %q", code, nonce.Nonce)
+	}
+
+	return nonce.Nonce
+}
+
+func TestOIDCLogin(t *testing.T) {
+	s, store, provider := newSSOService(t)
+	nonce := issueNonce(t, s)
+
+	idToken, err := provider.IDToken(nonce, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var session model.StaffSession
+	if code := post(t, s, "/auth/oidc", model.OIDCLoginRequest{IDToken: idToken, Nonce: nonce}, &session); code != http.StatusOK {
+		t.Fatalf("login: status %d", code)
+	}
+
+	if session.Token == "" || session.User.Username != "ada" || session.User.Role != model.RoleLibrarian {
+		t.Errorf("login: got token %q for %q as %q, want a token for ada as librarian", session.Token, session.User.Username, session.User.Role)
+	}
+
+	if store.sessions != 1 {
+		t.Errorf("login opened %d sessions, want 1", store.sessions)
+	}
+
+	// the nonce was consumed, the same token does not log in again
+	var problem model.Problem
+	if code := post(t, s, "/auth/oidc", model.OIDCLoginRequest{IDToken: idToken, Nonce: nonce}, &problem); code != http.StatusUnauthorized || problem.Code != "invalid_token" {
+		t.Errorf("replayed login: got %d %q, want 401 invalid_token", code, problem.Code)
+	}
+}
+
+func TestOIDCLoginRejectsToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		token func(t *testing.T, provider *mockoidc.Provider, nonce string) (string, error)
+		nonce func(issued string) string
+	}{
+		{
+			name: "wrong audience",
+			token: func(t *testing.T, provider *mockoidc.Provider, nonce string) (string, error) {
+				provider.ClientID = "other"
+				defer func() { provider.ClientID = testClientID }()
+
+				return provider.IDToken(nonce, time.Now().Add(time.Hour))
+			},
+		},
+		{
+			name: "expired token",
+			token: func(t *testing.T, provider *mockoidc.Provider, nonce string) (string, error) {
+				return provider.IDToken(nonce, time.Now().Add(-time.Hour))
+			},
+		},
+		{
+			name: "unknown key",
+			token: func(t *testing.T, provider *mockoidc.Provider, nonce string) (string, error) {
+				other, err := mockoidc.New(provider.Issuer, provider.ClientID, provider.User)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				other.KeyID = "other"
+
+				return other.IDToken(nonce, time.Now().Add(time.Hour))
+			},
+		},
+		{
+			name: "nonce mismatch",
+			token: func(t *testing.T, provider *mockoidc.Provider, _ string) (string, error) {
+				return provider.IDToken("another login", time.Now().Add(time.Hour))
+			},
+		},
+		{
+			name: "nonce not issued",
+			token: func(t *testing.T, provider *mockoidc.Provider, _ string) (string, error) {
+				return provider.IDToken("made up", time.Now().Add(time.Hour))
+			},
+			nonce: func(string) string { return "made up" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, store, provider := newSSOService(t)
+			nonce := issueNonce(t, s)
+
+			idToken, err := tt.token(t, provider, nonce)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.nonce != nil {
+				nonce = tt.nonce(nonce)
+			}
+
+			var problem model.Problem
+			if code := post(t, s, "/auth/oidc", model.OIDCLoginRequest{IDToken: idToken, Nonce: nonce}, &problem); code != http.StatusUnauthorized || problem.Code != "invalid_token" {
+				t.Errorf("got %d %q, want 401 invalid_token", code, problem.Code)
+			}
+
+			if store.sessions != 0 || len(store.users) != 0 {
+				t.Errorf("rejected token opened %d sessions for %d users", store.sessions, len(store.users))
+			}
+		})
+	}
+}
+
+func TestReadJSONRefusesLargeBody(t *testing.T) {
+	s, _, _ := newSSOService(t)
+
+	var problem model.Problem
+	if code := post(t, s, "/auth/oidc", model.OIDCLoginRequest{IDToken: strings.Repeat("x", maxBodyBytes)}, &problem); code != http.StatusRequestEntityTooLarge || problem.Code != "body_too_large" {
+		t.Errorf("got %d %q, want 413 body_too_large", code, problem.Code)
+	}
+}
@@ -0,0 +1,585 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tliefheid/go-ils/internal/model"
+)
+
+// How an operation is authenticated, see the security schemes of the
+// OpenAPI document.
+const (
+	authPublic = ""
+	authStaff  = "staff"  // staff session only
+	authToken  = "token"  // staff session or API key
+	authPatron = "patron" // patron portal session
+)
+
+// openAPIVersion is the version of the API the document describes.
+const openAPIVersion = "1.0.0"
+
+// apiParam is a query parameter of an operation.
+type apiParam struct {
+	Name        string
+	Type        string // string, integer or boolean
+	Description string
+}
+
+// apiOperation documents a route. The OpenAPI document and the docs page are
+// generated from apiOperations; TestOpenAPIMatchesRoutes compares them with
+// the router, so a route cannot be added without documenting it.
+type apiOperation struct {
+	ID         string
+	Method     string
+	Path       string
+	Tag        string
+	Summary    string
+	Auth       string
+	Permission model.Permission
+	Query      []apiParam
+	// ETag documents the record version: the ETag header of the response
+	// and, for changes, the If-Match header.
+	ETag bool
+	// Request and Response are example values of the JSON bodies, nil for
+	// none. MediaType is the type of a response that is not JSON.
+	Request   any
+	Status    int
+	Response  any
+	MediaType string
+	// Problems lists the codes of problems the handler answers with,
+	// besides those every operation of its kind may answer with.
+	Problems []string
+}
+
+var (
+	circulationProblems = []string{"membership_expired", "member_blocked", "loan_limit_reached", "on_hold", "no_copies_available", "book_not_found"}
+	holdProblems        = []string{"membership_expired", "member_blocked", "book_not_found", "already_on_hold", "hold_limit_reached"}
+	auditQuery          = []apiParam{
+		{"actor", "string", `"staff:<username>", "apikey:<prefix>", "patron:<member id>", "sip2:<institution>" or "system"`},
+		{"action", "string", "Audit action"},
+		{"entity", "string", "Kind of record"},
+		{"entity_id", "string", "ID of the record"},
+		{"book_id", "integer", "Entries about the book, its loans and holds"},
+		{"member_id", "integer", "Entries about the member and their loans, cards, blocks, holds and fines"},
+		{"request_id", "string", "Entries written by one request"},
+		{"from", "string", "First day, YYYY-MM-DD"},
+		{"to", "string", "Last day, YYYY-MM-DD"},
+		{"offset", "integer", "Entries to skip"},
+		{"limit", "integer", "Entries per page, 100 when empty"},
+	}
+	historyQuery = []apiParam{{"offset", "integer", "Entries to skip"}, {"limit", "integer", "Entries per page, 100 when empty"}}
+	searchQuery  = []apiParam{{"q", "string", "Search terms"}}
+)
+
+// apiOperations lists every route of the backend in the order of the docs.
+var apiOperations = []apiOperation{
+	{ID: "health", Method: "GET", Path: "/health", Tag: "Service", Summary: "Report the backend is up, same as /health/live", MediaType: "text/plain"},
+	{ID: "live", Method: "GET", Path: "/health/live", Tag: "Service", Summary: "Liveness probe: report the backend process answers", MediaType: "text/plain"},
+	{ID: "ready", Method: "GET", Path: "/health/ready", Tag: "Service", Summary: "Readiness probe: check the database and migrations, 503 when a component is down or the backend shuts down", Response: model.Readiness{}},
+	{ID: "metrics", Method: "GET", Path: "/metrics", Tag: "Service", Summary: "Prometheus metrics", MediaType: "text/plain"},
+	{ID: "openAPI", Method: "GET", Path: "/openapi.json", Tag: "Service", Summary: "This OpenAPI document", Response: map[string]any{}},
+	{ID: "docs", Method: "GET", Path: "/docs", Tag: "Service", Summary: "API documentation generated from the OpenAPI document", MediaType: "text/html"},
+	{ID: "listProblems", Method: "GET", Path: "/problems", Tag: "Service", Summary: "List the error codes", Response: []model.Problem{}},
+	{ID: "getProblem", Method: "GET", Path: "/problems/{code}", Tag: "Service", Summary: "Describe an error code", Response: model.Problem{}, Problems: []string{"not_found"}},
+	{ID: "sru", Method: "GET", Path: "/sru", Tag: "Service", Summary: "SRU 1.2/2.0 catalogue search, explain and scan", MediaType: "application/xml", Query: []apiParam{
+		{"operation", "string", "explain, searchRetrieve or scan"},
+		{"version", "string", "1.2 or 2.0"},
+		{"query", "string", "CQL query"},
+		{"startRecord", "integer", "First record, from 1"},
+		{"maximumRecords", "integer", "Records per response"},
+		{"recordSchema", "string", "dc or marcxml"},
+		{"recordPacking", "string", "xml or string"},
+		{"recordXMLEscaping", "string", "xml or string"},
+		{"scanClause", "string", "Index and term to scan from"},
+		{"maximumTerms", "integer", "Terms per scan response"},
+	}},
+
+	{ID: "staffLogin", Method: "POST", Path: "/auth/login", Tag: "Authentication", Summary: "Log a staff user in", Request: model.StaffLoginRequest{}, Response: model.StaffSession{}, Problems: []string{"invalid_credentials", "too_many_attempts"}},
+	{ID: "oidcNonce", Method: "POST", Path: "/auth/oidc/nonce", Tag: "Authentication", Summary: "Issue the nonce to start a single sign-on with", Response: model.OIDCNonce{}, Problems: []string{"sso_disabled"}},
+	{ID: "oidcLogin", Method: "POST", Path: "/auth/oidc", Tag: "Authentication", Summary: "Log a staff user in with a single sign-on ID token", Request: model.OIDCLoginRequest{}, Response: model.StaffSession{}, Problems: []string{"sso_disabled", "invalid_token", "disabled", "no_role", "upstream_error"}},
+	{ID: "staffLogout", Method: "POST", Path: "/auth/logout", Tag: "Authentication", Summary: "End the staff session", Auth: authStaff, Status: http.StatusNoContent},
+	{ID: "staffMe", Method: "GET", Path: "/auth/me", Tag: "Authentication", Summary: "The logged in staff user", Auth: authStaff, Response: model.StaffUser{}},
+	{ID: "changeOwnPassword", Method: "PUT", Path: "/auth/password", Tag: "Authentication", Summary: "Change the own password", Auth: authStaff, Request: model.PasswordRequest{}, Status: http.StatusNoContent, Problems: []string{"validation_failed", "sso_account"}},
+
+	{ID: "listStaff", Method: "GET", Path: "/staff", Tag: "Staff", Summary: "List staff users", Auth: authStaff, Permission: model.PermAdmin, Response: []model.StaffUser{}},
+	{ID: "addStaff", Method: "POST", Path: "/staff", Tag: "Staff", Summary: "Create a staff user", Auth: authStaff, Permission: model.PermAdmin, Request: model.StaffUserRequest{}, Status: http.StatusCreated, Response: model.StaffUser{}, Problems: []string{"validation_failed", "duplicate"}},
+	{ID: "editStaff", Method: "PUT", Path: "/staff/{id}", Tag: "Staff", Summary: "Change a staff user", Auth: authStaff, Permission: model.PermAdmin, Request: model.StaffUserRequest{}, Response: model.StaffUser{}, Problems: []string{"not_found", "validation_failed", "own_account", "duplicate"}},
+	{ID: "resetStaffPassword", Method: "PUT", Path: "/staff/{id}/password", Tag: "Staff", Summary: "Set the password of a staff user", Auth: authStaff, Permission: model.PermAdmin, Request: model.PasswordRequest{}, Status: http.StatusNoContent, Problems: []string{"not_found", "validation_failed", "sso_account"}},
+
+	{ID: "listAPIKeys", Method: "GET", Path: "/apikeys", Tag: "API keys", Summary: "List API keys", Auth: authStaff, Permission: model.PermAdmin, Response: []model.APIKey{}},
+	{ID: "addAPIKey", Method: "POST", Path: "/apikeys", Tag: "API keys", Summary: "Create an API key, the only time the key is shown", Auth: authStaff, Permission: model.PermAdmin, Request: model.APIKeyRequest{}, Status: http.StatusCreated, Response: model.NewAPIKey{}, Problems: []string{"validation_failed"}},
+	{ID: "revokeAPIKey", Method: "POST", Path: "/apikeys/{id}/revoke", Tag: "API keys", Summary: "Revoke an API key", Auth: authStaff, Permission: model.PermAdmin, Status: http.StatusNoContent, Problems: []string{"not_found"}},
+	{ID: "rotateAPIKey", Method: "POST", Path: "/apikeys/{id}/rotate", Tag: "API keys", Summary: "Replace the secret of an API key", Auth: authStaff, Permission: model.PermAdmin, Response: model.NewAPIKey{}, Problems: []string{"not_found"}},
+
+	{ID: "isbnInfo", Method: "GET", Path: "/isbn/{isbn}", Tag: "Books", Summary: "Look up book data by ISBN at Open Library", Auth: authToken, Permission: model.PermCatalogRead, Response: model.Book{}, Problems: []string{"bad_request", "upstream_error"}},
+	{ID: "listBooks", Method: "GET", Path: "/books", Tag: "Books", Summary: "List books", Auth: authToken, Permission: model.PermCatalogRead, Response: []model.Book{}},
+	{ID: "searchBooks", Method: "GET", Path: "/books/search", Tag: "Books", Summary: "Search books by title, author or ISBN", Auth: authToken, Permission: model.PermCatalogRead, Query: searchQuery, Response: []model.Book{}, Problems: []string{"bad_request"}},
+	{ID: "addBook", Method: "POST", Path: "/books", Tag: "Books", Summary: "Add a book", Auth: authToken, Permission: model.PermCatalogWrite, Request: model.Book{}, Response: model.Book{}, Problems: []string{"validation_failed", "duplicate"}},
+	{ID: "getBookByISBN", Method: "GET", Path: "/books/isbn/{isbn}", Tag: "Books", Summary: "Find the book with an ISBN", Auth: authToken, Permission: model.PermCatalogRead, Response: model.Book{}, Problems: []string{"bad_request", "book_not_found"}},
+	{ID: "listDeletedBooks", Method: "GET", Path: "/books/deleted", Tag: "Books", Summary: "List deleted books that can be restored", Auth: authToken, Permission: model.PermCatalogWrite, Response: []model.Book{}},
+	{ID: "getBook", Method: "GET", Path: "/books/{id}", Tag: "Books", Summary: "Get a book", Auth: authToken, Permission: model.PermCatalogRead, ETag: true, Response: model.Book{}, Problems: []string{"not_found"}},
+	{ID: "bookHistory", Method: "GET", Path: "/books/{id}/history", Tag: "Books", Summary: "Audit entries of a book, its loans and holds", Auth: authToken, Permission: model.PermCatalogRead, Query: historyQuery, Response: model.AuditPage{}, Problems: []string{"validation_failed"}},
+	{ID: "editBook", Method: "PUT", Path: "/books/{id}", Tag: "Books", Summary: "Change a book", Auth: authToken, Permission: model.PermCatalogWrite, ETag: true, Request: model.Book{}, Status: http.StatusNoContent, Problems: []string{"not_found", "validation_failed", "version_conflict", "duplicate"}},
+	{ID: "deleteBook", Method: "DELETE", Path: "/books/{id}", Tag: "Books", Summary: "Delete a book, it stays restorable", Auth: authToken, Permission: model.PermCatalogWrite, ETag: true, Status: http.StatusNoContent, Problems: []string{"not_found", "open_loans", "version_conflict"}},
+	{ID: "restoreBook", Method: "POST", Path: "/books/{id}/restore", Tag: "Books", Summary: "Restore a deleted book", Auth: authToken, Permission: model.PermCatalogWrite, Status: http.StatusNoContent, Problems: []string{"not_found"}},
+
+	{ID: "listMembers", Method: "GET", Path: "/members", Tag: "Members", Summary: "List members", Auth: authToken, Permission: model.PermMembersRead, Response: []model.Member{}},
+	{ID: "searchMembers", Method: "GET", Path: "/members/search", Tag: "Members", Summary: "Search members by name, email or card number", Auth: authToken, Permission: model.PermMembersRead, Query: searchQuery, Response: []model.Member{}, Problems: []string{"bad_request"}},
+	{ID: "listDeletedMembers", Method: "GET", Path: "/members/deleted", Tag: "Members", Summary: "List deleted members that can be restored", Auth: authToken, Permission: model.PermMembersWrite, Response: []model.Member{}},
+	{ID: "addMember", Method: "POST", Path: "/members", Tag: "Members", Summary: "Add a member", Auth: authToken, Permission: model.PermMembersWrite, Request: model.Member{}, Response: model.Member{}, Problems: []string{"validation_failed"}},
+	{ID: "getMember", Method: "GET", Path: "/members/{id}", Tag: "Members", Summary: "Get a member", Auth: authToken, Permission: model.PermMembersRead, ETag: true, Response: model.Member{}, Problems: []string{"not_found"}},
+	{ID: "memberHistory", Method: "GET", Path: "/members/{id}/history", Tag: "Members", Summary: "Audit entries of a member and their loans, cards, blocks, holds and fines", Auth: authToken, Permission: model.PermMembersRead, Query: historyQuery, Response: model.AuditPage{}, Problems: []string{"validation_failed"}},
+	{ID: "editMember", Method: "PUT", Path: "/members/{id}", Tag: "Members", Summary: "Change a member", Auth: authToken, Permission: model.PermMembersWrite, ETag: true, Request: model.Member{}, Status: http.StatusNoContent, Problems: []string{"not_found", "validation_failed", "version_conflict"}},
+	{ID: "deleteMember", Method: "DELETE", Path: "/members/{id}", Tag: "Members", Summary: "Delete a member, they stay restorable until archived", Auth: authToken, Permission: model.PermMembersWrite, ETag: true, Status: http.StatusNoContent, Problems: []string{"not_found", "open_loans", "version_conflict"}},
+	{ID: "restoreMember", Method: "POST", Path: "/members/{id}/restore", Tag: "Members", Summary: "Restore a deleted member", Auth: authToken, Permission: model.PermMembersWrite, Status: http.StatusNoContent, Problems: []string{"not_found"}},
+	{ID: "exportMember", Method: "GET", Path: "/members/{id}/export", Tag: "Members", Summary: "Export everything stored about a member as a zip of JSON and CSV files", Auth: authToken, Permission: model.PermMembersWrite, MediaType: "application/zip", Problems: []string{"not_found"}},
+	{ID: "eraseMember", Method: "POST", Path: "/members/{id}/erase", Tag: "Members", Summary: "Erase the personal data of a member", Auth: authToken, Permission: model.PermAdmin, Request: model.ErasureRequest{}, Response: model.ErasureRecord{}, Problems: []string{"not_found", "open_loans", "unpaid_fines"}},
+	{ID: "renewMembership", Method: "POST", Path: "/members/{id}/membership/renew", Tag: "Members", Summary: "Renew the membership for a term of the member's category", Auth: authToken, Permission: model.PermMembersWrite, Response: model.Member{}, Problems: []string{"not_found"}},
+	{ID: "setPIN", Method: "PUT", Path: "/members/{id}/pin", Tag: "Members", Summary: "Set the PIN the member logs in to the patron portal with", Auth: authToken, Permission: model.PermMembersWrite, Request: model.SetPINRequest{}, Status: http.StatusNoContent, Problems: []string{"not_found", "validation_failed"}},
+	{ID: "listErasures", Method: "GET", Path: "/erasures", Tag: "Members", Summary: "List the erasure records", Auth: authToken, Permission: model.PermAdmin, Response: []model.ErasureRecord{}},
+
+	{ID: "listMemberCards", Method: "GET", Path: "/members/{id}/cards", Tag: "Cards", Summary: "List the cards of a member", Auth: authToken, Permission: model.PermMembersRead, Response: []model.Card{}},
+	{ID: "issueCard", Method: "POST", Path: "/members/{id}/cards", Tag: "Cards", Summary: "Issue a new card to a member, retiring the active one", Auth: authToken, Permission: model.PermMembersWrite, Request: model.IssueCardRequest{}, Status: http.StatusCreated, Response: model.Card{}, Problems: []string{"not_found", "validation_failed"}},
+	{ID: "getCard", Method: "GET", Path: "/cards/{number}", Tag: "Cards", Summary: "Get a card by number", Auth: authToken, Permission: model.PermMembersRead, Response: model.Card{}, Problems: []string{"not_found"}},
+	{ID: "replaceCard", Method: "POST", Path: "/cards/{number}/replace", Tag: "Cards", Summary: "Retire a lost or damaged card and issue a replacement", Auth: authToken, Permission: model.PermMembersWrite, Request: model.ReplaceCardRequest{}, Status: http.StatusCreated, Response: model.Card{}, Problems: []string{"not_found", "card_not_active", "validation_failed"}},
+	{ID: "cardPDF", Method: "GET", Path: "/cards/{number}/pdf", Tag: "Cards", Summary: "Printable card with barcode", Auth: authToken, Permission: model.PermMembersRead, MediaType: "application/pdf", Problems: []string{"not_found"}},
+
+	{ID: "listCategories", Method: "GET", Path: "/categories", Tag: "Categories", Summary: "List membership categories", Auth: authToken, Permission: model.PermMembersRead, Response: []model.MembershipCategory{}},
+	{ID: "getCategory", Method: "GET", Path: "/categories/{code}", Tag: "Categories", Summary: "Get a membership category", Auth: authToken, Permission: model.PermMembersRead, Response: model.MembershipCategory{}, Problems: []string{"not_found"}},
+	{ID: "editCategory", Method: "PUT", Path: "/categories/{code}", Tag: "Categories", Summary: "Change the rules of a membership category", Auth: authToken, Permission: model.PermAdmin, Request: model.MembershipCategory{}, Status: http.StatusNoContent, Problems: []string{"not_found", "validation_failed"}},
+
+	{ID: "borrowBook", Method: "POST", Path: "/borrow", Tag: "Circulation", Summary: "Lend a book to a member, by member ID or card number", Auth: authToken, Permission: model.PermCirculation, Request: model.BorrowRequest{}, Status: http.StatusNoContent, Problems: append([]string{"not_found", "unknown_card", "card_not_usable"}, circulationProblems...)},
+	{ID: "listBorrowings", Method: "GET", Path: "/borrow", Tag: "Circulation", Summary: "List loans", Auth: authToken, Permission: model.PermMembersRead, Response: []model.BorrowingDetail{}},
+	{ID: "getBorrowing", Method: "GET", Path: "/borrow/{id}", Tag: "Circulation", Summary: "Get a loan", Auth: authToken, Permission: model.PermMembersRead, Response: model.BorrowingDetail{}, Problems: []string{"not_found"}},
+	{ID: "returnBook", Method: "POST", Path: "/returns/{id}", Tag: "Circulation", Summary: "Return a loan", Auth: authToken, Permission: model.PermCirculation, Status: http.StatusNoContent, Problems: []string{"not_found", "already_returned"}},
+	{ID: "listMemberBlocks", Method: "GET", Path: "/members/{id}/blocks", Tag: "Circulation", Summary: "List the blocks of a member", Auth: authToken, Permission: model.PermMembersRead, Response: []model.MemberBlock{}},
+	{ID: "addBlock", Method: "POST", Path: "/members/{id}/blocks", Tag: "Circulation", Summary: "Block a member from borrowing", Auth: authToken, Permission: model.PermMembersWrite, Request: model.BlockRequest{}, Status: http.StatusCreated, Response: model.MemberBlock{}, Problems: []string{"not_found", "validation_failed"}},
+	{ID: "liftBlock", Method: "POST", Path: "/members/{id}/blocks/{blockID}/lift", Tag: "Circulation", Summary: "Lift a block", Auth: authToken, Permission: model.PermMembersWrite, Status: http.StatusNoContent, Problems: []string{"not_found", "already_lifted"}},
+	{ID: "listMemberHolds", Method: "GET", Path: "/members/{id}/holds", Tag: "Circulation", Summary: "List the holds of a member", Auth: authToken, Permission: model.PermMembersRead, Response: []model.Hold{}},
+	{ID: "placeHold", Method: "POST", Path: "/members/{id}/holds", Tag: "Circulation", Summary: "Place a hold for a member", Auth: authToken, Permission: model.PermMembersWrite, Request: model.HoldRequest{}, Status: http.StatusCreated, Response: model.Hold{}, Problems: append([]string{"not_found"}, holdProblems...)},
+	{ID: "cancelHold", Method: "POST", Path: "/members/{id}/holds/{holdID}/cancel", Tag: "Circulation", Summary: "Cancel a hold", Auth: authToken, Permission: model.PermMembersWrite, Status: http.StatusNoContent, Problems: []string{"not_found", "hold_not_waiting"}},
+	{ID: "listMemberFines", Method: "GET", Path: "/members/{id}/fines", Tag: "Circulation", Summary: "List the fines of a member", Auth: authToken, Permission: model.PermMembersRead, Response: []model.Fine{}},
+	{ID: "payFine", Method: "POST", Path: "/members/{id}/fines/{fineID}/pay", Tag: "Circulation", Summary: "Record a fine as paid", Auth: authToken, Permission: model.PermCirculation, Status: http.StatusNoContent, Problems: []string{"not_found", "already_paid"}},
+
+	{ID: "borrowedReport", Method: "GET", Path: "/reports/borrowed", Tag: "Reports", Summary: "All loans with book and member", Auth: authToken, Permission: model.PermReports, Response: []model.BorrowingDetail{}},
+	{ID: "listAudit", Method: "GET", Path: "/audit", Tag: "Reports", Summary: "Browse the audit log", Auth: authToken, Permission: model.PermAdmin, Query: auditQuery, Response: model.AuditPage{}, Problems: []string{"validation_failed"}},
+	{ID: "runArchive", Method: "POST", Path: "/jobs/archive", Tag: "Reports", Summary: "Anonymize members deleted longer than the archive period", Auth: authToken, Permission: model.PermAdmin, Response: model.ArchiveResult{}, Problems: []string{"job_disabled"}},
+	{ID: "runRetention", Method: "POST", Path: "/jobs/retention", Tag: "Reports", Summary: "Unlink returned loans older than the retention period from their members", Auth: authToken, Permission: model.PermAdmin, Query: []apiParam{{"dry_run", "boolean", "Only report what would be anonymized"}}, Response: model.RetentionReport{}, Problems: []string{"bad_request", "job_disabled"}},
+
+	{ID: "patronLogin", Method: "POST", Path: "/patron/login", Tag: "Patron portal", Summary: "Log a member in with card number and PIN", Request: model.PatronLoginRequest{}, Response: model.PatronSession{}, Problems: []string{"invalid_credentials", "too_many_attempts"}},
+	{ID: "patronLogout", Method: "POST", Path: "/patron/logout", Tag: "Patron portal", Summary: "End the patron session", Auth: authPatron, Status: http.StatusNoContent},
+	{ID: "patronMe", Method: "GET", Path: "/patron/me", Tag: "Patron portal", Summary: "The logged in member", Auth: authPatron, Response: model.Member{}},
+	{ID: "patronContact", Method: "PUT", Path: "/patron/me/contact", Tag: "Patron portal", Summary: "Change the own contact details", Auth: authPatron, Request: model.ContactDetails{}, Response: model.Member{}, Problems: []string{"validation_failed", "version_conflict"}},
+	{ID: "patronLoans", Method: "GET", Path: "/patron/loans", Tag: "Patron portal", Summary: "List the own open loans", Auth: authPatron, Response: []model.BorrowingDetail{}},
+	{ID: "patronRenew", Method: "POST", Path: "/patron/loans/{loanID}/renew", Tag: "Patron portal", Summary: "Renew an own loan", Auth: authPatron, Response: model.Borrowing{}, Problems: []string{"not_found", "membership_expired", "member_blocked", "on_hold"}},
+	{ID: "patronHolds", Method: "GET", Path: "/patron/holds", Tag: "Patron portal", Summary: "List the own holds", Auth: authPatron, Response: []model.Hold{}},
+	{ID: "patronPlaceHold", Method: "POST", Path: "/patron/holds", Tag: "Patron portal", Summary: "Place a hold", Auth: authPatron, Request: model.HoldRequest{}, Status: http.StatusCreated, Response: model.Hold{}, Problems: holdProblems},
+	{ID: "patronCancelHold", Method: "POST", Path: "/patron/holds/{holdID}/cancel", Tag: "Patron portal", Summary: "Cancel an own hold", Auth: authPatron, Status: http.StatusNoContent, Problems: []string{"not_found", "hold_not_waiting"}},
+	{ID: "patronFines", Method: "GET", Path: "/patron/fines", Tag: "Patron portal", Summary: "List the own fines", Auth: authPatron, Response: []model.Fine{}},
+	{ID: "patronSearchBooks", Method: "GET", Path: "/patron/books", Tag: "Patron portal", Summary: "Search the catalogue", Auth: authPatron, Query: searchQuery, Response: []model.Book{}, Problems: []string{"bad_request"}},
+}
+
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// problems lists every code op may answer with: its own, those of its
+// authentication, parameters and body, and those of any request.
+func (op apiOperation) problems() []string {
+	codes := map[string]bool{"internal_error": true, "timeout": true}
+
+	for _, code := range op.Problems {
+		codes[code] = true
+	}
+
+	if op.Auth != authPublic {
+		codes["unauthorized"] = true
+	}
+
+	if op.Permission != "" {
+		codes["forbidden"] = true
+	}
+
+	if op.Request != nil {
+		codes["bad_request"] = true
+		codes["invalid_json"] = true
+		codes["body_too_large"] = true
+	}
+
+	for _, m := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+		if integerParam(m[1]) {
+			codes["bad_request"] = true
+		}
+	}
+
+	list := make([]string, 0, len(codes))
+	for code := range codes {
+		list = append(list, code)
+	}
+
+	sort.Strings(list)
+
+	return list
+}
+
+// integerParam reports whether the path parameter is a numeric ID.
+func integerParam(name string) bool {
+	return name == "id" || strings.HasSuffix(name, "ID")
+}
+
+func (op apiOperation) status() int {
+	if op.Status == 0 {
+		return http.StatusOK
+	}
+
+	return op.Status
+}
+
+// openAPISchemas builds the component schemas of the model types, named
+// after the Go types.
+type openAPISchemas map[string]any
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// enumValues lists the values of the model's string types.
+var enumValues = map[reflect.Type][]string{
+	reflect.TypeOf(model.CardStatus("")):  {string(model.CardActive), string(model.CardLost), string(model.CardReplaced), string(model.CardExpired)},
+	reflect.TypeOf(model.BlockKind("")):   {string(model.BlockManual), string(model.BlockAutomatic)},
+	reflect.TypeOf(model.HoldStatus("")):  {string(model.HoldWaiting), string(model.HoldFulfilled), string(model.HoldCancelled)},
+	reflect.TypeOf(model.StaffRole("")):   stringValues(model.StaffRoles),
+	reflect.TypeOf(model.APIKeyScope("")): stringValues(model.APIKeyScopes),
+	reflect.TypeOf(model.AuditAction("")): stringValues(model.AuditActions),
+	reflect.TypeOf(model.AuditEntity("")): stringValues(model.AuditEntities),
+}
+
+func stringValues[T ~string](values []T) []string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = string(v)
+	}
+
+	return s
+}
+
+// schema returns the JSON schema of t, a reference for named structs.
+func (c openAPISchemas) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawType:
+		return map[string]any{}
+	case enumValues[t] != nil:
+		return map[string]any{"type": "string", "enum": enumValues[t]}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if t.Name() == "" {
+			return c.object(t)
+		}
+
+		if _, ok := c[t.Name()]; !ok {
+			c[t.Name()] = nil // guards against recursion
+			c[t.Name()] = c.object(t)
+		}
+
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": c.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": c.schema(t.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	default:
+		return map[string]any{}
+	}
+}
+
+// object is the schema of a struct as encoding/json writes it; fields
+// without omitempty are required.
+func (c openAPISchemas) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+
+	c.fields(t, properties, &required)
+
+	o := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		o["required"] = required
+	}
+
+	return o
+}
+
+func (c openAPISchemas) fields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			c.fields(f.Type, properties, required)
+			continue
+		}
+
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+
+		properties[name] = c.schema(f.Type)
+
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// openAPIDocument generates the OpenAPI 3.1 document of the backend.
+func openAPIDocument() map[string]any {
+	schemas := openAPISchemas{}
+	paths := map[string]map[string]any{}
+
+	problem := schemas.schema(reflect.TypeOf(model.Problem{}))
+	codes := make([]string, 0, len(problemTypes))
+
+	for code := range problemTypes {
+		codes = append(codes, code)
+	}
+
+	sort.Strings(codes)
+	schemas["Problem"].(map[string]any)["properties"].(map[string]any)["code"] = map[string]any{"type": "string", "enum": codes}
+
+	for _, op := range apiOperations {
+		if paths[op.Path] == nil {
+			paths[op.Path] = map[string]any{}
+		}
+
+		paths[op.Path][strings.ToLower(op.Method)] = op.document(schemas, problem)
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":       "Library ILS backend API",
+			"version":     openAPIVersion,
+			"description": "Every failed request answers with RFC 7807 problem details; GET /problems lists the error codes.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"staffSession":  map[string]any{"type": "http", "scheme": "bearer", "description": "Token of POST /auth/login or /auth/oidc"},
+				"apiKey":        map[string]any{"type": "http", "scheme": "bearer", "description": "API key created at POST /apikeys, limited to its scopes"},
+				"patronSession": map[string]any{"type": "http", "scheme": "bearer", "description": "Token of POST /patron/login"},
+			},
+		},
+	}
+}
+
+func (op apiOperation) document(schemas openAPISchemas, problem map[string]any) map[string]any {
+	d := map[string]any{
+		"operationId": op.ID,
+		"summary":     op.Summary,
+		"tags":        []string{op.Tag},
+	}
+
+	if op.Permission != "" {
+		d["description"] = fmt.Sprintf("Needs the %s permission.", op.Permission)
+	}
+
+	switch op.Auth {
+	case authStaff:
+		d["security"] = []map[string][]string{{"staffSession": {}}}
+	case authToken:
+		d["security"] = []map[string][]string{{"staffSession": {}}, {"apiKey": {}}}
+	case authPatron:
+		d["security"] = []map[string][]string{{"patronSession": {}}}
+	default:
+		d["security"] = []map[string][]string{}
+	}
+
+	params := []map[string]any{}
+
+	for _, m := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+		typ := "string"
+		if integerParam(m[1]) {
+			typ = "integer"
+		}
+
+		params = append(params, map[string]any{"name": m[1], "in": "path", "required": true, "schema": map[string]any{"type": typ}})
+	}
+
+	for _, q := range op.Query {
+		params = append(params, map[string]any{"name": q.Name, "in": "query", "description": q.Description, "schema": map[string]any{"type": q.Type}})
+	}
+
+	if op.ETag && op.Method != http.MethodGet {
+		params = append(params, map[string]any{
+			"name": "If-Match", "in": "header",
+			"description": "ETag of the version the change is based on; 412 version_conflict when the record changed since",
+			"schema":      map[string]any{"type": "string"},
+		})
+	}
+
+	if len(params) > 0 {
+		d["parameters"] = params
+	}
+
+	if op.Request != nil {
+		d["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": schemas.schema(reflect.TypeOf(op.Request))}},
+		}
+	}
+
+	success := map[string]any{"description": http.StatusText(op.status())}
+
+	switch {
+	case op.Response != nil:
+		success["content"] = map[string]any{"application/json": map[string]any{"schema": schemas.schema(reflect.TypeOf(op.Response))}}
+	case op.MediaType != "":
+		success["content"] = map[string]any{op.MediaType: map[string]any{"schema": map[string]any{"type": "string"}}}
+	}
+
+	if op.ETag {
+		success["headers"] = map[string]any{"ETag": map[string]any{"description": "Version of the record", "schema": map[string]any{"type": "string"}}}
+	}
+
+	responses := map[string]any{strconv.Itoa(op.status()): success}
+
+	byStatus := map[int][]string{}
+	for _, code := range op.problems() {
+		status := problemTypes[code].Status
+		byStatus[status] = append(byStatus[status], code)
+	}
+
+	for status, codes := range byStatus {
+		responses[strconv.Itoa(status)] = map[string]any{
+			"description": http.StatusText(status) + ": " + strings.Join(codes, ", "),
+			"content":     map[string]any{model.ProblemContentType: map[string]any{"schema": problem}},
+		}
+	}
+
+	d["responses"] = responses
+
+	return d
+}
+
+func (s *Service) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, openAPIDocument())
+}
+
+// docsTag groups the operations of a tag on the docs page.
+type docsTag struct {
+	Name       string
+	Operations []docsOperation
+}
+
+type docsOperation struct {
+	apiOperation
+	Codes        []string
+	RequestType  string
+	ResponseType string
+}
+
+func typeName(v any) string {
+	if v == nil {
+		return ""
+	}
+
+	return strings.TrimPrefix(reflect.TypeOf(v).String(), "model.")
+}
+
+var docsTemplate = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Library ILS backend API</title>
+<style>
+body { font-family: sans-serif; max-width: 70em; margin: 2em auto; padding: 0 1em; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { text-align: left; vertical-align: top; padding: .3em .5em; border-bottom: 1px solid #ddd; }
+code { font-size: .95em; }
+.method { font-weight: bold; }
+small { color: #555; }
+</style>
+</head>
+<body>
+<h1>Library ILS backend API</h1>
+<p>The machine readable description is the <a href="/openapi.json">OpenAPI 3.1 document</a>.
+Send the token of a staff session or an API key as <code>Authorization: Bearer</code>.
+Errors are <code>application/problem+json</code>, the codes are described at <a href="/problems">/problems</a>.</p>
+{{range .}}
+<h2>{{.Name}}</h2>
+<table>
+<tr><th>Operation</th><th>Summary</th><th>Body</th><th>Response</th><th>Errors</th></tr>
+{{range .Operations}}
+<tr>
+<td><span class="method">{{.Method}}</span> <code>{{.Path}}</code><br><small>{{.ID}}</small></td>
+<td>{{.Summary}}{{if .Permission}}<br><small>needs {{.Permission}}</small>{{else if eq .Auth ""}}<br><small>public</small>{{end}}{{if .ETag}}<br><small>ETag / If-Match</small>{{end}}</td>
+<td>{{with .RequestType}}<code>{{.}}</code>{{end}}</td>
+<td>{{.Status}}{{with .ResponseType}} <code>{{.}}</code>{{end}}{{with .MediaType}} <code>{{.}}</code>{{end}}</td>
+<td>{{range .Codes}}<a href="/problems/{{.}}"><code>{{.}}</code></a> {{end}}</td>
+</tr>
+{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
+
+// docsHandler renders the operations as a page for people.
+func (s *Service) docsHandler(w http.ResponseWriter, r *http.Request) {
+	var tags []docsTag
+
+	index := map[string]int{}
+
+	for _, op := range apiOperations {
+		i, ok := index[op.Tag]
+		if !ok {
+			i = len(tags)
+			index[op.Tag] = i
+			tags = append(tags, docsTag{Name: op.Tag})
+		}
+
+		op.Status = op.status()
+		tags[i].Operations = append(tags[i].Operations, docsOperation{
+			apiOperation: op,
+			Codes:        op.problems(),
+			RequestType:  typeName(op.Request),
+			ResponseType: typeName(op.Response),
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := docsTemplate.Execute(w, tags); err != nil {
+		slog.ErrorContext(r.Context(), "rendering API docs failed", "err", err)
+	}
+}
@@ -0,0 +1,672 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tliefheid/go-ils/internal/card"
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/password"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+const (
+	apiStaffToken    = "staff-token"
+	apiPatronToken   = "patron-token"
+	apiStaffPassword = "correct horse battery"
+	apiPatronPIN     = "4711"
+)
+
+// apiStore is a library of one book, one member with a card, a loan, a
+// hold, a fine and a block, and an admin session. Changes succeed without
+// being kept, so every documented operation can be sent a request.
+type apiStore struct {
+	book      model.Book
+	member    model.Member
+	loan      model.BorrowingDetail
+	card      model.Card
+	category  model.MembershipCategory
+	hold      model.Hold
+	fine      model.Fine
+	block     model.MemberBlock
+	admin     model.StaffUser
+	key       model.APIKey
+	staffHash string
+	pinHash   string
+}
+
+func newAPIStore(t *testing.T) *apiStore {
+	t.Helper()
+
+	number, err := card.DefaultFormat.Generate(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	staffHash, err := password.Hash(apiStaffPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pinHash, err := password.Hash(apiPatronPIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	due := now.AddDate(0, 0, 14)
+
+	return &apiStore{
+		book: model.Book{ID: 1, Title: "The C Programming Language", Author: "Kernighan and Ritchie", ISBN: "9780131103627",
+			PublicationYear: 1978, CopiesTotal: 2, CopiesAvailable: 1, Version: 1},
+		member: model.Member{ID: 1, Name: "Ada Lovelace", GivenName: "Ada", FamilyName: "Lovelace", Email: "ada@example.org",
+			CardNumber: number, Category: "adult", MembershipExpires: now.AddDate(1, 0, 0).Format(model.DateLayout), Version: 1},
+		loan: model.BorrowingDetail{ID: 1, BookID: 1, BookTitle: "The C Programming Language", MemberID: 1, MemberName: "Ada Lovelace",
+			IssueDate: now, DueDate: &due},
+		card:     model.Card{ID: 1, MemberID: 1, Number: number, Status: model.CardActive, IssuedAt: now},
+		category: model.MembershipCategory{Code: "adult", Name: "Adult", MaxLoans: 5, MaxHolds: 5, LoanPeriodDays: 14, MembershipMonths: 12},
+		hold:     model.Hold{ID: 1, BookID: 1, BookTitle: "The C Programming Language", MemberID: 1, Status: model.HoldWaiting, CreatedAt: now},
+		fine:     model.Fine{ID: 1, MemberID: 1, AmountCents: 150, Reason: "overdue", CreatedAt: now},
+		block:    model.MemberBlock{ID: 1, MemberID: 1, Kind: model.BlockManual, Reason: "lost book", CreatedBy: "staff:admin", CreatedAt: now},
+		admin:    model.StaffUser{ID: 99, Username: "admin", Name: "Administrator", Role: model.RoleAdmin, CreatedAt: now},
+		key: model.APIKey{ID: 1, Name: "catalogue sync", Prefix: apiKeyPrefix + "abcdef", Scopes: []model.APIKeyScope{model.ScopeCatalogRead},
+			CreatedBy: "staff:admin", CreatedAt: now},
+		staffHash: staffHash,
+		pinHash:   pinHash,
+	}
+}
+
+func (st *apiStore) Migrate(context.Context) error                   { return nil }
+func (st *apiStore) MigrationsApplied(context.Context) (bool, error) { return true, nil }
+func (st *apiStore) Ping(context.Context) error                      { return nil }
+func (st *apiStore) Stats() sql.DBStats                              { return sql.DBStats{} }
+func (st *apiStore) Close() error                                    { return nil }
+
+func (st *apiStore) ListBooks(context.Context) ([]model.Book, error) {
+	return []model.Book{st.book}, nil
+}
+
+func (st *apiStore) SearchBookByISBN(_ context.Context, isbn string) (*model.Book, error) {
+	if isbn != st.book.ISBN {
+		return nil, repository.ErrNotFound
+	}
+
+	b := st.book
+
+	return &b, nil
+}
+
+func (st *apiStore) SearchBooks(context.Context, string) ([]model.Book, error) {
+	return []model.Book{st.book}, nil
+}
+
+func (st *apiStore) QueryBooks(context.Context, *repository.BookQuery, int, int) ([]model.Book, int, error) {
+	return []model.Book{st.book}, 1, nil
+}
+
+func (st *apiStore) ScanBooks(context.Context, repository.BookField, string, int) ([]repository.ScanTerm, error) {
+	return nil, nil
+}
+
+func (st *apiStore) AddBook(context.Context, model.Book) (int, error) { return 2, nil }
+
+func (st *apiStore) GetBook(_ context.Context, id int) (*model.Book, error) {
+	if id != st.book.ID {
+		return nil, repository.ErrNotFound
+	}
+
+	b := st.book
+
+	return &b, nil
+}
+
+func (st *apiStore) UpdateBook(context.Context, model.Book) error { return nil }
+func (st *apiStore) DeleteBook(context.Context, int, int) error   { return nil }
+func (st *apiStore) RestoreBook(context.Context, int) error       { return nil }
+func (st *apiStore) ListDeletedBooks(context.Context) ([]model.Book, error) {
+	b, deleted := st.book, time.Now()
+	b.DeletedAt = &deleted
+
+	return []model.Book{b}, nil
+}
+
+func (st *apiStore) ListMemberss(context.Context) ([]model.Member, error) {
+	return []model.Member{st.member}, nil
+}
+
+func (st *apiStore) SearchMembers(context.Context, string) ([]model.Member, error) {
+	return []model.Member{st.member}, nil
+}
+
+func (st *apiStore) AddMember(context.Context, model.Member) (int, error) { return 1, nil }
+
+func (st *apiStore) GetMember(_ context.Context, id int) (*model.Member, error) {
+	if id != st.member.ID {
+		return nil, repository.ErrNotFound
+	}
+
+	m := st.member
+
+	return &m, nil
+}
+
+func (st *apiStore) UpdateMember(context.Context, model.Member) error { return nil }
+func (st *apiStore) DeleteMember(context.Context, int, int) error     { return nil }
+func (st *apiStore) RestoreMember(context.Context, int) error         { return nil }
+
+func (st *apiStore) ListDeletedMembers(context.Context) ([]model.Member, error) {
+	m, deleted := st.member, time.Now()
+	m.DeletedAt = &deleted
+
+	return []model.Member{m}, nil
+}
+
+func (st *apiStore) AnonymizeDeletedMembers(context.Context, time.Time) (int, error) { return 0, nil }
+
+func (st *apiStore) EraseMember(_ context.Context, id int, requestedBy, reason string) (*model.ErasureRecord, error) {
+	return &model.ErasureRecord{ID: 1, MemberID: id, RequestedBy: requestedBy, Reason: reason, ErasedAt: time.Now()}, nil
+}
+
+func (st *apiStore) ListErasures(context.Context) ([]model.ErasureRecord, error) {
+	return []model.ErasureRecord{}, nil
+}
+
+func (st *apiStore) RenewMembership(context.Context, int, time.Time) error { return nil }
+
+func (st *apiStore) ListBorrowings(context.Context) ([]model.BorrowingDetail, error) {
+	return []model.BorrowingDetail{st.loan}, nil
+}
+
+func (st *apiStore) AddBorrowing(context.Context, model.Borrowing, int) (int, error) { return 2, nil }
+
+func (st *apiStore) GetBorrowing(_ context.Context, id int) (*model.BorrowingDetail, error) {
+	if id != st.loan.ID {
+		return nil, repository.ErrNotFound
+	}
+
+	l := st.loan
+
+	return &l, nil
+}
+
+func (st *apiStore) ListMemberBorrowings(context.Context, int) ([]model.BorrowingDetail, error) {
+	return []model.BorrowingDetail{st.loan}, nil
+}
+
+func (st *apiStore) ListMemberLoanHistory(context.Context, int) ([]model.BorrowingDetail, error) {
+	return []model.BorrowingDetail{st.loan}, nil
+}
+
+func (st *apiStore) FindOpenBorrowing(context.Context, int) (*model.BorrowingDetail, error) {
+	l := st.loan
+	return &l, nil
+}
+
+func (st *apiStore) ReturnBorrowing(context.Context, int) error                        { return nil }
+func (st *apiStore) RenewBorrowing(context.Context, int, model.Borrowing) (int, error) { return 2, nil }
+
+func (st *apiStore) CountOpenBorrowings(context.Context, time.Time) (int, int, error) {
+	return 1, 0, nil
+}
+
+func (st *apiStore) AnonymizeLoanHistory(_ context.Context, before time.Time, dryRun bool) (*model.RetentionReport, error) {
+	return &model.RetentionReport{DryRun: dryRun, ReturnedBefore: before}, nil
+}
+
+func (st *apiStore) NextCardSequence(context.Context) (int64, error) { return 2, nil }
+
+func (st *apiStore) AddCard(_ context.Context, c model.Card) (*model.Card, error) {
+	c.ID = 2
+	return &c, nil
+}
+
+func (st *apiStore) ListMemberCards(context.Context, int) ([]model.Card, error) {
+	return []model.Card{st.card}, nil
+}
+
+func (st *apiStore) GetCardByNumber(_ context.Context, number string) (*model.Card, error) {
+	if number != st.card.Number {
+		return nil, repository.ErrNotFound
+	}
+
+	c := st.card
+
+	return &c, nil
+}
+
+func (st *apiStore) ReplaceCard(_ context.Context, _ int, _ model.CardStatus, c model.Card) (*model.Card, error) {
+	c.ID = 2
+	return &c, nil
+}
+
+func (st *apiStore) ListCategories(context.Context) ([]model.MembershipCategory, error) {
+	return []model.MembershipCategory{st.category}, nil
+}
+
+func (st *apiStore) GetCategory(_ context.Context, code string) (*model.MembershipCategory, error) {
+	if code != st.category.Code {
+		return nil, repository.ErrNotFound
+	}
+
+	c := st.category
+
+	return &c, nil
+}
+
+func (st *apiStore) UpdateCategory(context.Context, model.MembershipCategory) error { return nil }
+
+func (st *apiStore) AddBlock(_ context.Context, b model.MemberBlock) (*model.MemberBlock, error) {
+	b.ID = 2
+	return &b, nil
+}
+
+// ListMemberBlocks reports no active block, so the member may borrow.
+func (st *apiStore) ListMemberBlocks(context.Context, int) ([]model.MemberBlock, error) {
+	return []model.MemberBlock{}, nil
+}
+
+func (st *apiStore) GetBlock(context.Context, int) (*model.MemberBlock, error) {
+	b := st.block
+	return &b, nil
+}
+
+func (st *apiStore) LiftBlock(context.Context, int, string) error { return nil }
+
+func (st *apiStore) SetMemberPIN(context.Context, int, string) error { return nil }
+
+func (st *apiStore) GetMemberPIN(context.Context, int) (string, error) { return st.pinHash, nil }
+
+func (st *apiStore) AddPatronSession(context.Context, string, int, time.Time) error { return nil }
+
+func (st *apiStore) GetPatronSession(_ context.Context, tokenHash string) (int, error) {
+	if tokenHash != password.HashToken(apiPatronToken) {
+		return 0, repository.ErrNotFound
+	}
+
+	return st.member.ID, nil
+}
+
+func (st *apiStore) DeletePatronSession(context.Context, string) error { return nil }
+
+func (st *apiStore) AddHold(_ context.Context, h model.Hold) (*model.Hold, error) {
+	h.ID = 2
+	return &h, nil
+}
+
+func (st *apiStore) GetHold(context.Context, int) (*model.Hold, error) {
+	h := st.hold
+	return &h, nil
+}
+
+func (st *apiStore) ListMemberHolds(context.Context, int) ([]model.Hold, error) {
+	return []model.Hold{st.hold}, nil
+}
+
+func (st *apiStore) CountWaitingHolds(context.Context, int, int) (int, error)      { return 0, nil }
+func (st *apiStore) CloseHold(context.Context, int, model.HoldStatus) error        { return nil }
+func (st *apiStore) FulfillHold(context.Context, int, int) error                   { return nil }
+func (st *apiStore) AddFine(context.Context, model.Fine) (int, error)              { return 2, nil }
+func (st *apiStore) PayFine(context.Context, int) error                            { return nil }
+func (st *apiStore) AddAuditEntry(context.Context, model.AuditEntry) error         { return nil }
+func (st *apiStore) AddOIDCNonce(context.Context, string, time.Time) error         { return nil }
+func (st *apiStore) ConsumeOIDCNonce(context.Context, string) error                { return repository.ErrNotFound }
+func (st *apiStore) AddStaffSession(context.Context, string, int, time.Time) error { return nil }
+func (st *apiStore) DeleteStaffSession(context.Context, string) error              { return nil }
+func (st *apiStore) SetStaffPassword(context.Context, int, string) error           { return nil }
+func (st *apiStore) UpdateStaffUser(context.Context, model.StaffUser) error        { return nil }
+func (st *apiStore) CountStaffUsers(context.Context) (int, error)                  { return 2, nil }
+func (st *apiStore) RevokeAPIKey(context.Context, int) error                       { return nil }
+
+func (st *apiStore) GetFine(context.Context, int) (*model.Fine, error) {
+	f := st.fine
+	return &f, nil
+}
+
+func (st *apiStore) ListMemberFines(context.Context, int) ([]model.Fine, error) {
+	return []model.Fine{st.fine}, nil
+}
+
+func (st *apiStore) AddStaffUser(_ context.Context, u model.StaffUser, _ string) (*model.StaffUser, error) {
+	u.ID, u.CreatedAt = 2, time.Now()
+	return &u, nil
+}
+
+// GetStaffUser returns a librarian for any id but the admin's.
+func (st *apiStore) GetStaffUser(_ context.Context, id int) (*model.StaffUser, error) {
+	if id == st.admin.ID {
+		u := st.admin
+		return &u, nil
+	}
+
+	return &model.StaffUser{ID: id, Username: "librarian", Name: "Librarian", Role: model.RoleLibrarian, CreatedAt: st.admin.CreatedAt}, nil
+}
+
+func (st *apiStore) GetStaffLogin(_ context.Context, username string) (*model.StaffUser, string, error) {
+	if username != st.admin.Username {
+		return nil, "", repository.ErrNotFound
+	}
+
+	u := st.admin
+
+	return &u, st.staffHash, nil
+}
+
+func (st *apiStore) ListStaffUsers(context.Context) ([]model.StaffUser, error) {
+	return []model.StaffUser{st.admin}, nil
+}
+
+func (st *apiStore) GetStaffSession(_ context.Context, tokenHash string) (*model.StaffUser, error) {
+	if tokenHash != password.HashToken(apiStaffToken) {
+		return nil, repository.ErrNotFound
+	}
+
+	u := st.admin
+
+	return &u, nil
+}
+
+func (st *apiStore) ProvisionStaffUser(context.Context, model.StaffUser, string) (*model.StaffUser, error) {
+	return nil, repository.ErrNotFound
+}
+
+func (st *apiStore) AddAPIKey(_ context.Context, k model.APIKey, _ string) (*model.APIKey, error) {
+	k.ID, k.CreatedAt = 2, time.Now()
+	return &k, nil
+}
+
+func (st *apiStore) GetAPIKey(context.Context, int) (*model.APIKey, error) {
+	k := st.key
+	return &k, nil
+}
+
+func (st *apiStore) ListAPIKeys(context.Context) ([]model.APIKey, error) {
+	return []model.APIKey{st.key}, nil
+}
+
+func (st *apiStore) UseAPIKey(context.Context, string) (*model.APIKey, error) {
+	return nil, repository.ErrNotFound
+}
+
+func (st *apiStore) RotateAPIKey(_ context.Context, _ int, prefix, _ string) (*model.APIKey, error) {
+	k := st.key
+	k.Prefix = prefix
+
+	return &k, nil
+}
+
+func (st *apiStore) ListAuditEntries(context.Context, repository.AuditFilter, int, int) ([]model.AuditEntry, int, error) {
+	return []model.AuditEntry{}, 0, nil
+}
+
+// openLibraryStub answers the Open Library lookups of the store's book.
+type openLibraryStub struct{}
+
+func (openLibraryStub) RoundTrip(r *http.Request) (*http.Response, error) {
+	body := `{"title": "The C Programming Language", "authors": [{"key": "/authors/OL1A"}], "publish_date": "1978"}`
+	if strings.HasPrefix(r.URL.Path, "/authors/") {
+		body = `{"name": "Brian W. Kernighan"}`
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    r,
+	}, nil
+}
+
+// apiRequestBodies are valid bodies of the operations that take one, so the
+// handlers get past validation.
+func apiRequestBodies(st *apiStore) map[string]any {
+	return map[string]any{
+		"staffLogin":         model.StaffLoginRequest{Username: st.admin.Username, Password: apiStaffPassword},
+		"oidcLogin":          model.OIDCLoginRequest{IDToken: "token", Nonce: "nonce"},
+		"changeOwnPassword":  model.PasswordRequest{Current: apiStaffPassword, Password: "a new long password"},
+		"addStaff":           model.StaffUserRequest{Username: "clerk", Name: "Clerk", Role: model.RoleVolunteer, Password: "a new long password"},
+		"editStaff":          model.StaffUserRequest{Username: "librarian", Name: "Librarian", Role: model.RoleLibrarian},
+		"resetStaffPassword": model.PasswordRequest{Password: "a new long password"},
+		"addAPIKey":          model.APIKeyRequest{Name: "sync", Scopes: []model.APIKeyScope{model.ScopeCatalogRead}},
+		"addBook":            model.Book{Title: "Structure and Interpretation of Computer Programs", Author: "Abelson and Sussman", ISBN: "9780262510875", PublicationYear: 1996, CopiesTotal: 1},
+		"editBook":           st.book,
+		"addMember":          model.Member{GivenName: "Grace", FamilyName: "Hopper", Email: "grace@example.org", Category: "adult"},
+		"editMember":         st.member,
+		"eraseMember":        model.ErasureRequest{Reason: "asked to be forgotten"},
+		"setPIN":             model.SetPINRequest{PIN: "8642"},
+		"issueCard":          model.IssueCardRequest{},
+		"replaceCard":        model.ReplaceCardRequest{Reason: model.CardLost},
+		"editCategory":       st.category,
+		"borrowBook":         model.BorrowRequest{BookID: "1", MemberID: "1"},
+		"addBlock":           model.BlockRequest{Reason: "lost book"},
+		"placeHold":          model.HoldRequest{BookID: 1},
+		"patronLogin":        model.PatronLoginRequest{CardNumber: st.card.Number, PIN: apiPatronPIN},
+		"patronContact":      model.ContactDetails{Email: "ada@example.org"},
+		"patronPlaceHold":    model.HoldRequest{BookID: 1},
+	}
+}
+
+// schemaChecked lists the responses whose operations have to succeed
+// against the store, so their JSON is compared with the schema.
+var schemaChecked = []reflect.Type{
+	reflect.TypeOf(model.Book{}),
+	reflect.TypeOf(model.Member{}),
+	reflect.TypeOf(model.BorrowingDetail{}),
+}
+
+// TestOpenAPIMatchesRoutes compares the OpenAPI document with the router:
+// every route must be documented and every documented operation routed,
+// with known error codes, and operations documented as authenticated must
+// refuse a request without a token. Sent a request against a store, each
+// operation answers with a documented status, and the JSON of books,
+// members and loans matches their schemas.
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	store := newAPIStore(t)
+
+	s, err := New(Config{Repository: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	documented := map[string]apiOperation{}
+
+	for _, op := range apiOperations {
+		key := op.Method + " " + op.Path
+		if _, ok := documented[key]; ok {
+			t.Errorf("%s is documented twice", key)
+		}
+
+		documented[key] = op
+
+		for _, code := range op.Problems {
+			if _, ok := problemTypes[code]; !ok {
+				t.Errorf("%s documents unknown error code %q", key, code)
+			}
+		}
+	}
+
+	routed := map[string]bool{}
+
+	err = chi.Walk(s.mux, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		path := strings.TrimSuffix(route, "/")
+		if path == "" {
+			path = "/"
+		}
+
+		key := method + " " + path
+		routed[key] = true
+
+		if _, ok := documented[key]; !ok {
+			t.Errorf("%s is not documented", key)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := openLibraryClient
+	openLibraryClient = &http.Client{Transport: openLibraryStub{}}
+
+	t.Cleanup(func() { openLibraryClient = client })
+
+	bodies := apiRequestBodies(store)
+	params := map[string]string{"isbn": store.book.ISBN, "number": store.card.Number, "code": store.category.Code}
+	queries := url.Values{"q": {"lovelace"}}
+
+	for key, op := range documented {
+		if !routed[key] {
+			t.Errorf("%s is documented but not routed", key)
+			continue
+		}
+
+		path := pathParam.ReplaceAllStringFunc(op.Path, func(p string) string {
+			if v, ok := params[strings.Trim(p, "{}")]; ok {
+				return v
+			}
+
+			return "1"
+		})
+
+		query := url.Values{}
+
+		for _, q := range op.Query {
+			if v, ok := queries[q.Name]; ok {
+				query[q.Name] = v
+			}
+		}
+
+		if len(query) > 0 {
+			path += "?" + query.Encode()
+		}
+
+		if op.Auth != authPublic {
+			t.Run(fmt.Sprintf("%s without a token", key), func(t *testing.T) {
+				req := httptest.NewRequest(op.Method, path, nil)
+				rec := httptest.NewRecorder()
+				s.mux.ServeHTTP(rec, req)
+
+				if rec.Code != http.StatusUnauthorized {
+					t.Errorf("answers %d, documented as authenticated", rec.Code)
+				}
+			})
+		}
+
+		t.Run(key, func(t *testing.T) {
+			var body io.Reader
+
+			if op.Request != nil {
+				payload, err := json.Marshal(bodies[op.ID])
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				body = bytes.NewReader(payload)
+			}
+
+			req := httptest.NewRequest(op.Method, path, body)
+			req.Header.Set("Content-Type", "application/json")
+
+			switch op.Auth {
+			case authStaff, authToken:
+				req.Header.Set("Authorization", "Bearer "+apiStaffToken)
+			case authPatron:
+				req.Header.Set("Authorization", "Bearer "+apiPatronToken)
+			}
+
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, req)
+
+			checkAPIResponse(t, op, rec)
+		})
+	}
+}
+
+// checkAPIResponse fails unless rec is the documented success of op, or a
+// problem op documents.
+func checkAPIResponse(t *testing.T, op apiOperation, rec *httptest.ResponseRecorder) {
+	t.Helper()
+
+	var response reflect.Type
+	if op.Response != nil {
+		response = reflect.TypeOf(op.Response)
+	}
+
+	item := response
+	if item != nil && item.Kind() == reflect.Slice {
+		item = item.Elem()
+	}
+
+	if rec.Code != op.status() {
+		var problem model.Problem
+		if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("answers %d with %q, documented is %d", rec.Code, rec.Body, op.status())
+		}
+
+		if !slices.Contains(op.problems(), problem.Code) || problemTypes[problem.Code].Status != rec.Code {
+			t.Fatalf("answers %d %s (%s), not documented", rec.Code, problem.Code, problem.Detail)
+		}
+
+		if slices.Contains(schemaChecked, item) {
+			t.Fatalf("answers %d %s (%s), want %d", rec.Code, problem.Code, problem.Detail, op.status())
+		}
+
+		return
+	}
+
+	if !slices.Contains(schemaChecked, item) {
+		return
+	}
+
+	var objects []map[string]json.RawMessage
+
+	if response.Kind() == reflect.Slice {
+		if err := json.Unmarshal(rec.Body.Bytes(), &objects); err != nil {
+			t.Fatalf("decode %q: %v", rec.Body, err)
+		}
+
+		if len(objects) == 0 {
+			t.Fatalf("answers an empty list, the store has one %s", item.Name())
+		}
+	} else {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(rec.Body.Bytes(), &object); err != nil {
+			t.Fatalf("decode %q: %v", rec.Body, err)
+		}
+
+		objects = append(objects, object)
+	}
+
+	schemas := openAPISchemas{}
+	schemas.schema(item)
+
+	schema := schemas[item.Name()].(map[string]any)
+	properties := schema["properties"].(map[string]any)
+	required, _ := schema["required"].([]string)
+
+	for _, object := range objects {
+		for key := range object {
+			if _, ok := properties[key]; !ok {
+				t.Errorf("%s has key %q, not in its schema", item.Name(), key)
+			}
+		}
+
+		for _, key := range required {
+			if _, ok := object[key]; !ok {
+				t.Errorf("%s misses required key %q", item.Name(), key)
+			}
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/password"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+// minPINLength is the shortest PIN or password accepted for the portal.
+const minPINLength = 4
+
+type contextKey string
+
+const patronKey contextKey = "patron"
+
+// patron returns the member logged in to the patron portal.
+func patron(r *http.Request) *model.Member {
+	m, _ := r.Context().Value(patronKey).(*model.Member)
+	return m
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
+
+// patronAuth resolves the bearer token to the member it was issued to. The
+// patron handlers only ever act on that member.
+func (s *Service) patronAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			writeProblem(w, r, "unauthorized", "Log in to the patron portal")
+			return
+		}
+
+		memberID, err := s.repository.GetPatronSession(r.Context(), password.HashToken(token))
+		if err != nil {
+			writeProblem(w, r, "unauthorized", "Log in to the patron portal")
+			return
+		}
+
+		member, err := s.repository.GetMember(r.Context(), memberID)
+		if err != nil {
+			writeProblem(w, r, "unauthorized", "Log in to the patron portal")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), patronKey, member)))
+	})
+}
+
+func (s *Service) setPINHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid member ID")
+		return
+	}
+
+	var req model.SetPINRequest
+
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	if len(req.PIN) < minPINLength {
+		writeInvalid(w, r, "Invalid PIN", map[string]string{"pin": fmt.Sprintf("Use at least %d characters.", minPINLength)})
+
+		return
+	}
+
+	hash, err := password.Hash(req.PIN)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "hashing PIN failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	err = s.repository.SetMemberPIN(r.Context(), id, hash)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Member not found")
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "setting PIN failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	// the PIN itself stays out of the log
+	s.audit(r.Context(), memberEntry(model.AuditUpdate, id), nil, map[string]bool{"pin_set": true})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) patronLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req model.PatronLoginRequest
+
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	// every failure gets the same answer, after the same time, so card
+	// numbers cannot be probed
+	const invalid = "Invalid card number or PIN"
+
+	number := strings.TrimSpace(req.CardNumber)
+	account, address := "patron:"+number, s.clientAddress(r)
+
+	if wait := s.logins.wait(account, address, time.Now()); wait > 0 {
+		writeTooManyAttempts(w, r, wait)
+		return
+	}
+
+	member, err := s.memberByCard(r.Context(), number)
+	if err != nil {
+		_ = password.VerifyNone(req.PIN)
+		s.logins.failed(account, address, time.Now())
+		writeProblem(w, r, "invalid_credentials", invalid)
+
+		return
+	}
+
+	if !s.verifyPIN(r.Context(), member.ID, req.PIN) {
+		s.logins.failed(account, address, time.Now())
+		writeProblem(w, r, "invalid_credentials", invalid)
+
+		return
+	}
+
+	s.logins.succeeded(account)
+
+	token, tokenHash, err := password.NewToken()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "creating session token failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	expires := time.Now().Add(s.patronSession)
+
+	if err := s.repository.AddPatronSession(r.Context(), tokenHash, member.ID, expires); err != nil {
+		slog.ErrorContext(r.Context(), "adding patron session failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	writeJSON(w, model.PatronSession{Token: token, ExpiresAt: expires, Member: *member})
+}
+
+// verifyPIN reports whether pin is the PIN the member set, false when none
+// is set.
+func (s *Service) verifyPIN(ctx context.Context, memberID int, pin string) bool {
+	hash, err := s.repository.GetMemberPIN(ctx, memberID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			slog.ErrorContext(ctx, "reading PIN failed", "err", err)
+		}
+
+		_ = password.VerifyNone(pin)
+
+		return false
+	}
+
+	return pin != "" && password.Verify(hash, pin) == nil
+}
+
+func (s *Service) patronLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.repository.DeletePatronSession(r.Context(), password.HashToken(bearerToken(r))); err != nil {
+		slog.ErrorContext(r.Context(), "deleting patron session failed", "err", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) patronMeHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, patron(r))
+}
+
+func (s *Service) patronContactHandler(w http.ResponseWriter, r *http.Request) {
+	var c model.ContactDetails
+
+	if !readJSON(w, r, &c) {
+		return
+	}
+
+	m := *patron(r)
+	c.Apply(&m)
+
+	if errs := m.ValidateUpdate(*patron(r)); len(errs) > 0 {
+		writeInvalid(w, r, "Invalid contact details", errs)
+		return
+	}
+
+	// m has the version the request started with, staff edits in between
+	// are not overwritten
+	err := s.repository.UpdateMember(r.Context(), m)
+	if errors.Is(err, repository.ErrConflict) {
+		writeConflict(w, r, "Your record", s.memberVersion(r.Context(), m.ID))
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "updating contact details failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	s.audit(r.Context(), memberEntry(model.AuditUpdate, m.ID), patron(r), m)
+
+	writeJSON(w, m)
+}
+
+func (s *Service) patronLoansHandler(w http.ResponseWriter, r *http.Request) {
+	loans, err := s.repository.ListMemberBorrowings(r.Context(), patron(r).ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing borrowings failed", "err", err)
+		writeProblem(w, r, "internal_error", "")
+
+		return
+	}
+
+	writeJSON(w, loans)
+}
+
+func (s *Service) patronRenewHandler(w http.ResponseWriter, r *http.Request) {
+	member := patron(r)
+
+	loanID, err := strconv.Atoi(chi.URLParam(r, "loanID"))
+	if err != nil || loanID <= 0 {
+		writeProblem(w, r, "bad_request", "Invalid loan ID")
+		return
+	}
+
+	loan, err := s.repository.GetBorrowing(r.Context(), loanID)
+	if err != nil || loan.MemberID != member.ID || loan.ReturnDate != nil {
+		writeProblem(w, r, "not_found", "Loan not found")
+		return
+	}
+
+	renewed, err := s.renew(r.Context(), member, loan)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, renewed)
+}
+
+func (s *Service) patronHoldsHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeHolds(w, r, patron(r).ID)
+}
+
+func (s *Service) patronPlaceHoldHandler(w http.ResponseWriter, r *http.Request) {
+	s.placeHoldFor(w, r, patron(r))
+}
+
+func (s *Service) patronCancelHoldHandler(w http.ResponseWriter, r *http.Request) {
+	s.cancelHoldFor(w, r, patron(r).ID)
+}
+
+func (s *Service) patronFinesHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeFines(w, r, patron(r).ID)
+}
@@ -0,0 +1,193 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+// problemType describes an error code: the status it is sent with and a
+// title that does not change between occurrences.
+type problemType struct {
+	Status int
+	Title  string
+}
+
+// problemTypes lists every code the API answers with. Codes are stable,
+// clients may rely on them; add new ones rather than reusing a code.
+var problemTypes = map[string]problemType{
+	"bad_request":         {http.StatusBadRequest, "Bad request"},
+	"invalid_json":        {http.StatusBadRequest, "Request body is not valid JSON"},
+	"validation_failed":   {http.StatusBadRequest, "Invalid fields"},
+	"unknown_card":        {http.StatusBadRequest, "Unknown card number"},
+	"unauthorized":        {http.StatusUnauthorized, "Authentication required"},
+	"invalid_credentials": {http.StatusUnauthorized, "Invalid credentials"},
+	"invalid_token":       {http.StatusUnauthorized, "Invalid identity token"},
+	"forbidden":           {http.StatusForbidden, "Permission denied"},
+	"disabled":            {http.StatusForbidden, "Account disabled"},
+	"no_role":             {http.StatusForbidden, "No role for the account's groups"},
+	"membership_expired":  {http.StatusForbidden, "Membership expired"},
+	"member_blocked":      {http.StatusForbidden, "Member blocked"},
+	"card_not_usable":     {http.StatusForbidden, "Card cannot be used"},
+	"not_found":           {http.StatusNotFound, "Not found"},
+	"book_not_found":      {http.StatusNotFound, "Book not found"},
+	"sso_disabled":        {http.StatusNotFound, "Single sign-on not configured"},
+	"method_not_allowed":  {http.StatusMethodNotAllowed, "Method not allowed"},
+	"duplicate":           {http.StatusConflict, "Already exists"},
+	"open_loans":          {http.StatusConflict, "Open loans"},
+	"unpaid_fines":        {http.StatusConflict, "Unpaid fines"},
+	"no_copies_available": {http.StatusConflict, "No copies available"},
+	"loan_limit_reached":  {http.StatusConflict, "Loan limit reached"},
+	"on_hold":             {http.StatusConflict, "On hold for another member"},
+	"hold_limit_reached":  {http.StatusConflict, "Hold limit reached"},
+	"already_on_hold":     {http.StatusConflict, "Already on hold"},
+	"already_returned":    {http.StatusConflict, "Already returned"},
+	"already_lifted":      {http.StatusConflict, "Block already lifted"},
+	"already_paid":        {http.StatusConflict, "Fine already paid"},
+	"hold_not_waiting":    {http.StatusConflict, "Hold no longer waiting"},
+	"card_not_active":     {http.StatusConflict, "Card not active"},
+	"job_disabled":        {http.StatusConflict, "Job disabled"},
+	"own_account":         {http.StatusConflict, "Own account"},
+	"sso_account":         {http.StatusConflict, "Single sign-on account"},
+	"version_conflict":    {http.StatusPreconditionFailed, "Changed since loaded"},
+	"body_too_large":      {http.StatusRequestEntityTooLarge, "Request body too large"},
+	"too_many_attempts":   {http.StatusTooManyRequests, "Too many failed logins"},
+	"internal_error":      {http.StatusInternalServerError, "Internal server error"},
+	"upstream_error":      {http.StatusBadGateway, "Upstream service unavailable"},
+	"timeout":             {http.StatusServiceUnavailable, "Request timed out"},
+}
+
+// apiError is a request refused for a reason the client can act on. Code
+// is one of problemTypes, so clients can react to it without parsing the
+// message.
+type apiError struct {
+	Code    string
+	Message string
+	Fields  map[string]string
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+// invalid is a validation error with a message per invalid field.
+func invalid(msg string, fields map[string]string) *apiError {
+	return &apiError{Code: "validation_failed", Message: msg, Fields: fields}
+}
+
+// writeProblem answers with problem details for code; detail explains
+// this occurrence and may be empty.
+func writeProblem(w http.ResponseWriter, r *http.Request, code, detail string) {
+	// an internal error of a request past its deadline is most likely the
+	// cancelled query
+	if code == "internal_error" && r.Context().Err() != nil {
+		code, detail = "timeout", ""
+	}
+
+	writeAPIError(w, r, &apiError{Code: code, Message: detail})
+}
+
+// writeInvalid answers 400 validation_failed with the invalid fields.
+func writeInvalid(w http.ResponseWriter, r *http.Request, msg string, fields map[string]string) {
+	writeAPIError(w, r, invalid(msg, fields))
+}
+
+// writeError answers with the problem an error stands for: an apiError as
+// is, the repository's errors with their codes and anything else as an
+// internal error, logged but not shown to the client.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var aerr *apiError
+
+	switch {
+	case errors.As(err, &aerr):
+		writeAPIError(w, r, aerr)
+	case errors.Is(err, repository.ErrNotFound):
+		writeProblem(w, r, "not_found", "")
+	case errors.Is(err, repository.ErrConflict):
+		writeProblem(w, r, "version_conflict", "")
+	case errors.Is(err, repository.ErrDuplicate):
+		writeProblem(w, r, "duplicate", "")
+	case errors.Is(err, repository.ErrOpenLoans):
+		writeProblem(w, r, "open_loans", "")
+	case errors.Is(err, repository.ErrUnpaidFines):
+		writeProblem(w, r, "unpaid_fines", "")
+	case errors.Is(err, repository.ErrUnavailable):
+		writeProblem(w, r, "no_copies_available", "")
+	case errors.Is(err, context.Canceled):
+		// the client went away, nobody reads the answer
+		writeProblem(w, r, "timeout", "")
+	case errors.Is(err, context.DeadlineExceeded):
+		slog.WarnContext(r.Context(), "request timed out", "method", r.Method, "path", r.URL.Path, "err", err)
+		writeProblem(w, r, "timeout", "")
+	default:
+		slog.ErrorContext(r.Context(), "request failed", "method", r.Method, "path", r.URL.Path, "err", err)
+		writeProblem(w, r, "internal_error", "")
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, r *http.Request, e *apiError) {
+	t, ok := problemTypes[e.Code]
+	if !ok {
+		slog.ErrorContext(r.Context(), "unknown problem code", "code", e.Code)
+		t = problemTypes["internal_error"]
+	}
+
+	p := model.Problem{
+		Type:      model.ProblemTypePrefix + e.Code,
+		Title:     t.Title,
+		Status:    t.Status,
+		Detail:    e.Message,
+		Instance:  r.URL.Path,
+		Code:      e.Code,
+		Fields:    e.Fields,
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+
+	w.Header().Set("Content-Type", model.ProblemContentType)
+	w.WriteHeader(p.Status)
+
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		slog.ErrorContext(r.Context(), "encoding problem failed", "err", err)
+	}
+}
+
+// listProblemsHandler describes every error code, sorted by code.
+func (s *Service) listProblemsHandler(w http.ResponseWriter, r *http.Request) {
+	codes := make([]string, 0, len(problemTypes))
+	for code := range problemTypes {
+		codes = append(codes, code)
+	}
+
+	sort.Strings(codes)
+
+	problems := make([]model.Problem, len(codes))
+	for i, code := range codes {
+		problems[i] = problemDescription(code)
+	}
+
+	writeJSON(w, problems)
+}
+
+// problemHandler describes the error code the type URI of a problem names.
+func (s *Service) problemHandler(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "code")
+	if _, ok := problemTypes[code]; !ok {
+		writeProblem(w, r, "not_found", "Unknown problem type")
+		return
+	}
+
+	writeJSON(w, problemDescription(code))
+}
+
+func problemDescription(code string) model.Problem {
+	t := problemTypes[code]
+	return model.Problem{Type: model.ProblemTypePrefix + code, Title: t.Title, Status: t.Status, Code: code}
+}
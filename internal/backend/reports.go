@@ -3,9 +3,9 @@ package backend
 import "net/http"
 
 func (s *Service) getBorrowedBooksHandler(w http.ResponseWriter, r *http.Request) {
-	data, err := s.repository.ListBorrowings()
+	data, err := s.repository.ListBorrowings(r.Context())
 	if err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		writeProblem(w, r, "internal_error", "")
 		return
 	}
 
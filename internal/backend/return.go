@@ -1,11 +1,13 @@
 package backend
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/tliefheid/go-ils/internal/repository"
 )
 
 func (s *Service) returnBookHandler(w http.ResponseWriter, r *http.Request) {
@@ -20,13 +22,13 @@ func (s *Service) returnBookHandler(w http.ResponseWriter, r *http.Request) {
 	// }
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing borrowing ID", http.StatusBadRequest)
+		writeProblem(w, r, "bad_request", "Missing borrowing ID")
 		return
 	}
 	// Convert id to int
 	borrowingID, err := strconv.Atoi(id)
 	if err != nil || borrowingID <= 0 {
-		http.Error(w, "Invalid borrowing ID", http.StatusBadRequest)
+		writeProblem(w, r, "bad_request", "Invalid borrowing ID")
 		return
 	}
 
@@ -49,14 +51,27 @@ func (s *Service) returnBookHandler(w http.ResponseWriter, r *http.Request) {
 	// 	http.Error(w, "No active borrowing found", http.StatusNotFound)
 	// 	return
 	// }
-	err = s.repository.ReturnBorrowing(borrowingID)
+	loan, err := s.repository.GetBorrowing(r.Context(), borrowingID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeProblem(w, r, "not_found", "Borrowing not found")
+		return
+	}
+
 	if err != nil {
-		fmt.Println("Error returning borrowing:", err)
-		http.Error(w, "Failed to return book", http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
+	}
 
+	if loan.ReturnDate != nil {
+		writeProblem(w, r, "already_returned", "Borrowing is already returned")
+		return
+	}
+
+	err = s.checkin(r.Context(), loan)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("return borrowing: %w", err))
 		return
 	}
 
-	fmt.Println("Successfully returned borrowing with ID:", borrowingID)
 	w.WriteHeader(http.StatusNoContent)
 }
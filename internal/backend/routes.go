@@ -2,40 +2,115 @@ package backend
 
 import (
 	"encoding/json"
-	"fmt"
+	"log/slog"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
+	"github.com/tliefheid/go-ils/internal/health"
+	"github.com/tliefheid/go-ils/internal/logging"
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/tracing"
 )
 
 func (s *Service) setupRoutes() {
-	fmt.Println("setup routes")
-	s.mux.Use(middleware.Logger)
-
-	s.mux.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		_, err := w.Write([]byte("OK"))
-		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-	})
+	s.mux.Use(logging.RequestID)
+	s.mux.Use(tracing.Middleware)
+	s.mux.Use(logging.Requests)
+	s.mux.Use(s.registry.Middleware)
+	s.mux.Use(s.deadline)
+
+	// /health stays the liveness probe for the deployments that use it
+	s.mux.Get("/health", health.LiveHandler)
+	s.mux.Get("/health/live", health.LiveHandler)
+	s.mux.Get("/health/ready", s.health.ReadyHandler)
+	s.mux.Get("/metrics", s.registry.Handler().ServeHTTP)
 	s.mux.NotFound(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Println("Not Found handler called")
-		http.Error(w, "Not Found", http.StatusNotFound)
+		writeProblem(w, r, "not_found", "No such endpoint")
+	})
+	s.mux.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, r, "method_not_allowed", r.Method+" is not allowed here")
+	})
+	// the error codes are described at the type URIs of the problems
+	s.mux.Get("/problems", s.listProblemsHandler)
+	s.mux.Get("/problems/{code}", s.problemHandler)
+	s.mux.Get("/openapi.json", s.openAPIHandler)
+	s.mux.Get("/docs", s.docsHandler)
+	// the SRU catalogue and the patron portal are public or have their own
+	// login, everything else needs a staff session or an API key
+	s.mux.Get("/sru", s.sruHandler)
+	s.mux.Mount("/patron", s.handlePatronRoutes())
+	s.mux.Mount("/auth", s.handleAuthRoutes())
+
+	// accounts and keys are only managed by staff logged in themselves
+	s.mux.Group(func(mux chi.Router) {
+		mux.Use(s.staffAuth)
+
+		mux.Mount("/staff", s.handleStaffRoutes())
+		mux.Mount("/apikeys", s.handleAPIKeyRoutes())
+	})
+
+	s.mux.Group(func(mux chi.Router) {
+		mux.Use(s.authenticate)
+
+		mux.With(require(model.PermCatalogRead)).Get("/isbn/{isbn}", s.isbnInfoHandler)
+
+		mux.Mount("/books", s.handleBooksRoutes())
+		mux.Mount("/members", s.handleMemberRoutes())
+		mux.Mount("/cards", s.handleCardRoutes())
+		mux.Mount("/categories", s.handleCategoryRoutes())
+
+		mux.Mount("/returns", s.handleReturnsRoutes())
+		mux.Mount("/borrow", s.handleBorrowRoutes())
+		mux.Mount("/reports", s.handleReportsRoutes())
+		mux.Mount("/jobs", s.handleJobRoutes())
+		mux.With(require(model.PermAdmin)).Get("/erasures", s.listErasuresHandler)
+		mux.With(require(model.PermAdmin)).Get("/audit", s.listAuditHandler)
+	})
+}
+
+func (s *Service) handleAuthRoutes() *chi.Mux {
+	mux := chi.NewRouter()
+
+	mux.Post("/login", s.staffLoginHandler)
+	mux.Post("/oidc", s.oidcLoginHandler)
+	mux.Post("/oidc/nonce", s.oidcNonceHandler)
+	mux.Group(func(mux chi.Router) {
+		mux.Use(s.staffAuth)
+		mux.Post("/logout", s.staffLogoutHandler)
+		mux.Get("/me", s.staffMeHandler)
+		mux.Put("/password", s.changeOwnPasswordHandler)
 	})
-	s.mux.Get("/isbn/{isbn}", s.isbnInfoHandler)
 
-	s.mux.Mount("/books", s.handleBooksRoutes())
-	s.mux.Mount("/members", s.handleMemberRoutes())
+	return mux
+}
+
+func (s *Service) handleStaffRoutes() *chi.Mux {
+	mux := chi.NewRouter()
+	mux.Use(require(model.PermAdmin))
+
+	mux.Get("/", s.listStaffHandler)
+	mux.Post("/", s.addStaffHandler)
+	mux.Put("/{id}", s.editStaffHandler)
+	mux.Put("/{id}/password", s.resetStaffPasswordHandler)
 
-	s.mux.Mount("/returns", s.handleReturnsRoutes())
-	s.mux.Mount("/borrow", s.handleBorrowRoutes())
-	s.mux.Mount("/reports", s.handleReportsRoutes())
+	return mux
+}
+
+func (s *Service) handleAPIKeyRoutes() *chi.Mux {
+	mux := chi.NewRouter()
+	mux.Use(require(model.PermAdmin))
+
+	mux.Get("/", s.listAPIKeysHandler)
+	mux.Post("/", s.addAPIKeyHandler)
+	mux.Post("/{id}/revoke", s.revokeAPIKeyHandler)
+	mux.Post("/{id}/rotate", s.rotateAPIKeyHandler)
+
+	return mux
 }
 
 func (s *Service) handleReturnsRoutes() *chi.Mux {
 	mux := chi.NewRouter()
+	mux.Use(require(model.PermCirculation))
 	mux.Post("/{id}", s.returnBookHandler)
 
 	return mux
@@ -43,40 +118,122 @@ func (s *Service) handleReturnsRoutes() *chi.Mux {
 
 func (s *Service) handleBorrowRoutes() *chi.Mux {
 	mux := chi.NewRouter()
-	mux.Post("/", s.borrowBookHandler)
-	mux.Get("/", s.getBorrowingHandler)
-	mux.Get("/{id}", s.getBorrowingDetailHandler)
+	mux.With(require(model.PermCirculation)).Post("/", s.borrowBookHandler)
+	mux.With(require(model.PermMembersRead)).Get("/", s.getBorrowingHandler)
+	mux.With(require(model.PermMembersRead)).Get("/{id}", s.getBorrowingDetailHandler)
 
 	return mux
 }
 
 func (s *Service) handleBooksRoutes() *chi.Mux {
 	mux := chi.NewRouter()
+	read := mux.With(require(model.PermCatalogRead))
+	write := mux.With(require(model.PermCatalogWrite))
 
-	mux.Get("/", s.listBooksHandler)
-	mux.Get("/search", s.searchBooks)
-	mux.Post("/", s.addBookHandler)
-	mux.Get("/isbn/{isbn}", s.isBookPresentHandler)
-	mux.Route("/{id}", func(mux chi.Router) {
-		mux.Get("/", s.getBookHandler)
-		mux.Put("/", s.editBookHandler)
-		mux.Delete("/", s.deleteBookHandler)
-	})
+	read.Get("/", s.listBooksHandler)
+	read.Get("/search", s.searchBooks)
+	write.Post("/", s.addBookHandler)
+	read.Get("/isbn/{isbn}", s.isBookPresentHandler)
+	write.Get("/deleted", s.listDeletedBooksHandler)
+	read.Get("/{id}", s.getBookHandler)
+	read.Get("/{id}/history", s.bookHistoryHandler)
+	write.Put("/{id}", s.editBookHandler)
+	write.Delete("/{id}", s.deleteBookHandler)
+	write.Post("/{id}/restore", s.restoreBookHandler)
 
 	return mux
 }
 func (s *Service) handleMemberRoutes() *chi.Mux {
 	mux := chi.NewRouter()
+	read := mux.With(require(model.PermMembersRead))
+	write := mux.With(require(model.PermMembersWrite))
 
-	mux.Get("/", s.listMembersHandler)
-	mux.Get("/search", s.searchMembers)
+	read.Get("/", s.listMembersHandler)
+	read.Get("/search", s.searchMembers)
+	write.Get("/deleted", s.listDeletedMembersHandler)
 
-	mux.Post("/", s.addMemberHandler)
+	write.Post("/", s.addMemberHandler)
 
 	mux.Route("/{id}", func(mux chi.Router) {
-		mux.Get("/", s.getMemberHandler)
-		mux.Put("/", s.editMemberHandler)
-		mux.Delete("/", s.deleteMemberHandler)
+		read := mux.With(require(model.PermMembersRead))
+		write := mux.With(require(model.PermMembersWrite))
+
+		read.Get("/", s.getMemberHandler)
+		read.Get("/history", s.memberHistoryHandler)
+		write.Put("/", s.editMemberHandler)
+		write.Delete("/", s.deleteMemberHandler)
+		write.Post("/restore", s.restoreMemberHandler)
+		write.Get("/export", s.exportMemberHandler)
+		mux.With(require(model.PermAdmin)).Post("/erase", s.eraseMemberHandler)
+		read.Get("/cards", s.listMemberCardsHandler)
+		write.Post("/cards", s.issueCardHandler)
+		write.Post("/membership/renew", s.renewMembershipHandler)
+		read.Get("/blocks", s.listMemberBlocksHandler)
+		write.Post("/blocks", s.addBlockHandler)
+		write.Post("/blocks/{blockID}/lift", s.liftBlockHandler)
+		read.Get("/holds", s.listMemberHoldsHandler)
+		write.Post("/holds", s.placeHoldHandler)
+		write.Post("/holds/{holdID}/cancel", s.cancelHoldHandler)
+		read.Get("/fines", s.listMemberFinesHandler)
+		mux.With(require(model.PermCirculation)).Post("/fines/{fineID}/pay", s.payFineHandler)
+		write.Put("/pin", s.setPINHandler)
+	})
+
+	return mux
+}
+
+func (s *Service) handleCardRoutes() *chi.Mux {
+	mux := chi.NewRouter()
+
+	mux.Route("/{number}", func(mux chi.Router) {
+		mux.With(require(model.PermMembersRead)).Get("/", s.getCardHandler)
+		mux.With(require(model.PermMembersWrite)).Post("/replace", s.replaceCardHandler)
+		mux.With(require(model.PermMembersRead)).Get("/pdf", s.cardPDFHandler)
+	})
+
+	return mux
+}
+
+func (s *Service) handleCategoryRoutes() *chi.Mux {
+	mux := chi.NewRouter()
+
+	mux.With(require(model.PermMembersRead)).Get("/", s.listCategoriesHandler)
+	mux.Route("/{code}", func(mux chi.Router) {
+		mux.With(require(model.PermMembersRead)).Get("/", s.getCategoryHandler)
+		mux.With(require(model.PermAdmin)).Put("/", s.editCategoryHandler)
+	})
+
+	return mux
+}
+
+func (s *Service) handleJobRoutes() *chi.Mux {
+	mux := chi.NewRouter()
+	mux.Use(require(model.PermAdmin))
+
+	mux.Post("/archive", s.archiveHandler)
+	mux.Post("/retention", s.retentionHandler)
+
+	return mux
+}
+
+// handlePatronRoutes serves the patron portal. Apart from login every route
+// acts on the member of the session only.
+func (s *Service) handlePatronRoutes() *chi.Mux {
+	mux := chi.NewRouter()
+
+	mux.Post("/login", s.patronLoginHandler)
+	mux.Group(func(mux chi.Router) {
+		mux.Use(s.patronAuth)
+		mux.Post("/logout", s.patronLogoutHandler)
+		mux.Get("/me", s.patronMeHandler)
+		mux.Put("/me/contact", s.patronContactHandler)
+		mux.Get("/loans", s.patronLoansHandler)
+		mux.Post("/loans/{loanID}/renew", s.patronRenewHandler)
+		mux.Get("/holds", s.patronHoldsHandler)
+		mux.Post("/holds", s.patronPlaceHoldHandler)
+		mux.Post("/holds/{holdID}/cancel", s.patronCancelHoldHandler)
+		mux.Get("/fines", s.patronFinesHandler)
+		mux.Get("/books", s.searchBooks)
 	})
 
 	return mux
@@ -84,6 +241,7 @@ func (s *Service) handleMemberRoutes() *chi.Mux {
 
 func (s *Service) handleReportsRoutes() *chi.Mux {
 	mux := chi.NewRouter()
+	mux.Use(require(model.PermReports))
 
 	mux.Get("/borrowed", s.getBorrowedBooksHandler)
 
@@ -91,10 +249,14 @@ func (s *Service) handleReportsRoutes() *chi.Mux {
 }
 
 func writeJSON(w http.ResponseWriter, data interface{}) {
+	writeJSONStatus(w, http.StatusOK, data)
+}
+
+func writeJSONStatus(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 
 	if err := json.NewEncoder(w).Encode(data); err != nil {
-		fmt.Println("Error encoding JSON:", err)
+		slog.Error("encoding JSON failed", "err", err)
 	}
 }
@@ -2,18 +2,95 @@ package backend
 
 import (
 	"fmt"
+	"net/http"
+	"net/netip"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/tliefheid/go-ils/internal/card"
+	"github.com/tliefheid/go-ils/internal/health"
+	"github.com/tliefheid/go-ils/internal/metrics"
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/oidc"
 	"github.com/tliefheid/go-ils/internal/repository"
+	"github.com/tliefheid/go-ils/internal/tracing"
 )
 
+// tracer starts the spans of the backend's own work.
+var tracer = tracing.Tracer("github.com/tliefheid/go-ils/internal/backend")
+
 type Service struct {
-	mux        *chi.Mux
-	repository repository.Store
+	mux            *chi.Mux
+	repository     repository.Store
+	requestTimeout time.Duration
+	registry       *metrics.Registry
+	metrics        *serviceMetrics
+	health         *health.Checker
+
+	libraryName  string
+	cardFormat   card.Format
+	cardValidity time.Duration
+
+	overdueBlockDays int
+	archiveAfter     time.Duration
+	loanRetention    time.Duration
+	retentionDryRun  bool
+	finePerDay       int
+	patronSession    time.Duration
+	staffSession     time.Duration
+	logins           *loginThrottle
+	trustedProxies   []netip.Prefix
+
+	oidc            *oidc.Client
+	oidcGroupsClaim string
+	oidcRoleGroups  map[model.StaffRole][]string
 }
 
 type Config struct {
 	Repository repository.Store
+	// RequestTimeout limits how long a request may take before its work is
+	// cancelled, zero for no limit.
+	RequestTimeout time.Duration
+
+	// LibraryName is printed on library cards.
+	LibraryName string
+	// CardFormat defines the library card numbers, DefaultFormat when zero.
+	CardFormat card.Format
+	// CardValidity is how long new cards are valid, zero for no expiry.
+	CardValidity time.Duration
+	// OverdueBlockDays blocks members automatically once a loan is this many
+	// days overdue, zero disables automatic blocks.
+	OverdueBlockDays int
+	// ArchiveAfter is how long deleted members are kept restorable before
+	// their personal data is anonymized, zero disables archival.
+	ArchiveAfter time.Duration
+	// LoanRetention is how long returned loans stay linked to the member,
+	// zero disables the retention job.
+	LoanRetention time.Duration
+	// RetentionDryRun makes the scheduled retention job only report.
+	RetentionDryRun bool
+	// FinePerDay is the fine in cents for every started day a loan is
+	// returned late, zero disables fines.
+	FinePerDay int
+	// PatronSession is how long a patron portal login lasts, a day when
+	// zero.
+	PatronSession time.Duration
+	// StaffSession is how long a staff login lasts, 12 hours when zero.
+	StaffSession time.Duration
+	// OIDCIssuer is the identity provider trusted for single sign-on, empty
+	// disables it.
+	OIDCIssuer string
+	// OIDCClientID is the frontend's client ID, the audience of ID tokens.
+	OIDCClientID string
+	// OIDCGroupsClaim is the ID token claim listing the user's groups,
+	// "groups" when empty.
+	OIDCGroupsClaim string
+	// OIDCRoleGroups lists the provider groups that give each role.
+	OIDCRoleGroups map[model.StaffRole][]string
+	// TrustedProxies are the proxies, such as the web frontend, whose
+	// X-Forwarded-For header names the client that failed logins are
+	// counted for.
+	TrustedProxies []netip.Prefix
 }
 
 func New(cfg Config) (*Service, error) {
@@ -21,6 +98,69 @@ func New(cfg Config) (*Service, error) {
 	s.mux = chi.NewRouter()
 
 	s.repository = cfg.Repository
+	s.requestTimeout = cfg.RequestTimeout
+
+	s.registry = metrics.New()
+	s.metrics = newServiceMetrics(s.registry)
+
+	if s.repository != nil {
+		s.registry.RegisterDBStats(s.repository.Stats)
+		s.registry.MustRegister(newLoanCollector(s))
+	}
+
+	s.health = newHealth(s)
+
+	s.libraryName = cfg.LibraryName
+	if s.libraryName == "" {
+		s.libraryName = "Library ILS"
+	}
+
+	s.cardFormat = cfg.CardFormat
+	if s.cardFormat == (card.Format{}) {
+		s.cardFormat = card.DefaultFormat
+	}
+
+	if err := s.cardFormat.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.cardValidity = cfg.CardValidity
+	s.overdueBlockDays = cfg.OverdueBlockDays
+	s.archiveAfter = cfg.ArchiveAfter
+	s.loanRetention = cfg.LoanRetention
+	s.retentionDryRun = cfg.RetentionDryRun
+	s.finePerDay = cfg.FinePerDay
+
+	s.patronSession = cfg.PatronSession
+	if s.patronSession <= 0 {
+		s.patronSession = 24 * time.Hour
+	}
+
+	s.staffSession = cfg.StaffSession
+	if s.staffSession <= 0 {
+		s.staffSession = 12 * time.Hour
+	}
+
+	s.logins = newLoginThrottle()
+	s.trustedProxies = cfg.TrustedProxies
+
+	if cfg.OIDCIssuer != "" {
+		if cfg.OIDCClientID == "" {
+			return nil, fmt.Errorf("single sign-on needs a client ID")
+		}
+
+		s.oidc = &oidc.Client{
+			Issuer:     cfg.OIDCIssuer,
+			ClientID:   cfg.OIDCClientID,
+			HTTPClient: &http.Client{Timeout: 10 * time.Second, Transport: tracing.Transport(nil)},
+		}
+		s.oidcRoleGroups = cfg.OIDCRoleGroups
+
+		s.oidcGroupsClaim = cfg.OIDCGroupsClaim
+		if s.oidcGroupsClaim == "" {
+			s.oidcGroupsClaim = "groups"
+		}
+	}
 
 	s.setupRoutes()
 
@@ -28,6 +168,5 @@ func New(cfg Config) (*Service, error) {
 }
 
 func (s *Service) Mux() *chi.Mux {
-	fmt.Println("Returning mux")
 	return s.mux
 }
@@ -0,0 +1,441 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/password"
+	"github.com/tliefheid/go-ils/internal/repository"
+	"github.com/tliefheid/go-ils/internal/sip2"
+)
+
+const (
+	sip2Language = "000"
+	// supported messages in BX order: patron status, checkout, checkin,
+	// block patron, SC/ACS status, resend, login, patron information, end
+	// session, fee paid, item information, item status update, patron enable,
+	// hold, renew, renew all
+	sip2Supported      = "YYYNYYYYYNYNNNYN"
+	sip2PatronStatusOK = "              "
+)
+
+var (
+	errPatronNotFound = errors.New("patron not found")
+	errPatronLookup   = errors.New("patron lookup failed")
+	errInvalidPIN     = errors.New("invalid PIN")
+	errPatronLocked   = errors.New("too many failed PIN attempts, try again later")
+	errItemNotFound   = errors.New("item not found")
+)
+
+// sip2Handler maps SIP2 circulation messages onto the repository.
+type sip2Handler struct {
+	s           *Service
+	institution string
+}
+
+// SIP2Handler returns the handler for a SIP2 server answering for the given
+// institution id.
+func (s *Service) SIP2Handler(institution string) sip2.Handler {
+	return &sip2Handler{s: s, institution: institution}
+}
+
+// audited returns the context of the handler's changes, audited as the self
+// check's institution.
+func (h *sip2Handler) audited(ctx context.Context) context.Context {
+	return withActor(ctx, "sip2:"+h.institution)
+}
+
+func (h *sip2Handler) now() string {
+	return sip2.Timestamp(time.Now())
+}
+
+func (h *sip2Handler) SCStatus(_ context.Context, req *sip2.Message) *sip2.Message {
+	return sip2.NewMessage(sip2.CodeACSStatus,
+		"Y", "Y", "Y", "Y", "N", "N", "030", "003", h.now(), "2.00").
+		Add(sip2.FieldInstitutionID, h.institution).
+		Add(sip2.FieldLibraryName, "Library ILS").
+		Add(sip2.FieldSupportedMessages, sip2Supported)
+}
+
+func (h *sip2Handler) PatronStatus(ctx context.Context, req *sip2.Message) *sip2.Message {
+	ctx = h.audited(ctx)
+
+	patronID := req.Get(sip2.FieldPatronID)
+	member, pinOK, err := h.patron(ctx, patronID, req.Get(sip2.FieldPatronPassword))
+
+	if err != nil || !pinOK {
+		return sip2.NewMessage(sip2.CodePatronStatusResp, sip2PatronStatusOK, sip2Language, h.now()).
+			Add(sip2.FieldInstitutionID, h.institution).
+			Add(sip2.FieldPatronID, patronID).
+			Add(sip2.FieldPersonalName, "").
+			Add(sip2.FieldValidPatron, sip2.Bool(err == nil)).
+			Add(sip2.FieldValidPatronPwd, "N").
+			Add(sip2.FieldScreenMessage, patronMessage(err))
+	}
+
+	loans, err := h.s.repository.ListMemberBorrowings(ctx, member.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "listing borrowings failed", "err", err)
+	}
+
+	return sip2.NewMessage(sip2.CodePatronStatusResp, h.patronStatus(ctx, member, len(loans)), sip2Language, h.now()).
+		Add(sip2.FieldInstitutionID, h.institution).
+		Add(sip2.FieldPatronID, patronID).
+		Add(sip2.FieldPersonalName, member.Name).
+		Add(sip2.FieldValidPatron, "Y").
+		Add(sip2.FieldValidPatronPwd, "Y")
+}
+
+func (h *sip2Handler) PatronInfo(ctx context.Context, req *sip2.Message) *sip2.Message {
+	ctx = h.audited(ctx)
+
+	patronID := req.Get(sip2.FieldPatronID)
+
+	member, pinOK, err := h.patron(ctx, patronID, req.Get(sip2.FieldPatronPassword))
+	if err != nil || !pinOK {
+		return sip2.NewMessage(sip2.CodePatronInfoResp, sip2PatronStatusOK, sip2Language, h.now(),
+			sip2.Count(0), sip2.Count(0), sip2.Count(0), sip2.Count(0), sip2.Count(0), sip2.Count(0)).
+			Add(sip2.FieldInstitutionID, h.institution).
+			Add(sip2.FieldPatronID, patronID).
+			Add(sip2.FieldPersonalName, "").
+			Add(sip2.FieldValidPatron, sip2.Bool(err == nil)).
+			Add(sip2.FieldValidPatronPwd, "N").
+			Add(sip2.FieldScreenMessage, patronMessage(err))
+	}
+
+	loans, err := h.s.repository.ListMemberBorrowings(ctx, member.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "listing borrowings failed", "err", err)
+	}
+
+	overdue := 0
+
+	for _, l := range loans {
+		if l.Overdue(time.Now()) {
+			overdue++
+		}
+	}
+
+	resp := sip2.NewMessage(sip2.CodePatronInfoResp, h.patronStatus(ctx, member, len(loans)), sip2Language, h.now(),
+		sip2.Count(0), sip2.Count(overdue), sip2.Count(len(loans)), sip2.Count(0), sip2.Count(0), sip2.Count(0)).
+		Add(sip2.FieldInstitutionID, h.institution).
+		Add(sip2.FieldPatronID, patronID).
+		Add(sip2.FieldPersonalName, member.Name).
+		Add(sip2.FieldValidPatron, "Y").
+		Add(sip2.FieldValidPatronPwd, "Y")
+
+	// the summary field flags which item list is requested, position 2 is
+	// charged items
+	if req.FixedAt(21+2, 1) == "Y" {
+		for _, l := range loans {
+			resp.Add(sip2.FieldChargedItems, l.BookTitle)
+		}
+	}
+
+	return resp
+}
+
+func (h *sip2Handler) ItemInfo(ctx context.Context, req *sip2.Message) *sip2.Message {
+	ctx = h.audited(ctx)
+
+	itemID := req.Get(sip2.FieldItemID)
+
+	book, err := h.item(ctx, itemID)
+	if err != nil {
+		return sip2.NewMessage(sip2.CodeItemInfoResp, "01", "00", "01", h.now()).
+			Add(sip2.FieldItemID, itemID).
+			Add(sip2.FieldTitle, "").
+			Add(sip2.FieldScreenMessage, err.Error())
+	}
+
+	status := "03" // available
+	if book.CopiesAvailable < 1 {
+		status = "04" // charged
+	}
+
+	return sip2.NewMessage(sip2.CodeItemInfoResp, status, "00", "01", h.now()).
+		Add(sip2.FieldItemID, itemID).
+		Add(sip2.FieldTitle, book.Title).
+		Add(sip2.FieldPermanentLocation, h.institution)
+}
+
+func (h *sip2Handler) Checkout(ctx context.Context, req *sip2.Message) *sip2.Message {
+	ctx = h.audited(ctx)
+
+	patronID, itemID := req.Get(sip2.FieldPatronID), req.Get(sip2.FieldItemID)
+
+	fail := func(msg string) *sip2.Message {
+		return sip2.NewMessage(sip2.CodeCheckoutResp, "0", "N", "U", "N", h.now()).
+			Add(sip2.FieldInstitutionID, h.institution).
+			Add(sip2.FieldPatronID, patronID).
+			Add(sip2.FieldItemID, itemID).
+			Add(sip2.FieldTitle, "").
+			Add(sip2.FieldDueDate, "").
+			Add(sip2.FieldScreenMessage, msg)
+	}
+
+	member, err := h.authorizedPatron(ctx, req)
+	if err != nil {
+		return fail(patronMessage(err))
+	}
+
+	book, err := h.item(ctx, itemID)
+	if err != nil {
+		return fail(err.Error())
+	}
+
+	var (
+		loan    *model.Borrowing
+		renewal bool
+	)
+
+	// a checkout of an item the patron already holds is a renewal when the
+	// self check allows it
+	if open := h.openLoan(ctx, member.ID, book.ID); open != nil && req.FixedAt(0, 1) == "Y" {
+		loan, err = h.s.renew(ctx, member, open)
+		renewal = true
+	} else {
+		loan, err = h.s.checkout(ctx, member, book.ID)
+	}
+
+	if err != nil {
+		return fail(circulationMessage(err, "Item cannot be checked out"))
+	}
+
+	return sip2.NewMessage(sip2.CodeCheckoutResp, "1", sip2.Bool(renewal), "U", "Y", h.now()).
+		Add(sip2.FieldInstitutionID, h.institution).
+		Add(sip2.FieldPatronID, patronID).
+		Add(sip2.FieldItemID, itemID).
+		Add(sip2.FieldTitle, book.Title).
+		Add(sip2.FieldDueDate, sip2.Timestamp(loan.DueDate))
+}
+
+func (h *sip2Handler) Checkin(ctx context.Context, req *sip2.Message) *sip2.Message {
+	ctx = h.audited(ctx)
+
+	itemID := req.Get(sip2.FieldItemID)
+
+	resp := func(ok bool, title, msg string) *sip2.Message {
+		m := sip2.NewMessage(sip2.CodeCheckinResp, sip2.Digit(ok), sip2.Bool(ok), "U", "N", h.now()).
+			Add(sip2.FieldInstitutionID, h.institution).
+			Add(sip2.FieldItemID, itemID).
+			Add(sip2.FieldPermanentLocation, h.institution).
+			Add(sip2.FieldTitle, title)
+		if msg != "" {
+			m.Add(sip2.FieldScreenMessage, msg)
+		}
+
+		return m
+	}
+
+	book, err := h.item(ctx, itemID)
+	if err != nil {
+		return resp(false, "", err.Error())
+	}
+
+	loan, err := h.s.repository.FindOpenBorrowing(ctx, book.ID)
+	if err != nil {
+		return resp(false, book.Title, "Item is not checked out")
+	}
+
+	if err := h.s.checkin(ctx, loan); err != nil {
+		slog.ErrorContext(ctx, "returning borrowing failed", "err", err)
+		return resp(false, book.Title, "Checkin failed")
+	}
+
+	return resp(true, book.Title, "")
+}
+
+func (h *sip2Handler) Renew(ctx context.Context, req *sip2.Message) *sip2.Message {
+	ctx = h.audited(ctx)
+
+	patronID, itemID := req.Get(sip2.FieldPatronID), req.Get(sip2.FieldItemID)
+
+	resp := func(ok bool, title, due, msg string) *sip2.Message {
+		m := sip2.NewMessage(sip2.CodeRenewResp, sip2.Digit(ok), sip2.Bool(ok), "U", "N", h.now()).
+			Add(sip2.FieldInstitutionID, h.institution).
+			Add(sip2.FieldPatronID, patronID).
+			Add(sip2.FieldItemID, itemID).
+			Add(sip2.FieldTitle, title).
+			Add(sip2.FieldDueDate, due)
+		if msg != "" {
+			m.Add(sip2.FieldScreenMessage, msg)
+		}
+
+		return m
+	}
+
+	member, err := h.authorizedPatron(ctx, req)
+	if err != nil {
+		return resp(false, "", "", patronMessage(err))
+	}
+
+	book, err := h.item(ctx, itemID)
+	if err != nil {
+		return resp(false, "", "", err.Error())
+	}
+
+	open := h.openLoan(ctx, member.ID, book.ID)
+	if open == nil {
+		return resp(false, book.Title, "", "Item is not checked out to this patron")
+	}
+
+	loan, err := h.s.renew(ctx, member, open)
+	if err != nil {
+		return resp(false, book.Title, "", circulationMessage(err, "Renewal failed"))
+	}
+
+	return resp(true, book.Title, sip2.Timestamp(loan.DueDate), "")
+}
+
+func (h *sip2Handler) EndSession(_ context.Context, req *sip2.Message) *sip2.Message {
+	return sip2.NewMessage(sip2.CodeEndSessionResp, "Y", h.now()).
+		Add(sip2.FieldInstitutionID, h.institution).
+		Add(sip2.FieldPatronID, req.Get(sip2.FieldPatronID))
+}
+
+// patron resolves a SIP2 patron identifier to a member and checks the PIN
+// sent in AD against the one set for the patron portal. Only card numbers
+// identify patrons; sequential member IDs are easy to guess. Failed checks
+// count towards the same throttle as portal logins, by card and by the self
+// check's address.
+func (h *sip2Handler) patron(ctx context.Context, id, pin string) (member *model.Member, pinOK bool, err error) {
+	id = strings.TrimSpace(id)
+	account, address := "patron:"+id, sip2.RemoteAddr(ctx)
+
+	if h.s.logins.wait(account, address, time.Now()) > 0 {
+		return nil, false, errPatronLocked
+	}
+
+	if !h.s.cardFormat.Valid(id) {
+		_ = password.VerifyNone(pin)
+		h.s.logins.failed(account, address, time.Now())
+
+		return nil, false, errPatronNotFound
+	}
+
+	member, err = h.s.memberByCard(ctx, id)
+
+	switch {
+	case errors.Is(err, errCardNotUsable):
+		return nil, false, err
+	case errors.Is(err, repository.ErrNotFound):
+		_ = password.VerifyNone(pin)
+		h.s.logins.failed(account, address, time.Now())
+
+		return nil, false, errPatronNotFound
+	case err != nil:
+		slog.ErrorContext(ctx, "looking up sip2 patron failed", "err", err)
+		return nil, false, errPatronLookup
+	}
+
+	// a status request without a PIN is not a guess
+	switch pinOK = h.s.verifyPIN(ctx, member.ID, pin); {
+	case pinOK:
+		h.s.logins.succeeded(account)
+	case pin != "":
+		h.s.logins.failed(account, address, time.Now())
+	}
+
+	return member, pinOK, nil
+}
+
+// authorizedPatron resolves the patron of a circulation request, which
+// needs the patron's PIN.
+func (h *sip2Handler) authorizedPatron(ctx context.Context, req *sip2.Message) (*model.Member, error) {
+	member, pinOK, err := h.patron(ctx, req.Get(sip2.FieldPatronID), req.Get(sip2.FieldPatronPassword))
+	if err != nil {
+		return nil, err
+	}
+
+	if !pinOK {
+		return nil, errInvalidPIN
+	}
+
+	return member, nil
+}
+
+// patronMessage is the screen message for a patron that was not found or
+// whose PIN did not match.
+func patronMessage(err error) string {
+	if err == nil {
+		err = errInvalidPIN
+	}
+
+	return err.Error()
+}
+
+// item resolves a SIP2 item identifier, either an ISBN barcode or a book id.
+func (h *sip2Handler) item(ctx context.Context, id string) (*model.Book, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, errItemNotFound
+	}
+
+	if book, err := h.s.repository.SearchBookByISBN(ctx, id); err == nil {
+		return book, nil
+	}
+
+	bookID, err := strconv.Atoi(id)
+	if err != nil || bookID <= 0 {
+		return nil, errItemNotFound
+	}
+
+	book, err := h.s.repository.GetBook(ctx, bookID)
+	if err != nil {
+		return nil, errItemNotFound
+	}
+
+	return book, nil
+}
+
+func (h *sip2Handler) openLoan(ctx context.Context, memberID, bookID int) *model.BorrowingDetail {
+	loans, err := h.s.repository.ListMemberBorrowings(ctx, memberID)
+	if err != nil {
+		slog.ErrorContext(ctx, "listing borrowings failed", "err", err)
+		return nil
+	}
+
+	for i := range loans {
+		if loans[i].BookID == bookID {
+			return &loans[i]
+		}
+	}
+
+	return nil
+}
+
+// patronStatus builds the 14 character patron status field. An expired
+// membership or a block denies charge and renewal privileges, a member at
+// the loan limit has too many items charged.
+func (h *sip2Handler) patronStatus(ctx context.Context, member *model.Member, loans int) string {
+	status := []byte(sip2PatronStatusOK)
+
+	if member.MembershipExpired(time.Now()) || member.Blocked {
+		status[0], status[1] = 'Y', 'Y'
+	}
+
+	if category, err := h.s.memberCategory(ctx, member); err == nil && loans >= category.MaxLoans {
+		status[5] = 'Y'
+	}
+
+	return string(status)
+}
+
+// circulationMessage returns the screen message for a failed circulation
+// request: the rule that refused it, or fallback for other errors.
+func circulationMessage(err error, fallback string) string {
+	var cerr *apiError
+	if errors.As(err, &cerr) {
+		return cerr.Message
+	}
+
+	slog.Error("sip2 circulation request failed", "err", err)
+
+	return fallback
+}
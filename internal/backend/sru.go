@@ -0,0 +1,240 @@
+package backend
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/tliefheid/go-ils/internal/sru"
+)
+
+const (
+	sruDefaultRecords = 10
+	sruMaxRecords     = 100
+	sruDefaultTerms   = 20
+)
+
+// sruHandler implements the SRU 1.2 and 2.0 protocol on top of the book
+// store. Errors are reported as SRU diagnostics with status 200, as the
+// protocol requires.
+func (s *Service) sruHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	version := params.Get("version")
+	operation := params.Get("operation")
+
+	if version == "" {
+		version = sru.Version20
+		if operation != "" {
+			version = sru.Version12
+		}
+	}
+
+	if operation == "" {
+		switch {
+		case params.Get("query") != "":
+			operation = "searchRetrieve"
+		case params.Get("scanClause") != "":
+			operation = "scan"
+		default:
+			operation = "explain"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+
+	var diag *sru.Diagnostic
+	if !sru.SupportedVersion(version) {
+		diag = sru.Diag(sru.DiagUnsupportedVersion, version)
+		version = sru.Version12
+	}
+
+	var err error
+
+	switch operation {
+	case "searchRetrieve":
+		err = s.sruSearchRetrieve(w, r, version, diag)
+	case "scan":
+		err = s.sruScan(w, r, version, diag)
+	case "explain":
+		err = s.sruExplain(w, r, version, diag)
+	default:
+		err = sru.WriteExplain(w, sru.ExplainResponse{
+			Version:     version,
+			Diagnostics: []*sru.Diagnostic{sru.Diag(sru.DiagUnsupportedOp, operation)},
+		})
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "writing SRU response failed", "err", err)
+	}
+}
+
+func (s *Service) sruSearchRetrieve(w http.ResponseWriter, r *http.Request, version string, diag *sru.Diagnostic) error {
+	resp := sru.SearchRetrieveResponse{Version: version}
+
+	fail := func(d *sru.Diagnostic) error {
+		resp.Diagnostics = []*sru.Diagnostic{d}
+		return sru.WriteSearchRetrieve(w, resp)
+	}
+
+	if diag != nil {
+		return fail(diag)
+	}
+
+	params := r.URL.Query()
+
+	query := params.Get("query")
+	if query == "" {
+		return fail(sru.Diag(sru.DiagMissingParam, "query"))
+	}
+
+	start, err := intParam(params.Get("startRecord"), 1)
+	if err != nil || start < 1 {
+		return fail(sru.Diag(sru.DiagUnsupportedParam, "startRecord"))
+	}
+
+	max, err := intParam(params.Get("maximumRecords"), sruDefaultRecords)
+	if err != nil || max < 0 {
+		return fail(sru.Diag(sru.DiagUnsupportedParam, "maximumRecords"))
+	}
+
+	if max > sruMaxRecords {
+		max = sruMaxRecords
+	}
+
+	schema, ok := sru.LookupSchema(params.Get("recordSchema"))
+	if !ok {
+		return fail(sru.Diag(sru.DiagUnsupportedSchema, params.Get("recordSchema")))
+	}
+
+	packing := params.Get("recordPacking")
+	if version == sru.Version20 {
+		packing = params.Get("recordXMLEscaping")
+	}
+
+	switch packing {
+	case "", "xml":
+	case "string":
+		resp.Escaped = true
+	default:
+		return fail(sru.Diag(sru.DiagUnsupportedPacking, packing))
+	}
+
+	q, err := sru.ParseCQL(query)
+	if err != nil {
+		var d *sru.Diagnostic
+		if errors.As(err, &d) {
+			return fail(d)
+		}
+
+		return fail(sru.Diag(sru.DiagQuerySyntax, err.Error()))
+	}
+
+	books, total, err := s.repository.QueryBooks(r.Context(), q, start-1, max)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "querying books for SRU failed", "err", err)
+		return fail(sru.Diag(sru.DiagGeneral, "database error"))
+	}
+
+	resp.NumberOfRecords = total
+
+	if total > 0 && start > total {
+		return fail(sru.Diag(sru.DiagFirstRecordRange, strconv.Itoa(start)))
+	}
+
+	for i, b := range books {
+		resp.Records = append(resp.Records, sru.Record{
+			Schema:   schema.URI,
+			Data:     schema.Encode(b),
+			Position: start + i,
+		})
+	}
+
+	if next := start + len(books); next <= total && len(books) > 0 {
+		resp.NextRecordPosition = next
+	}
+
+	return sru.WriteSearchRetrieve(w, resp)
+}
+
+func (s *Service) sruScan(w http.ResponseWriter, r *http.Request, version string, diag *sru.Diagnostic) error {
+	resp := sru.ScanResponse{Version: version}
+
+	fail := func(d *sru.Diagnostic) error {
+		resp.Diagnostics = []*sru.Diagnostic{d}
+		return sru.WriteScan(w, resp)
+	}
+
+	if diag != nil {
+		return fail(diag)
+	}
+
+	params := r.URL.Query()
+
+	clause := params.Get("scanClause")
+	if clause == "" {
+		return fail(sru.Diag(sru.DiagMissingParam, "scanClause"))
+	}
+
+	max, err := intParam(params.Get("maximumTerms"), sruDefaultTerms)
+	if err != nil || max < 1 {
+		return fail(sru.Diag(sru.DiagUnsupportedParam, "maximumTerms"))
+	}
+
+	if max > sruMaxRecords {
+		max = sruMaxRecords
+	}
+
+	field, from, err := sru.ParseScanClause(clause)
+	if err != nil {
+		var d *sru.Diagnostic
+		if errors.As(err, &d) {
+			return fail(d)
+		}
+
+		return fail(sru.Diag(sru.DiagQuerySyntax, err.Error()))
+	}
+
+	terms, err := s.repository.ScanBooks(r.Context(), field, from, max)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "scanning books for SRU failed", "err", err)
+		return fail(sru.Diag(sru.DiagInvalidTerm, from))
+	}
+
+	for _, t := range terms {
+		resp.Terms = append(resp.Terms, sru.ScanTerm{Value: t.Value, NumberOfRecords: t.Count})
+	}
+
+	return sru.WriteScan(w, resp)
+}
+
+func (s *Service) sruExplain(w http.ResponseWriter, r *http.Request, version string, diag *sru.Diagnostic) error {
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host, port = r.Host, "80"
+	}
+
+	resp := sru.ExplainResponse{
+		Version:  version,
+		Host:     host,
+		Port:     port,
+		Database: "sru",
+	}
+
+	if diag != nil {
+		resp.Diagnostics = []*sru.Diagnostic{diag}
+	}
+
+	return sru.WriteExplain(w, resp)
+}
+
+func intParam(v string, fallback int) (int, error) {
+	if v == "" {
+		return fallback, nil
+	}
+
+	return strconv.Atoi(v)
+}
@@ -0,0 +1,142 @@
+package backend
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Failed logins allowed per account and per client address within
+// loginWindow. Past the limit logins are refused until the window of the
+// first failure passed, whether the credentials are right or not.
+const (
+	loginWindow          = 15 * time.Minute
+	maxAccountFailures   = 5
+	maxAddressFailures   = 50
+	forwardedForHeader   = "X-Forwarded-For"
+	throttleSweepEntries = 10000
+)
+
+var errTooManyAttempts = &apiError{Code: "too_many_attempts", Message: "Too many failed logins, try again later"}
+
+// loginThrottle counts failed logins by account and by client address.
+type loginThrottle struct {
+	mu       sync.Mutex
+	failures map[string]*failedLogins
+}
+
+type failedLogins struct {
+	count int
+	first time.Time
+}
+
+func newLoginThrottle() *loginThrottle {
+	return &loginThrottle{failures: map[string]*failedLogins{}}
+}
+
+// wait returns how long a login to account from address has to wait, zero
+// when it may be tried now.
+func (t *loginThrottle) wait(account, address string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return max(t.waitFor("account:"+account, maxAccountFailures, now), t.waitFor("address:"+address, maxAddressFailures, now))
+}
+
+func (t *loginThrottle) waitFor(key string, limit int, now time.Time) time.Duration {
+	f, ok := t.failures[key]
+	if !ok || f.count < limit {
+		return 0
+	}
+
+	return max(f.first.Add(loginWindow).Sub(now), 0)
+}
+
+// failed counts a failed login to account from address.
+func (t *loginThrottle) failed(account, address string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.failures) > throttleSweepEntries {
+		t.sweep(now)
+	}
+
+	for _, key := range []string{"account:" + account, "address:" + address} {
+		f, ok := t.failures[key]
+		if !ok || now.Sub(f.first) >= loginWindow {
+			f = &failedLogins{first: now}
+			t.failures[key] = f
+		}
+
+		f.count++
+	}
+}
+
+// succeeded forgets the failed logins to account, the address keeps its
+// count so one valid account does not open the way to guessing others.
+func (t *loginThrottle) succeeded(account string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.failures, "account:"+account)
+}
+
+// sweep drops the counts whose window passed.
+func (t *loginThrottle) sweep(now time.Time) {
+	for key, f := range t.failures {
+		if now.Sub(f.first) >= loginWindow {
+			delete(t.failures, key)
+		}
+	}
+}
+
+// writeTooManyAttempts refuses a throttled login, telling the client when to
+// try again.
+func writeTooManyAttempts(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	writeAPIError(w, r, errTooManyAttempts)
+}
+
+// clientAddress returns the address a request comes from. Behind one of the
+// trusted proxies, such as the web frontend, it is the last address the
+// proxies added to X-Forwarded-For that is not a proxy itself.
+func (s *Service) clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !s.trustedProxy(addr) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values(forwardedForHeader), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+
+		addr = hop
+		if !s.trustedProxy(hop) {
+			break
+		}
+	}
+
+	return addr.String()
+}
+
+func (s *Service) trustedProxy(addr netip.Addr) bool {
+	for _, p := range s.trustedProxies {
+		if p.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+
+	return false
+}
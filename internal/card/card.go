@@ -0,0 +1,81 @@
+// Package card generates and validates library card numbers and renders
+// printable cards.
+package card
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Format describes library card numbers: a fixed prefix, a zero padded
+// sequence number and a trailing Luhn check digit, Length digits in total.
+type Format struct {
+	Prefix string
+	Length int
+}
+
+// DefaultFormat is the common 14 digit Codabar library card layout.
+var DefaultFormat = Format{Prefix: "2", Length: 14}
+
+// Validate checks that the format can produce numbers.
+func (f Format) Validate() error {
+	if _, err := strconv.ParseUint(f.Prefix, 10, 64); f.Prefix != "" && err != nil {
+		return fmt.Errorf("card prefix %q must be numeric", f.Prefix)
+	}
+
+	if f.Length < len(f.Prefix)+2 {
+		return fmt.Errorf("card length %d too short for prefix %q", f.Length, f.Prefix)
+	}
+
+	return nil
+}
+
+// Generate builds the card number for sequence number seq.
+func (f Format) Generate(seq int64) (string, error) {
+	width := f.Length - len(f.Prefix) - 1
+
+	body := fmt.Sprintf("%s%0*d", f.Prefix, width, seq)
+	if len(body) != f.Length-1 {
+		return "", errors.New("card sequence exhausted for configured length")
+	}
+
+	return body + strconv.Itoa(luhn(body)), nil
+}
+
+// Valid reports whether number matches the format and its check digit.
+func (f Format) Valid(number string) bool {
+	if len(number) != f.Length || !strings.HasPrefix(number, f.Prefix) {
+		return false
+	}
+
+	for _, c := range number {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return luhn(number[:len(number)-1]) == int(number[len(number)-1]-'0')
+}
+
+// luhn returns the check digit for the digits in body.
+func luhn(body string) int {
+	sum := 0
+	double := true
+
+	for i := len(body) - 1; i >= 0; i-- {
+		d := int(body[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+
+		sum += d
+		double = !double
+	}
+
+	return (10 - sum%10) % 10
+}
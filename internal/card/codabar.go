@@ -0,0 +1,42 @@
+package card
+
+import "fmt"
+
+// codabar holds the 7 element patterns (bar, space, bar, ...) of each
+// Codabar character. A set bit, most significant first, is a wide element.
+var codabar = map[rune]uint8{
+	'0': 0x03, '1': 0x06, '2': 0x09, '3': 0x60, '4': 0x12,
+	'5': 0x42, '6': 0x21, '7': 0x24, '8': 0x30, '9': 0x48,
+	'-': 0x0c, '$': 0x18, ':': 0x45, '/': 0x51, '.': 0x54, '+': 0x15,
+	'A': 0x1a, 'B': 0x29, 'C': 0x0b, 'D': 0x0e,
+}
+
+const codabarWideRatio = 3
+
+// Codabar encodes value between A start and stop characters and returns
+// the element widths in narrow units, starting with a bar.
+func Codabar(value string) ([]int, error) {
+	var widths []int
+
+	for i, c := range "A" + value + "A" {
+		pattern, ok := codabar[c]
+		if !ok {
+			return nil, fmt.Errorf("character %q cannot be encoded in codabar", c)
+		}
+
+		if i > 0 {
+			widths = append(widths, 1) // inter character gap
+		}
+
+		for bit := 6; bit >= 0; bit-- {
+			w := 1
+			if pattern&(1<<bit) != 0 {
+				w = codabarWideRatio
+			}
+
+			widths = append(widths, w)
+		}
+	}
+
+	return widths, nil
+}
@@ -0,0 +1,118 @@
+package card
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ID-1 card size in points (85.6 x 54 mm).
+const (
+	pageWidth  = 242.65
+	pageHeight = 153.07
+	margin     = 14.0
+)
+
+// Printable holds what is printed on a card.
+type Printable struct {
+	Library    string
+	MemberName string
+	Number     string
+	ValidUntil string // empty when the card does not expire
+}
+
+// WritePDF renders a single page, card sized PDF with the member details and
+// a Codabar barcode of the card number.
+func WritePDF(w io.Writer, p Printable) error {
+	widths, err := Codabar(p.Number)
+	if err != nil {
+		return err
+	}
+
+	var content bytes.Buffer
+
+	text(&content, "F2", 11, margin, pageHeight-margin-11, p.Library)
+	text(&content, "F1", 10, margin, pageHeight-margin-30, p.MemberName)
+
+	if p.ValidUntil != "" {
+		text(&content, "F1", 7, margin, pageHeight-margin-42, "Valid until "+p.ValidUntil)
+	}
+
+	total := 0
+	for _, wd := range widths {
+		total += wd
+	}
+
+	unit := (pageWidth - 2*margin) / float64(total)
+	x := margin
+
+	for i, wd := range widths {
+		if i%2 == 0 {
+			fmt.Fprintf(&content, "%.3f %.3f %.3f %.3f re\n", x, 30.0, unit*float64(wd), 45.0)
+		}
+
+		x += unit * float64(wd)
+	}
+
+	content.WriteString("f\n")
+	text(&content, "F1", 9, margin, 16, p.Number)
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 5 0 R /F2 6 0 R >> >> /Contents 4 0 R >>", pageWidth, pageHeight),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+	}
+
+	var out bytes.Buffer
+
+	out.WriteString("%PDF-1.4\n")
+
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	_, err = w.Write(out.Bytes())
+
+	return err
+}
+
+func text(buf *bytes.Buffer, font string, size, x, y float64, s string) {
+	fmt.Fprintf(buf, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfString(s))
+}
+
+// pdfString escapes s for a literal PDF string. Characters outside Latin-1
+// are replaced, the standard fonts cannot show them.
+func pdfString(s string) string {
+	var b strings.Builder
+
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r > 0xff || r < 0x20:
+			b.WriteByte('?')
+		case r >= 0x80:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
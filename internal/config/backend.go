@@ -0,0 +1,301 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/tliefheid/go-ils/internal/card"
+	"github.com/tliefheid/go-ils/internal/logging"
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/tracing"
+)
+
+// Backend holds the settings of the backend service.
+type Backend struct {
+	Server  Server  `yaml:"server" toml:"server"`
+	Log     Log     `yaml:"log" toml:"log"`
+	Tracing Tracing `yaml:"tracing" toml:"tracing"`
+	DB      DB      `yaml:"db" toml:"db"`
+	SIP2    SIP2    `yaml:"sip2" toml:"sip2"`
+	Library Library `yaml:"library" toml:"library"`
+	Policy  Policy  `yaml:"policy" toml:"policy"`
+	Auth    Auth    `yaml:"auth" toml:"auth"`
+	OIDC    OIDC    `yaml:"oidc" toml:"oidc"`
+
+	RequestTimeoutSeconds int `yaml:"request_timeout_seconds" toml:"request_timeout_seconds" env:"REQUEST_TIMEOUT_SECONDS" help:"seconds a request may take, 0 for no limit"`
+}
+
+// DefaultBackend returns the backend defaults, which suit a local database
+// and the docker compose setup.
+func DefaultBackend() Backend {
+	return Backend{
+		Server:  defaultServer(":8080"),
+		Log:     Log{Level: "info", Format: logging.FormatText},
+		Tracing: Tracing{Exporter: tracing.ExporterNone},
+		DB: DB{
+			Host:                   "localhost",
+			Port:                   5432,
+			User:                   "postgres",
+			Name:                   "library",
+			SSLMode:                "disable",
+			MaxOpenConns:           25,
+			MaxIdleConns:           5,
+			ConnMaxLifetimeSeconds: 1800,
+			ConnMaxIdleTimeSeconds: 300,
+			QueryTimeoutSeconds:    10,
+		},
+		SIP2: SIP2{Institution: "library"},
+		Library: Library{
+			Name:       "Library ILS",
+			CardPrefix: card.DefaultFormat.Prefix,
+			CardLength: card.DefaultFormat.Length,
+		},
+		Policy: Policy{
+			OverdueBlockDays: 14,
+			ArchiveAfterDays: 365,
+			FinePerDayCents:  25,
+		},
+		Auth: Auth{
+			AdminUsername:      "admin",
+			StaffSessionHours:  12,
+			PatronSessionHours: 24,
+		},
+		OIDC:                  OIDC{GroupsClaim: "groups"},
+		RequestTimeoutSeconds: 30,
+	}
+}
+
+func (c *Backend) Validate() error {
+	return errors.Join(
+		c.Server.validate(),
+		c.Log.validate(),
+		c.Tracing.validate(),
+		c.DB.validate(),
+		c.SIP2.validate(),
+		c.Library.validate(),
+		c.Policy.validate(),
+		c.Auth.validate(),
+		c.OIDC.validate(),
+		notNegative("request_timeout_seconds", c.RequestTimeoutSeconds),
+		c.requestFitsWrite(),
+	)
+}
+
+// requestFitsWrite fails when requests may run past the write timeout,
+// whose clients would get no answer instead of the timeout problem.
+func (c *Backend) requestFitsWrite() error {
+	write, request := c.Server.WriteTimeoutSeconds, c.RequestTimeoutSeconds
+	if write > 0 && (request == 0 || request >= write) {
+		return fmt.Errorf("request_timeout_seconds: %d is not shorter than server.write_timeout_seconds %d", request, write)
+	}
+
+	return nil
+}
+
+// DB holds the database connection and pool settings.
+type DB struct {
+	Host     string `yaml:"host" toml:"host" env:"DB_HOST" help:"database host"`
+	Port     int    `yaml:"port" toml:"port" env:"DB_PORT" help:"database port"`
+	User     string `yaml:"user" toml:"user" env:"DB_USER" help:"database user"`
+	Password string `yaml:"password" toml:"password" env:"DB_PASSWORD" help:"database password" secret:"true"`
+	Name     string `yaml:"name" toml:"name" env:"DB_NAME" help:"database name"`
+	SSLMode  string `yaml:"sslmode" toml:"sslmode" env:"DB_SSLMODE" help:"TLS to the database: disable, require, verify-ca or verify-full"`
+
+	MaxOpenConns           int `yaml:"max_open_conns" toml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" help:"connections open at most, 0 for no limit"`
+	MaxIdleConns           int `yaml:"max_idle_conns" toml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" help:"idle connections kept open"`
+	ConnMaxLifetimeSeconds int `yaml:"conn_max_lifetime_seconds" toml:"conn_max_lifetime_seconds" env:"DB_CONN_MAX_LIFETIME_SECONDS" help:"seconds a connection is reused, 0 for no limit"`
+	ConnMaxIdleTimeSeconds int `yaml:"conn_max_idle_time_seconds" toml:"conn_max_idle_time_seconds" env:"DB_CONN_MAX_IDLE_TIME_SECONDS" help:"seconds a connection stays idle, 0 for no limit"`
+	QueryTimeoutSeconds    int `yaml:"query_timeout_seconds" toml:"query_timeout_seconds" env:"DB_QUERY_TIMEOUT_SECONDS" help:"seconds a query may take, 0 for no limit"`
+}
+
+func (d DB) validate() error {
+	var errs []error
+
+	errs = append(errs, required("db.host", d.Host), required("db.user", d.User), required("db.name", d.Name))
+
+	if d.Port < 1 || d.Port > 65535 {
+		errs = append(errs, fmt.Errorf("db.port: %d is not a port", d.Port))
+	}
+
+	switch d.SSLMode {
+	case "disable", "require", "verify-ca", "verify-full":
+	default:
+		errs = append(errs, fmt.Errorf("db.sslmode: %q is not disable, require, verify-ca or verify-full", d.SSLMode))
+	}
+
+	errs = append(errs,
+		notNegative("db.max_open_conns", d.MaxOpenConns),
+		notNegative("db.max_idle_conns", d.MaxIdleConns),
+		notNegative("db.conn_max_lifetime_seconds", d.ConnMaxLifetimeSeconds),
+		notNegative("db.conn_max_idle_time_seconds", d.ConnMaxIdleTimeSeconds),
+		notNegative("db.query_timeout_seconds", d.QueryTimeoutSeconds),
+	)
+
+	if d.MaxOpenConns > 0 && d.MaxIdleConns > d.MaxOpenConns {
+		errs = append(errs, fmt.Errorf("db.max_idle_conns: %d is more than the %d open connections allowed", d.MaxIdleConns, d.MaxOpenConns))
+	}
+
+	return errors.Join(errs...)
+}
+
+// DSN returns the connection string of the database, with the values
+// quoted so passwords may hold spaces and quotes.
+func (d DB) DSN() string {
+	quote := func(s string) string {
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+	}
+
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		quote(d.Host), d.Port, quote(d.User), quote(d.Password), quote(d.Name), d.SSLMode)
+}
+
+// SIP2 holds the settings of the SIP2 server for self-service kiosks.
+type SIP2 struct {
+	Addr        string `yaml:"addr" toml:"addr" env:"SIP2" help:"address the SIP2 server listens on, empty disables it"`
+	User        string `yaml:"user" toml:"user" env:"SIP2_USER" help:"SIP2 login user the self checks send"`
+	Password    string `yaml:"password" toml:"password" env:"SIP2_PASSWORD" help:"SIP2 login password" secret:"true"`
+	Institution string `yaml:"institution" toml:"institution" env:"SIP2_INSTITUTION" help:"institution ID in SIP2 responses"`
+}
+
+func (s SIP2) validate() error {
+	if s.Addr == "" {
+		return nil
+	}
+
+	return errors.Join(required("sip2.user", s.User), required("sip2.password", s.Password))
+}
+
+// Library holds the name and the library card settings.
+type Library struct {
+	Name             string `yaml:"name" toml:"name" env:"LIBRARY_NAME" help:"library name printed on cards"`
+	CardPrefix       string `yaml:"card_prefix" toml:"card_prefix" env:"CARD_PREFIX" help:"numeric prefix of card numbers"`
+	CardLength       int    `yaml:"card_length" toml:"card_length" env:"CARD_LENGTH" help:"digits in card numbers, check digit included"`
+	CardValidityDays int    `yaml:"card_validity_days" toml:"card_validity_days" env:"CARD_VALIDITY_DAYS" help:"days new cards are valid, 0 for no expiry"`
+}
+
+func (l Library) validate() error {
+	var errs []error
+
+	if err := l.CardFormat().Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("library: %w", err))
+	}
+
+	errs = append(errs, notNegative("library.card_validity_days", l.CardValidityDays))
+
+	return errors.Join(errs...)
+}
+
+// CardFormat returns the format of the card numbers.
+func (l Library) CardFormat() card.Format {
+	return card.Format{Prefix: l.CardPrefix, Length: l.CardLength}
+}
+
+// Policy holds the circulation and retention rules that are not set per
+// membership category.
+type Policy struct {
+	OverdueBlockDays  int  `yaml:"overdue_block_days" toml:"overdue_block_days" env:"OVERDUE_BLOCK_DAYS" help:"days overdue before a member is blocked, 0 disables blocks"`
+	FinePerDayCents   int  `yaml:"fine_per_day_cents" toml:"fine_per_day_cents" env:"FINE_PER_DAY_CENTS" help:"fine in cents per day late, 0 disables fines"`
+	LoanRetentionDays int  `yaml:"loan_retention_days" toml:"loan_retention_days" env:"LOAN_RETENTION_DAYS" help:"days returned loans stay linked to the member, 0 keeps them"`
+	RetentionDryRun   bool `yaml:"retention_dry_run" toml:"retention_dry_run" env:"LOAN_RETENTION_DRY_RUN" help:"only report what the retention job would unlink"`
+	ArchiveAfterDays  int  `yaml:"archive_after_days" toml:"archive_after_days" env:"ARCHIVE_AFTER_DAYS" help:"days deleted members stay restorable, 0 disables archival"`
+}
+
+func (p Policy) validate() error {
+	return errors.Join(
+		notNegative("policy.overdue_block_days", p.OverdueBlockDays),
+		notNegative("policy.fine_per_day_cents", p.FinePerDayCents),
+		notNegative("policy.loan_retention_days", p.LoanRetentionDays),
+		notNegative("policy.archive_after_days", p.ArchiveAfterDays),
+	)
+}
+
+// Auth holds the staff and patron login settings.
+type Auth struct {
+	AdminUsername      string   `yaml:"admin_username" toml:"admin_username" env:"ADMIN_USERNAME" help:"first admin account, created when there are no staff users"`
+	AdminPassword      string   `yaml:"admin_password" toml:"admin_password" env:"ADMIN_PASSWORD" help:"password of the first admin account" secret:"true"`
+	StaffSessionHours  int      `yaml:"staff_session_hours" toml:"staff_session_hours" env:"STAFF_SESSION_HOURS" help:"hours a staff login lasts"`
+	PatronSessionHours int      `yaml:"patron_session_hours" toml:"patron_session_hours" env:"PATRON_SESSION_HOURS" help:"hours a patron portal login lasts"`
+	TrustedProxies     []string `yaml:"trusted_proxies" toml:"trusted_proxies" env:"TRUSTED_PROXIES" help:"comma separated addresses or CIDR ranges of proxies, such as the web frontend, whose X-Forwarded-For names the client"`
+}
+
+func (a Auth) validate() error {
+	var errs []error
+
+	if a.StaffSessionHours < 1 {
+		errs = append(errs, fmt.Errorf("auth.staff_session_hours: %d is less than an hour", a.StaffSessionHours))
+	}
+
+	if a.PatronSessionHours < 1 {
+		errs = append(errs, fmt.Errorf("auth.patron_session_hours: %d is less than an hour", a.PatronSessionHours))
+	}
+
+	for _, p := range a.TrustedProxies {
+		if _, err := parsePrefix(p); err != nil {
+			errs = append(errs, fmt.Errorf("auth.trusted_proxies: %q is not an address or CIDR range", p))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Proxies returns the trusted proxies as address ranges.
+func (a Auth) Proxies() []netip.Prefix {
+	var list []netip.Prefix
+
+	for _, p := range a.TrustedProxies {
+		if prefix, err := parsePrefix(p); err == nil {
+			list = append(list, prefix)
+		}
+	}
+
+	return list
+}
+
+// parsePrefix parses a CIDR range or a single address.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+
+	return netip.ParsePrefix(s)
+}
+
+// OIDC holds the identity provider the backend trusts for single sign-on
+// and how its groups map to staff roles.
+type OIDC struct {
+	Issuer          string   `yaml:"issuer" toml:"issuer" env:"OIDC_ISSUER" help:"identity provider URL, empty disables single sign-on"`
+	ClientID        string   `yaml:"client_id" toml:"client_id" env:"OIDC_CLIENT_ID" help:"the web UI's client ID, the audience of ID tokens"`
+	GroupsClaim     string   `yaml:"groups_claim" toml:"groups_claim" env:"OIDC_GROUPS_CLAIM" help:"ID token claim listing the user's groups"`
+	AdminGroups     []string `yaml:"admin_groups" toml:"admin_groups" env:"OIDC_ADMIN_GROUPS" help:"comma separated groups made admin"`
+	LibrarianGroups []string `yaml:"librarian_groups" toml:"librarian_groups" env:"OIDC_LIBRARIAN_GROUPS" help:"comma separated groups made librarian"`
+	VolunteerGroups []string `yaml:"volunteer_groups" toml:"volunteer_groups" env:"OIDC_VOLUNTEER_GROUPS" help:"comma separated groups made volunteer"`
+	ReadOnlyGroups  []string `yaml:"read_only_groups" toml:"read_only_groups" env:"OIDC_READ_ONLY_GROUPS" help:"comma separated groups given read-only access"`
+}
+
+func (o OIDC) validate() error {
+	if o.Issuer == "" {
+		return nil
+	}
+
+	return errors.Join(required("oidc.client_id", o.ClientID), required("oidc.groups_claim", o.GroupsClaim))
+}
+
+// RoleGroups maps the roles to the provider groups that give them.
+func (o OIDC) RoleGroups() map[model.StaffRole][]string {
+	groups := map[model.StaffRole][]string{}
+
+	for role, list := range map[model.StaffRole][]string{
+		model.RoleAdmin:     o.AdminGroups,
+		model.RoleLibrarian: o.LibrarianGroups,
+		model.RoleVolunteer: o.VolunteerGroups,
+		model.RoleReadOnly:  o.ReadOnlyGroups,
+	} {
+		if len(list) > 0 {
+			groups[role] = list
+		}
+	}
+
+	return groups
+}
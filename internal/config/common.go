@@ -0,0 +1,142 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/tliefheid/go-ils/internal/logging"
+	"github.com/tliefheid/go-ils/internal/server"
+	"github.com/tliefheid/go-ils/internal/tracing"
+)
+
+// Server holds the settings of the HTTP server of a service.
+type Server struct {
+	HTTP                     string `yaml:"http" toml:"http" env:"HTTP" help:"address the HTTP server listens on"`
+	ReadHeaderTimeoutSeconds int    `yaml:"read_header_timeout_seconds" toml:"read_header_timeout_seconds" env:"HTTP_READ_HEADER_TIMEOUT_SECONDS" help:"seconds a client may take to send the request headers"`
+	ReadTimeoutSeconds       int    `yaml:"read_timeout_seconds" toml:"read_timeout_seconds" env:"HTTP_READ_TIMEOUT_SECONDS" help:"seconds a client may take to send a request, 0 for no limit"`
+	WriteTimeoutSeconds      int    `yaml:"write_timeout_seconds" toml:"write_timeout_seconds" env:"HTTP_WRITE_TIMEOUT_SECONDS" help:"seconds to answer a request, 0 for no limit"`
+	IdleTimeoutSeconds       int    `yaml:"idle_timeout_seconds" toml:"idle_timeout_seconds" env:"HTTP_IDLE_TIMEOUT_SECONDS" help:"seconds an idle keep-alive connection stays open"`
+	ShutdownDrainSeconds     int    `yaml:"shutdown_drain_seconds" toml:"shutdown_drain_seconds" env:"SHUTDOWN_DRAIN_SECONDS" help:"seconds readiness fails before the server shuts down"`
+	ShutdownTimeoutSeconds   int    `yaml:"shutdown_timeout_seconds" toml:"shutdown_timeout_seconds" env:"SHUTDOWN_TIMEOUT_SECONDS" help:"seconds in-flight requests and background work get to finish on shutdown"`
+	TLSCertFile              string `yaml:"tls_cert_file" toml:"tls_cert_file" env:"TLS_CERT_FILE" help:"PEM certificate to serve HTTPS with, reloaded when it changes"`
+	TLSKeyFile               string `yaml:"tls_key_file" toml:"tls_key_file" env:"TLS_KEY_FILE" help:"PEM private key of the certificate"`
+}
+
+// defaultServer returns the server defaults listening on addr.
+func defaultServer(addr string) Server {
+	return Server{
+		HTTP:                     addr,
+		ReadHeaderTimeoutSeconds: 10,
+		ReadTimeoutSeconds:       30,
+		WriteTimeoutSeconds:      60,
+		IdleTimeoutSeconds:       120,
+		ShutdownDrainSeconds:     5,
+		ShutdownTimeoutSeconds:   15,
+	}
+}
+
+func (s Server) validate() error {
+	var errs []error
+
+	errs = append(errs,
+		required("server.http", s.HTTP),
+		positive("server.read_header_timeout_seconds", s.ReadHeaderTimeoutSeconds),
+		notNegative("server.read_timeout_seconds", s.ReadTimeoutSeconds),
+		notNegative("server.write_timeout_seconds", s.WriteTimeoutSeconds),
+		positive("server.idle_timeout_seconds", s.IdleTimeoutSeconds),
+		notNegative("server.shutdown_drain_seconds", s.ShutdownDrainSeconds),
+		positive("server.shutdown_timeout_seconds", s.ShutdownTimeoutSeconds),
+	)
+
+	if (s.TLSCertFile == "") != (s.TLSKeyFile == "") {
+		errs = append(errs, errors.New("server.tls_cert_file and server.tls_key_file: set both or neither"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Runner returns the settings of the server runner.
+func (s Server) Runner() server.Config {
+	return server.Config{
+		Addr:              s.HTTP,
+		ReadHeaderTimeout: time.Duration(s.ReadHeaderTimeoutSeconds) * time.Second,
+		ReadTimeout:       time.Duration(s.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout:      time.Duration(s.WriteTimeoutSeconds) * time.Second,
+		IdleTimeout:       time.Duration(s.IdleTimeoutSeconds) * time.Second,
+		DrainDelay:        time.Duration(s.ShutdownDrainSeconds) * time.Second,
+		ShutdownTimeout:   time.Duration(s.ShutdownTimeoutSeconds) * time.Second,
+		TLSCertFile:       s.TLSCertFile,
+		TLSKeyFile:        s.TLSKeyFile,
+	}
+}
+
+// Log holds the logging settings.
+type Log struct {
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL" help:"log level: debug, info, warn or error"`
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT" help:"log format: text or json"`
+}
+
+func (l Log) validate() error {
+	var errs []error
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("log.level: %q is not debug, info, warn or error", l.Level))
+	}
+
+	if l.Format != logging.FormatText && l.Format != logging.FormatJSON {
+		errs = append(errs, fmt.Errorf("log.format: %q is not %s or %s", l.Format, logging.FormatText, logging.FormatJSON))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Tracing holds the settings of the trace exporter.
+type Tracing struct {
+	Exporter     string `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER" help:"trace exporter: none, otlp or stdout"`
+	OTLPEndpoint string `yaml:"otlp_endpoint" toml:"otlp_endpoint" env:"OTLP_ENDPOINT" help:"OTLP/HTTP collector URL, the OTEL_EXPORTER_OTLP_* variables when empty"`
+}
+
+func (t Tracing) validate() error {
+	switch t.Exporter {
+	case tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout:
+		return nil
+	}
+
+	return fmt.Errorf("tracing.exporter: %q is not %s, %s or %s", t.Exporter, tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout)
+}
+
+// Config returns the tracing setup of the service name.
+func (t Tracing) Config(name string) tracing.Config {
+	return tracing.Config{ServiceName: name, Exporter: t.Exporter, Endpoint: t.OTLPEndpoint}
+}
+
+// required fails for an empty setting.
+func required(path, value string) error {
+	if value == "" {
+		return fmt.Errorf("%s: required", path)
+	}
+
+	return nil
+}
+
+// positive fails for a number below one.
+func positive(path string, n int) error {
+	if n < 1 {
+		return fmt.Errorf("%s: %d is not positive", path, n)
+	}
+
+	return nil
+}
+
+// notNegative fails for a negative number, zero usually disabling what
+// the setting limits.
+func notNegative(path string, n int) error {
+	if n < 0 {
+		return fmt.Errorf("%s: %d is negative", path, n)
+	}
+
+	return nil
+}
@@ -0,0 +1,246 @@
+// Package config loads the settings of the services in layers: built-in
+// defaults, then a YAML or TOML file, then environment variables, then
+// command line flags, each overriding the one before. Settings are plain
+// structs whose fields name their file key, environment variable and help
+// text in tags; every one also gets a flag named by its path in the file,
+// such as -db.host.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/tliefheid/go-ils/internal/logging"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the configuration file when the -config flag does not.
+const FileEnv = "CONFIG_FILE"
+
+// Config is the settings of a service.
+type Config interface {
+	// Validate reports every invalid setting.
+	Validate() error
+}
+
+// Load fills cfg, a pointer to settings holding the defaults, from the
+// configuration file, the environment and the flags in args, and validates
+// the result. The flags are added to fs, which may hold flags of its own,
+// and parsed.
+func Load(fs *flag.FlagSet, args []string, cfg Config) error {
+	settings := fields(reflect.ValueOf(cfg).Elem(), "")
+
+	file := fs.String("config", os.Getenv(FileEnv), "YAML or TOML configuration `file`, also read from "+FileEnv)
+
+	flags := make([]*flagValue, len(settings))
+	for i, f := range settings {
+		flags[i] = &flagValue{field: f}
+		fs.Var(flags[i], f.path, f.help+" ("+f.env+")")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *file != "" {
+		if err := loadFile(*file, cfg); err != nil {
+			return fmt.Errorf("read %s: %w", *file, err)
+		}
+	}
+
+	for _, f := range settings {
+		value, ok := os.LookupEnv(f.env)
+		if !ok {
+			continue
+		}
+
+		if err := set(f.value, value); err != nil {
+			return fmt.Errorf("invalid %s: %w", f.env, err)
+		}
+	}
+
+	for _, fv := range flags {
+		if fv.parsed.IsValid() {
+			fv.field.value.Set(fv.parsed)
+		}
+	}
+
+	return cfg.Validate()
+}
+
+// Print writes cfg as YAML, usable as a configuration file, with the
+// secrets that are set redacted.
+func Print(w io.Writer, cfg Config) error {
+	c := reflect.New(reflect.TypeOf(cfg).Elem())
+	c.Elem().Set(reflect.ValueOf(cfg).Elem())
+
+	for _, f := range fields(c.Elem(), "") {
+		if f.secret && !f.value.IsZero() {
+			f.value.SetString(logging.Redacted)
+		}
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(c.Interface()); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+// field is a setting of a configuration struct.
+type field struct {
+	// path is the dotted key in the file, such as db.host, and the flag
+	// name.
+	path   string
+	env    string
+	help   string
+	secret bool
+	value  reflect.Value
+}
+
+// fields lists the settings of the struct v, descending into the sections.
+func fields(v reflect.Value, prefix string) []field {
+	var list []field
+
+	t := v.Type()
+	for i := range t.NumField() {
+		sf := t.Field(i)
+
+		key, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+
+		if sf.Type.Kind() == reflect.Struct {
+			list = append(list, fields(v.Field(i), prefix+key+".")...)
+			continue
+		}
+
+		list = append(list, field{
+			path:   prefix + key,
+			env:    sf.Tag.Get("env"),
+			help:   sf.Tag.Get("help"),
+			secret: sf.Tag.Get("secret") == "true",
+			value:  v.Field(i),
+		})
+	}
+
+	return list
+}
+
+// set parses s into v: a string, an integer, a boolean or a comma
+// separated list.
+func set(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+
+		v.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", s)
+		}
+
+		v.SetBool(b)
+	case reflect.Slice:
+		var list []string
+
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+
+		v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+
+	return nil
+}
+
+// flagValue is the flag of a setting. The value is parsed when the flag is
+// and applied after the file and the environment, which it overrides.
+type flagValue struct {
+	field  field
+	parsed reflect.Value
+}
+
+func (f *flagValue) String() string {
+	if f == nil || !f.field.value.IsValid() {
+		return ""
+	}
+
+	v := f.field.value
+	if v.Kind() == reflect.Slice {
+		return strings.Join(v.Interface().([]string), ",")
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+func (f *flagValue) Set(s string) error {
+	parsed := reflect.New(f.field.value.Type()).Elem()
+	if err := set(parsed, s); err != nil {
+		return err
+	}
+
+	f.parsed = parsed
+
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be given as -name without a value.
+func (f *flagValue) IsBoolFlag() bool {
+	return f.field.value.Kind() == reflect.Bool
+}
+
+// loadFile decodes the YAML or TOML file fn, told apart by its extension,
+// into cfg. Unknown keys are errors, so misspelt settings are not ignored.
+func loadFile(fn string, cfg Config) error {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return err
+		}
+
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown settings %v", undecoded)
+		}
+	default:
+		return fmt.Errorf("unknown file type %q, want .yaml, .yml or .toml", filepath.Ext(fn))
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/tliefheid/go-ils/internal/logging"
+	"github.com/tliefheid/go-ils/internal/tracing"
+)
+
+// Frontend holds the settings of the web UI.
+type Frontend struct {
+	Server  Server     `yaml:"server" toml:"server"`
+	Log     Log        `yaml:"log" toml:"log"`
+	Tracing Tracing    `yaml:"tracing" toml:"tracing"`
+	Backend BackendAPI `yaml:"backend" toml:"backend"`
+	OIDC    OIDCClient `yaml:"oidc" toml:"oidc"`
+}
+
+// DefaultFrontend returns the web UI defaults, which suit a backend
+// running on the same machine.
+func DefaultFrontend() Frontend {
+	return Frontend{
+		Server:  defaultServer(":4000"),
+		Log:     Log{Level: "info", Format: logging.FormatText},
+		Tracing: Tracing{Exporter: tracing.ExporterNone},
+		Backend: BackendAPI{URI: "http://localhost:8080", TimeoutSeconds: 15},
+		OIDC:    OIDCClient{RedirectURL: "http://localhost:4000/login/oidc/callback"},
+	}
+}
+
+func (c *Frontend) Validate() error {
+	return errors.Join(
+		c.Server.validate(),
+		c.Log.validate(),
+		c.Tracing.validate(),
+		c.Backend.validate(),
+		c.OIDC.validate(),
+	)
+}
+
+// BackendAPI holds how the web UI reaches the backend.
+type BackendAPI struct {
+	URI            string `yaml:"uri" toml:"uri" env:"BACKEND_URI" help:"base URL of the backend API"`
+	TimeoutSeconds int    `yaml:"timeout_seconds" toml:"timeout_seconds" env:"BACKEND_TIMEOUT_SECONDS" help:"seconds a backend request may take, 0 for the client's default"`
+}
+
+func (b BackendAPI) validate() error {
+	var errs []error
+
+	if u, err := url.Parse(b.URI); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("backend.uri: %q is not an absolute URL", b.URI))
+	}
+
+	errs = append(errs, notNegative("backend.timeout_seconds", b.TimeoutSeconds))
+
+	return errors.Join(errs...)
+}
+
+// OIDCClient holds the web UI's client registration at the identity
+// provider for single sign-on.
+type OIDCClient struct {
+	Issuer       string `yaml:"issuer" toml:"issuer" env:"OIDC_ISSUER" help:"identity provider URL, empty disables single sign-on"`
+	ClientID     string `yaml:"client_id" toml:"client_id" env:"OIDC_CLIENT_ID" help:"client ID at the provider"`
+	ClientSecret string `yaml:"client_secret" toml:"client_secret" env:"OIDC_CLIENT_SECRET" help:"client secret, empty for a public client" secret:"true"`
+	RedirectURL  string `yaml:"redirect_url" toml:"redirect_url" env:"OIDC_REDIRECT_URL" help:"the web UI's /login/oidc/callback as the provider reaches it"`
+}
+
+func (o OIDCClient) validate() error {
+	if o.Issuer == "" {
+		return nil
+	}
+
+	return errors.Join(required("oidc.client_id", o.ClientID), required("oidc.redirect_url", o.RedirectURL))
+}
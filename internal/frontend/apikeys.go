@@ -0,0 +1,104 @@
+package frontend
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tliefheid/go-ils/client"
+	"github.com/tliefheid/go-ils/internal/model"
+)
+
+type apiKeysPageData struct {
+	Keys            []apiKeyView
+	Scopes          []model.APIKeyScope
+	NewKey          *model.NewAPIKey
+	ValidationError map[string]string
+}
+
+// apiKeyView is an API key as shown on the API keys page.
+type apiKeyView struct {
+	model.APIKey
+	IsActive bool
+}
+
+func (s *Service) apiKeysPage(w http.ResponseWriter, r *http.Request) {
+	s.renderAPIKeys(w, r, apiKeysPageData{})
+}
+
+func (s *Service) renderAPIKeys(w http.ResponseWriter, r *http.Request, data apiKeysPageData) {
+	keys, err := s.backend(r).ListAPIKeys(r.Context())
+	if err != nil {
+		s.errorPage(w, r, "Failed to fetch API keys", err)
+		return
+	}
+
+	now := time.Now()
+	for _, k := range keys {
+		data.Keys = append(data.Keys, apiKeyView{APIKey: k, IsActive: k.Active(now)})
+	}
+
+	data.Scopes = model.APIKeyScopes
+
+	s.executeTemplate(w, "apikeys.gohtml", data)
+}
+
+func (s *Service) addAPIKeyPost(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.errorPage(w, r, "Invalid form", err)
+		return
+	}
+
+	req := model.APIKeyRequest{
+		Name:      strings.TrimSpace(r.FormValue("name")),
+		ExpiresAt: r.FormValue("expires_at"),
+	}
+	for _, sc := range r.Form["scopes"] {
+		req.Scopes = append(req.Scopes, model.APIKeyScope(sc))
+	}
+
+	key, err := s.backend(r).AddAPIKey(r.Context(), req)
+
+	if fields, ok := client.FieldErrors(err); ok {
+		s.renderAPIKeys(w, r, apiKeysPageData{ValidationError: fields})
+		return
+	}
+
+	if err != nil {
+		s.errorPage(w, r, "Failed to create API key", err)
+		return
+	}
+
+	s.renderAPIKeys(w, r, apiKeysPageData{NewKey: key})
+}
+
+func (s *Service) rotateAPIKeyPost(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		s.errorPage(w, r, "Invalid API key ID", err)
+		return
+	}
+
+	key, err := s.backend(r).RotateAPIKey(r.Context(), id)
+	if err != nil {
+		s.errorPage(w, r, "Failed to rotate API key", err)
+		return
+	}
+
+	s.renderAPIKeys(w, r, apiKeysPageData{NewKey: key})
+}
+
+func (s *Service) revokeAPIKeyPost(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		s.errorPage(w, r, "Invalid API key ID", err)
+		return
+	}
+
+	if err := s.backend(r).RevokeAPIKey(r.Context(), id); err != nil {
+		s.errorPage(w, r, "Failed to revoke API key", err)
+		return
+	}
+
+	http.Redirect(w, r, "/apikeys", http.StatusSeeOther)
+}
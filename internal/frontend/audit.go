@@ -0,0 +1,155 @@
+package frontend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/tliefheid/go-ils/client"
+	"github.com/tliefheid/go-ils/internal/model"
+)
+
+// historyLimit is how many audit entries the book and member pages show.
+const historyLimit = 20
+
+// auditView is an audit entry with its snapshots formatted for display.
+type auditView struct {
+	model.AuditEntry
+	Before string
+	After  string
+}
+
+type auditPageData struct {
+	Entries  []auditView
+	Total    int
+	Filter   url.Values
+	Actions  []model.AuditAction
+	Entities []model.AuditEntity
+	Prev     string
+	Next     string
+}
+
+// historyData is what the history section of a detail page shows: the
+// latest entries and a link to all of them in the audit log.
+type historyData struct {
+	Entries []auditView
+	Total   int
+	More    string
+}
+
+// auditPage shows the audit log, filtered like the backend's /audit.
+func (s *Service) auditPage(w http.ResponseWriter, r *http.Request) {
+	filter := url.Values{}
+
+	for _, k := range []string{"actor", "action", "entity", "entity_id", "book_id", "member_id", "request_id", "from", "to", "offset"} {
+		if v := r.URL.Query().Get(k); v != "" {
+			filter.Set(k, v)
+		}
+	}
+
+	q := client.AuditQuery{
+		Actor:     filter.Get("actor"),
+		Action:    model.AuditAction(filter.Get("action")),
+		Entity:    model.AuditEntity(filter.Get("entity")),
+		EntityID:  filter.Get("entity_id"),
+		RequestID: filter.Get("request_id"),
+		From:      filter.Get("from"),
+		To:        filter.Get("to"),
+	}
+
+	for k, v := range map[string]*int{"book_id": &q.BookID, "member_id": &q.MemberID, "offset": &q.Offset} {
+		if filter.Get(k) == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(filter.Get(k))
+		if err != nil || n < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			s.errorPage(w, r, "Invalid audit filter", fmt.Errorf("%s must be a number", k))
+
+			return
+		}
+
+		*v = n
+	}
+
+	page, err := s.backend(r).Audit(r.Context(), q)
+	if err != nil {
+		s.errorPage(w, r, "Failed to fetch the audit log", err)
+		return
+	}
+
+	data := auditPageData{
+		Entries:  auditViews(page.Entries),
+		Total:    page.Total,
+		Filter:   filter,
+		Actions:  model.AuditActions,
+		Entities: model.AuditEntities,
+	}
+
+	if page.Offset > 0 {
+		data.Prev = auditOffset(filter, page.Offset-page.Limit)
+	}
+
+	if page.Offset+page.Limit < page.Total {
+		data.Next = auditOffset(filter, page.Offset+page.Limit)
+	}
+
+	s.executeTemplate(w, "audit.gohtml", data)
+}
+
+// historyFunc fetches a page of the history of a book or member.
+type historyFunc func(ctx context.Context, id, offset, limit int) (*model.AuditPage, error)
+
+// history fetches the latest audit entries of the book or member id, and
+// links the rest with the audit log filter.
+func history(r *http.Request, fetch historyFunc, filter string, id int) (historyData, error) {
+	page, err := fetch(r.Context(), id, 0, historyLimit)
+	if err != nil {
+		return historyData{}, err
+	}
+
+	return historyData{
+		Entries: auditViews(page.Entries),
+		Total:   page.Total,
+		More:    "/audit?" + url.Values{filter: {strconv.Itoa(id)}}.Encode(),
+	}, nil
+}
+
+func auditOffset(filter url.Values, offset int) string {
+	q := url.Values{}
+	for k, v := range filter {
+		q[k] = v
+	}
+
+	if offset > 0 {
+		q.Set("offset", strconv.Itoa(offset))
+	} else {
+		q.Del("offset")
+	}
+
+	return "/audit?" + q.Encode()
+}
+
+func auditViews(entries []model.AuditEntry) []auditView {
+	views := make([]auditView, len(entries))
+
+	for i, e := range entries {
+		views[i] = auditView{AuditEntry: e, Before: indentJSON(e.Before), After: indentJSON(e.After)}
+	}
+
+	return views
+}
+
+func indentJSON(b json.RawMessage) string {
+	var out bytes.Buffer
+	if len(b) == 0 || json.Indent(&out, b, "", "  ") != nil {
+		return string(b)
+	}
+
+	return out.String()
+}
@@ -0,0 +1,98 @@
+package frontend
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tliefheid/go-ils/client"
+	"github.com/tliefheid/go-ils/internal/model"
+)
+
+// staffCookie holds the backend session token of a staff login.
+const staffCookie = "staff_session"
+
+// backend returns a client for backend calls made on behalf of the staff
+// user logged in with r. Calls fail with client.ErrUnauthorized once the
+// backend no longer accepts the session.
+func (s *Service) backend(r *http.Request) *client.Client {
+	var token string
+	if c, err := r.Cookie(staffCookie); err == nil {
+		token = c.Value
+	}
+
+	return s.client(r).WithToken(token)
+}
+
+// requireLogin sends requests without a staff session to the login page.
+func requireLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie(staffCookie); err != nil {
+			http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Service) loginPage(w http.ResponseWriter, r *http.Request) {
+	s.executeTemplate(w, "login.gohtml", map[string]interface{}{"Next": r.URL.Query().Get("next"), "SSO": s.oidc != nil})
+}
+
+// safeNext returns next when it stays within the frontend, else "/".
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") {
+		return "/"
+	}
+
+	return next
+}
+
+func (s *Service) loginPost(w http.ResponseWriter, r *http.Request) {
+	username := strings.TrimSpace(r.FormValue("username"))
+	next := safeNext(r.FormValue("next"))
+
+	session, err := s.client(r).Login(r.Context(), username, r.FormValue("password"))
+
+	var cerr *client.Error
+	if errors.As(err, &cerr) && cerr.StatusCode < http.StatusInternalServerError {
+		w.WriteHeader(http.StatusUnauthorized)
+		s.executeTemplate(w, "login.gohtml", map[string]interface{}{
+			"Username": username,
+			"Next":     next,
+			"SSO":      s.oidc != nil,
+			"Error":    cerr.Error(),
+		})
+
+		return
+	}
+
+	if err != nil {
+		s.errorPage(w, r, "Failed to log in", err)
+		return
+	}
+
+	setStaffCookie(w, r, *session)
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+func setStaffCookie(w http.ResponseWriter, r *http.Request, session model.StaffSession) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     staffCookie,
+		Value:    session.Token,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		Secure:   r.TLS != nil,
+	})
+}
+
+func (s *Service) logoutPost(w http.ResponseWriter, r *http.Request) {
+	_ = s.backend(r).Logout(r.Context())
+
+	http.SetCookie(w, &http.Cookie{Name: staffCookie, Path: "/", MaxAge: -1, HttpOnly: true})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
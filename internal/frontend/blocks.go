@@ -0,0 +1,71 @@
+package frontend
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tliefheid/go-ils/internal/model"
+)
+
+func (s *Service) addBlockPost(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		s.errorPage(w, r, "Invalid member ID", err)
+		return
+	}
+
+	_, err = s.backend(r).AddBlock(r.Context(), id, model.BlockRequest{
+		Reason:    strings.TrimSpace(r.FormValue("reason")),
+		ExpiresAt: r.FormValue("expires_at"),
+	})
+	if err != nil {
+		s.errorPage(w, r, "Failed to block member", err)
+		return
+	}
+
+	http.Redirect(w, r, "/members/"+strconv.Itoa(id), http.StatusSeeOther)
+}
+
+func (s *Service) liftBlockPost(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		s.errorPage(w, r, "Invalid member ID", err)
+		return
+	}
+
+	blockID, err := pathID(r, "blockID")
+	if err != nil {
+		s.errorPage(w, r, "Invalid block ID", err)
+		return
+	}
+
+	if err := s.backend(r).LiftBlock(r.Context(), id, blockID); err != nil {
+		s.errorPage(w, r, "Failed to lift block", err)
+		return
+	}
+
+	http.Redirect(w, r, "/members/"+strconv.Itoa(id), http.StatusSeeOther)
+}
+
+// blockView is a member block as shown on the member page.
+type blockView struct {
+	model.MemberBlock
+	IsActive bool
+}
+
+func blockViews(blocks []model.MemberBlock) (views, active []blockView) {
+	now := time.Now()
+
+	for _, b := range blocks {
+		v := blockView{MemberBlock: b, IsActive: b.Active(now)}
+		views = append(views, v)
+
+		if v.IsActive {
+			active = append(active, v)
+		}
+	}
+
+	return views, active
+}
@@ -1,16 +1,14 @@
 package frontend
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
 	"regexp"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/tliefheid/go-ils/client"
 	"github.com/tliefheid/go-ils/internal/model"
 )
 
@@ -19,8 +17,6 @@ var (
 )
 
 func (s *Service) bookPost(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("bookPost called")
-
 	idStr := r.FormValue("id")
 	title := r.FormValue("title")
 	contact := r.FormValue("author")
@@ -28,13 +24,6 @@ func (s *Service) bookPost(w http.ResponseWriter, r *http.Request) {
 	pubYear := r.FormValue("publication_year")
 	copies := r.FormValue("copies_total")
 
-	fmt.Printf("idStr: %v\n", idStr)
-	fmt.Printf("title: %v\n", title)
-	fmt.Printf("contact: %v\n", contact)
-	fmt.Printf("isbn: %v\n", isbn)
-	fmt.Printf("pubYear: %v\n", pubYear)
-	fmt.Printf("copies: %v\n", copies)
-
 	if idStr == "" ||
 		title == "" ||
 		contact == "" ||
@@ -49,20 +38,20 @@ func (s *Service) bookPost(w http.ResponseWriter, r *http.Request) {
 
 			id, err = strconv.Atoi(idStr)
 			if err != nil {
-				s.errorPage(w, "Invalid book ID", err)
+				s.errorPage(w, r, "Invalid book ID", err)
 				return
 			}
 		}
 
 		pubYearInt, err := strconv.Atoi(pubYear)
 		if err != nil {
-			s.errorPage(w, "Invalid publication year", err)
+			s.errorPage(w, r, "Invalid publication year", err)
 			return
 		}
 
 		copiesInt, err := strconv.Atoi(copies)
 		if err != nil {
-			s.errorPage(w, "Invalid copies value", err)
+			s.errorPage(w, r, "Invalid copies value", err)
 			return
 		}
 
@@ -76,13 +65,9 @@ func (s *Service) bookPost(w http.ResponseWriter, r *http.Request) {
 			CopiesAvailable: copiesInt, // Initially all copies are available
 		}
 
-		fmt.Printf("r.URL.String(): %v\n", r.URL.String())
-
 		r.URL.RawQuery = ""
-		fmt.Printf("r.URL after: %v\n", r.URL.String())
 
 		ctx := context.WithValue(r.Context(), "book", book)
-		fmt.Printf("ctx: %v\n", ctx)
 		s.bookUpsertPage(w, r.WithContext(ctx))
 
 		return
@@ -95,20 +80,20 @@ func (s *Service) bookPost(w http.ResponseWriter, r *http.Request) {
 
 		id, err = strconv.Atoi(idStr)
 		if err != nil {
-			s.errorPage(w, "Invalid book ID", err)
+			s.errorPage(w, r, "Invalid book ID", err)
 			return
 		}
 	}
 
 	pubYearInt, err := strconv.Atoi(pubYear)
 	if err != nil {
-		s.errorPage(w, "Invalid publication year", err)
+		s.errorPage(w, r, "Invalid publication year", err)
 		return
 	}
 
 	copiesInt, err := strconv.Atoi(copies)
 	if err != nil {
-		s.errorPage(w, "Invalid copies value", err)
+		s.errorPage(w, r, "Invalid copies value", err)
 		return
 	}
 
@@ -122,135 +107,61 @@ func (s *Service) bookPost(w http.ResponseWriter, r *http.Request) {
 		CopiesAvailable: copiesInt, // Initially all copies are available
 	}
 
-	b, _ := json.Marshal(book)
-
 	if idStr == "new" {
-		fmt.Println("Creating new book")
-
-		fmt.Printf("Book to create: %+v\n", book)
-
 		// New member, send POST request to create
-		err := s.newBook(b)
+		_, err := s.backend(r).AddBook(r.Context(), book)
 		if err != nil {
-			s.errorPage(w, "Failed to create new book", err)
+			s.errorPage(w, r, "Failed to create new book", err)
 			return
 		}
 	} else {
-		fmt.Println("Updating existing book")
-		fmt.Printf("Book to update: %+v\n", book)
+		// Existing member, send PUT request to update, based on the
+		// version the form was loaded with
+		book.Version = formVersion(r)
 
-		// Existing member, send PUT request to update
-		err := s.updateBook(idStr, b)
-		if err != nil {
-			s.errorPage(w, "Failed to update member", err)
+		err := s.backend(r).UpdateBook(r.Context(), book)
+		if errors.Is(err, client.ErrVersionConflict) {
+			s.bookConflictPage(w, r, book)
 			return
 		}
-	}
 
-	s.booksPage(w, r)
-}
-
-func (s *Service) newBook(b []byte) error {
-	resp, err := http.Post(s.uri+"/books", "application/json", bytes.NewReader(b))
-	if err != nil {
-		fmt.Printf("post book creation err: %v\n", err)
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		bodyBytes := new(bytes.Buffer)
-		_, readErr := bodyBytes.ReadFrom(resp.Body)
-
-		if readErr == nil {
-			fmt.Printf("Response body: %s\n", bodyBytes.String())
+		if err != nil {
+			s.errorPage(w, r, "Failed to update member", err)
+			return
 		}
-
-		return errors.New("Invalid response status code: " + strconv.Itoa(resp.StatusCode) + ", because: " + bodyBytes.String())
 	}
 
-	return nil
-}
-
-func (s *Service) updateBook(id string, b []byte) error {
-	client := &http.Client{}
-
-	req, err := http.NewRequest("PUT", s.uri+"/books/"+id, bytes.NewReader(b))
-	if err != nil {
-		return err
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-
-	defer resp.Body.Close()
-
-	bodyBytes := new(bytes.Buffer)
-	_, readErr := bodyBytes.ReadFrom(resp.Body)
-
-	if readErr == nil {
-		fmt.Printf("Response body: %s\n", bodyBytes.String())
-	}
-
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		return errors.New("Invalid response status code: " + strconv.Itoa(resp.StatusCode) + ", because: " + bodyBytes.String())
-	}
-
-	return nil
+	s.booksPage(w, r)
 }
 
 // should return only a boolean
-func (s *Service) checkBook(isbn string) (bool, error) {
-	resp, err := http.Get(s.uri + "/books/isbn/" + isbn)
-	if err != nil {
-		return false, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == http.StatusNotFound {
+func (s *Service) checkBook(r *http.Request, isbn string) (bool, error) {
+	_, err := s.backend(r).BookByISBN(r.Context(), isbn)
+	if errors.Is(err, client.ErrNotFound) {
 		return false, nil // Book not found
 	}
 
-	if resp.StatusCode == http.StatusOK {
-		return true, nil // Book exists
-	}
-	// If we reach here, it means there was an unexpected status code
-
-	bodyBytes := new(bytes.Buffer)
-	_, err = bodyBytes.ReadFrom(resp.Body)
-
 	if err != nil {
-		bodyBytes.WriteString("Failed to read response body")
+		return false, err
 	}
 
-	return false, errors.New("book not found, %v" + bodyBytes.String())
+	return true, nil // Book exists
 }
 
 func (s *Service) booksPage(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query().Get("q")
 
-	var resp *http.Response
+	var books []model.Book
 
 	var err error
 	if q != "" {
-		resp, err = http.Get(s.uri + "/books/search?q=" + q)
+		books, err = s.backend(r).SearchBooks(r.Context(), q)
 	} else {
-		resp, err = http.Get(s.uri + "/books")
+		books, err = s.backend(r).ListBooks(r.Context())
 	}
 
 	if err != nil {
-		s.errorPage(w, "failed to fetch books", err)
-		return
-	}
-
-	defer resp.Body.Close()
-
-	var books []model.Book
-	if err := json.NewDecoder(resp.Body).Decode(&books); err != nil {
-		s.errorPage(w, "failed to decose books", err)
-
+		s.errorPage(w, r, "failed to fetch books", err)
 		return
 	}
 
@@ -273,23 +184,15 @@ type bookDetailData struct {
 }
 
 func (s *Service) bookUpsertPage(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("bookUpsertPage called")
-	fmt.Printf("r.URL.String(): %v\n", r.URL.String())
-
 	ctx := r.Context()
-	fmt.Printf("ctx: %v\n", ctx)
 
 	bookVal := ctx.Value("book")
 	if bookVal != nil {
 		book, ok := ctx.Value("book").(model.Book)
 		if !ok {
-			fmt.Println("bookVal is not of type model.Book")
 			// break out fo this if
 		} else {
-			fmt.Println("bookVal is of type model.Book")
-			fmt.Printf("book: %+v\n", book)
 			isbnOk := isbnRegex.MatchString(book.ISBN)
-			fmt.Printf("isbnOk: %v\n", isbnOk)
 
 			validations := map[string]string{}
 
@@ -304,7 +207,7 @@ func (s *Service) bookUpsertPage(w http.ResponseWriter, r *http.Request) {
 			}
 
 			// check if book is already present in backend
-			found, _ := s.checkBook(book.ISBN)
+			found, _ := s.checkBook(r, book.ISBN)
 			if found {
 				// book already exists in backend, so we set IsNew to false
 				payload.IsNew = false
@@ -324,7 +227,7 @@ func (s *Service) bookUpsertPage(w http.ResponseWriter, r *http.Request) {
 
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		s.errorPage(w, "Missing book id", nil)
+		s.errorPage(w, r, "Missing book id", nil)
 
 		return
 	}
@@ -339,97 +242,69 @@ func (s *Service) bookUpsertPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := http.Get(s.uri + "/books/" + id)
+	bookID, err := strconv.Atoi(id)
 	if err != nil {
-		s.errorPage(w, "Failed to fetch book", err)
+		s.errorPage(w, r, "Invalid book ID", err)
 		return
 	}
 
-	defer resp.Body.Close()
-
-	var b model.Book
-
-	if err := json.NewDecoder(resp.Body).Decode(&b); err != nil {
-		s.errorPage(w, "Failed to decode book", err)
+	b, err := s.backend(r).GetBook(r.Context(), bookID)
+	if err != nil {
+		s.errorPage(w, r, "Failed to fetch book", err)
 		return
 	}
 
 	s.executeTemplate(w, "book_upsert.gohtml", bookDetailData{
 		IsNew: false,
-		Book:  b,
+		Book:  *b,
 	})
 }
 func (s *Service) bookDetailPage(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	if id == "" {
-		s.errorPage(w, "Missing book id", nil)
-
-		return
-	}
-
-	resp, err := http.Get(s.uri + "/books/" + id)
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		s.errorPage(w, "failed to fetch books", err)
-
+		s.errorPage(w, r, "Invalid book ID", err)
 		return
 	}
 
-	defer resp.Body.Close()
+	api := s.backend(r)
 
-	var book model.Book
-	if err := json.NewDecoder(resp.Body).Decode(&book); err != nil {
-		s.errorPage(w, "Failed to fetch books", err)
+	book, err := api.GetBook(r.Context(), id)
+	if err != nil {
+		s.errorPage(w, r, "failed to fetch books", err)
 
 		return
 	}
 
 	// Fetch members for borrow dropdown
-	resp2, err := http.Get(s.uri + "/members")
+	members, err := api.ListMembers(r.Context())
 	if err != nil {
-		s.errorPage(w, "Failed to fetch members", err)
+		s.errorPage(w, r, "Failed to fetch members", err)
 
 		return
 	}
 
-	defer resp2.Body.Close()
-
-	var members []model.Member
-	if err := json.NewDecoder(resp2.Body).Decode(&members); err != nil {
-		s.errorPage(w, "Failed to decode members", err)
-
+	history, err := history(r, api.BookHistory, "book_id", book.ID)
+	if err != nil {
+		s.errorPage(w, r, "Failed to fetch history", err)
 		return
 	}
 
 	s.executeTemplate(w, "book_detail.gohtml", struct {
 		Book    *model.Book
 		Members []model.Member
-	}{&book, members})
+		History historyData
+	}{book, members, history})
 }
 
 func (s *Service) deleteBookPost(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	if id == "" {
-		s.errorPage(w, "Missing book ID", nil)
-		return
-	}
-
-	client := &http.Client{}
-
-	req, err := http.NewRequest("DELETE", s.uri+"/books/"+id, nil)
-	if err != nil {
-		s.errorPage(w, "Failed to create delete request", err)
-		return
-	}
-
-	resp, err := client.Do(req)
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		s.errorPage(w, "Failed to delete book", err)
+		s.errorPage(w, r, "Invalid book ID", err)
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		s.errorPage(w, "Failed to delete book: "+resp.Status, nil)
+	if err := s.backend(r).DeleteBook(r.Context(), id, formVersion(r)); err != nil {
+		s.errorPage(w, r, "Failed to delete book", err)
 		return
 	}
 
@@ -1,29 +1,17 @@
 package frontend
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
-	"io"
 	"net/http"
+	"strings"
 
-	"github.com/go-chi/chi/v5"
 	"github.com/tliefheid/go-ils/internal/model"
 )
 
 func (s *Service) borrowPage(w http.ResponseWriter, r *http.Request) {
-	resp, err := http.Get(s.uri + "/borrow")
+	b, err := s.backend(r).ListBorrowings(r.Context())
 	if err != nil {
-		s.errorPage(w, "failed to fetch borrowings", err)
-		return
-	}
-
-	defer resp.Body.Close()
-
-	var b []model.BorrowingDetail
-
-	if err := json.NewDecoder(resp.Body).Decode(&b); err != nil {
-		s.errorPage(w, "failed to decode borrowings", err)
+		s.errorPage(w, r, "failed to fetch borrowings", err)
 		return
 	}
 
@@ -31,18 +19,15 @@ func (s *Service) borrowPage(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Service) borrowDetailsPage(w http.ResponseWriter, r *http.Request) {
-	resp, err := http.Get(s.uri + "/borrow/" + chi.URLParam(r, "id"))
+	id, err := pathID(r, "id")
 	if err != nil {
-		s.errorPage(w, "failed to fetch borrowing details", err)
+		s.errorPage(w, r, "Invalid borrowing ID", err)
 		return
 	}
 
-	defer resp.Body.Close()
-
-	var b model.BorrowingDetail
-
-	if err := json.NewDecoder(resp.Body).Decode(&b); err != nil {
-		s.errorPage(w, "failed to decode borrowing details", err)
+	b, err := s.backend(r).GetBorrowing(r.Context(), id)
+	if err != nil {
+		s.errorPage(w, r, "failed to fetch borrowing details", err)
 		return
 	}
 
@@ -52,36 +37,21 @@ func (s *Service) borrowDetailsPage(w http.ResponseWriter, r *http.Request) {
 func (s *Service) borrowPost(w http.ResponseWriter, r *http.Request) {
 	bookID := r.FormValue("book_id")
 	memberID := r.FormValue("member_id")
+	cardNumber := strings.TrimSpace(r.FormValue("card_number"))
 
-	if bookID == "" || memberID == "" {
-		s.errorPage(w, "Missing book ID or member ID", nil)
+	if bookID == "" || (memberID == "" && cardNumber == "") {
+		s.errorPage(w, r, "Missing book ID or member ID", errors.New("select a member or enter a card number"))
 		return
 	}
 
 	payload := model.BorrowRequest{
-		BookID:   bookID,
-		MemberID: memberID,
+		BookID:     bookID,
+		MemberID:   memberID,
+		CardNumber: cardNumber,
 	}
 
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		s.errorPage(w, "Failed to marshal borrow request", err)
-		return
-	}
-
-	resp, err := http.Post(s.uri+"/borrow", "application/json", bytes.NewReader(jsonPayload))
-	if err != nil {
-		s.errorPage(w, "Failed to send borrow request", err)
-		return
-	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 204 {
-		body, _ := io.ReadAll(resp.Body)
-
-		s.errorPage(w, "Failed to borrow book", errors.New(string(body)))
-
+	if err := s.backend(r).Borrow(r.Context(), payload); err != nil {
+		s.errorPage(w, r, "Failed to borrow book", err)
 		return
 	}
 
@@ -0,0 +1,52 @@
+package frontend
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tliefheid/go-ils/internal/model"
+)
+
+func (s *Service) issueCardPost(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		s.errorPage(w, r, "Invalid member ID", err)
+		return
+	}
+
+	if _, err := s.backend(r).IssueCard(r.Context(), id, ""); err != nil {
+		s.errorPage(w, r, "Failed to issue card", err)
+		return
+	}
+
+	http.Redirect(w, r, "/members/"+strconv.Itoa(id), http.StatusSeeOther)
+}
+
+func (s *Service) replaceCardPost(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	reason := model.CardStatus(r.FormValue("reason"))
+
+	if _, err := s.backend(r).ReplaceCard(r.Context(), chi.URLParam(r, "number"), reason); err != nil {
+		s.errorPage(w, r, "Failed to replace card", err)
+		return
+	}
+
+	http.Redirect(w, r, "/members/"+id, http.StatusSeeOther)
+}
+
+func (s *Service) cardPDF(w http.ResponseWriter, r *http.Request) {
+	pdf, err := s.backend(r).CardPDF(r.Context(), chi.URLParam(r, "number"))
+	if err != nil {
+		s.errorPage(w, r, "Failed to fetch card", err)
+		return
+	}
+
+	defer pdf.Close()
+
+	w.Header().Set("Content-Type", pdf.ContentType)
+	w.Header().Set("Content-Disposition", pdf.ContentDisposition)
+
+	_, _ = io.Copy(w, pdf.Body)
+}
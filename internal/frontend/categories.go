@@ -0,0 +1,21 @@
+package frontend
+
+import (
+	"net/http"
+	"strconv"
+)
+
+func (s *Service) renewMembershipPost(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		s.errorPage(w, r, "Invalid member ID", err)
+		return
+	}
+
+	if _, err := s.backend(r).RenewMembership(r.Context(), id); err != nil {
+		s.errorPage(w, r, "Failed to renew membership", err)
+		return
+	}
+
+	http.Redirect(w, r, "/members/"+strconv.Itoa(id), http.StatusSeeOther)
+}
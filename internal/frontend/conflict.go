@@ -0,0 +1,133 @@
+package frontend
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/tliefheid/go-ils/internal/model"
+)
+
+// conflictField is a form field with the value the user entered and the
+// value saved in the meantime.
+type conflictField struct {
+	Label  string
+	Name   string
+	Value  string // form value of the user's version
+	Mine   string
+	Theirs string
+}
+
+func (f conflictField) Changed() bool {
+	return f.Mine != f.Theirs
+}
+
+type conflictPageData struct {
+	What   string
+	Action string
+	Back   string
+	Hidden map[string]string
+	Fields []conflictField
+}
+
+// formVersion is the record version the form was loaded with, 0 when it
+// has none and the change is saved unconditionally.
+func formVersion(r *http.Request) int {
+	v, err := strconv.Atoi(r.FormValue("version"))
+	if err != nil || v < 0 {
+		return 0
+	}
+
+	return v
+}
+
+// bookConflictPage shows the user's edit of a book next to the version
+// saved in the meantime, to save theirs over it or start again.
+func (s *Service) bookConflictPage(w http.ResponseWriter, r *http.Request, mine model.Book) {
+	theirs, err := s.backend(r).GetBook(r.Context(), mine.ID)
+	if err != nil {
+		s.errorPage(w, r, "Failed to fetch book", err)
+		return
+	}
+
+	field := func(label, name, m, t string) conflictField {
+		return conflictField{Label: label, Name: name, Value: m, Mine: m, Theirs: t}
+	}
+
+	w.WriteHeader(http.StatusConflict)
+	s.executeTemplate(w, "conflict.gohtml", conflictPageData{
+		What:   "Book " + theirs.Title,
+		Action: "/books",
+		Back:   "/books/upsert/" + strconv.Itoa(theirs.ID),
+		Hidden: map[string]string{
+			"id":      strconv.Itoa(theirs.ID),
+			"version": strconv.Itoa(theirs.Version),
+			"isbn":    theirs.ISBN,
+		},
+		Fields: []conflictField{
+			field("Title", "title", mine.Title, theirs.Title),
+			field("Author", "author", mine.Author, theirs.Author),
+			field("Publication year", "publication_year", strconv.Itoa(mine.PublicationYear), strconv.Itoa(theirs.PublicationYear)),
+			field("Copies total", "copies_total", strconv.Itoa(mine.CopiesTotal), strconv.Itoa(theirs.CopiesTotal)),
+		},
+	})
+}
+
+// memberConflictPage shows the user's edit of a member next to the version
+// saved in the meantime.
+func (s *Service) memberConflictPage(w http.ResponseWriter, r *http.Request, mine model.Member) {
+	theirs, err := s.backend(r).GetMember(r.Context(), mine.ID)
+	if err != nil {
+		s.errorPage(w, r, "Failed to fetch member", err)
+		return
+	}
+
+	text := func(label, name, m, t string) conflictField {
+		return conflictField{Label: label, Name: name, Value: m, Mine: m, Theirs: t}
+	}
+
+	check := func(label, name string, m, t bool) conflictField {
+		f := conflictField{Label: label, Name: name, Mine: yesNo(m), Theirs: yesNo(t)}
+		if m {
+			f.Value = "1"
+		}
+
+		return f
+	}
+
+	w.WriteHeader(http.StatusConflict)
+	s.executeTemplate(w, "conflict.gohtml", conflictPageData{
+		What:   "Member " + theirs.Name,
+		Action: "/members",
+		Back:   "/members/" + strconv.Itoa(theirs.ID),
+		Hidden: map[string]string{
+			"id":      strconv.Itoa(theirs.ID),
+			"version": strconv.Itoa(theirs.Version),
+		},
+		Fields: []conflictField{
+			text("Given name", "given_name", mine.GivenName, theirs.GivenName),
+			text("Family name", "family_name", mine.FamilyName, theirs.FamilyName),
+			text("Email", "email", mine.Email, theirs.Email),
+			text("Phone", "phone", mine.Phone, theirs.Phone),
+			text("Street", "address_street", mine.Address.Street, theirs.Address.Street),
+			text("Postal code", "address_postal_code", mine.Address.PostalCode, theirs.Address.PostalCode),
+			text("City", "address_city", mine.Address.City, theirs.Address.City),
+			text("Country", "address_country", mine.Address.Country, theirs.Address.Country),
+			text("Date of birth", "date_of_birth", mine.DateOfBirth, theirs.DateOfBirth),
+			text("Preferred language", "preferred_language", mine.PreferredLanguage, theirs.PreferredLanguage),
+			text("Membership category", "category", mine.Category, theirs.Category),
+			text("Membership valid until", "membership_expires", mine.MembershipExpires, theirs.MembershipExpires),
+			check("Email notifications", "notify_email", mine.Notifications.Email, theirs.Notifications.Email),
+			check("SMS notifications", "notify_sms", mine.Notifications.SMS, theirs.Notifications.SMS),
+			check("Post notifications", "notify_post", mine.Notifications.Post, theirs.Notifications.Post),
+			check("Keep reading history", "keep_history", mine.KeepHistory, theirs.KeepHistory),
+		},
+	})
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+
+	return "no"
+}
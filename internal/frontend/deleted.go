@@ -0,0 +1,85 @@
+package frontend
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// deletedItem is a row of the deleted books or members page.
+type deletedItem struct {
+	ID        int
+	Label     string
+	DeletedAt *time.Time
+}
+
+type deletedPageData struct {
+	Title string
+	Note  string
+	Back  string
+	Items []deletedItem
+}
+
+func (s *Service) deletedBooksPage(w http.ResponseWriter, r *http.Request) {
+	books, err := s.backend(r).ListDeletedBooks(r.Context())
+	if err != nil {
+		s.errorPage(w, r, "Failed to fetch deleted books", err)
+		return
+	}
+
+	data := deletedPageData{Title: "Deleted books", Back: "/books"}
+	for _, b := range books {
+		data.Items = append(data.Items, deletedItem{ID: b.ID, Label: b.Title + " by " + b.Author, DeletedAt: b.DeletedAt})
+	}
+
+	s.executeTemplate(w, "deleted.gohtml", data)
+}
+
+func (s *Service) deletedMembersPage(w http.ResponseWriter, r *http.Request) {
+	members, err := s.backend(r).ListDeletedMembers(r.Context())
+	if err != nil {
+		s.errorPage(w, r, "Failed to fetch deleted members", err)
+		return
+	}
+
+	data := deletedPageData{
+		Title: "Deleted members",
+		Note:  "Deleted members are anonymized by the archival job after the retention period and can no longer be restored.",
+		Back:  "/members",
+	}
+	for _, m := range members {
+		data.Items = append(data.Items, deletedItem{ID: m.ID, Label: m.Name, DeletedAt: m.DeletedAt})
+	}
+
+	s.executeTemplate(w, "deleted.gohtml", data)
+}
+
+func (s *Service) restoreBookPost(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		s.errorPage(w, r, "Invalid book ID", err)
+		return
+	}
+
+	if err := s.backend(r).RestoreBook(r.Context(), id); err != nil {
+		s.errorPage(w, r, "Failed to restore book", err)
+		return
+	}
+
+	http.Redirect(w, r, "/books/"+strconv.Itoa(id), http.StatusSeeOther)
+}
+
+func (s *Service) restoreMemberPost(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		s.errorPage(w, r, "Invalid member ID", err)
+		return
+	}
+
+	if err := s.backend(r).RestoreMember(r.Context(), id); err != nil {
+		s.errorPage(w, r, "Failed to restore member", err)
+		return
+	}
+
+	http.Redirect(w, r, "/members/"+strconv.Itoa(id), http.StatusSeeOther)
+}
@@ -2,22 +2,55 @@ package frontend
 
 import (
 	"errors"
+	"log/slog"
 	"net/http"
+	"net/url"
+
+	"github.com/tliefheid/go-ils/client"
+	"github.com/tliefheid/go-ils/internal/model"
 )
 
 type ErrorPageData struct {
-	Message string `json:"message"`
-	Details string `json:"error"`
+	Message string         `json:"message"`
+	Details string         `json:"error"`
+	Problem *model.Problem `json:"problem,omitempty"`
 }
 
-func (s *Service) errorPage(w http.ResponseWriter, msg string, err error) {
-	data := ErrorPageData{
-		Message: msg,
-		Details: err.Error(),
+// errorPage shows msg and the reason err gives. Problem details from the
+// backend are shown with their code and request ID, and their status is
+// passed on.
+func (s *Service) errorPage(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	if errors.Is(err, client.ErrUnauthorized) {
+		w.WriteHeader(http.StatusUnauthorized)
+		s.executeTemplate(w, "login.gohtml", map[string]interface{}{"Error": "Your session has expired, please log in again."})
+
+		return
+	}
+
+	data := ErrorPageData{Message: msg}
+
+	var cerr *client.Error
+	if errors.As(err, &cerr) {
+		data.Problem = &cerr.Problem
+		data.Details = cerr.Detail
+
+		if cerr.StatusCode >= http.StatusBadRequest {
+			w.WriteHeader(cerr.StatusCode)
+		}
+	} else if err != nil {
+		// the backend logs what it fails itself, under the same request ID;
+		// a backend that cannot be reached is logged here
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			slog.ErrorContext(r.Context(), msg, "err", err)
+		}
+
+		data.Details = err.Error()
 	}
+
 	s.executeTemplate(w, "error.gohtml", data)
 }
 
 func (s *Service) tempErrorPage(w http.ResponseWriter, r *http.Request) {
-	s.errorPage(w, "Temporary Error", errors.New("This page is temporarily unavailable. Please try again later"))
+	s.errorPage(w, r, "Temporary Error", errors.New("This page is temporarily unavailable. Please try again later"))
 }
@@ -0,0 +1,54 @@
+package frontend
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/tliefheid/go-ils/internal/model"
+)
+
+func (s *Service) memberExport(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		s.errorPage(w, r, "Invalid member ID", err)
+		return
+	}
+
+	export, err := s.backend(r).ExportMember(r.Context(), id)
+	if err != nil {
+		s.errorPage(w, r, "Failed to export member data", err)
+		return
+	}
+
+	defer export.Close()
+
+	w.Header().Set("Content-Type", export.ContentType)
+	w.Header().Set("Content-Disposition", export.ContentDisposition)
+
+	_, _ = io.Copy(w, export.Body)
+}
+
+func (s *Service) eraseMemberPost(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		s.errorPage(w, r, "Invalid member ID", err)
+		return
+	}
+
+	if r.FormValue("confirm") == "" {
+		s.errorPage(w, r, "Erasure not confirmed", errors.New("tick the confirmation box to erase the member's personal data"))
+		return
+	}
+
+	_, err = s.backend(r).EraseMember(r.Context(), id, model.ErasureRequest{
+		Reason: strings.TrimSpace(r.FormValue("reason")),
+	})
+	if err != nil {
+		s.errorPage(w, r, "Failed to erase member", err)
+		return
+	}
+
+	http.Redirect(w, r, "/members", http.StatusSeeOther)
+}
@@ -0,0 +1,78 @@
+package frontend
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/tliefheid/go-ils/internal/model"
+)
+
+func (s *Service) cancelHoldPost(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		s.errorPage(w, r, "Invalid member ID", err)
+		return
+	}
+
+	holdID, err := pathID(r, "holdID")
+	if err != nil {
+		s.errorPage(w, r, "Invalid hold ID", err)
+		return
+	}
+
+	if err := s.backend(r).CancelHold(r.Context(), id, holdID); err != nil {
+		s.errorPage(w, r, "Failed to cancel hold", err)
+		return
+	}
+
+	http.Redirect(w, r, "/members/"+strconv.Itoa(id), http.StatusSeeOther)
+}
+
+func (s *Service) payFinePost(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		s.errorPage(w, r, "Invalid member ID", err)
+		return
+	}
+
+	fineID, err := pathID(r, "fineID")
+	if err != nil {
+		s.errorPage(w, r, "Invalid fine ID", err)
+		return
+	}
+
+	if err := s.backend(r).PayFine(r.Context(), id, fineID); err != nil {
+		s.errorPage(w, r, "Failed to pay fine", err)
+		return
+	}
+
+	http.Redirect(w, r, "/members/"+strconv.Itoa(id), http.StatusSeeOther)
+}
+
+func (s *Service) setPINPost(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		s.errorPage(w, r, "Invalid member ID", err)
+		return
+	}
+
+	if err := s.backend(r).SetPIN(r.Context(), id, r.FormValue("pin")); err != nil {
+		s.errorPage(w, r, "Failed to set PIN", err)
+		return
+	}
+
+	http.Redirect(w, r, "/members/"+strconv.Itoa(id), http.StatusSeeOther)
+}
+
+// fineTotal sums the unpaid fines.
+func fineTotal(fines []model.Fine) model.Fine {
+	var total model.Fine
+
+	for _, f := range fines {
+		if f.PaidAt == nil {
+			total.AmountCents += f.AmountCents
+		}
+	}
+
+	return total
+}
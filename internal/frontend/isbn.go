@@ -2,36 +2,29 @@ package frontend
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
 
-	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/client"
 )
 
 func (s *Service) isbnPost(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
-		s.errorPage(w, "Failed to parse form data", err)
+		s.errorPage(w, r, "Failed to parse form data", err)
 		return
 	}
 
 	isbn := r.FormValue("isbn")
-	fmt.Printf("isbn: %v\n", isbn)
 	// isbn := chi.URLParam(r, "isbn")
 	if isbn == "" {
-		s.errorPage(w, "Missing ISBN", errors.New("missing ISBN"))
+		s.errorPage(w, r, "Missing ISBN", errors.New("missing ISBN"))
 		return
 	}
 
-	resp, err := http.Get(s.uri + "/isbn/" + isbn)
-	if err != nil {
-		s.errorPage(w, "Failed to fetch book info", err)
-		return
-	}
-	defer resp.Body.Close()
+	book, err := s.backend(r).LookupISBN(r.Context(), isbn)
 
-	if resp.StatusCode != http.StatusOK {
+	var cerr *client.Error
+	if errors.As(err, &cerr) && !errors.Is(err, client.ErrUnauthorized) {
 		s.executeTemplate(w, "isbn.gohtml", map[string]string{
 			"Error": "Book not found",
 		})
@@ -39,15 +32,12 @@ func (s *Service) isbnPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var book model.Book
-
-	if err := json.NewDecoder(resp.Body).Decode(&book); err != nil {
-		s.errorPage(w, "Failed to decode book info", err)
+	if err != nil {
+		s.errorPage(w, r, "Failed to fetch book info", err)
 		return
 	}
 
-	fmt.Printf("book: %+v\n", book)
-	ctx := context.WithValue(r.Context(), "book", book)
+	ctx := context.WithValue(r.Context(), "book", *book)
 	s.bookUpsertPage(w, r.WithContext(ctx))
 }
 
@@ -1,35 +1,26 @@
 package frontend
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/tliefheid/go-ils/client"
 	"github.com/tliefheid/go-ils/internal/model"
 )
 
 func (s *Service) memberPost(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("memberPost called")
-
 	idStr := r.FormValue("id")
-	name := r.FormValue("name")
-	contact := r.FormValue("contact")
-
-	if name == "" || idStr == "" || contact == "" {
+	if idStr == "" {
 		http.Error(w, "Missing fields", 400)
 		return
 	}
 
 	id := 0
 
-	fmt.Printf("idStr: %v\n", idStr)
-	fmt.Printf("name: %v\n", name)
-	fmt.Printf("contact: %v\n", contact)
-
 	if idStr != "new" {
 		var err error
 
@@ -38,97 +29,88 @@ func (s *Service) memberPost(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Invalid member ID", http.StatusBadRequest)
 			return
 		}
-		// Create new member
 	}
 
-	member := model.Member{
-		ID:      id,
-		Name:    name,
-		Contact: contact,
+	member := memberFromForm(r)
+	member.ID = id
+
+	if errs := member.Validate(); len(errs) > 0 {
+		s.memberFormPage(w, r, idStr == "new", member, errs)
+		return
 	}
 
-	m, _ := json.Marshal(member)
+	var err error
 
 	if idStr == "new" {
-		fmt.Println("Creating new member")
 		// New member, send POST request to create
-		err := s.newMember(m)
-		if err != nil {
-			s.errorPage(w, "Failed to create new member", err)
-			return
-		}
+		_, err = s.backend(r).AddMember(r.Context(), member)
 	} else {
-		fmt.Println("Updating existing member")
-		// Existing member, send PUT request to update
-		err := s.updateMember(idStr, m)
-		if err != nil {
-			s.errorPage(w, "Failed to update member", err)
-			return
-		}
+		// Existing member, send PUT request to update, based on the
+		// version the form was loaded with
+		member.Version = formVersion(r)
+		err = s.backend(r).UpdateMember(r.Context(), member)
 	}
 
-	s.memberPage(w, r)
-}
-
-func (s *Service) newMember(m []byte) error {
-	resp, err := http.Post(s.uri+"/members", "application/json", bytes.NewReader(m))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+	if fields, ok := client.FieldErrors(err); ok {
+		member.Version = formVersion(r)
+		s.memberFormPage(w, r, idStr == "new", member, fields)
 
-	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		return errors.New("Invalid response status code: " + strconv.Itoa(resp.StatusCode))
+		return
 	}
 
-	return nil
-}
-
-func (s *Service) updateMember(id string, m []byte) error {
-	client := &http.Client{}
-
-	req, err := http.NewRequest("PUT", s.uri+"/members/"+id, bytes.NewReader(m))
-	if err != nil {
-		return err
+	if errors.Is(err, client.ErrVersionConflict) {
+		s.memberConflictPage(w, r, member)
+		return
 	}
 
-	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		s.errorPage(w, r, "Failed to save member", err)
+		return
 	}
 
-	defer resp.Body.Close()
+	s.memberPage(w, r)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return errors.New("Invalid response status code: " + strconv.Itoa(resp.StatusCode))
+// memberFromForm reads the member profile fields of the upsert form.
+func memberFromForm(r *http.Request) model.Member {
+	return model.Member{
+		GivenName:   strings.TrimSpace(r.FormValue("given_name")),
+		FamilyName:  strings.TrimSpace(r.FormValue("family_name")),
+		Email:       strings.TrimSpace(r.FormValue("email")),
+		Phone:       strings.TrimSpace(r.FormValue("phone")),
+		DateOfBirth: r.FormValue("date_of_birth"),
+		Address: model.Address{
+			Street:     strings.TrimSpace(r.FormValue("address_street")),
+			PostalCode: strings.TrimSpace(r.FormValue("address_postal_code")),
+			City:       strings.TrimSpace(r.FormValue("address_city")),
+			Country:    strings.TrimSpace(r.FormValue("address_country")),
+		},
+		PreferredLanguage: strings.TrimSpace(r.FormValue("preferred_language")),
+		KeepHistory:       r.FormValue("keep_history") != "",
+		Category:          r.FormValue("category"),
+		MembershipExpires: r.FormValue("membership_expires"),
+		Notifications: model.NotificationPreferences{
+			Email: r.FormValue("notify_email") != "",
+			SMS:   r.FormValue("notify_sms") != "",
+			Post:  r.FormValue("notify_post") != "",
+		},
 	}
-
-	return nil
 }
 
 func (s *Service) memberPage(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query().Get("q")
 
-	var resp *http.Response
+	var members []model.Member
 
 	var err error
 	if q != "" {
-		resp, err = http.Get(s.uri + "/members/search?q=" + q)
+		members, err = s.backend(r).SearchMembers(r.Context(), q)
 	} else {
-		resp, err = http.Get(s.uri + "/members")
+		members, err = s.backend(r).ListMembers(r.Context())
 	}
 
 	if err != nil {
-		s.errorPage(w, "Failed to fetch members", err)
-		return
-	}
-
-	defer resp.Body.Close()
-
-	var members []model.Member
-
-	if err := json.NewDecoder(resp.Body).Decode(&members); err != nil {
-		s.errorPage(w, "Failed to decode members", err)
+		s.errorPage(w, r, "Failed to fetch members", err)
 		return
 	}
 
@@ -139,73 +121,119 @@ func (s *Service) memberPage(w http.ResponseWriter, r *http.Request) {
 }
 
 type memberDetailData struct {
-	IsNew  bool
-	Member model.Member
+	IsNew           bool
+	Member          model.Member
+	ValidationError map[string]string
+	Cards           []model.Card
+	Categories      []model.MembershipCategory
+	Expired         bool
+	Blocks          []blockView
+	ActiveBlocks    []blockView
+	Holds           []model.Hold
+	Fines           []model.Fine
+	Outstanding     model.Fine
+	History         historyData
 }
 
-func (s *Service) memberDetailPage(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	if id == "" {
-		s.errorPage(w, "Missing member id", nil)
+// memberFormPage re-renders the upsert form with the backend's or local
+// validation errors.
+func (s *Service) memberFormPage(w http.ResponseWriter, r *http.Request, isNew bool, member model.Member, errs map[string]string) {
+	categories, err := s.backend(r).ListCategories(r.Context())
+	if err != nil {
+		s.errorPage(w, r, "Failed to fetch membership categories", err)
 		return
 	}
 
-	if id == "new" {
-		// New member
-		s.executeTemplate(w, "member_upsert.gohtml", memberDetailData{
-			IsNew:  true,
-			Member: model.Member{},
-		})
+	s.executeTemplate(w, "member_upsert.gohtml", memberDetailData{
+		IsNew:           isNew,
+		Member:          member,
+		ValidationError: errs,
+		Categories:      categories,
+	})
+}
 
+func (s *Service) memberDetailPage(w http.ResponseWriter, r *http.Request) {
+	if chi.URLParam(r, "id") == "new" {
+		// New member
+		s.memberFormPage(w, r, true, model.Member{}, nil)
 		return
 	}
 
-	resp, err := http.Get(s.uri + "/members/" + id)
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		s.errorPage(w, "Failed to fetch member", err)
+		s.errorPage(w, r, "Invalid member ID", err)
 		return
 	}
 
-	defer resp.Body.Close()
+	api := s.backend(r)
 
-	var member model.Member
+	member, err := api.GetMember(r.Context(), id)
+	if err != nil {
+		s.errorPage(w, r, "Failed to fetch member", err)
+		return
+	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&member); err != nil {
-		s.errorPage(w, "Failed to decode member", err)
+	cards, err := api.MemberCards(r.Context(), id)
+	if err != nil {
+		s.errorPage(w, r, "Failed to fetch cards", err)
 		return
 	}
 
-	s.executeTemplate(w, "member_upsert.gohtml", memberDetailData{
-		IsNew:  false,
-		Member: member,
-	})
-}
+	categories, err := api.ListCategories(r.Context())
+	if err != nil {
+		s.errorPage(w, r, "Failed to fetch membership categories", err)
+		return
+	}
 
-func (s *Service) memberDeletePost(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	if id == "" {
-		s.errorPage(w, "Missing member id", nil)
+	blocks, err := api.MemberBlocks(r.Context(), id)
+	if err != nil {
+		s.errorPage(w, r, "Failed to fetch blocks", err)
 		return
 	}
 
-	client := &http.Client{}
+	holds, err := api.MemberHolds(r.Context(), id)
+	if err != nil {
+		s.errorPage(w, r, "Failed to fetch holds", err)
+		return
+	}
 
-	req, err := http.NewRequest("DELETE", s.uri+"/members/"+id, nil)
+	fines, err := api.MemberFines(r.Context(), id)
 	if err != nil {
-		s.errorPage(w, "Failed to create delete request", err)
+		s.errorPage(w, r, "Failed to fetch fines", err)
 		return
 	}
 
-	resp, err := client.Do(req)
+	history, err := history(r, api.MemberHistory, "member_id", member.ID)
 	if err != nil {
-		s.errorPage(w, "Failed to delete member", err)
+		s.errorPage(w, r, "Failed to fetch history", err)
 		return
 	}
 
-	defer resp.Body.Close()
+	data := memberDetailData{
+		IsNew:       false,
+		Member:      *member,
+		Cards:       cards,
+		Categories:  categories,
+		Expired:     member.MembershipExpired(time.Now()),
+		Holds:       holds,
+		Fines:       fines,
+		Outstanding: fineTotal(fines),
+		History:     history,
+	}
+	data.Blocks, data.ActiveBlocks = blockViews(blocks)
+
+	s.executeTemplate(w, "member_upsert.gohtml", data)
+}
+
+func (s *Service) memberDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.errorPage(w, r, "Invalid member ID", err)
+		return
+	}
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		s.errorPage(w, "Failed to delete member", fmt.Errorf("invalid response status code: %d", resp.StatusCode))
+	if err := s.backend(r).DeleteMember(r.Context(), id, formVersion(r)); err != nil {
+		s.errorPage(w, r, "Failed to delete member", err)
 		return
 	}
 
@@ -0,0 +1,35 @@
+package frontend
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tliefheid/go-ils/client"
+	"github.com/tliefheid/go-ils/internal/metrics"
+	"github.com/tliefheid/go-ils/internal/tracing"
+)
+
+// backendHTTPClient returns the HTTP client for the backend calls, which
+// counts and times them in reg and passes the trace context on.
+func backendHTTPClient(reg *metrics.Registry) *http.Client {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "backend_requests_total",
+		Help:      "Calls of the backend API, by method and status.",
+	}, []string{"method", "code"})
+
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Name:      "backend_request_duration_seconds",
+		Help:      "Time taken by calls of the backend API, by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	reg.MustRegister(requests, duration)
+
+	transport := promhttp.InstrumentRoundTripperCounter(requests,
+		promhttp.InstrumentRoundTripperDuration(duration, tracing.Transport(nil)))
+
+	return &http.Client{Transport: transport, Timeout: client.DefaultTimeout}
+}
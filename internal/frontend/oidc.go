@@ -0,0 +1,127 @@
+package frontend
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/tliefheid/go-ils/client"
+	"github.com/tliefheid/go-ils/internal/oidc"
+)
+
+// oidcCookie keeps state, nonce and PKCE verifier of a single sign-on
+// until the provider sends the user back.
+const oidcCookie = "oidc_login"
+
+// oidcLogin starts a single sign-on at the identity provider.
+func (s *Service) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	login := url.Values{"next": {safeNext(r.URL.Query().Get("next"))}}
+
+	// the backend issues the nonce and accepts it once, so a leaked ID
+	// token cannot be traded for another session
+	nonce, err := s.client(r).OIDCNonce(r.Context())
+	if err != nil {
+		s.errorPage(w, r, "Failed to start single sign-on", err)
+		return
+	}
+
+	login.Set("nonce", nonce.Nonce)
+
+	for _, k := range []string{"state", "verifier"} {
+		v, err := oidc.RandomString()
+		if err != nil {
+			s.errorPage(w, r, "Failed to start single sign-on", err)
+			return
+		}
+
+		login.Set(k, v)
+	}
+
+	uri, err := s.oidc.AuthCodeURL(r.Context(), login.Get("state"), login.Get("nonce"), oidc.Challenge(login.Get("verifier")))
+	if err != nil {
+		s.errorPage(w, r, "Failed to reach the identity provider", err)
+		return
+	}
+
+	// Lax, the provider sends the user back with a cross-site redirect
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    login.Encode(),
+		Path:     "/login/oidc",
+		MaxAge:   600,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   r.TLS != nil,
+	})
+	http.Redirect(w, r, uri, http.StatusFound)
+}
+
+// oidcCallback finishes a single sign-on: it redeems the code with the PKCE
+// verifier and trades the ID token for a backend session.
+func (s *Service) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	var login url.Values
+
+	if c, err := r.Cookie(oidcCookie); err == nil {
+		login, _ = url.ParseQuery(c.Value)
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: oidcCookie, Path: "/login/oidc", MaxAge: -1, HttpOnly: true})
+
+	q := r.URL.Query()
+
+	switch {
+	case q.Get("error") != "":
+		s.ssoFailed(w, http.StatusUnauthorized, fmt.Sprintf("The identity provider refused the login: %s %s", q.Get("error"), q.Get("error_description")))
+		return
+	case login.Get("state") == "" || q.Get("state") != login.Get("state"):
+		s.ssoFailed(w, http.StatusBadRequest, "The login expired or was started elsewhere, please try again.")
+		return
+	}
+
+	token, err := s.oidc.Exchange(r.Context(), q.Get("code"), login.Get("verifier"))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "exchanging authorization code failed", "err", err)
+		s.ssoFailed(w, http.StatusBadGateway, "The identity provider did not complete the login.")
+
+		return
+	}
+
+	session, err := s.client(r).LoginOIDC(r.Context(), token.IDToken, login.Get("nonce"))
+
+	var cerr *client.Error
+	if errors.As(err, &cerr) {
+		s.ssoFailed(w, cerr.StatusCode, cerr.Error())
+		return
+	}
+
+	if err != nil {
+		s.errorPage(w, r, "Failed to log in", err)
+		return
+	}
+
+	setStaffCookie(w, r, *session)
+
+	// the staff cookie is SameSite strict, so it is not sent along a
+	// redirect that started at the provider; a same-site refresh is
+	next := template.HTMLEscapeString(safeNext(login.Get("next")))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!DOCTYPE html><html><head><meta http-equiv="refresh" content="0;url=%s"></head><body><a href="%s">Continue</a></body></html>`, next, next)
+}
+
+func (s *Service) ssoFailed(w http.ResponseWriter, status int, msg string) {
+	w.WriteHeader(status)
+	s.executeTemplate(w, "login.gohtml", map[string]interface{}{"SSO": true, "Error": msg})
+}
@@ -0,0 +1,319 @@
+package frontend
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tliefheid/go-ils/client"
+	"github.com/tliefheid/go-ils/internal/model"
+)
+
+// patronCookie holds the backend session token of a patron portal login.
+const patronCookie = "patron_session"
+
+// errPatronLoggedOut is returned when the backend no longer accepts the
+// patron's session.
+var errPatronLoggedOut = errors.New("patron session expired")
+
+type patronHomeData struct {
+	Member      model.Member
+	Loans       []loanView
+	Holds       []model.Hold
+	Fines       []model.Fine
+	Outstanding model.Fine
+	Query       string
+	Books       []model.Book
+	Error       string
+	Notice      string
+}
+
+// loanView is a loan as shown in the patron portal.
+type loanView struct {
+	model.BorrowingDetail
+	IsOverdue bool
+}
+
+type patronContactData struct {
+	Member          model.Member
+	ValidationError map[string]string
+	Saved           bool
+}
+
+// patron returns a client for the backend's patron API with the session
+// token of the request's cookie.
+func (s *Service) patron(r *http.Request) (*client.Client, error) {
+	cookie, err := r.Cookie(patronCookie)
+	if err != nil {
+		return nil, errPatronLoggedOut
+	}
+
+	return s.client(r).WithToken(cookie.Value), nil
+}
+
+// patronLoggedOut reports whether err means the patron has to log in again.
+func patronLoggedOut(err error) bool {
+	return errors.Is(err, errPatronLoggedOut) || errors.Is(err, client.ErrUnauthorized)
+}
+
+// patronError sends a logged out patron back to the login page and shows any
+// other error on the dashboard.
+func (s *Service) patronError(w http.ResponseWriter, r *http.Request, err error) {
+	if patronLoggedOut(err) {
+		clearPatronCookie(w)
+		http.Redirect(w, r, "/patron/login", http.StatusSeeOther)
+
+		return
+	}
+
+	http.Redirect(w, r, "/patron?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+}
+
+func clearPatronCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: patronCookie, Path: "/patron", MaxAge: -1, HttpOnly: true})
+}
+
+func (s *Service) patronLoginPage(w http.ResponseWriter, r *http.Request) {
+	s.executeTemplate(w, "patron_login.gohtml", map[string]interface{}{})
+}
+
+func (s *Service) patronLoginPost(w http.ResponseWriter, r *http.Request) {
+	cardNumber := strings.TrimSpace(r.FormValue("card_number"))
+
+	session, err := s.client(r).PatronLogin(r.Context(), cardNumber, r.FormValue("pin"))
+
+	var cerr *client.Error
+	if errors.As(err, &cerr) && cerr.StatusCode < http.StatusInternalServerError {
+		w.WriteHeader(http.StatusUnauthorized)
+		s.executeTemplate(w, "patron_login.gohtml", map[string]interface{}{
+			"CardNumber": cardNumber,
+			"Error":      cerr.Error(),
+		})
+
+		return
+	}
+
+	if err != nil {
+		s.errorPage(w, r, "Failed to log in", err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     patronCookie,
+		Value:    session.Token,
+		Path:     "/patron",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		Secure:   r.TLS != nil,
+	})
+	http.Redirect(w, r, "/patron", http.StatusSeeOther)
+}
+
+func (s *Service) patronLogoutPost(w http.ResponseWriter, r *http.Request) {
+	api, err := s.patron(r)
+	if err == nil {
+		err = api.PatronLogout(r.Context())
+	}
+
+	if err != nil && !patronLoggedOut(err) {
+		s.errorPage(w, r, "Failed to log out", err)
+		return
+	}
+
+	clearPatronCookie(w)
+	http.Redirect(w, r, "/patron/login", http.StatusSeeOther)
+}
+
+func (s *Service) patronHomePage(w http.ResponseWriter, r *http.Request) {
+	data := patronHomeData{
+		Query:  strings.TrimSpace(r.URL.Query().Get("q")),
+		Error:  r.URL.Query().Get("error"),
+		Notice: r.URL.Query().Get("notice"),
+	}
+
+	api, err := s.patron(r)
+	if err != nil {
+		s.patronPageError(w, r, err)
+		return
+	}
+
+	me, err := api.PatronMe(r.Context())
+	if err != nil {
+		s.patronPageError(w, r, err)
+		return
+	}
+
+	data.Member = *me
+
+	loans, err := api.PatronLoans(r.Context())
+	if err != nil {
+		s.patronPageError(w, r, err)
+		return
+	}
+
+	now := time.Now()
+	for _, l := range loans {
+		data.Loans = append(data.Loans, loanView{BorrowingDetail: l, IsOverdue: l.Overdue(now)})
+	}
+
+	if data.Holds, err = api.PatronHolds(r.Context()); err != nil {
+		s.patronPageError(w, r, err)
+		return
+	}
+
+	if data.Fines, err = api.PatronFines(r.Context()); err != nil {
+		s.patronPageError(w, r, err)
+		return
+	}
+
+	data.Outstanding = fineTotal(data.Fines)
+
+	if data.Query != "" {
+		if data.Books, err = api.PatronSearchBooks(r.Context(), data.Query); err != nil {
+			s.patronPageError(w, r, err)
+			return
+		}
+	}
+
+	s.executeTemplate(w, "patron_home.gohtml", data)
+}
+
+// patronPageError is patronError for pages, which cannot redirect to the
+// dashboard without looping.
+func (s *Service) patronPageError(w http.ResponseWriter, r *http.Request, err error) {
+	if patronLoggedOut(err) {
+		clearPatronCookie(w)
+		http.Redirect(w, r, "/patron/login", http.StatusSeeOther)
+
+		return
+	}
+
+	s.errorPage(w, r, "Failed to load your account", err)
+}
+
+func (s *Service) patronRenewPost(w http.ResponseWriter, r *http.Request) {
+	loanID, err := pathID(r, "id")
+	if err != nil {
+		s.patronError(w, r, errors.New("invalid loan"))
+		return
+	}
+
+	api, err := s.patron(r)
+	if err == nil {
+		_, err = api.PatronRenew(r.Context(), loanID)
+	}
+
+	if err != nil {
+		s.patronError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/patron?notice="+url.QueryEscape("Loan renewed."), http.StatusSeeOther)
+}
+
+func (s *Service) patronHoldPost(w http.ResponseWriter, r *http.Request) {
+	bookID, err := strconv.Atoi(r.FormValue("book_id"))
+	if err != nil {
+		s.patronError(w, r, errors.New("invalid book"))
+		return
+	}
+
+	api, err := s.patron(r)
+	if err == nil {
+		_, err = api.PatronPlaceHold(r.Context(), bookID)
+	}
+
+	if err != nil {
+		s.patronError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/patron?notice="+url.QueryEscape("Hold placed."), http.StatusSeeOther)
+}
+
+func (s *Service) patronCancelHoldPost(w http.ResponseWriter, r *http.Request) {
+	holdID, err := pathID(r, "id")
+	if err != nil {
+		s.patronError(w, r, errors.New("invalid hold"))
+		return
+	}
+
+	api, err := s.patron(r)
+	if err == nil {
+		err = api.PatronCancelHold(r.Context(), holdID)
+	}
+
+	if err != nil {
+		s.patronError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/patron?notice="+url.QueryEscape("Hold cancelled."), http.StatusSeeOther)
+}
+
+func (s *Service) patronContactPage(w http.ResponseWriter, r *http.Request) {
+	api, err := s.patron(r)
+	if err != nil {
+		s.patronPageError(w, r, err)
+		return
+	}
+
+	me, err := api.PatronMe(r.Context())
+	if err != nil {
+		s.patronPageError(w, r, err)
+		return
+	}
+
+	data := patronContactData{Member: *me}
+	data.Saved = r.URL.Query().Get("saved") != ""
+
+	s.executeTemplate(w, "patron_contact.gohtml", data)
+}
+
+func (s *Service) patronContactPost(w http.ResponseWriter, r *http.Request) {
+	form := memberFromForm(r)
+	contact := model.ContactDetails{
+		Email:             form.Email,
+		Phone:             form.Phone,
+		Address:           form.Address,
+		PreferredLanguage: form.PreferredLanguage,
+		Notifications:     form.Notifications,
+	}
+
+	api, err := s.patron(r)
+	if err != nil {
+		s.patronPageError(w, r, err)
+		return
+	}
+
+	_, err = api.PatronUpdateContact(r.Context(), contact)
+	if patronLoggedOut(err) {
+		s.patronPageError(w, r, err)
+		return
+	}
+
+	if fields, ok := client.FieldErrors(err); ok {
+		me, err := api.PatronMe(r.Context())
+		if err != nil {
+			s.patronPageError(w, r, err)
+			return
+		}
+
+		data := patronContactData{Member: *me, ValidationError: fields}
+		contact.Apply(&data.Member)
+		s.executeTemplate(w, "patron_contact.gohtml", data)
+
+		return
+	}
+
+	if err != nil {
+		s.errorPage(w, r, "Failed to save contact details", err)
+		return
+	}
+
+	http.Redirect(w, r, "/patron/contact?saved=1", http.StatusSeeOther)
+}
@@ -1,24 +1,13 @@
 package frontend
 
 import (
-	"encoding/json"
 	"net/http"
-
-	"github.com/tliefheid/go-ils/internal/model"
 )
 
 func (s *Service) reportsPage(w http.ResponseWriter, r *http.Request) {
-	borrowedResp, err := http.Get(s.uri + "/reports/borrowed")
+	borrowed, err := s.backend(r).BorrowedReport(r.Context())
 	if err != nil {
-		http.Error(w, "Failed to fetch borrowed books", 500)
-		return
-	}
-
-	defer borrowedResp.Body.Close()
-
-	var borrowed []model.BorrowingDetail
-	if err := json.NewDecoder(borrowedResp.Body).Decode(&borrowed); err != nil {
-		http.Error(w, "Failed to decode borrowed books", 500)
+		s.errorPage(w, r, "Failed to fetch borrowed books", err)
 		return
 	}
 
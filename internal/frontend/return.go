@@ -1,36 +1,18 @@
 package frontend
 
 import (
-	"errors"
-	"fmt"
 	"net/http"
-
-	"github.com/go-chi/chi/v5"
 )
 
 func (s *Service) returnPost(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("returnPost called")
-
-	id := chi.URLParam(r, "id")
-	if id == "" {
-		s.errorPage(w, "Missing borrow ID", nil)
-		return
-	}
-
-	resp, err := http.Post(s.uri+"/returns/"+id, "application/json", nil)
+	id, err := pathID(r, "id")
 	if err != nil {
-		s.errorPage(w, "Failed to return book", err)
+		s.errorPage(w, r, "Invalid borrow ID", err)
 		return
 	}
 
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		s.errorPage(w,
-			"Failed to return book",
-			errors.New("Invalid response status code: "+resp.Status),
-		)
-
+	if err := s.backend(r).Return(r.Context(), id); err != nil {
+		s.errorPage(w, r, "Failed to return book", err)
 		return
 	}
 
@@ -1,37 +1,53 @@
 package frontend
 
 import (
-	"fmt"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
+	"github.com/tliefheid/go-ils/internal/health"
+	"github.com/tliefheid/go-ils/internal/logging"
+	"github.com/tliefheid/go-ils/internal/tracing"
 )
 
 func (s *Service) setupRoutes() {
-	fmt.Println("setup routes")
-	s.mux.Use(middleware.Logger)
-
-	s.mux.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		_, err := w.Write([]byte("OK"))
-		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-	})
+	s.mux.Use(logging.RequestID)
+	s.mux.Use(tracing.Middleware)
+	s.mux.Use(logging.Requests)
+	s.mux.Use(s.registry.Middleware)
+
+	// /health stays the liveness probe for the deployments that use it
+	s.mux.Get("/health", health.LiveHandler)
+	s.mux.Get("/health/live", health.LiveHandler)
+	s.mux.Get("/health/ready", s.health.ReadyHandler)
+	s.mux.Get("/metrics", s.registry.Handler().ServeHTTP)
 	s.mux.NotFound(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Println("Not Found handler called")
 		http.Error(w, "Not Found", http.StatusNotFound)
 	})
 
-	s.mux.Get("/", s.indexPage)
-	s.mux.Get("/error", s.tempErrorPage)
-	s.mux.Mount("/isbn", s.isbnRoutes())
-	s.mux.Mount("/books", s.handleBooksRoutes())
-	s.mux.Mount("/members", s.handleMembersRoutes())
-	s.mux.Mount("/borrow", s.handleBorrowRoutes())
-	s.mux.Mount("/return", s.handleReturnRoutes())
-	s.mux.Get("/reports", s.reportsPage)
+	s.mux.Get("/login", s.loginPage)
+	s.mux.Post("/login", s.loginPost)
+	s.mux.Get("/login/oidc", s.oidcLogin)
+	s.mux.Get("/login/oidc/callback", s.oidcCallback)
+	s.mux.Mount("/patron", s.handlePatronRoutes())
+
+	s.mux.Group(func(mux chi.Router) {
+		mux.Use(requireLogin)
+
+		mux.Post("/logout", s.logoutPost)
+		mux.Get("/", s.indexPage)
+		mux.Get("/error", s.tempErrorPage)
+		mux.Mount("/isbn", s.isbnRoutes())
+		mux.Mount("/books", s.handleBooksRoutes())
+		mux.Mount("/members", s.handleMembersRoutes())
+		mux.Mount("/borrow", s.handleBorrowRoutes())
+		mux.Mount("/return", s.handleReturnRoutes())
+		mux.Get("/reports", s.reportsPage)
+		mux.Get("/audit", s.auditPage)
+		mux.Mount("/staff", s.handleStaffRoutes())
+		mux.Mount("/apikeys", s.handleAPIKeyRoutes())
+		mux.Get("/account", s.accountPage)
+		mux.Post("/account/password", s.accountPasswordPost)
+	})
 	// http.HandleFunc("/members", membersPage)
 	// http.HandleFunc("/borrowed", borrowedBooksPage)
 	// http.HandleFunc("/borrow", borrowBookHandler)
@@ -55,10 +71,12 @@ func (s *Service) handleBooksRoutes() *chi.Mux {
 	mux := chi.NewRouter()
 
 	mux.Get("/", s.booksPage)
+	mux.Get("/deleted", s.deletedBooksPage)
 	mux.Get("/{id}", s.bookDetailPage)
 	mux.Post("/", s.bookPost)
 	mux.Get("/upsert/{id}", s.bookUpsertPage)
 	mux.Post("/delete/{id}", s.deleteBookPost)
+	mux.Post("/{id}/restore", s.restoreBookPost)
 	// mux.Post("/", s.addBookHandler)
 
 	// mux.Route("/{id}", func(mux chi.Router) {
@@ -73,9 +91,22 @@ func (s *Service) handleMembersRoutes() *chi.Mux {
 	mux := chi.NewRouter()
 
 	mux.Get("/", s.memberPage)
+	mux.Get("/deleted", s.deletedMembersPage)
 	mux.Get("/{id}", s.memberDetailPage)
 	mux.Post("/", s.memberPost)
 	mux.Post("/{id}/delete", s.memberDeletePost)
+	mux.Post("/{id}/restore", s.restoreMemberPost)
+	mux.Get("/{id}/export", s.memberExport)
+	mux.Post("/{id}/erase", s.eraseMemberPost)
+	mux.Post("/{id}/cards", s.issueCardPost)
+	mux.Post("/{id}/membership/renew", s.renewMembershipPost)
+	mux.Post("/{id}/blocks", s.addBlockPost)
+	mux.Post("/{id}/blocks/{blockID}/lift", s.liftBlockPost)
+	mux.Post("/{id}/holds/{holdID}/cancel", s.cancelHoldPost)
+	mux.Post("/{id}/fines/{fineID}/pay", s.payFinePost)
+	mux.Post("/{id}/pin", s.setPINPost)
+	mux.Post("/{id}/cards/{number}/replace", s.replaceCardPost)
+	mux.Get("/{id}/cards/{number}/pdf", s.cardPDF)
 
 	// mux.Route("/{id}", func(mux chi.Router) {
 	// 	mux.Get("/", s.getBookHandler)
@@ -85,6 +116,47 @@ func (s *Service) handleMembersRoutes() *chi.Mux {
 
 	return mux
 }
+
+// handlePatronRoutes serves the patron portal, which has its own login and
+// only shows the data of the logged in member.
+func (s *Service) handlePatronRoutes() *chi.Mux {
+	mux := chi.NewRouter()
+
+	mux.Get("/login", s.patronLoginPage)
+	mux.Post("/login", s.patronLoginPost)
+	mux.Post("/logout", s.patronLogoutPost)
+	mux.Get("/", s.patronHomePage)
+	mux.Post("/loans/{id}/renew", s.patronRenewPost)
+	mux.Post("/holds", s.patronHoldPost)
+	mux.Post("/holds/{id}/cancel", s.patronCancelHoldPost)
+	mux.Get("/contact", s.patronContactPage)
+	mux.Post("/contact", s.patronContactPost)
+
+	return mux
+}
+
+func (s *Service) handleStaffRoutes() *chi.Mux {
+	mux := chi.NewRouter()
+
+	mux.Get("/", s.staffPage)
+	mux.Post("/", s.addStaffPost)
+	mux.Post("/{id}", s.editStaffPost)
+	mux.Post("/{id}/password", s.resetStaffPasswordPost)
+
+	return mux
+}
+
+func (s *Service) handleAPIKeyRoutes() *chi.Mux {
+	mux := chi.NewRouter()
+
+	mux.Get("/", s.apiKeysPage)
+	mux.Post("/", s.addAPIKeyPost)
+	mux.Post("/{id}/rotate", s.rotateAPIKeyPost)
+	mux.Post("/{id}/revoke", s.revokeAPIKeyPost)
+
+	return mux
+}
+
 func (s *Service) isbnRoutes() *chi.Mux {
 	mux := chi.NewRouter()
 
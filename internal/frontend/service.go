@@ -3,31 +3,105 @@ package frontend
 import (
 	"fmt"
 	"html/template"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/tliefheid/go-ils/client"
+	"github.com/tliefheid/go-ils/internal/health"
+	"github.com/tliefheid/go-ils/internal/logging"
+	"github.com/tliefheid/go-ils/internal/metrics"
+	"github.com/tliefheid/go-ils/internal/oidc"
+	"github.com/tliefheid/go-ils/internal/tracing"
 )
 
 type Service struct {
-	mux  *chi.Mux
-	uri  string
-	tmpl *template.Template
+	mux      *chi.Mux
+	api      *client.Client
+	tmpl     *template.Template
+	oidc     *oidc.Client
+	registry *metrics.Registry
+	health   *health.Checker
 }
 
 type Config struct {
 	BackendUri string
+	// BackendTimeout limits every backend request, zero uses the
+	// client's default.
+	BackendTimeout time.Duration
+	// OIDCIssuer is the identity provider for single sign-on, empty
+	// disables it.
+	OIDCIssuer string
+	// OIDCClientID and OIDCClientSecret identify the frontend at the
+	// provider; the secret is empty for a public client.
+	OIDCClientID     string
+	OIDCClientSecret string
+	// OIDCRedirectURL is the frontend's /login/oidc/callback as the
+	// provider reaches it.
+	OIDCRedirectURL string
 }
 
 func New(cfg Config) (*Service, error) {
 	s := new(Service)
 	s.mux = chi.NewRouter()
 	s.tmpl = template.Must(template.New("").ParseGlob("assets/*.gohtml"))
-	s.uri = cfg.BackendUri
+
+	s.registry = metrics.New()
+
+	opts := []client.Option{client.WithHTTPClient(backendHTTPClient(s.registry))}
+	if cfg.BackendTimeout > 0 {
+		opts = append(opts, client.WithTimeout(cfg.BackendTimeout))
+	}
+
+	s.api = client.New(cfg.BackendUri, opts...)
+
+	// the frontend serves nothing useful without the backend
+	s.health = health.New(health.DefaultTimeout)
+	s.health.Add("backend", s.api.Health)
+
+	if cfg.OIDCIssuer != "" {
+		if cfg.OIDCClientID == "" || cfg.OIDCRedirectURL == "" {
+			return nil, fmt.Errorf("single sign-on needs a client ID and redirect URL")
+		}
+
+		s.oidc = &oidc.Client{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			HTTPClient:   &http.Client{Timeout: 10 * time.Second, Transport: tracing.Transport(nil)},
+		}
+	}
+
 	s.setupRoutes()
 
 	return s, nil
 }
 
+// client returns the backend client for calls made while answering r,
+// which passes r's request ID on.
+func (s *Service) client(r *http.Request) *client.Client {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return s.api.WithRequestID(logging.RequestIDFrom(r.Context())).WithForwardedFor(host)
+}
+
+// Drain fails the readiness probe from now on, so load balancers stop
+// sending requests before the server shuts down.
+func (s *Service) Drain() {
+	s.health.Drain()
+}
+
 func (s *Service) Mux() *chi.Mux {
-	fmt.Println("Returning mux")
 	return s.mux
 }
+
+// pathID reads the numeric URL parameter name, such as a member ID.
+func pathID(r *http.Request, name string) (int, error) {
+	return strconv.Atoi(chi.URLParam(r, name))
+}
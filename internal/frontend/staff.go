@@ -0,0 +1,141 @@
+package frontend
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tliefheid/go-ils/client"
+	"github.com/tliefheid/go-ils/internal/model"
+)
+
+type staffPageData struct {
+	Users           []model.StaffUser
+	Roles           []model.StaffRole
+	Form            model.StaffUserRequest
+	ValidationError map[string]string
+}
+
+type accountPageData struct {
+	User            model.StaffUser
+	ValidationError map[string]string
+	Saved           bool
+}
+
+func (s *Service) staffPage(w http.ResponseWriter, r *http.Request) {
+	s.staffFormPage(w, r, model.StaffUserRequest{Role: model.RoleLibrarian}, nil)
+}
+
+// staffFormPage renders the staff list with the new user form and its
+// validation errors.
+func (s *Service) staffFormPage(w http.ResponseWriter, r *http.Request, form model.StaffUserRequest, errs map[string]string) {
+	data := staffPageData{Roles: model.StaffRoles, Form: form, ValidationError: errs}
+
+	users, err := s.backend(r).ListStaff(r.Context())
+	if err != nil {
+		s.errorPage(w, r, "Failed to fetch staff users", err)
+		return
+	}
+
+	data.Users = users
+
+	s.executeTemplate(w, "staff.gohtml", data)
+}
+
+func (s *Service) addStaffPost(w http.ResponseWriter, r *http.Request) {
+	form := model.StaffUserRequest{
+		Username: strings.TrimSpace(r.FormValue("username")),
+		Name:     strings.TrimSpace(r.FormValue("name")),
+		Role:     model.StaffRole(r.FormValue("role")),
+		Password: r.FormValue("password"),
+	}
+
+	_, err := s.backend(r).AddStaff(r.Context(), form)
+
+	if fields, ok := client.FieldErrors(err); ok {
+		form.Password = ""
+		s.staffFormPage(w, r, form, fields)
+
+		return
+	}
+
+	if err != nil {
+		s.errorPage(w, r, "Failed to add staff user", err)
+		return
+	}
+
+	http.Redirect(w, r, "/staff", http.StatusSeeOther)
+}
+
+func (s *Service) editStaffPost(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		s.errorPage(w, r, "Invalid staff user ID", err)
+		return
+	}
+
+	_, err = s.backend(r).EditStaff(r.Context(), id, model.StaffUserRequest{
+		Name:     strings.TrimSpace(r.FormValue("name")),
+		Role:     model.StaffRole(r.FormValue("role")),
+		Disabled: r.FormValue("disabled") != "",
+	})
+	if err != nil {
+		s.errorPage(w, r, "Failed to update staff user", err)
+		return
+	}
+
+	http.Redirect(w, r, "/staff", http.StatusSeeOther)
+}
+
+func (s *Service) resetStaffPasswordPost(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		s.errorPage(w, r, "Invalid staff user ID", err)
+		return
+	}
+
+	if err := s.backend(r).SetStaffPassword(r.Context(), id, r.FormValue("password")); err != nil {
+		s.errorPage(w, r, "Failed to reset password", err)
+		return
+	}
+
+	http.Redirect(w, r, "/staff", http.StatusSeeOther)
+}
+
+func (s *Service) accountPage(w http.ResponseWriter, r *http.Request) {
+	me, err := s.backend(r).Me(r.Context())
+	if err != nil {
+		s.errorPage(w, r, "Failed to fetch your account", err)
+		return
+	}
+
+	data := accountPageData{User: *me}
+	data.Saved = r.URL.Query().Get("saved") != ""
+
+	s.executeTemplate(w, "account.gohtml", data)
+}
+
+func (s *Service) accountPasswordPost(w http.ResponseWriter, r *http.Request) {
+	err := s.backend(r).ChangePassword(r.Context(), r.FormValue("current"), r.FormValue("password"))
+
+	if fields, ok := client.FieldErrors(err); ok {
+		me, err := s.backend(r).Me(r.Context())
+		if err != nil {
+			s.errorPage(w, r, "Failed to fetch your account", err)
+			return
+		}
+
+		s.executeTemplate(w, "account.gohtml", accountPageData{User: *me, ValidationError: fields})
+
+		return
+	}
+
+	// a new password ends all sessions, including this one
+	if errors.Is(err, client.ErrUnauthorized) || err == nil {
+		http.Redirect(w, r, "/login?next="+url.QueryEscape("/account?saved=1"), http.StatusSeeOther)
+		return
+	}
+
+	s.errorPage(w, r, "Failed to change password", err)
+}
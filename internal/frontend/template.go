@@ -1,7 +1,7 @@
 package frontend
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 )
 
@@ -11,6 +11,6 @@ func (s *Service) executeTemplate(w http.ResponseWriter, name string, data inter
 	err := s.tmpl.ExecuteTemplate(w, name, data)
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		log.Printf("template execution error: %v", err)
+		slog.Error("executing template failed", "template", name, "err", err)
 	}
 }
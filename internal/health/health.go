@@ -0,0 +1,135 @@
+// Package health answers the liveness and readiness probes of the services.
+// Liveness only tells the process answers; readiness checks the components
+// a service depends on and fails while it shuts down, so load balancers and
+// orchestrators stop sending it traffic.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tliefheid/go-ils/internal/model"
+)
+
+// DefaultTimeout bounds every readiness check when the checker has none.
+const DefaultTimeout = 2 * time.Second
+
+// Check reports whether a component works, nil when it does.
+type Check func(ctx context.Context) error
+
+type component struct {
+	name  string
+	check Check
+}
+
+// Checker runs the readiness checks of a service.
+type Checker struct {
+	timeout    time.Duration
+	components []component
+	draining   atomic.Bool
+}
+
+// New returns a checker bounding every check by timeout, DefaultTimeout
+// when zero.
+func New(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &Checker{timeout: timeout}
+}
+
+// Add registers the check of the component name. Checks are added before
+// the checker serves requests.
+func (c *Checker) Add(name string, check Check) {
+	c.components = append(c.components, component{name: name, check: check})
+}
+
+// Drain fails readiness from now on, for a service about to shut down.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Ready runs the checks concurrently and reports their results.
+func (c *Checker) Ready(ctx context.Context) model.Readiness {
+	if c.draining.Load() {
+		return model.Readiness{Status: model.HealthDraining, Components: []model.ComponentHealth{}}
+	}
+
+	ready := model.Readiness{Status: model.HealthUp, Components: make([]model.ComponentHealth, len(c.components))}
+
+	var wg sync.WaitGroup
+
+	for i, comp := range c.components {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			ready.Components[i] = c.run(ctx, comp)
+		}()
+	}
+
+	wg.Wait()
+
+	for _, comp := range ready.Components {
+		if comp.Status != model.HealthUp {
+			ready.Status = model.HealthDown
+		}
+	}
+
+	return ready
+}
+
+// run checks comp within the checker's timeout.
+func (c *Checker) run(ctx context.Context, comp component) model.ComponentHealth {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := comp.check(ctx)
+	result := model.ComponentHealth{
+		Name:      comp.name,
+		Status:    model.HealthUp,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+
+	if err != nil {
+		// the error may name hosts and users, it is only logged
+		result.Status = model.HealthDown
+		slog.WarnContext(ctx, "readiness check failed", "component", comp.name, "err", err)
+	}
+
+	return result
+}
+
+// LiveHandler answers the liveness probe, OK for as long as the process
+// serves requests.
+func LiveHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("OK"))
+}
+
+// ReadyHandler answers the readiness probe with the results of the checks,
+// 503 Service Unavailable unless every component is up.
+func (c *Checker) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	ready := c.Ready(r.Context())
+
+	status := http.StatusOK
+	if ready.Status != model.HealthUp {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(ready); err != nil {
+		slog.ErrorContext(r.Context(), "writing readiness failed", "err", err)
+	}
+}
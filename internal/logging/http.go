@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// RequestIDHeader carries the request ID from the frontend to the backend
+// and back to the client.
+const RequestIDHeader = "X-Request-Id"
+
+// validRequestID is what an incoming request ID has to look like to be
+// taken over; anything else could forge log lines.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID gives every request an ID: the one it came with, when valid,
+// or a new one. The ID is stored where chi's middleware.GetReqID finds it
+// and sent back in the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), middleware.RequestIDKey, id)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIDFrom returns the ID of the request ctx belongs to, empty
+// outside a request.
+func RequestIDFrom(ctx context.Context) string {
+	return middleware.GetReqID(ctx)
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// Requests logs every request once it is answered, with its status, size
+// and duration. It logs the chi route pattern the request matched rather
+// than the path, which may hold card numbers and other personal data, as
+// may the query.
+func Requests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		defer func() {
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			level := slog.LevelInfo
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelWarn
+			}
+
+			route := "unmatched"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+
+			slog.Log(r.Context(), level, "request",
+				"method", r.Method,
+				"route", route,
+				"status", status,
+				"bytes", ww.BytesWritten(),
+				"duration", time.Since(start),
+				"remote", r.RemoteAddr,
+			)
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
@@ -0,0 +1,103 @@
+// Package logging sets up structured logging with log/slog for the
+// services: text or JSON records at a configurable level, tagged with the
+// ID of the request they belong to and with personal data redacted.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Formats of the log records.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Redacted replaces the value of a personal data attribute.
+const Redacted = "[redacted]"
+
+// piiKeys are attribute keys whose values are personal data or secrets and
+// never end up in the logs, whatever the caller passes.
+var piiKeys = map[string]bool{
+	"name":          true,
+	"given_name":    true,
+	"family_name":   true,
+	"email":         true,
+	"phone":         true,
+	"address":       true,
+	"date_of_birth": true,
+	"card":          true,
+	"card_number":   true,
+	"pin":           true,
+	"password":      true,
+	"secret":        true,
+	"token":         true,
+	"authorization": true,
+	"cookie":        true,
+	"query":         true,
+}
+
+// New returns a logger writing to w at level, "debug", "info", "warn" or
+// "error", in format, FormatText or FormatJSON.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl, ReplaceAttr: redact}
+
+	var h slog.Handler
+
+	switch strings.ToLower(format) {
+	case FormatText:
+		h = slog.NewTextHandler(w, opts)
+	case FormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q, want %s or %s", format, FormatText, FormatJSON)
+	}
+
+	return slog.New(contextHandler{h}), nil
+}
+
+// redact replaces the values of personal data attributes.
+func redact(_ []string, a slog.Attr) slog.Attr {
+	if piiKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, Redacted)
+	}
+
+	return a
+}
+
+// contextHandler adds the request ID and the trace of the context to the
+// records logged with it.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestIDFrom(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,136 @@
+// Package metrics exposes Prometheus metrics of the services: the HTTP
+// requests per route, the Go runtime, the database connection pool and the
+// metrics a service registers itself.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes the names of the metrics of the services.
+const Namespace = "ils"
+
+// Registry holds the metrics of a service.
+type Registry struct {
+	*prometheus.Registry
+
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// New returns a registry with the HTTP, Go runtime and process metrics.
+func New() *Registry {
+	r := &Registry{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests answered, by method, route pattern and status.",
+		}, []string{"method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to answer HTTP requests, by method and route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+	}
+
+	r.MustRegister(
+		r.requests,
+		r.duration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return r
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (r *Registry) Handler() http.Handler {
+	return promhttp.HandlerFor(r.Registry, promhttp.HandlerOpts{Registry: r.Registry})
+}
+
+// Middleware counts and times the requests by the chi route pattern they
+// matched, so /books/1 and /books/2 are both /books/{id}.
+func (r *Registry) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, req.ProtoMajor)
+
+		next.ServeHTTP(ww, req)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(req.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		method := methodLabel(req.Method)
+		r.requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+		r.duration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// knownMethods are the HTTP methods counted by name.
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true, http.MethodPatch: true,
+	http.MethodDelete: true, http.MethodConnect: true, http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// methodLabel is the method of a request as a label, "other" for methods
+// not in knownMethods, so clients cannot add series with made-up methods.
+func methodLabel(method string) string {
+	if knownMethods[method] {
+		return method
+	}
+
+	return "other"
+}
+
+// RegisterDBStats registers the statistics of a database connection pool,
+// read from stats on every scrape.
+func (r *Registry) RegisterDBStats(stats func() sql.DBStats) {
+	gauge := func(name, help string, value func(sql.DBStats) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Namespace: Namespace, Subsystem: "db", Name: name, Help: help},
+			func() float64 { return value(stats()) })
+	}
+
+	counter := func(name, help string, value func(sql.DBStats) float64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Namespace: Namespace, Subsystem: "db", Name: name, Help: help},
+			func() float64 { return value(stats()) })
+	}
+
+	r.MustRegister(
+		gauge("max_open_connections", "Maximum number of open connections to the database.",
+			func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }),
+		gauge("open_connections", "Established connections, in use and idle.",
+			func(s sql.DBStats) float64 { return float64(s.OpenConnections) }),
+		gauge("in_use_connections", "Connections currently in use.",
+			func(s sql.DBStats) float64 { return float64(s.InUse) }),
+		gauge("idle_connections", "Idle connections.",
+			func(s sql.DBStats) float64 { return float64(s.Idle) }),
+		counter("wait_count_total", "Connections waited for.",
+			func(s sql.DBStats) float64 { return float64(s.WaitCount) }),
+		counter("wait_duration_seconds_total", "Time spent waiting for a connection.",
+			func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }),
+		counter("max_idle_closed_total", "Connections closed because of the idle connection limit.",
+			func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }),
+		counter("max_idle_time_closed_total", "Connections closed because they were idle too long.",
+			func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) }),
+		counter("max_lifetime_closed_total", "Connections closed because they reached their maximum lifetime.",
+			func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }),
+	)
+}
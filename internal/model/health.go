@@ -0,0 +1,26 @@
+package model
+
+// HealthStatus is the state of a service or of a component it depends on
+type HealthStatus string
+
+const (
+	HealthUp   HealthStatus = "up"
+	HealthDown HealthStatus = "down"
+	// HealthDraining is a service shutting down, which takes no new traffic
+	HealthDraining HealthStatus = "draining"
+)
+
+// ComponentHealth is the result of checking one dependency of a service
+type ComponentHealth struct {
+	Name   string       `json:"name"`
+	Status HealthStatus `json:"status"`
+	// LatencyMS is the time the check took, in milliseconds
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// Readiness reports whether a service can take traffic: up when every
+// component is, down when one is not and draining while shutting down
+type Readiness struct {
+	Status     HealthStatus      `json:"status"`
+	Components []ComponentHealth `json:"components"`
+}
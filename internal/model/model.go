@@ -1,6 +1,11 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
 
 // Book represents a library book
 type Book struct {
@@ -11,13 +16,55 @@ type Book struct {
 	PublicationYear int    `json:"publication_year"`
 	CopiesTotal     int    `json:"copies_total"`
 	CopiesAvailable int    `json:"copies_available"`
+	Version         int    `json:"version,omitempty"` // counts changes, sent as ETag
+
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 // Member represents a library member
 type Member struct {
-	ID      int    `json:"id"` // generated id
-	Name    string `json:"name"`
-	Contact string `json:"contact"`
+	ID                int                     `json:"id"`   // generated id
+	Name              string                  `json:"name"` // display name, derived from given and family name
+	GivenName         string                  `json:"given_name"`
+	FamilyName        string                  `json:"family_name"`
+	Email             string                  `json:"email,omitempty"`
+	Phone             string                  `json:"phone,omitempty"`
+	Address           Address                 `json:"address"`
+	DateOfBirth       string                  `json:"date_of_birth,omitempty"` // YYYY-MM-DD
+	PreferredLanguage string                  `json:"preferred_language,omitempty"`
+	Notifications     NotificationPreferences `json:"notifications"`
+	CardNumber        string                  `json:"card_number,omitempty"` // number of the active card, read only
+	Category          string                  `json:"category"`
+	MembershipExpires string                  `json:"membership_expires,omitempty"` // YYYY-MM-DD, set on creation and changed by renewing
+	KeepHistory       bool                    `json:"keep_history"`                 // opted in to keeping the loan history
+	Blocked           bool                    `json:"blocked"`                      // has an active block, read only
+	Version           int                     `json:"version,omitempty"`            // counts changes, sent as ETag
+	DeletedAt         *time.Time              `json:"deleted_at,omitempty"`
+}
+
+// Address is a postal address
+type Address struct {
+	Street     string `json:"street,omitempty"`
+	PostalCode string `json:"postal_code,omitempty"`
+	City       string `json:"city,omitempty"`
+	Country    string `json:"country,omitempty"`
+}
+
+// IsZero reports whether no address field is set
+func (a Address) IsZero() bool {
+	return a == Address{}
+}
+
+// NotificationPreferences holds the channels a member wants to be notified on
+type NotificationPreferences struct {
+	Email bool `json:"email"`
+	SMS   bool `json:"sms"`
+	Post  bool `json:"post"`
+}
+
+// DisplayName joins the given and family name
+func (m Member) DisplayName() string {
+	return strings.TrimSpace(m.GivenName + " " + m.FamilyName)
 }
 
 // Borrowing represents a book borrowing record
@@ -26,6 +73,7 @@ type Borrowing struct {
 	BookID     int        `json:"book_id"`
 	MemberID   int        `json:"member_id"`
 	IssueDate  time.Time  `json:"issue_date"`
+	DueDate    time.Time  `json:"due_date"`
 	ReturnDate *time.Time `json:"return_date,omitempty"` // nil if not returned
 }
 
@@ -33,8 +81,357 @@ type BorrowingDetail struct {
 	ID         int        `json:"id"`
 	BookID     int        `json:"book_id"`
 	BookTitle  string     `json:"book_title"`
-	MemberID   int        `json:"member_id"`
+	MemberID   int        `json:"member_id"` // zero once the loan is anonymized
 	MemberName string     `json:"member_name"`
+	Cohort     string     `json:"cohort,omitempty"` // set once the loan is anonymized
 	IssueDate  time.Time  `json:"issue_date"`
+	DueDate    *time.Time `json:"due_date,omitempty"`
 	ReturnDate *time.Time `json:"return_date,omitempty"` // nil if not returned
 }
+
+// Overdue reports whether the borrowing is open and past its due date at t
+func (b BorrowingDetail) Overdue(t time.Time) bool {
+	return b.ReturnDate == nil && b.DueDate != nil && t.After(*b.DueDate)
+}
+
+// CardStatus is the lifecycle state of a library card
+type CardStatus string
+
+const (
+	CardActive   CardStatus = "active"
+	CardLost     CardStatus = "lost"
+	CardReplaced CardStatus = "replaced"
+	CardExpired  CardStatus = "expired"
+)
+
+// Card is a library card issued to a member
+type Card struct {
+	ID         int        `json:"id"`
+	MemberID   int        `json:"member_id"`
+	Number     string     `json:"number"`
+	Status     CardStatus `json:"status"`
+	IssuedAt   time.Time  `json:"issued_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // nil if the card does not expire
+	ReplacedBy *int       `json:"replaced_by,omitempty"`
+}
+
+// Usable reports whether the card can be used for circulation at t
+func (c Card) Usable(t time.Time) bool {
+	return c.Status == CardActive && (c.ExpiresAt == nil || t.Before(*c.ExpiresAt))
+}
+
+// MembershipCategory carries the circulation rules for a group of members
+type MembershipCategory struct {
+	Code             string `json:"code"`
+	Name             string `json:"name"`
+	MaxLoans         int    `json:"max_loans"`
+	MaxHolds         int    `json:"max_holds"`
+	LoanPeriodDays   int    `json:"loan_period_days"`
+	MembershipMonths int    `json:"membership_months"`
+}
+
+// LoanPeriod returns the loan period as a duration
+func (c MembershipCategory) LoanPeriod() time.Duration {
+	return time.Duration(c.LoanPeriodDays) * 24 * time.Hour
+}
+
+// MembershipExpired reports whether the membership has lapsed at t
+func (m Member) MembershipExpired(t time.Time) bool {
+	if m.MembershipExpires == "" {
+		return false
+	}
+
+	expires, err := time.Parse(DateLayout, m.MembershipExpires)
+	if err != nil {
+		return false
+	}
+
+	// the membership is valid through the whole expiry day
+	return !t.Before(expires.AddDate(0, 0, 1))
+}
+
+// BlockKind tells whether a block was set by staff or by a circulation rule
+type BlockKind string
+
+const (
+	BlockManual    BlockKind = "manual"
+	BlockAutomatic BlockKind = "automatic"
+)
+
+// MemberBlock stops a member from borrowing and renewing until it is lifted
+// or expires
+type MemberBlock struct {
+	ID        int        `json:"id"`
+	MemberID  int        `json:"member_id"`
+	Kind      BlockKind  `json:"kind"`
+	Reason    string     `json:"reason"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	LiftedAt  *time.Time `json:"lifted_at,omitempty"`
+	LiftedBy  string     `json:"lifted_by,omitempty"`
+}
+
+// Active reports whether the block is in force at t
+func (b MemberBlock) Active(t time.Time) bool {
+	return b.LiftedAt == nil && (b.ExpiresAt == nil || t.Before(*b.ExpiresAt))
+}
+
+// ArchiveResult reports a run of the archival job
+type ArchiveResult struct {
+	DeletedBefore time.Time `json:"deleted_before"`
+	Anonymized    int       `json:"anonymized"`
+}
+
+// RetentionReport reports a run of the loan history retention job
+type RetentionReport struct {
+	DryRun         bool           `json:"dry_run"`
+	ReturnedBefore time.Time      `json:"returned_before"`
+	Loans          int            `json:"loans"`             // loans anonymized, or that would be on a dry run
+	Cohorts        map[string]int `json:"cohorts,omitempty"` // loans per cohort
+	Fines          int            `json:"fines"`             // fines of those loans unlinked from the member
+	Holds          int            `json:"holds"`             // closed holds deleted
+}
+
+// ErasureRecord is the audit record of a member's erasure request
+type ErasureRecord struct {
+	ID              int       `json:"id"`
+	MemberID        int       `json:"member_id"`
+	RequestedBy     string    `json:"requested_by"`
+	Reason          string    `json:"reason,omitempty"`
+	LoansAnonymized int       `json:"loans_anonymized"`
+	ErasedAt        time.Time `json:"erased_at"`
+}
+
+// MemberExport is everything the library stores about a member
+type MemberExport struct {
+	ExportedAt time.Time         `json:"exported_at"`
+	Member     Member            `json:"member"`
+	Cards      []Card            `json:"cards"`
+	Blocks     []MemberBlock     `json:"blocks"`
+	Loans      []BorrowingDetail `json:"loans"`
+	Holds      []Hold            `json:"holds"`
+	Fines      []Fine            `json:"fines"`
+}
+
+// HoldStatus is the lifecycle state of a hold
+type HoldStatus string
+
+const (
+	HoldWaiting   HoldStatus = "waiting"
+	HoldFulfilled HoldStatus = "fulfilled" // the member borrowed the book
+	HoldCancelled HoldStatus = "cancelled"
+)
+
+// Hold is a member's request to borrow a book next
+type Hold struct {
+	ID        int        `json:"id"`
+	BookID    int        `json:"book_id"`
+	BookTitle string     `json:"book_title"`
+	MemberID  int        `json:"member_id"`
+	Status    HoldStatus `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	ClosedAt  *time.Time `json:"closed_at,omitempty"`
+}
+
+// Fine is an amount a member owes, for example for an overdue loan
+type Fine struct {
+	ID          int        `json:"id"`
+	MemberID    int        `json:"member_id"` // zero once the loan is anonymized
+	BorrowingID *int       `json:"borrowing_id,omitempty"`
+	AmountCents int        `json:"amount_cents"`
+	Reason      string     `json:"reason"`
+	CreatedAt   time.Time  `json:"created_at"`
+	PaidAt      *time.Time `json:"paid_at,omitempty"`
+}
+
+// Amount formats the fine as a decimal amount
+func (f Fine) Amount() string {
+	return fmt.Sprintf("%d.%02d", f.AmountCents/100, f.AmountCents%100)
+}
+
+// StaffRole decides which parts of the backend API a staff user may use
+type StaffRole string
+
+const (
+	RoleAdmin     StaffRole = "admin"
+	RoleLibrarian StaffRole = "librarian"
+	RoleVolunteer StaffRole = "volunteer"
+	RoleReadOnly  StaffRole = "read-only"
+)
+
+// StaffRoles lists the roles from most to least privileged
+var StaffRoles = []StaffRole{RoleAdmin, RoleLibrarian, RoleVolunteer, RoleReadOnly}
+
+// Permission is a group of backend routes a role can be granted
+type Permission string
+
+const (
+	PermCatalogRead  Permission = "catalog:read"
+	PermCatalogWrite Permission = "catalog:write"
+	PermMembersRead  Permission = "members:read"
+	PermMembersWrite Permission = "members:write"
+	PermCirculation  Permission = "circulation"
+	PermReports      Permission = "reports"
+	PermAdmin        Permission = "admin" // staff accounts, jobs, erasure and configuration
+)
+
+var rolePermissions = map[StaffRole][]Permission{
+	RoleAdmin: {PermCatalogRead, PermCatalogWrite, PermMembersRead, PermMembersWrite, PermCirculation, PermReports,
+		PermAdmin},
+	RoleLibrarian: {PermCatalogRead, PermCatalogWrite, PermMembersRead, PermMembersWrite, PermCirculation, PermReports},
+	RoleVolunteer: {PermCatalogRead, PermMembersRead, PermCirculation},
+	RoleReadOnly:  {PermCatalogRead, PermMembersRead, PermReports},
+}
+
+// Valid reports whether r is a known role
+func (r StaffRole) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can reports whether the role is granted p
+func (r StaffRole) Can(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StaffUser is an account of a library employee or volunteer
+type StaffUser struct {
+	ID       int       `json:"id"`
+	Username string    `json:"username"`
+	Name     string    `json:"name"`
+	Role     StaffRole `json:"role"`
+	Disabled bool      `json:"disabled"`
+	// SSO is set for users provisioned by single sign-on, who have no
+	// password.
+	SSO         bool       `json:"sso"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// APIKeyScope is a set of permissions granted to an API key
+type APIKeyScope string
+
+const (
+	ScopeCatalogRead APIKeyScope = "catalog:read"
+	ScopeCirculation APIKeyScope = "circulation" // check in and out, look up members and cards
+	ScopeAdmin       APIKeyScope = "admin"       // everything
+)
+
+// APIKeyScopes lists the scopes a key can be given
+var APIKeyScopes = []APIKeyScope{ScopeCatalogRead, ScopeCirculation, ScopeAdmin}
+
+var scopePermissions = map[APIKeyScope][]Permission{
+	ScopeCatalogRead: {PermCatalogRead},
+	ScopeCirculation: {PermCatalogRead, PermMembersRead, PermCirculation},
+	ScopeAdmin:       rolePermissions[RoleAdmin],
+}
+
+// Valid reports whether s is a known scope
+func (s APIKeyScope) Valid() bool {
+	_, ok := scopePermissions[s]
+	return ok
+}
+
+// APIKey authenticates a script, kiosk or partner system. The secret key is
+// only shown when it is created or rotated, Prefix identifies it afterwards.
+type APIKey struct {
+	ID         int           `json:"id"`
+	Name       string        `json:"name"`
+	Prefix     string        `json:"prefix"`
+	Scopes     []APIKeyScope `json:"scopes"`
+	CreatedBy  string        `json:"created_by"`
+	CreatedAt  time.Time     `json:"created_at"`
+	ExpiresAt  *time.Time    `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time    `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time    `json:"revoked_at,omitempty"`
+}
+
+// Can reports whether one of the key's scopes grants p
+func (k APIKey) Can(p Permission) bool {
+	for _, s := range k.Scopes {
+		for _, granted := range scopePermissions[s] {
+			if granted == p {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Active reports whether the key can be used at t
+func (k APIKey) Active(t time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || t.Before(*k.ExpiresAt))
+}
+
+// AuditAction is what an audited change did
+type AuditAction string
+
+const (
+	AuditCreate  AuditAction = "create"
+	AuditUpdate  AuditAction = "update"
+	AuditDelete  AuditAction = "delete"
+	AuditRestore AuditAction = "restore"
+	AuditBorrow  AuditAction = "borrow"
+	AuditReturn  AuditAction = "return"
+	AuditRenew   AuditAction = "renew"
+	AuditErase   AuditAction = "erase"
+)
+
+// AuditActions lists the actions in the order they are offered as filter
+var AuditActions = []AuditAction{AuditCreate, AuditUpdate, AuditDelete, AuditRestore, AuditBorrow, AuditReturn, AuditRenew, AuditErase}
+
+// AuditEntity is the kind of record an audit entry is about
+type AuditEntity string
+
+const (
+	EntityBook     AuditEntity = "book"
+	EntityMember   AuditEntity = "member"
+	EntityLoan     AuditEntity = "loan"
+	EntityCard     AuditEntity = "card"
+	EntityBlock    AuditEntity = "block"
+	EntityHold     AuditEntity = "hold"
+	EntityFine     AuditEntity = "fine"
+	EntityCategory AuditEntity = "category"
+	EntityStaff    AuditEntity = "staff"
+	EntityAPIKey   AuditEntity = "apikey"
+)
+
+// AuditEntities lists the entities in the order they are offered as filter
+var AuditEntities = []AuditEntity{EntityBook, EntityMember, EntityLoan, EntityCard, EntityBlock, EntityHold, EntityFine, EntityCategory, EntityStaff, EntityAPIKey}
+
+// AuditEntry records one change. Actor is "staff:<username>",
+// "apikey:<prefix>", "patron:<member id>", "sip2:<institution>" or "system" for
+// scheduled jobs. BookID and MemberID link loans, holds, cards and the like
+// to the book and member histories. Before and After are snapshots of the
+// entity, without secrets; they are cleared, and RedactedAt set, when the
+// member's personal data is anonymized.
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	At         time.Time       `json:"at"`
+	Actor      string          `json:"actor"`
+	Action     AuditAction     `json:"action"`
+	Entity     AuditEntity     `json:"entity"`
+	EntityID   string          `json:"entity_id"`
+	BookID     int             `json:"book_id,omitempty"`
+	MemberID   int             `json:"member_id,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+	RedactedAt *time.Time      `json:"redacted_at,omitempty"`
+}
+
+// AuditPage is one page of audit entries with the number of all matches
+type AuditPage struct {
+	Entries []AuditEntry `json:"entries"`
+	Total   int          `json:"total"`
+	Offset  int          `json:"offset"`
+	Limit   int          `json:"limit"`
+}
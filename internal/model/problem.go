@@ -0,0 +1,41 @@
+package model
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ProblemContentType is the media type of problem details, RFC 7807
+const ProblemContentType = "application/problem+json"
+
+// ProblemTypePrefix starts the type URI of every problem, the backend
+// describes each code at that path
+const ProblemTypePrefix = "/problems/"
+
+// Problem is the response body of every failed API request, problem details
+// as in RFC 7807. Code is a stable machine readable reason, Type is the URI
+// reference of its description, Fields holds a message per invalid field
+// keyed by the json field name.
+type Problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	Instance  string            `json:"instance,omitempty"`
+	Code      string            `json:"code"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
+func (p *Problem) Error() string {
+	msg := p.Detail
+	if msg == "" {
+		msg = p.Title
+	}
+
+	if msg == "" {
+		msg = http.StatusText(p.Status)
+	}
+
+	return fmt.Sprintf("%s (%s)", msg, p.Code)
+}
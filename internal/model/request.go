@@ -1,6 +1,131 @@
 package model
 
+import "time"
+
 type BorrowRequest struct {
-	BookID   string `json:"book_id"`
-	MemberID string `json:"member_id"`
+	BookID     string `json:"book_id"`
+	MemberID   string `json:"member_id"`
+	CardNumber string `json:"card_number,omitempty"` // alternative to MemberID
+}
+
+// IssueCardRequest issues a new card to a member
+type IssueCardRequest struct {
+	ExpiresAt string `json:"expires_at,omitempty"` // YYYY-MM-DD, empty uses the configured validity
+}
+
+// ReplaceCardRequest retires a card and issues a replacement
+type ReplaceCardRequest struct {
+	Reason CardStatus `json:"reason"` // lost or replaced
+}
+
+// BlockRequest places a manual block on a member
+type BlockRequest struct {
+	Reason    string `json:"reason"`
+	ExpiresAt string `json:"expires_at,omitempty"` // YYYY-MM-DD the block lifts on, empty for no expiry
+}
+
+// ErasureRequest erases the personal data of a member
+type ErasureRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// SetPINRequest sets the PIN or password a member logs in to the patron
+// portal with
+type SetPINRequest struct {
+	PIN string `json:"pin"`
+}
+
+// PatronLoginRequest logs a member in to the patron portal
+type PatronLoginRequest struct {
+	CardNumber string `json:"card_number"`
+	PIN        string `json:"pin"`
+}
+
+// PatronSession is the response to a successful patron login
+type PatronSession struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Member    Member    `json:"member"`
+}
+
+// HoldRequest places a hold on a book
+type HoldRequest struct {
+	BookID int `json:"book_id"`
+}
+
+// ContactDetails are the member fields a patron may change themselves
+type ContactDetails struct {
+	Email             string                  `json:"email"`
+	Phone             string                  `json:"phone"`
+	Address           Address                 `json:"address"`
+	PreferredLanguage string                  `json:"preferred_language"`
+	Notifications     NotificationPreferences `json:"notifications"`
+}
+
+// Apply copies the contact details onto m
+func (c ContactDetails) Apply(m *Member) {
+	m.Email = c.Email
+	m.Phone = c.Phone
+	m.Address = c.Address
+	m.PreferredLanguage = c.PreferredLanguage
+	m.Notifications = c.Notifications
+}
+
+// StaffLoginRequest logs a staff user in to the backend API
+type StaffLoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// OIDCLoginRequest logs a staff user in with the ID token of a single
+// sign-on, Nonce is the one the login was started with
+type OIDCLoginRequest struct {
+	IDToken string `json:"id_token"`
+	Nonce   string `json:"nonce"`
+}
+
+// OIDCNonce is the nonce a single sign-on is started with, the backend
+// accepts it in one OIDCLoginRequest before ExpiresAt
+type OIDCNonce struct {
+	Nonce     string    `json:"nonce"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// StaffSession is the response to a successful staff login, Token is sent as
+// "Authorization: Bearer" on later requests
+type StaffSession struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	User      StaffUser `json:"user"`
+}
+
+// StaffUserRequest creates a staff user, or updates one when Password is
+// empty
+type StaffUserRequest struct {
+	Username string    `json:"username"`
+	Name     string    `json:"name"`
+	Role     StaffRole `json:"role"`
+	Disabled bool      `json:"disabled"`
+	Password string    `json:"password,omitempty"`
+}
+
+// PasswordRequest changes a staff password. Current is required when users
+// change their own password.
+type PasswordRequest struct {
+	Current  string `json:"current,omitempty"`
+	Password string `json:"password"`
+}
+
+// APIKeyRequest creates an API key
+type APIKeyRequest struct {
+	Name      string        `json:"name"`
+	Scopes    []APIKeyScope `json:"scopes"`
+	ExpiresAt string        `json:"expires_at,omitempty"` // YYYY-MM-DD the key stops working, empty for no expiry
+}
+
+// NewAPIKey is the response to creating or rotating an API key, the only
+// time Key is shown
+type NewAPIKey struct {
+	APIKey
+	Key string `json:"key"`
 }
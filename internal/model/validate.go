@@ -0,0 +1,175 @@
+package model
+
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DateLayout is the format of date-only fields such as DateOfBirth
+const DateLayout = "2006-01-02"
+
+var (
+	phoneRegex    = regexp.MustCompile(`^\+?[0-9][0-9 ()./-]{4,18}[0-9]$`)
+	languageRegex = regexp.MustCompile(`^[a-z]{2}(-[A-Z]{2})?$`)
+	isbnRegex     = regexp.MustCompile(`^([0-9]{9}[0-9X]|[0-9]{13})$`)
+)
+
+// Validate checks the member profile and returns a message per invalid
+// field, keyed by the json field name. An empty map means the member is
+// valid.
+func (m Member) Validate() map[string]string {
+	errs := map[string]string{}
+
+	if strings.TrimSpace(m.GivenName) == "" {
+		errs["given_name"] = "Given name is required."
+	}
+
+	if strings.TrimSpace(m.FamilyName) == "" {
+		errs["family_name"] = "Family name is required."
+	}
+
+	if m.Email != "" {
+		if addr, err := mail.ParseAddress(m.Email); err != nil || addr.Address != m.Email {
+			errs["email"] = "Invalid email address."
+		}
+	}
+
+	if m.Phone != "" && !phoneRegex.MatchString(m.Phone) {
+		errs["phone"] = "Invalid phone number. Use digits, spaces and an optional leading +."
+	}
+
+	if !m.Address.IsZero() && (strings.TrimSpace(m.Address.Street) == "" || strings.TrimSpace(m.Address.City) == "") {
+		errs["address"] = "An address needs at least a street and a city."
+	}
+
+	if m.DateOfBirth != "" {
+		dob, err := time.Parse(DateLayout, m.DateOfBirth)
+
+		switch {
+		case err != nil:
+			errs["date_of_birth"] = "Invalid date, use YYYY-MM-DD."
+		case dob.After(time.Now()):
+			errs["date_of_birth"] = "Date of birth cannot be in the future."
+		}
+	}
+
+	if m.MembershipExpires != "" {
+		if _, err := time.Parse(DateLayout, m.MembershipExpires); err != nil {
+			errs["membership_expires"] = "Invalid date, use YYYY-MM-DD."
+		}
+	}
+
+	if m.PreferredLanguage != "" && !languageRegex.MatchString(m.PreferredLanguage) {
+		errs["preferred_language"] = "Use a language code such as en or nl-BE."
+	}
+
+	if m.Notifications.Email && m.Email == "" {
+		errs["notifications"] = "Email notifications need an email address."
+	}
+
+	if m.Notifications.SMS && m.Phone == "" {
+		errs["notifications"] = "SMS notifications need a phone number."
+	}
+
+	if m.Notifications.Post && m.Address.IsZero() {
+		errs["notifications"] = "Postal notifications need an address."
+	}
+
+	return errs
+}
+
+// ValidateUpdate checks the member profile replacing stored. Members
+// migrated from a single-word name have no family name, which stays
+// optional for them until one is given.
+func (m Member) ValidateUpdate(stored Member) map[string]string {
+	errs := m.Validate()
+
+	if stored.FamilyName == "" && strings.TrimSpace(m.FamilyName) == "" {
+		delete(errs, "family_name")
+	}
+
+	return errs
+}
+
+// Validate checks the catalogue fields of a book and returns a message per
+// invalid field, keyed by the json field name.
+func (b Book) Validate() map[string]string {
+	errs := map[string]string{}
+
+	if strings.TrimSpace(b.Title) == "" {
+		errs["title"] = "Title is required."
+	}
+
+	if strings.TrimSpace(b.Author) == "" {
+		errs["author"] = "Author is required."
+	}
+
+	isbn := strings.NewReplacer("-", "", " ", "").Replace(strings.ToUpper(b.ISBN))
+	if !isbnRegex.MatchString(isbn) {
+		errs["isbn"] = "Use an ISBN of 10 or 13 digits."
+	}
+
+	if b.PublicationYear < 0 || b.PublicationYear > time.Now().Year()+1 {
+		errs["publication_year"] = "Invalid year."
+	}
+
+	if b.CopiesTotal < 0 {
+		errs["copies_total"] = "Must not be negative."
+	}
+
+	return errs
+}
+
+// Validate checks the rules of a membership category and returns the
+// problems keyed by JSON field name.
+func (c MembershipCategory) Validate() map[string]string {
+	errs := map[string]string{}
+
+	if strings.TrimSpace(c.Name) == "" {
+		errs["name"] = "Name is required."
+	}
+
+	if c.MaxLoans < 0 {
+		errs["max_loans"] = "Must not be negative."
+	}
+
+	if c.MaxHolds < 0 {
+		errs["max_holds"] = "Must not be negative."
+	}
+
+	if c.LoanPeriodDays < 1 {
+		errs["loan_period_days"] = "Must be at least one day."
+	}
+
+	if c.MembershipMonths < 1 {
+		errs["membership_months"] = "Must be at least one month."
+	}
+
+	return errs
+}
+
+var usernameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{1,31}$`)
+
+// MinPasswordLength is the shortest staff password accepted
+const MinPasswordLength = 8
+
+// Validate checks a staff user and returns a message per invalid field.
+func (u StaffUser) Validate() map[string]string {
+	errs := map[string]string{}
+
+	if !usernameRegex.MatchString(u.Username) {
+		errs["username"] = "Use 2 to 32 lowercase letters, digits, dots, dashes or underscores."
+	}
+
+	if strings.TrimSpace(u.Name) == "" {
+		errs["name"] = "Name is required."
+	}
+
+	if !u.Role.Valid() {
+		errs["role"] = "Unknown role."
+	}
+
+	return errs
+}
@@ -0,0 +1,312 @@
+// Package mockoidc is a minimal OpenID provider for development and tests.
+// It logs in a fixed user without asking for credentials, supports the
+// authorization code flow with PKCE and signs ID tokens with a key generated
+// at startup.
+package mockoidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/tliefheid/go-ils/internal/oidc"
+)
+
+// DefaultKeyID names the signing key in the key set when KeyID is empty.
+const DefaultKeyID = "mock"
+
+// User is the user the provider logs in.
+type User struct {
+	Subject           string
+	Email             string
+	Name              string
+	PreferredUsername string
+	Groups            []string
+}
+
+// Provider serves discovery, authorize, token and key set endpoints.
+type Provider struct {
+	// Issuer is the URL the provider is reached at.
+	Issuer string
+	// ClientID is the only client the provider accepts.
+	ClientID string
+	// User is logged in by every authorization request.
+	User User
+	// TokenLifetime is how long ID tokens are valid, an hour when zero.
+	TokenLifetime time.Duration
+	// KeyID names the signing key in the key set and the tokens,
+	// DefaultKeyID when empty. Tests sign with a key the relying party does
+	// not know by giving a second provider another ID.
+	KeyID string
+
+	key *rsa.PrivateKey
+	mux *http.ServeMux
+
+	mu    sync.Mutex
+	codes map[string]authRequest
+}
+
+type authRequest struct {
+	redirectURI string
+	nonce       string
+	challenge   string
+	expires     time.Time
+}
+
+// New creates a provider for the issuer URL.
+func New(issuer, clientID string, user User) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Provider{
+		Issuer:   issuer,
+		ClientID: clientID,
+		User:     user,
+		key:      key,
+		mux:      http.NewServeMux(),
+		codes:    map[string]authRequest{},
+	}
+
+	p.mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	p.mux.HandleFunc("GET /authorize", p.authorize)
+	p.mux.HandleFunc("POST /token", p.token)
+	p.mux.HandleFunc("GET /jwks", p.jwks)
+
+	return p, nil
+}
+
+// NewServer starts a provider on a local test server; close the server when
+// done.
+func NewServer(clientID string, user User) (*Provider, *httptest.Server, error) {
+	var p *Provider
+
+	// the issuer is the server URL, known once the server listens
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.ServeHTTP(w, r)
+	}))
+
+	p, err := New(srv.URL, clientID, user)
+	if err != nil {
+		srv.Close()
+		return nil, nil, err
+	}
+
+	return p, srv, nil
+}
+
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mux.ServeHTTP(w, r)
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.Issuer,
+		"authorization_endpoint":                p.Issuer + "/authorize",
+		"token_endpoint":                        p.Issuer + "/token",
+		"jwks_uri":                              p.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []oidc.JWK{oidc.RSAKey(p.keyID(), &p.key.PublicKey)},
+	})
+}
+
+// authorize logs the user in at once and sends the code back to the client.
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI := q.Get("redirect_uri")
+
+	switch {
+	case q.Get("client_id") != p.ClientID:
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	case redirectURI == "":
+		http.Error(w, "missing redirect_uri", http.StatusBadRequest)
+		return
+	case q.Get("response_type") != "code":
+		http.Error(w, "unsupported response_type", http.StatusBadRequest)
+		return
+	case q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256":
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	code, err := oidc.RandomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	p.mu.Lock()
+	p.codes[code] = authRequest{
+		redirectURI: redirectURI,
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		expires:     time.Now().Add(time.Minute),
+	}
+	p.mu.Unlock()
+
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	back := u.Query()
+	back.Set("code", code)
+	back.Set("state", q.Get("state"))
+	u.RawQuery = back.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// token redeems a code once, after checking the PKCE verifier.
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", err.Error())
+		return
+	}
+
+	clientID := r.PostForm.Get("client_id")
+	if user, _, ok := r.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(user)
+	}
+
+	code := r.PostForm.Get("code")
+
+	p.mu.Lock()
+	req, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code":
+		tokenError(w, "unsupported_grant_type", "")
+		return
+	case clientID != p.ClientID:
+		tokenError(w, "invalid_client", "")
+		return
+	case !ok || time.Now().After(req.expires):
+		tokenError(w, "invalid_grant", "unknown or expired code")
+		return
+	case r.PostForm.Get("redirect_uri") != req.redirectURI:
+		tokenError(w, "invalid_grant", "redirect_uri mismatch")
+		return
+	case oidc.Challenge(r.PostForm.Get("code_verifier")) != req.challenge:
+		tokenError(w, "invalid_grant", "code_verifier mismatch")
+		return
+	}
+
+	lifetime := p.lifetime()
+
+	idToken, err := p.IDToken(req.nonce, time.Now().Add(lifetime))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	access, err := oidc.RandomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, oidc.Token{
+		AccessToken: access,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(lifetime.Seconds()),
+		IDToken:     idToken,
+	})
+}
+
+func (p *Provider) lifetime() time.Duration {
+	if p.TokenLifetime > 0 {
+		return p.TokenLifetime
+	}
+
+	return time.Hour
+}
+
+func (p *Provider) keyID() string {
+	if p.KeyID != "" {
+		return p.KeyID
+	}
+
+	return DefaultKeyID
+}
+
+// IDToken signs an ID token for the user, so tests can also present
+// expired tokens or tokens with another nonce.
+func (p *Provider) IDToken(nonce string, expires time.Time) (string, error) {
+	claims := map[string]interface{}{
+		"iss":    p.Issuer,
+		"sub":    p.User.Subject,
+		"aud":    p.ClientID,
+		"iat":    time.Now().Unix(),
+		"exp":    expires.Unix(),
+		"groups": p.User.Groups,
+	}
+
+	optional := map[string]string{
+		"nonce":              nonce,
+		"email":              p.User.Email,
+		"name":               p.User.Name,
+		"preferred_username": p.User.PreferredUsername,
+	}
+
+	for k, v := range optional {
+		if v != "" {
+			claims[k] = v
+		}
+	}
+
+	return p.sign(claims)
+}
+
+func (p *Provider) sign(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": p.keyID()})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func tokenError(w http.ResponseWriter, code, description string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code, "error_description": description})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,236 @@
+// Package oidc implements the parts of OpenID Connect go-ils needs: provider
+// discovery, the authorization code flow with PKCE and validation of ID
+// tokens against the provider's JSON Web Key Set.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultScopes are requested when a Client has no scopes.
+var DefaultScopes = []string{"openid", "profile", "email"}
+
+// ErrInvalidToken is returned for ID tokens that fail validation.
+var ErrInvalidToken = errors.New("invalid ID token")
+
+// Metadata is the part of the provider configuration served at
+// /.well-known/openid-configuration that the client uses.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Token is the answer of the token endpoint.
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+}
+
+// Client talks to one OpenID provider. The provider configuration and its
+// keys are fetched on first use, so a provider that is down at startup does
+// not keep the service from starting.
+type Client struct {
+	// Issuer is the provider URL, it must equal the iss claim of its tokens.
+	Issuer string
+	// ClientID is the client registered at the provider, the audience of
+	// its ID tokens.
+	ClientID string
+	// ClientSecret authenticates a confidential client, empty for a public
+	// client that relies on PKCE alone.
+	ClientSecret string
+	// RedirectURL receives the authorization code.
+	RedirectURL string
+	// Scopes are requested at login, DefaultScopes when empty.
+	Scopes []string
+	// HTTPClient makes the requests to the provider, a client with a 10
+	// second timeout when nil.
+	HTTPClient *http.Client
+
+	mu       sync.Mutex
+	metadata *Metadata
+	keys     *keySet
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+// Metadata returns the provider configuration, discovering it on the first
+// call.
+func (c *Client) Metadata(ctx context.Context) (*Metadata, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.metadata != nil {
+		return c.metadata, nil
+	}
+
+	var m Metadata
+	if err := c.getJSON(ctx, strings.TrimSuffix(c.Issuer, "/")+"/.well-known/openid-configuration", &m); err != nil {
+		return nil, fmt.Errorf("discovering OpenID provider: %w", err)
+	}
+
+	if m.Issuer != c.Issuer {
+		return nil, fmt.Errorf("provider issuer %q does not match %q", m.Issuer, c.Issuer)
+	}
+
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, errors.New("provider configuration lacks endpoints")
+	}
+
+	c.metadata = &m
+	c.keys = &keySet{uri: m.JWKSURI, client: c}
+
+	return c.metadata, nil
+}
+
+// AuthCodeURL returns the URL the user is sent to for logging in. The
+// challenge is the PKCE challenge of the verifier passed to Exchange.
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+	m, err := c.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	scopes := c.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.ClientID},
+		"redirect_uri":          {c.RedirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(m.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return m.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange trades an authorization code and its PKCE verifier for tokens.
+func (c *Client) Exchange(ctx context.Context, code, verifier string) (*Token, error) {
+	m, err := c.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.RedirectURL},
+		"client_id":     {c.ClientID},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if c.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(body, &e) == nil && e.Error != "" {
+			return nil, fmt.Errorf("token endpoint: %s %s", e.Error, e.Description)
+		}
+
+		return nil, fmt.Errorf("token endpoint: status %d", resp.StatusCode)
+	}
+
+	var t Token
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return nil, err
+	}
+
+	if t.IDToken == "" {
+		return nil, errors.New("token endpoint returned no ID token")
+	}
+
+	return &t, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, uri string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", uri, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// RandomString returns a URL safe random string for states, nonces and PKCE
+// verifiers.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge returns the S256 PKCE challenge of a verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
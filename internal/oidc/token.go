@@ -0,0 +1,353 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clockSkew is the leeway allowed between our clock and the provider's.
+const clockSkew = time.Minute
+
+// IDToken holds the validated claims of an ID token.
+type IDToken struct {
+	Issuer            string
+	Subject           string
+	Audience          []string
+	Expiry            time.Time
+	Nonce             string
+	Email             string
+	Name              string
+	PreferredUsername string
+	// Claims has all claims, for provider specific ones like groups.
+	Claims map[string]interface{}
+}
+
+// Strings returns a claim holding a string or a list of strings.
+func (t *IDToken) Strings(claim string) []string {
+	switch v := t.Claims[claim].(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		var s []string
+
+		for _, e := range v {
+			if str, ok := e.(string); ok {
+				s = append(s, str)
+			}
+		}
+
+		return s
+	}
+
+	return nil
+}
+
+// audience decodes the aud claim, which is a string or a list of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*a = audience{s}
+		return nil
+	}
+
+	var l []string
+	if err := json.Unmarshal(b, &l); err != nil {
+		return err
+	}
+
+	*a = l
+
+	return nil
+}
+
+type claims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	Expiry            int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// Verify checks the signature of a raw ID token against the provider's keys
+// and validates issuer, audience, expiry and, when not empty, the nonce.
+func (c *Client) Verify(ctx context.Context, raw, nonce string) (*IDToken, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+
+	if _, err := c.Metadata(ctx); err != nil {
+		return nil, err
+	}
+
+	key, err := c.keys.get(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	var cl claims
+	if err := decodeSegment(parts[1], &cl); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+
+	var all map[string]interface{}
+	if err := decodeSegment(parts[1], &all); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+
+	now := time.Now()
+	expiry := time.Unix(cl.Expiry, 0)
+
+	switch {
+	case cl.Issuer != c.Issuer:
+		return nil, fmt.Errorf("%w: issuer %q", ErrInvalidToken, cl.Issuer)
+	case !contains(cl.Audience, c.ClientID):
+		return nil, fmt.Errorf("%w: not issued to %q", ErrInvalidToken, c.ClientID)
+	case len(cl.Audience) > 1 && cl.AuthorizedParty != c.ClientID:
+		return nil, fmt.Errorf("%w: authorized party %q", ErrInvalidToken, cl.AuthorizedParty)
+	case cl.Expiry == 0 || now.After(expiry.Add(clockSkew)):
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	case cl.IssuedAt != 0 && time.Unix(cl.IssuedAt, 0).After(now.Add(clockSkew)):
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidToken)
+	case cl.Subject == "":
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	case nonce != "" && cl.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+
+	return &IDToken{
+		Issuer:            cl.Issuer,
+		Subject:           cl.Subject,
+		Audience:          cl.Audience,
+		Expiry:            expiry,
+		Nonce:             cl.Nonce,
+		Email:             cl.Email,
+		Name:              cl.Name,
+		PreferredUsername: cl.PreferredUsername,
+		Claims:            all,
+	}, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+func contains(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verifySignature checks an RS256 or ES256 signature, the algorithms
+// providers use for ID tokens.
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	sum := sha256.Sum256([]byte(signed))
+
+	switch alg {
+	case "RS256":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not fit %s", alg)
+		}
+
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig)
+	case "ES256":
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return fmt.Errorf("key does not fit %s", alg)
+		}
+
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(k, sum[:], r, s) {
+			return fmt.Errorf("bad signature")
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("unsupported algorithm %q", alg)
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// PublicKey decodes the RSA or P-256 key.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	num := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := num(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := num(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := num(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := num(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// RSAKey returns the JWK of an RSA public key.
+func RSAKey(kid string, k *rsa.PublicKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+	}
+}
+
+// keySet caches the provider's keys. An unknown key ID refetches the set,
+// which picks up keys the provider rotated in, at most once a minute.
+type keySet struct {
+	uri    string
+	client *Client
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+func (s *keySet) get(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if k, ok := s.lookup(kid); ok {
+		return k, nil
+	}
+
+	if time.Since(s.fetched) < time.Minute {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+	}
+
+	var set struct {
+		Keys []JWK `json:"keys"`
+	}
+
+	if err := s.client.getJSON(ctx, s.uri, &set); err != nil {
+		return nil, fmt.Errorf("fetching provider keys: %w", err)
+	}
+
+	s.keys = map[string]crypto.PublicKey{}
+	s.fetched = time.Now()
+
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		k, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+
+		s.keys[jwk.Kid] = k
+	}
+
+	if k, ok := s.lookup(kid); ok {
+		return k, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+}
+
+// lookup finds a key by ID; a token without key ID matches a set of one key.
+func (s *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if k, ok := s.keys[kid]; ok {
+		return k, true
+	}
+
+	if kid == "" && len(s.keys) == 1 {
+		for _, k := range s.keys {
+			return k, true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/tliefheid/go-ils/internal/model"
+)
+
+// AuditFilter selects audit entries, zero fields match everything.
+type AuditFilter struct {
+	Actor     string
+	Action    model.AuditAction
+	Entity    model.AuditEntity
+	EntityID  string
+	BookID    int
+	MemberID  int
+	RequestID string
+	// From and To bound the time of the change, To exclusive.
+	From time.Time
+	To   time.Time
+}
@@ -0,0 +1,129 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+const apiKeyColumns = `id, name, prefix, scopes, created_by, created_at, expires_at, last_used_at, revoked_at`
+
+// activeAPIKey matches keys that are neither revoked nor expired.
+const activeAPIKey = `revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())`
+
+func scanAPIKey(row rowScanner) (*model.APIKey, error) {
+	var (
+		k                          model.APIKey
+		scopes                     []string
+		expires, lastUsed, revoked sql.NullTime
+	)
+
+	err := row.Scan(&k.ID, &k.Name, &k.Prefix, pq.Array(&scopes), &k.CreatedBy, &k.CreatedAt, &expires, &lastUsed, &revoked)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range scopes {
+		k.Scopes = append(k.Scopes, model.APIKeyScope(s))
+	}
+
+	if expires.Valid {
+		k.ExpiresAt = &expires.Time
+	}
+
+	if lastUsed.Valid {
+		k.LastUsedAt = &lastUsed.Time
+	}
+
+	if revoked.Valid {
+		k.RevokedAt = &revoked.Time
+	}
+
+	return &k, nil
+}
+
+func (s *Store) AddAPIKey(ctx context.Context, k model.APIKey, keyHash string) (*model.APIKey, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	scopes := make([]string, len(k.Scopes))
+	for i, sc := range k.Scopes {
+		scopes[i] = string(sc)
+	}
+
+	return scanAPIKey(s.db.QueryRowContext(ctx, `INSERT INTO api_keys (name, prefix, key_hash, scopes, created_by, created_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING `+apiKeyColumns,
+		k.Name, k.Prefix, keyHash, pq.Array(scopes), k.CreatedBy, time.Now(), k.ExpiresAt))
+}
+
+func (s *Store) GetAPIKey(ctx context.Context, id int) (*model.APIKey, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return scanAPIKey(s.db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE id=$1", id))
+}
+
+func (s *Store) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY revoked_at DESC NULLS FIRST, name")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var keys []model.APIKey
+
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, *k)
+	}
+
+	return keys, rows.Err()
+}
+
+func (s *Store) UseAPIKey(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return scanAPIKey(s.db.QueryRowContext(ctx, `UPDATE api_keys SET last_used_at=now()
+	WHERE key_hash=$1 AND `+activeAPIKey+` RETURNING `+apiKeyColumns, keyHash))
+}
+
+func (s *Store) RevokeAPIKey(ctx context.Context, id int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, "UPDATE api_keys SET revoked_at=$1 WHERE id=$2 AND revoked_at IS NULL", time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return repository.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) RotateAPIKey(ctx context.Context, id int, prefix, keyHash string) (*model.APIKey, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return scanAPIKey(s.db.QueryRowContext(ctx, `UPDATE api_keys SET prefix=$1, key_hash=$2, last_used_at=NULL
+	WHERE id=$3 AND `+activeAPIKey+` RETURNING `+apiKeyColumns, prefix, keyHash, id))
+}
@@ -0,0 +1,168 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+const auditColumns = `id, at, actor, action, entity, entity_id, book_id, member_id, before_data, after_data, request_id, redacted_at`
+
+func scanAuditEntry(row rowScanner) (*model.AuditEntry, error) {
+	var (
+		e                model.AuditEntry
+		bookID, memberID sql.NullInt64
+		before, after    []byte
+		requestID        sql.NullString
+		redacted         sql.NullTime
+	)
+
+	err := row.Scan(&e.ID, &e.At, &e.Actor, &e.Action, &e.Entity, &e.EntityID, &bookID, &memberID, &before, &after, &requestID, &redacted)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	e.BookID = int(bookID.Int64)
+	e.MemberID = int(memberID.Int64)
+	e.Before = before
+	e.After = after
+	e.RequestID = requestID.String
+
+	if redacted.Valid {
+		e.RedactedAt = &redacted.Time
+	}
+
+	return &e, nil
+}
+
+func (s *Store) AddAuditEntry(ctx context.Context, e model.AuditEntry) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO audit_log (at, actor, action, entity, entity_id, book_id, member_id, before_data, after_data, request_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		e.At, e.Actor, e.Action, e.Entity, e.EntityID, nullInt(e.BookID), nullInt(e.MemberID),
+		nullJSON(e.Before), nullJSON(e.After), nullString(e.RequestID))
+
+	return err
+}
+
+func (s *Store) ListAuditEntries(ctx context.Context, f repository.AuditFilter, offset, limit int) ([]model.AuditEntry, int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var (
+		conds []string
+		args  []interface{}
+	)
+
+	where := func(cond string, v interface{}) {
+		args = append(args, v)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.Actor != "" {
+		where("actor = $%d", f.Actor)
+	}
+
+	if f.Action != "" {
+		where("action = $%d", f.Action)
+	}
+
+	if f.Entity != "" {
+		where("entity = $%d", f.Entity)
+	}
+
+	if f.EntityID != "" {
+		where("entity_id = $%d", f.EntityID)
+	}
+
+	if f.BookID != 0 {
+		where("book_id = $%d", f.BookID)
+	}
+
+	if f.MemberID != 0 {
+		where("member_id = $%d", f.MemberID)
+	}
+
+	if f.RequestID != "" {
+		where("request_id = $%d", f.RequestID)
+	}
+
+	if !f.From.IsZero() {
+		where("at >= $%d", f.From)
+	}
+
+	if !f.To.IsZero() {
+		where("at < $%d", f.To)
+	}
+
+	clause := ""
+	if len(conds) > 0 {
+		clause = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT count(*) FROM audit_log"+clause, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, limit, offset)
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT "+auditColumns+" FROM audit_log"+clause+" ORDER BY id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	var entries []model.AuditEntry
+
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		entries = append(entries, *e)
+	}
+
+	return entries, total, rows.Err()
+}
+
+// redactAudit clears the snapshots of the audit entries matching where,
+// which may use $1 to $n for args. Patron actors lose their member ID, and
+// unlinkHistory also unlinks the loans, fines and holds from the member like
+// the loan history.
+func redactAudit(ctx context.Context, tx *sql.Tx, where string, unlinkHistory bool, args ...interface{}) error {
+	memberID := "member_id"
+	if unlinkHistory {
+		memberID = "CASE WHEN entity IN ('loan', 'fine', 'hold') THEN NULL ELSE member_id END"
+	}
+
+	_, err := tx.ExecContext(ctx, `UPDATE audit_log SET before_data=NULL, after_data=NULL, redacted_at=COALESCE(redacted_at, now()), member_id=`+memberID+`,
+	actor=CASE WHEN actor LIKE 'patron:%' THEN 'patron' ELSE actor END
+	WHERE `+where, args...)
+
+	return err
+}
+
+func nullInt(i int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(i), Valid: i != 0}
+}
+
+func nullJSON(b []byte) interface{} {
+	if len(b) == 0 {
+		return nil
+	}
+
+	return string(b)
+}
@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+const blockColumns = `id, member_id, kind, reason, created_by, created_at, expires_at, lifted_at, lifted_by`
+
+func scanBlock(row rowScanner) (model.MemberBlock, error) {
+	var (
+		b               model.MemberBlock
+		expires, lifted sql.NullTime
+		liftedBy        sql.NullString
+	)
+
+	if err := row.Scan(&b.ID, &b.MemberID, &b.Kind, &b.Reason, &b.CreatedBy, &b.CreatedAt, &expires, &lifted, &liftedBy); err != nil {
+		return b, err
+	}
+
+	if expires.Valid {
+		b.ExpiresAt = &expires.Time
+	}
+
+	if lifted.Valid {
+		b.LiftedAt = &lifted.Time
+	}
+
+	b.LiftedBy = liftedBy.String
+
+	return b, nil
+}
+
+func (s *Store) AddBlock(ctx context.Context, b model.MemberBlock) (*model.MemberBlock, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	block, err := scanBlock(s.db.QueryRowContext(ctx, `INSERT INTO member_blocks (member_id, kind, reason, created_by, created_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6) RETURNING `+blockColumns, b.MemberID, b.Kind, b.Reason, b.CreatedBy, time.Now(), b.ExpiresAt))
+	if err != nil {
+		return nil, err
+	}
+
+	return &block, nil
+}
+
+func (s *Store) ListMemberBlocks(ctx context.Context, memberID int) ([]model.MemberBlock, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+blockColumns+" FROM member_blocks WHERE member_id=$1 ORDER BY created_at DESC", memberID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var blocks []model.MemberBlock
+
+	for rows.Next() {
+		b, err := scanBlock(rows)
+		if err != nil {
+			slog.ErrorContext(ctx, "skip unreadable row", "err", err)
+			continue
+		}
+
+		blocks = append(blocks, b)
+	}
+
+	return blocks, nil
+}
+
+func (s *Store) GetBlock(ctx context.Context, id int) (*model.MemberBlock, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	b, err := scanBlock(s.db.QueryRowContext(ctx, "SELECT "+blockColumns+" FROM member_blocks WHERE id=$1", id))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
+
+func (s *Store) LiftBlock(ctx context.Context, id int, by string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, "UPDATE member_blocks SET lifted_at=$1, lifted_by=$2 WHERE id=$3 AND lifted_at IS NULL", time.Now(), by, id)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return repository.ErrNotFound
+	}
+
+	return nil
+}
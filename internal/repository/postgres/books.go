@@ -1,14 +1,21 @@
 package postgres
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 
+	"github.com/lib/pq"
 	"github.com/tliefheid/go-ils/internal/model"
 	"github.com/tliefheid/go-ils/internal/repository"
 )
 
-func (s *Store) ListBooks() ([]model.Book, error) {
-	rows, err := s.db.Query("SELECT id, title, author, isbn, publication_year, copies_total, copies_available FROM books ORDER BY title")
+func (s *Store) ListBooks(ctx context.Context) ([]model.Book, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT id, title, author, isbn, publication_year, copies_total, copies_available FROM books WHERE deleted_at IS NULL ORDER BY title")
 	if err != nil {
 		return nil, err
 	}
@@ -19,7 +26,7 @@ func (s *Store) ListBooks() ([]model.Book, error) {
 	for rows.Next() {
 		var b model.Book
 		if err := rows.Scan(&b.ID, &b.Title, &b.Author, &b.ISBN, &b.PublicationYear, &b.CopiesTotal, &b.CopiesAvailable); err != nil {
-			fmt.Println("Error scanning row:", err)
+			slog.ErrorContext(ctx, "skip unreadable row", "err", err)
 			continue
 		}
 
@@ -29,8 +36,11 @@ func (s *Store) ListBooks() ([]model.Book, error) {
 	return books, nil
 }
 
-func (s *Store) SearchBookByISBN(isbn string) (*model.Book, error) {
-	rows, err := s.db.Query(`SELECT id, title, author, isbn, publication_year, copies_total, copies_available FROM books WHERE isbn ILIKE '%' || $1 || '%'`, isbn)
+func (s *Store) SearchBookByISBN(ctx context.Context, isbn string) (*model.Book, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `SELECT id, title, author, isbn, publication_year, copies_total, copies_available FROM books WHERE deleted_at IS NULL AND isbn ILIKE '%' || $1 || '%'`, isbn)
 	if err != nil {
 		return nil, err
 	}
@@ -42,15 +52,13 @@ func (s *Store) SearchBookByISBN(isbn string) (*model.Book, error) {
 	for rows.Next() {
 		var b model.Book
 		if err := rows.Scan(&b.ID, &b.Title, &b.Author, &b.ISBN, &b.PublicationYear, &b.CopiesTotal, &b.CopiesAvailable); err != nil {
-			fmt.Println("Error scanning row:", err)
+			slog.ErrorContext(ctx, "skip unreadable row", "err", err)
 			continue
 		}
 
 		books = append(books, &b)
 	}
 
-	fmt.Printf("search with isbn: len(books): %v\n", len(books))
-
 	if len(books) == 0 {
 		return nil, repository.ErrNotFound
 	}
@@ -61,8 +69,11 @@ func (s *Store) SearchBookByISBN(isbn string) (*model.Book, error) {
 
 	return books[0], nil
 }
-func (s *Store) SearchBooks(search string) ([]model.Book, error) {
-	rows, err := s.db.Query(`SELECT id, title, author, isbn, publication_year, copies_total, copies_available FROM books WHERE title ILIKE '%' || $1 || '%' OR author ILIKE '%' || $1 || '%' OR isbn ILIKE '%' || $1 || '%'`, search)
+func (s *Store) SearchBooks(ctx context.Context, search string) ([]model.Book, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `SELECT id, title, author, isbn, publication_year, copies_total, copies_available FROM books WHERE deleted_at IS NULL AND (title ILIKE '%' || $1 || '%' OR author ILIKE '%' || $1 || '%' OR isbn ILIKE '%' || $1 || '%')`, search)
 	if err != nil {
 		return nil, err
 	}
@@ -74,7 +85,7 @@ func (s *Store) SearchBooks(search string) ([]model.Book, error) {
 	for rows.Next() {
 		var b model.Book
 		if err := rows.Scan(&b.ID, &b.Title, &b.Author, &b.ISBN, &b.PublicationYear, &b.CopiesTotal, &b.CopiesAvailable); err != nil {
-			fmt.Println("Error scanning row:", err)
+			slog.ErrorContext(ctx, "skip unreadable row", "err", err)
 			continue
 		}
 
@@ -84,18 +95,30 @@ func (s *Store) SearchBooks(search string) ([]model.Book, error) {
 	return books, nil
 }
 
-func (s *Store) AddBook(book model.Book) error {
+func (s *Store) AddBook(ctx context.Context, book model.Book) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	query := `INSERT INTO books (title, author, isbn, publication_year, copies_total, copies_available) VALUES ($1, $2, $3, $4, $5, $5) RETURNING id`
 
-	err := s.db.QueryRow(query, book.Title, book.Author, book.ISBN, book.PublicationYear, book.CopiesTotal).Scan(&book.ID)
+	err := s.db.QueryRowContext(ctx, query, book.Title, book.Author, book.ISBN, book.PublicationYear, book.CopiesTotal).Scan(&book.ID)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return 0, fmt.Errorf("isbn %s: %w", book.ISBN, repository.ErrDuplicate)
+	}
+
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	return book.ID, nil
 }
-func (s *Store) GetBook(id int) (*model.Book, error) {
-	rows, err := s.db.Query("SELECT id, title, author, isbn, publication_year, copies_total, copies_available FROM books WHERE id=$1", id)
+func (s *Store) GetBook(ctx context.Context, id int) (*model.Book, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT id, title, author, isbn, publication_year, copies_total, copies_available, version FROM books WHERE id=$1 AND deleted_at IS NULL", id)
 	if err != nil {
 		return nil, err
 	}
@@ -105,8 +128,8 @@ func (s *Store) GetBook(id int) (*model.Book, error) {
 
 	for rows.Next() {
 		var b model.Book
-		if err := rows.Scan(&b.ID, &b.Title, &b.Author, &b.ISBN, &b.PublicationYear, &b.CopiesTotal, &b.CopiesAvailable); err != nil {
-			fmt.Println("Error scanning row:", err)
+		if err := rows.Scan(&b.ID, &b.Title, &b.Author, &b.ISBN, &b.PublicationYear, &b.CopiesTotal, &b.CopiesAvailable, &b.Version); err != nil {
+			slog.ErrorContext(ctx, "skip unreadable row", "err", err)
 			continue
 		}
 
@@ -114,7 +137,7 @@ func (s *Store) GetBook(id int) (*model.Book, error) {
 	}
 
 	if len(books) == 0 {
-		return nil, fmt.Errorf("book with id %d not found", id)
+		return nil, fmt.Errorf("book with id %d: %w", id, repository.ErrNotFound)
 	}
 
 	if len(books) > 1 {
@@ -123,23 +146,74 @@ func (s *Store) GetBook(id int) (*model.Book, error) {
 
 	return &books[0], nil
 }
-func (s *Store) UpdateBook(book model.Book) error {
-	query := `UPDATE books SET title=$1, author=$2, isbn=$3, publication_year=$4, copies_total=$5, copies_available=$6 WHERE id=$7`
+func (s *Store) UpdateBook(ctx context.Context, book model.Book) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	// copies lent out stay lent out, only added or removed copies change
+	// what is available; a loan since the caller checked can leave fewer
+	// copies on the shelf than are removed, which is a conflict
+	query := `UPDATE books SET title=$1, author=$2, isbn=$3, publication_year=$4, copies_available=copies_available+($5-copies_total), copies_total=$5
+	WHERE id=$6 AND deleted_at IS NULL AND ($7=0 OR version=$7) AND copies_available+($5-copies_total) >= 0`
+
+	res, err := s.db.ExecContext(ctx, query, book.Title, book.Author, book.ISBN, book.PublicationYear, book.CopiesTotal, book.ID, book.Version)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return fmt.Errorf("isbn %s: %w", book.ISBN, repository.ErrDuplicate)
+	}
 
-	_, err := s.db.Exec(query, book.Title, book.Author, book.ISBN, book.PublicationYear, book.CopiesTotal, book.CopiesAvailable, book.ID)
 	if err != nil {
-		fmt.Println("Error updating book:", err)
 		return err
 	}
 
+	if n, _ := res.RowsAffected(); n == 0 {
+		if err := s.checkVersion(ctx, "books", book.ID, book.Version); err != nil {
+			return err
+		}
+
+		// the row moved on between the update and the check, or copies
+		// were lent out that the update would remove
+		return repository.ErrConflict
+	}
+
 	return nil
 }
-func (s *Store) DeleteBook(id int) error {
-	_, err := s.db.Exec("DELETE FROM books WHERE id=$1", id)
+func (s *Store) DeleteBook(ctx context.Context, id, version int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.softDelete(ctx, "books", "book_id", id, version)
+}
+
+func (s *Store) RestoreBook(ctx context.Context, id int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.restore(ctx, "books", id)
+}
+
+func (s *Store) ListDeletedBooks(ctx context.Context) ([]model.Book, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT id, title, author, isbn, publication_year, copies_total, copies_available, deleted_at FROM books WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC")
 	if err != nil {
-		fmt.Println("Error deleting book:", err)
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	return nil
+	var books []model.Book
+
+	for rows.Next() {
+		var b model.Book
+		if err := rows.Scan(&b.ID, &b.Title, &b.Author, &b.ISBN, &b.PublicationYear, &b.CopiesTotal, &b.CopiesAvailable, &b.DeletedAt); err != nil {
+			slog.ErrorContext(ctx, "skip unreadable row", "err", err)
+			continue
+		}
+
+		books = append(books, b)
+	}
+
+	return books, nil
 }
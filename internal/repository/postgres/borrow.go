@@ -1,20 +1,53 @@
 package postgres
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
 )
 
-func (s *Store) ListBorrowings() ([]model.BorrowingDetail, error) {
-	rows, err := s.db.Query(`
-	SELECT br.id, b.id, b.title, m.id, m.name, br.issue_date FROM borrowings br
+// borrowingDetailQuery selects the columns read by scanBorrowingDetail.
+// Anonymized borrowings have no member, only a cohort.
+const borrowingDetailQuery = `
+	SELECT br.id, b.id, b.title, m.id, COALESCE(m.name, ''), br.cohort, br.issue_date, br.due_date, br.return_date FROM borrowings br
 	JOIN books b
 	ON br.book_id = b.id
-	JOIN members m
-	ON br.member_id = m.id
-	WHERE br.return_date IS NULL`)
+	LEFT JOIN members m
+	ON br.member_id = m.id`
+
+func scanBorrowingDetail(row rowScanner) (model.BorrowingDetail, error) {
+	var (
+		bd                model.BorrowingDetail
+		memberID          sql.NullInt64
+		cohort            sql.NullString
+		due, returnedDate sql.NullTime
+	)
+
+	if err := row.Scan(&bd.ID, &bd.BookID, &bd.BookTitle, &memberID, &bd.MemberName, &cohort, &bd.IssueDate, &due, &returnedDate); err != nil {
+		return bd, err
+	}
+
+	bd.MemberID = int(memberID.Int64)
+	bd.Cohort = cohort.String
+
+	if due.Valid {
+		bd.DueDate = &due.Time
+	}
+
+	if returnedDate.Valid {
+		bd.ReturnDate = &returnedDate.Time
+	}
+
+	return bd, nil
+}
+
+func (s *Store) queryBorrowings(ctx context.Context, query string, args ...interface{}) ([]model.BorrowingDetail, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -24,140 +57,253 @@ func (s *Store) ListBorrowings() ([]model.BorrowingDetail, error) {
 	var result []model.BorrowingDetail
 
 	for rows.Next() {
-		var id, bookId, memberId int
-
-		var title, name string
-
-		var issueDate time.Time
-		if err := rows.Scan(&id, &bookId, &title, &memberId, &name, &issueDate); err != nil {
-			fmt.Println("Error scanning row:", err)
+		bd, err := scanBorrowingDetail(rows)
+		if err != nil {
+			slog.ErrorContext(ctx, "skip unreadable row", "err", err)
 			continue
 		}
 
-		bd := model.BorrowingDetail{
-			ID:         id,
-			BookID:     id,
-			BookTitle:  title,
-			MemberID:   memberId,
-			MemberName: name,
-			IssueDate:  issueDate,
-		}
 		result = append(result, bd)
 	}
 
-	return result, nil
+	return result, rows.Err()
 }
-func (s *Store) AddBorrowing(b model.Borrowing) error {
-	var available int
 
-	err := s.db.QueryRow("SELECT copies_available FROM books WHERE id=$1", b.BookID).Scan(&available)
+func (s *Store) ListBorrowings(ctx context.Context) ([]model.BorrowingDetail, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.queryBorrowings(ctx, borrowingDetailQuery+`
+	WHERE br.return_date IS NULL`)
+}
+func (s *Store) AddBorrowing(ctx context.Context, b model.Borrowing, maxLoans int) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// the member's row lock serializes the checkouts of one member, so two
+	// of them cannot both pass the loan limit
+	var exists bool
+
+	err = tx.QueryRowContext(ctx, "SELECT true FROM members WHERE id=$1 FOR UPDATE", b.MemberID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("member ID %d: %w", b.MemberID, repository.ErrNotFound)
 	}
 
-	if available < 1 {
-		fmt.Println("No copies available for book ID:", b.BookID)
-		return fmt.Errorf("no copies available for book ID: %d", b.BookID)
+	if err != nil {
+		return 0, err
 	}
-	// Insert borrowing record
-	issueDate := time.Now()
 
-	_, err = s.db.Exec(`INSERT INTO borrowings (book_id, member_id, issue_date) VALUES ($1, $2, $3)`, b.BookID, b.MemberID, issueDate)
+	var open int
+
+	err = tx.QueryRowContext(ctx, "SELECT count(*) FROM borrowings WHERE member_id=$1 AND return_date IS NULL", b.MemberID).Scan(&open)
+	if err != nil {
+		return 0, err
+	}
+
+	if open >= maxLoans {
+		return 0, fmt.Errorf("member ID %d has %d loans: %w", b.MemberID, open, repository.ErrLoanLimit)
+	}
+
+	if err := takeCopy(ctx, tx, b.BookID); err != nil {
+		return 0, err
+	}
+
+	id, err := insertBorrowing(ctx, tx, b)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// takeCopy lends one available copy of a book. The guard on the stock makes
+// concurrent checkouts of the last copy fail instead of overdrawing it.
+func takeCopy(ctx context.Context, tx *sql.Tx, bookID int) error {
+	res, err := tx.ExecContext(ctx, "UPDATE books SET copies_available = copies_available - 1 WHERE id=$1 AND deleted_at IS NULL AND copies_available > 0", bookID)
 	if err != nil {
-		fmt.Println("Error inserting borrowing record:", err)
 		return err
 	}
 
-	// Update book inventory
-	_, err = s.db.Exec("UPDATE books SET copies_available = copies_available - 1 WHERE id=$1", b.BookID)
+	if n, _ := res.RowsAffected(); n == 1 {
+		return nil
+	}
+
+	var exists bool
+
+	err = tx.QueryRowContext(ctx, "SELECT true FROM books WHERE id=$1 AND deleted_at IS NULL", bookID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("book ID %d: %w", bookID, repository.ErrNotFound)
+	}
+
 	if err != nil {
-		fmt.Println("Error updating book inventory:", err)
 		return err
 	}
 
-	return nil
+	return fmt.Errorf("book ID %d: %w", bookID, repository.ErrUnavailable)
 }
-func (s *Store) GetBorrowing(id int) (*model.BorrowingDetail, error) {
-	rows, err := s.db.Query(`
-	SELECT br.id, b.id, b.title, m.id, m.name, br.issue_date FROM borrowings br
-	JOIN books b
-	ON br.book_id = b.id
-	JOIN members m
-	ON br.member_id = m.id
-	WHERE br.id=$1`, id)
+
+func insertBorrowing(ctx context.Context, tx *sql.Tx, b model.Borrowing) (int, error) {
+	dueDate := sql.NullTime{Time: b.DueDate, Valid: !b.DueDate.IsZero()}
+
+	var id int
+
+	err := tx.QueryRowContext(ctx, `INSERT INTO borrowings (book_id, member_id, issue_date, due_date) VALUES ($1, $2, $3, $4) RETURNING id`,
+		b.BookID, b.MemberID, time.Now(), dueDate).Scan(&id)
+
+	return id, err
+}
+
+func (s *Store) GetBorrowing(ctx context.Context, id int) (*model.BorrowingDetail, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	bd, err := scanBorrowingDetail(s.db.QueryRowContext(ctx, borrowingDetailQuery+`
+	WHERE br.id=$1`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("borrowing with id %d %w", id, repository.ErrNotFound)
+	}
+
 	if err != nil {
 		return nil, err
 	}
 
-	defer rows.Close()
-
-	var result []*model.BorrowingDetail
+	return &bd, nil
+}
 
-	for rows.Next() {
-		var id, bookId, memberId int
+func (s *Store) ListMemberBorrowings(ctx context.Context, memberID int) ([]model.BorrowingDetail, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-		var title, name string
+	return s.queryBorrowings(ctx, borrowingDetailQuery+`
+	WHERE br.member_id=$1 AND br.return_date IS NULL
+	ORDER BY br.issue_date`, memberID)
+}
 
-		var issueDate time.Time
-		if err := rows.Scan(&id, &bookId, &title, &memberId, &name, &issueDate); err != nil {
-			fmt.Println("Error scanning row:", err)
-			continue
-		}
+func (s *Store) FindOpenBorrowing(ctx context.Context, bookID int) (*model.BorrowingDetail, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-		bd := &model.BorrowingDetail{
-			ID:         id,
-			BookID:     id,
-			BookTitle:  title,
-			MemberID:   memberId,
-			MemberName: name,
-			IssueDate:  issueDate,
-		}
-		result = append(result, bd)
+	bd, err := scanBorrowingDetail(s.db.QueryRowContext(ctx, borrowingDetailQuery+`
+	WHERE br.book_id=$1 AND br.return_date IS NULL
+	ORDER BY br.issue_date
+	LIMIT 1`, bookID))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
 	}
 
-	if len(result) == 0 {
-		return nil, fmt.Errorf("borrowing with id %d not found", id)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(result) > 1 {
-		return nil, fmt.Errorf("multiple borrowings found with id %d", id)
+	return &bd, nil
+}
+
+func (s *Store) ReturnBorrowing(ctx context.Context, id int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
 
-	return result[0], nil
-}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	bookID, err := closeBorrowing(ctx, tx, id)
+	if err != nil {
+		return err
+	}
 
-func (s *Store) DeleteBorrowing(id int) error {
-	_, err := s.db.Exec("DELETE FROM borrowings WHERE book_id=$1", id)
+	_, err = tx.ExecContext(ctx, "UPDATE books SET copies_available = copies_available + 1 WHERE id=$1", bookID)
 	if err != nil {
-		fmt.Println("Error deleting borrowing:", err)
 		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-func (s *Store) ReturnBorrowing(id int) error {
-	returnDate := time.Now()
+func (s *Store) RenewBorrowing(ctx context.Context, id int, renewal model.Borrowing) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	_, err := s.db.Exec(`UPDATE borrowings SET return_date=$1 WHERE id=$2`, returnDate, id)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		fmt.Println("Error updating borrowing return date:", err)
-		return err
+		return 0, err
 	}
 
-	b, err := s.GetBorrowing(id)
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// the copy passes from the closed borrowing to the renewal, the stock
+	// does not change
+	bookID, err := closeBorrowing(ctx, tx, id)
 	if err != nil {
-		fmt.Println("Error getting borrowing details:", err)
-		return err
+		return 0, err
 	}
 
-	fmt.Printf("b: %v\n", b)
+	renewal.BookID = bookID
 
-	_, err = s.db.Exec("UPDATE books SET copies_available = copies_available + 1 WHERE id=$1", b.BookID)
+	newID, err := insertBorrowing(ctx, tx, renewal)
 	if err != nil {
-		fmt.Println("Error updating book inventory after return:", err)
-		return err
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// closeBorrowing sets the return date of an open borrowing and returns its
+// book. A borrowing returned meanwhile is ErrConflict, so a copy is never
+// given back twice.
+func closeBorrowing(ctx context.Context, tx *sql.Tx, id int) (int, error) {
+	var bookID int
+
+	err := tx.QueryRowContext(ctx, `UPDATE borrowings SET return_date=$1 WHERE id=$2 AND return_date IS NULL RETURNING book_id`, time.Now(), id).Scan(&bookID)
+	if err == nil {
+		return bookID, nil
+	}
+
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	err = tx.QueryRowContext(ctx, "SELECT book_id FROM borrowings WHERE id=$1", id).Scan(&bookID)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("borrowing with id %d %w", id, repository.ErrNotFound)
+	}
+
+	if err != nil {
+		return 0, err
 	}
 
-	return nil
+	return 0, fmt.Errorf("borrowing %d is already returned: %w", id, repository.ErrConflict)
+}
+
+func (s *Store) CountOpenBorrowings(ctx context.Context, now time.Time) (open, overdue int, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	err = s.db.QueryRowContext(ctx, `SELECT COUNT(*), COUNT(*) FILTER (WHERE due_date < $1) FROM borrowings WHERE return_date IS NULL`, now).
+		Scan(&open, &overdue)
+
+	return open, overdue, err
 }
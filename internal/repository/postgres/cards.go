@@ -0,0 +1,143 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+const cardColumns = `id, member_id, number, status, issued_at, expires_at, replaced_by`
+
+func scanCard(row rowScanner) (model.Card, error) {
+	var (
+		c          model.Card
+		expires    sql.NullTime
+		replacedBy sql.NullInt64
+	)
+
+	if err := row.Scan(&c.ID, &c.MemberID, &c.Number, &c.Status, &c.IssuedAt, &expires, &replacedBy); err != nil {
+		return c, err
+	}
+
+	if expires.Valid {
+		c.ExpiresAt = &expires.Time
+	}
+
+	if replacedBy.Valid {
+		id := int(replacedBy.Int64)
+		c.ReplacedBy = &id
+	}
+
+	// expiry is not stored, an active card past its date reads as expired
+	if c.Status == model.CardActive && c.ExpiresAt != nil && !c.Usable(time.Now()) {
+		c.Status = model.CardExpired
+	}
+
+	return c, nil
+}
+
+func (s *Store) NextCardSequence(ctx context.Context) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var seq int64
+
+	err := s.db.QueryRowContext(ctx, "SELECT nextval('card_number_seq')").Scan(&seq)
+
+	return seq, err
+}
+
+func (s *Store) AddCard(ctx context.Context, c model.Card) (*model.Card, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	card, err := scanCard(s.db.QueryRowContext(ctx, `INSERT INTO cards (member_id, number, status, issued_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5) RETURNING `+cardColumns, c.MemberID, c.Number, model.CardActive, time.Now(), c.ExpiresAt))
+	if err != nil {
+		return nil, err
+	}
+
+	return &card, nil
+}
+
+func (s *Store) ListMemberCards(ctx context.Context, memberID int) ([]model.Card, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+cardColumns+" FROM cards WHERE member_id=$1 ORDER BY issued_at DESC", memberID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var cards []model.Card
+
+	for rows.Next() {
+		c, err := scanCard(rows)
+		if err != nil {
+			slog.ErrorContext(ctx, "skip unreadable row", "err", err)
+			continue
+		}
+
+		cards = append(cards, c)
+	}
+
+	return cards, nil
+}
+
+func (s *Store) GetCardByNumber(ctx context.Context, number string) (*model.Card, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	c, err := scanCard(s.db.QueryRowContext(ctx, "SELECT "+cardColumns+" FROM cards WHERE number=$1", number))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (s *Store) ReplaceCard(ctx context.Context, id int, status model.CardStatus, replacement model.Card) (*model.Card, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	card, err := scanCard(tx.QueryRowContext(ctx, `INSERT INTO cards (member_id, number, status, issued_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5) RETURNING `+cardColumns, replacement.MemberID, replacement.Number, model.CardActive, time.Now(), replacement.ExpiresAt))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := tx.ExecContext(ctx, "UPDATE cards SET status=$1, replaced_by=$2 WHERE id=$3 AND status=$4", status, card.ID, id, model.CardActive)
+	if err != nil {
+		return nil, err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("card %d is not active", id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &card, nil
+}
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+const categoryColumns = `code, name, max_loans, max_holds, loan_period_days, membership_months`
+
+func scanCategory(row rowScanner) (model.MembershipCategory, error) {
+	var c model.MembershipCategory
+
+	err := row.Scan(&c.Code, &c.Name, &c.MaxLoans, &c.MaxHolds, &c.LoanPeriodDays, &c.MembershipMonths)
+
+	return c, err
+}
+
+func (s *Store) ListCategories(ctx context.Context) ([]model.MembershipCategory, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+categoryColumns+" FROM membership_categories ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var categories []model.MembershipCategory
+
+	for rows.Next() {
+		c, err := scanCategory(rows)
+		if err != nil {
+			slog.ErrorContext(ctx, "skip unreadable row", "err", err)
+			continue
+		}
+
+		categories = append(categories, c)
+	}
+
+	return categories, nil
+}
+
+func (s *Store) GetCategory(ctx context.Context, code string) (*model.MembershipCategory, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	c, err := scanCategory(s.db.QueryRowContext(ctx, "SELECT "+categoryColumns+" FROM membership_categories WHERE code=$1", code))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (s *Store) UpdateCategory(ctx context.Context, c model.MembershipCategory) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `UPDATE membership_categories SET name=$1, max_loans=$2, max_holds=$3, loan_period_days=$4, membership_months=$5
+	WHERE code=$6`, c.Name, c.MaxLoans, c.MaxHolds, c.LoanPeriodDays, c.MembershipMonths, c.Code)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return repository.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+const erasureColumns = `id, member_id, requested_by, reason, loans_anonymized, erased_at`
+
+func scanErasure(row rowScanner) (model.ErasureRecord, error) {
+	var (
+		e      model.ErasureRecord
+		reason sql.NullString
+	)
+
+	err := row.Scan(&e.ID, &e.MemberID, &e.RequestedBy, &reason, &e.LoansAnonymized, &e.ErasedAt)
+	e.Reason = reason.String
+
+	return e, err
+}
+
+func (s *Store) ListMemberLoanHistory(ctx context.Context, memberID int) ([]model.BorrowingDetail, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.queryBorrowings(ctx, borrowingDetailQuery+`
+	WHERE br.member_id=$1
+	ORDER BY br.issue_date`, memberID)
+}
+
+func (s *Store) EraseMember(ctx context.Context, id int, requestedBy, reason string) (*model.ErasureRecord, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var exists bool
+
+	err = tx.QueryRowContext(ctx, "SELECT true FROM members WHERE id=$1 AND anonymized_at IS NULL FOR UPDATE", id).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var open int
+
+	err = tx.QueryRowContext(ctx, "SELECT count(*) FROM borrowings WHERE member_id=$1 AND return_date IS NULL", id).Scan(&open)
+	if err != nil {
+		return nil, err
+	}
+
+	if open > 0 {
+		return nil, fmt.Errorf("%d open loans: %w", open, repository.ErrOpenLoans)
+	}
+
+	var unpaid int
+
+	err = tx.QueryRowContext(ctx, "SELECT count(*) FROM fines WHERE member_id=$1 AND paid_at IS NULL", id).Scan(&unpaid)
+	if err != nil {
+		return nil, err
+	}
+
+	if unpaid > 0 {
+		return nil, fmt.Errorf("%d unpaid fines: %w", unpaid, repository.ErrUnpaidFines)
+	}
+
+	if err := redactAudit(ctx, tx, "member_id=$1", true, id); err != nil {
+		return nil, err
+	}
+
+	// the loan history goes to the member's cohort regardless of the
+	// keep_history opt-in, the member asked for erasure
+	res, err := tx.ExecContext(ctx, `UPDATE borrowings br SET cohort = `+cohortExpr+`, member_id = NULL
+	FROM members m WHERE br.member_id = m.id AND m.id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	loans, _ := res.RowsAffected()
+
+	if _, err := anonymizeMembers(ctx, tx, "id=$1", id); err != nil {
+		return nil, err
+	}
+
+	record, err := scanErasure(tx.QueryRowContext(ctx, `INSERT INTO erasures (member_id, requested_by, reason, loans_anonymized, erased_at)
+	VALUES ($1, $2, $3, $4, now()) RETURNING `+erasureColumns, id, requestedBy, nullString(reason), loans))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+func (s *Store) ListErasures(ctx context.Context) ([]model.ErasureRecord, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+erasureColumns+" FROM erasures ORDER BY erased_at DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var records []model.ErasureRecord
+
+	for rows.Next() {
+		e, err := scanErasure(rows)
+		if err != nil {
+			slog.ErrorContext(ctx, "skip unreadable row", "err", err)
+			continue
+		}
+
+		records = append(records, e)
+	}
+
+	return records, rows.Err()
+}
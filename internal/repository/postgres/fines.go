@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+const fineColumns = `id, member_id, borrowing_id, amount_cents, reason, created_at, paid_at`
+
+func scanFine(row rowScanner) (model.Fine, error) {
+	var (
+		f           model.Fine
+		memberID    sql.NullInt64
+		borrowingID sql.NullInt64
+		paid        sql.NullTime
+	)
+
+	if err := row.Scan(&f.ID, &memberID, &borrowingID, &f.AmountCents, &f.Reason, &f.CreatedAt, &paid); err != nil {
+		return f, err
+	}
+
+	f.MemberID = int(memberID.Int64)
+
+	if borrowingID.Valid {
+		id := int(borrowingID.Int64)
+		f.BorrowingID = &id
+	}
+
+	if paid.Valid {
+		f.PaidAt = &paid.Time
+	}
+
+	return f, nil
+}
+
+func (s *Store) AddFine(ctx context.Context, f model.Fine) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var id int
+
+	err := s.db.QueryRowContext(ctx, `INSERT INTO fines (member_id, borrowing_id, amount_cents, reason, created_at) VALUES ($1, $2, $3, $4, now()) RETURNING id`,
+		f.MemberID, f.BorrowingID, f.AmountCents, f.Reason).Scan(&id)
+
+	return id, err
+}
+
+func (s *Store) ListMemberFines(ctx context.Context, memberID int) ([]model.Fine, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+fineColumns+" FROM fines WHERE member_id=$1 ORDER BY created_at DESC", memberID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var fines []model.Fine
+
+	for rows.Next() {
+		f, err := scanFine(rows)
+		if err != nil {
+			slog.ErrorContext(ctx, "skip unreadable row", "err", err)
+			continue
+		}
+
+		fines = append(fines, f)
+	}
+
+	return fines, nil
+}
+
+func (s *Store) PayFine(ctx context.Context, id int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, "UPDATE fines SET paid_at=now() WHERE id=$1 AND paid_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return repository.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) GetFine(ctx context.Context, id int) (*model.Fine, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	f, err := scanFine(s.db.QueryRowContext(ctx, "SELECT "+fineColumns+" FROM fines WHERE id=$1", id))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
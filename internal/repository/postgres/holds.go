@@ -0,0 +1,129 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+const holdQuery = `SELECT h.id, h.book_id, b.title, h.member_id, h.status, h.created_at, h.closed_at FROM holds h
+	JOIN books b ON b.id = h.book_id`
+
+func scanHold(row rowScanner) (model.Hold, error) {
+	var (
+		h      model.Hold
+		closed sql.NullTime
+	)
+
+	if err := row.Scan(&h.ID, &h.BookID, &h.BookTitle, &h.MemberID, &h.Status, &h.CreatedAt, &closed); err != nil {
+		return h, err
+	}
+
+	if closed.Valid {
+		h.ClosedAt = &closed.Time
+	}
+
+	return h, nil
+}
+
+func (s *Store) queryHolds(ctx context.Context, query string, args ...interface{}) ([]model.Hold, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var holds []model.Hold
+
+	for rows.Next() {
+		h, err := scanHold(rows)
+		if err != nil {
+			slog.ErrorContext(ctx, "skip unreadable row", "err", err)
+			continue
+		}
+
+		holds = append(holds, h)
+	}
+
+	return holds, nil
+}
+
+func (s *Store) AddHold(ctx context.Context, h model.Hold) (*model.Hold, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var id int
+
+	err := s.db.QueryRowContext(ctx, `INSERT INTO holds (book_id, member_id, status, created_at) VALUES ($1, $2, $3, now()) RETURNING id`,
+		h.BookID, h.MemberID, model.HoldWaiting).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetHold(ctx, id)
+}
+
+func (s *Store) GetHold(ctx context.Context, id int) (*model.Hold, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	h, err := scanHold(s.db.QueryRowContext(ctx, holdQuery+" WHERE h.id=$1", id))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &h, nil
+}
+
+func (s *Store) ListMemberHolds(ctx context.Context, memberID int) ([]model.Hold, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.queryHolds(ctx, holdQuery+" WHERE h.member_id=$1 ORDER BY h.created_at DESC", memberID)
+}
+
+func (s *Store) CountWaitingHolds(ctx context.Context, bookID, exceptMemberID int) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var n int
+
+	err := s.db.QueryRowContext(ctx, "SELECT count(*) FROM holds WHERE book_id=$1 AND member_id<>$2 AND status=$3",
+		bookID, exceptMemberID, model.HoldWaiting).Scan(&n)
+
+	return n, err
+}
+
+func (s *Store) CloseHold(ctx context.Context, id int, status model.HoldStatus) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, "UPDATE holds SET status=$1, closed_at=now() WHERE id=$2 AND status=$3", status, id, model.HoldWaiting)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return repository.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) FulfillHold(ctx context.Context, memberID, bookID int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "UPDATE holds SET status=$1, closed_at=now() WHERE member_id=$2 AND book_id=$3 AND status=$4",
+		model.HoldFulfilled, memberID, bookID, model.HoldWaiting)
+
+	return err
+}
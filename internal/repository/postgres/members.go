@@ -1,13 +1,74 @@
 package postgres
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
 )
 
-func (s *Store) ListMemberss() ([]model.Member, error) {
-	rows, err := s.db.Query("SELECT id, name, contact FROM members")
+const memberColumns = `id, given_name, family_name, email, phone, address_street, address_postal_code, address_city, address_country, date_of_birth, preferred_language, notify_email, notify_sms, notify_post, category, membership_expires_at, keep_history,
+	(SELECT c.number FROM cards c WHERE c.member_id = members.id AND c.status = 'active' ORDER BY c.issued_at DESC LIMIT 1),
+	EXISTS (SELECT 1 FROM member_blocks mb WHERE mb.member_id = members.id AND mb.lifted_at IS NULL AND (mb.expires_at IS NULL OR mb.expires_at > now())), version`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMember(row rowScanner) (model.Member, error) {
+	var (
+		m                                        model.Member
+		email, phone, street, postal, city, ctry sql.NullString
+		lang, card                               sql.NullString
+		dob, expires                             sql.NullTime
+	)
+
+	err := row.Scan(&m.ID, &m.GivenName, &m.FamilyName, &email, &phone, &street, &postal, &city, &ctry, &dob, &lang,
+		&m.Notifications.Email, &m.Notifications.SMS, &m.Notifications.Post, &m.Category, &expires, &m.KeepHistory, &card, &m.Blocked, &m.Version)
+	if err != nil {
+		return m, err
+	}
+
+	m.Name = m.DisplayName()
+	m.Email = email.String
+	m.Phone = phone.String
+	m.Address = model.Address{Street: street.String, PostalCode: postal.String, City: city.String, Country: ctry.String}
+	m.PreferredLanguage = lang.String
+	m.CardNumber = card.String
+
+	if dob.Valid {
+		m.DateOfBirth = dob.Time.Format(model.DateLayout)
+	}
+
+	if expires.Valid {
+		m.MembershipExpires = expires.Time.Format(model.DateLayout)
+	}
+
+	return m, nil
+}
+
+// memberArgs returns the values for the given_name to notify_post, name,
+// category and keep_history columns; the membership expiry is set apart.
+func memberArgs(m model.Member) []interface{} {
+	return []interface{}{
+		m.GivenName, m.FamilyName, nullString(m.Email), nullString(m.Phone),
+		nullString(m.Address.Street), nullString(m.Address.PostalCode), nullString(m.Address.City), nullString(m.Address.Country),
+		nullString(m.DateOfBirth), nullString(m.PreferredLanguage),
+		m.Notifications.Email, m.Notifications.SMS, m.Notifications.Post,
+		m.DisplayName(), m.Category, m.KeepHistory,
+	}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func (s *Store) queryMembers(ctx context.Context, query string, args ...interface{}) ([]model.Member, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -17,9 +78,9 @@ func (s *Store) ListMemberss() ([]model.Member, error) {
 	var members []model.Member
 
 	for rows.Next() {
-		var m model.Member
-		if err := rows.Scan(&m.ID, &m.Name, &m.Contact); err != nil {
-			fmt.Println("Error scanning row:", err)
+		m, err := scanMember(rows)
+		if err != nil {
+			slog.ErrorContext(ctx, "skip unreadable row", "err", err)
 			continue
 		}
 
@@ -29,82 +90,203 @@ func (s *Store) ListMemberss() ([]model.Member, error) {
 	return members, nil
 }
 
-func (s *Store) SearchMembers(search string) ([]model.Member, error) {
-	rows, err := s.db.Query(`SELECT id, name, contact FROM members WHERE name ILIKE '%' || $1 || '%' OR contact ILIKE '%' || $1 || '%'`, search)
+func (s *Store) ListMemberss(ctx context.Context) ([]model.Member, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.queryMembers(ctx, "SELECT "+memberColumns+" FROM members WHERE deleted_at IS NULL ORDER BY family_name, given_name")
+}
+
+func (s *Store) SearchMembers(ctx context.Context, search string) ([]model.Member, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.queryMembers(ctx, `SELECT `+memberColumns+` FROM members
+	WHERE deleted_at IS NULL AND (name ILIKE '%' || $1 || '%' OR given_name ILIKE '%' || $1 || '%' OR family_name ILIKE '%' || $1 || '%'
+	OR email ILIKE '%' || $1 || '%' OR phone ILIKE '%' || $1 || '%'
+	OR EXISTS (SELECT 1 FROM cards c WHERE c.member_id = members.id AND c.number = $1))
+	ORDER BY family_name, given_name`, search)
+}
+
+func (s *Store) AddMember(ctx context.Context, member model.Member) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	query := `INSERT INTO members (given_name, family_name, email, phone, address_street, address_postal_code, address_city, address_country, date_of_birth, preferred_language, notify_email, notify_sms, notify_post, name, category, keep_history, membership_expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17) RETURNING id`
+
+	var id int
+
+	err := s.db.QueryRowContext(ctx, query, append(memberArgs(member), nullString(member.MembershipExpires))...).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+func (s *Store) GetMember(ctx context.Context, id int) (*model.Member, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	m, err := scanMember(s.db.QueryRowContext(ctx, "SELECT "+memberColumns+" FROM members WHERE id=$1 AND deleted_at IS NULL", id))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+
 	if err != nil {
 		return nil, err
 	}
 
-	defer rows.Close()
+	return &m, nil
+}
+func (s *Store) UpdateMember(ctx context.Context, m model.Member) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	var members []model.Member
+	query := `UPDATE members SET given_name=$1, family_name=$2, email=$3, phone=$4, address_street=$5, address_postal_code=$6, address_city=$7, address_country=$8,
+	date_of_birth=$9, preferred_language=$10, notify_email=$11, notify_sms=$12, notify_post=$13, name=$14, category=$15, keep_history=$16
+	WHERE id=$17 AND deleted_at IS NULL AND ($18=0 OR version=$18)`
 
-	for rows.Next() {
-		var m model.Member
+	res, err := s.db.ExecContext(ctx, query, append(memberArgs(m), m.ID, m.Version)...)
+	if err != nil {
+		return err
+	}
 
-		if err := rows.Scan(&m.ID, &m.Name, &m.Contact); err != nil {
-			fmt.Println("Error scanning row:", err)
-			continue
+	if n, _ := res.RowsAffected(); n == 0 {
+		if err := s.checkVersion(ctx, "members", m.ID, m.Version); err != nil {
+			return err
 		}
 
-		members = append(members, m)
+		// the row moved on between the update and the check
+		return repository.ErrConflict
 	}
 
-	return members, nil
+	return nil
 }
+func (s *Store) RenewMembership(ctx context.Context, id int, expires time.Time) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-func (s *Store) AddMember(member model.Member) error {
-	query := `INSERT INTO members (name, contact) VALUES ($1, $2)`
-
-	_, err := s.db.Query(query, member.Name, member.Contact)
+	res, err := s.db.ExecContext(ctx, "UPDATE members SET membership_expires_at=$1 WHERE id=$2 AND deleted_at IS NULL", expires, id)
 	if err != nil {
 		return err
 	}
 
+	if n, _ := res.RowsAffected(); n == 0 {
+		return repository.ErrNotFound
+	}
+
 	return nil
 }
-func (s *Store) GetMember(id int) (*model.Member, error) {
-	rows, err := s.db.Query("SELECT id, name, contact FROM members WHERE id=$1", id)
+
+func (s *Store) DeleteMember(ctx context.Context, id, version int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.softDelete(ctx, "members", "member_id", id, version)
+}
+
+func (s *Store) RestoreMember(ctx context.Context, id int) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.restore(ctx, "members", id)
+}
+
+func (s *Store) ListDeletedMembers(ctx context.Context) ([]model.Member, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `SELECT `+memberColumns+`, deleted_at FROM members
+	WHERE deleted_at IS NOT NULL AND anonymized_at IS NULL ORDER BY deleted_at DESC`)
 	if err != nil {
 		return nil, err
 	}
 
 	defer rows.Close()
 
-	var members []*model.Member
+	var members []model.Member
 
 	for rows.Next() {
-		var m model.Member
-		if err := rows.Scan(&m.ID, &m.Name, &m.Contact); err != nil {
+		var deletedAt time.Time
+
+		m, err := scanMember(deletedScanner{rows, &deletedAt})
+		if err != nil {
+			slog.ErrorContext(ctx, "skip unreadable row", "err", err)
 			continue
 		}
 
-		members = append(members, &m)
+		m.DeletedAt = &deletedAt
+		members = append(members, m)
 	}
 
-	return members[0], nil
+	return members, nil
 }
-func (s *Store) UpdateMember(m model.Member) error {
-	query := `UPDATE members SET name=$1, contact=$2,WHERE id=$3`
 
-	_, err := s.db.Exec(query, m.Name, m.Contact, m.ID)
+func (s *Store) AnonymizeDeletedMembers(ctx context.Context, before time.Time) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
-}
-func (s *Store) DeleteMember(id int) error {
-	// First, delete all borrowings for this member (to avoid FK constraint errors)
-	_, err := s.db.Exec("DELETE FROM borrowings WHERE member_id=$1", id)
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	n, err := anonymizeMembers(ctx, tx, "deleted_at < $1 AND anonymized_at IS NULL", before)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// anonymizeMembers strips the personal data of the members matching where,
+// which may use $1 to $n for args. Cards, blocks, holds and portal sessions
+// only identify the person and are deleted, the borrowings and fines stay
+// for the statistics and now point at an anonymous member.
+func anonymizeMembers(ctx context.Context, tx *sql.Tx, where string, args ...interface{}) (int, error) {
+	selected := "SELECT id FROM members WHERE " + where
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM cards WHERE member_id IN ("+selected+")", args...); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM member_blocks WHERE member_id IN ("+selected+")", args...); err != nil {
+		return 0, err
 	}
 
-	_, err = s.db.Exec("DELETE FROM members WHERE id=$1", id)
+	if _, err := tx.ExecContext(ctx, "DELETE FROM holds WHERE member_id IN ("+selected+")", args...); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM patron_sessions WHERE member_id IN ("+selected+")", args...); err != nil {
+		return 0, err
+	}
+
+	if err := redactAudit(ctx, tx, "member_id IN ("+selected+")", false, args...); err != nil {
+		return 0, err
+	}
+
+	name := fmt.Sprintf("$%d", len(args)+1)
+
+	res, err := tx.ExecContext(ctx, `UPDATE members SET name=`+name+`, given_name=`+name+`, family_name='', email=NULL, phone=NULL,
+	address_street=NULL, address_postal_code=NULL, address_city=NULL, address_country=NULL,
+	date_of_birth=NULL, preferred_language=NULL, notify_email=false, notify_sms=false, notify_post=false, pin_hash=NULL,
+	deleted_at=COALESCE(deleted_at, now()), anonymized_at=now()
+	WHERE `+where, append(args, anonymizedName)...)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	n, _ := res.RowsAffected()
+
+	return int(n), nil
 }
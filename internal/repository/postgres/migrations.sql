@@ -0,0 +1,235 @@
+-- Books table
+CREATE TABLE IF NOT EXISTS books (
+    id SERIAL PRIMARY KEY,
+    title TEXT NOT NULL,
+    author TEXT NOT NULL,
+    isbn TEXT UNIQUE NOT NULL,
+    publication_year INT NOT NULL,
+    copies_total INT NOT NULL,
+    copies_available INT NOT NULL
+);
+-- Members table
+CREATE TABLE IF NOT EXISTS members (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    contact TEXT
+);
+-- Borrowings table
+CREATE TABLE IF NOT EXISTS borrowings (
+    id SERIAL PRIMARY KEY,
+    book_id INT REFERENCES books(id),
+    member_id INT REFERENCES members(id),
+    issue_date TIMESTAMP NOT NULL,
+    return_date TIMESTAMP
+);
+-- Structured member profiles
+ALTER TABLE members ADD COLUMN IF NOT EXISTS given_name TEXT;
+ALTER TABLE members ADD COLUMN IF NOT EXISTS family_name TEXT;
+ALTER TABLE members ADD COLUMN IF NOT EXISTS email TEXT;
+ALTER TABLE members ADD COLUMN IF NOT EXISTS phone TEXT;
+ALTER TABLE members ADD COLUMN IF NOT EXISTS address_street TEXT;
+ALTER TABLE members ADD COLUMN IF NOT EXISTS address_postal_code TEXT;
+ALTER TABLE members ADD COLUMN IF NOT EXISTS address_city TEXT;
+ALTER TABLE members ADD COLUMN IF NOT EXISTS address_country TEXT;
+ALTER TABLE members ADD COLUMN IF NOT EXISTS date_of_birth DATE;
+ALTER TABLE members ADD COLUMN IF NOT EXISTS preferred_language TEXT;
+ALTER TABLE members ADD COLUMN IF NOT EXISTS notify_email BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE members ADD COLUMN IF NOT EXISTS notify_sms BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE members ADD COLUMN IF NOT EXISTS notify_post BOOLEAN NOT NULL DEFAULT FALSE;
+-- Best-effort split of legacy members: the last word of the name becomes the
+-- family name, an email address or phone number is picked out of the free-form
+-- contact and anything else is kept as the street line of the address.
+UPDATE members SET
+    given_name = CASE WHEN trim(name) ~ '\s' THEN regexp_replace(trim(name), '\s+\S+$', '') ELSE trim(name) END,
+    family_name = CASE WHEN trim(name) ~ '\s' THEN regexp_replace(trim(name), '^.*\s', '') ELSE '' END,
+    email = substring(contact from '[^\s,;<>]+@[^\s,;<>]+\.[A-Za-z]{2,}'),
+    phone = substring(contact from '\+?[0-9][0-9 ()./-]{4,}[0-9]'),
+    address_street = CASE
+        WHEN substring(contact from '[^\s,;<>]+@[^\s,;<>]+\.[A-Za-z]{2,}') IS NULL
+         AND substring(contact from '\+?[0-9][0-9 ()./-]{4,}[0-9]') IS NULL
+        THEN nullif(trim(contact), '')
+    END
+WHERE given_name IS NULL;
+ALTER TABLE members ALTER COLUMN given_name SET NOT NULL;
+ALTER TABLE members ALTER COLUMN family_name SET NOT NULL;
+-- Library cards
+CREATE SEQUENCE IF NOT EXISTS card_number_seq;
+CREATE TABLE IF NOT EXISTS cards (
+    id SERIAL PRIMARY KEY,
+    member_id INT NOT NULL REFERENCES members(id),
+    number TEXT UNIQUE NOT NULL,
+    status TEXT NOT NULL DEFAULT 'active',
+    issued_at TIMESTAMP NOT NULL DEFAULT now(),
+    expires_at TIMESTAMP,
+    replaced_by INT REFERENCES cards(id)
+);
+CREATE INDEX IF NOT EXISTS cards_member_id_idx ON cards(member_id);
+-- Membership categories
+CREATE TABLE IF NOT EXISTS membership_categories (
+    code TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    max_loans INT NOT NULL,
+    max_holds INT NOT NULL,
+    loan_period_days INT NOT NULL,
+    membership_months INT NOT NULL
+);
+INSERT INTO membership_categories (code, name, max_loans, max_holds, loan_period_days, membership_months) VALUES
+    ('adult', 'Adult', 10, 5, 21, 12),
+    ('child', 'Child', 5, 3, 21, 12),
+    ('staff', 'Staff', 25, 10, 42, 12),
+    ('institutional', 'Institutional', 50, 20, 42, 12)
+ON CONFLICT (code) DO NOTHING;
+ALTER TABLE members ADD COLUMN IF NOT EXISTS category TEXT NOT NULL DEFAULT 'adult' REFERENCES membership_categories(code);
+ALTER TABLE members ADD COLUMN IF NOT EXISTS membership_expires_at DATE;
+UPDATE members SET membership_expires_at = CURRENT_DATE + INTERVAL '12 months' WHERE membership_expires_at IS NULL;
+ALTER TABLE borrowings ADD COLUMN IF NOT EXISTS due_date TIMESTAMP;
+UPDATE borrowings SET due_date = issue_date + INTERVAL '21 days' WHERE due_date IS NULL;
+-- Member blocks
+CREATE TABLE IF NOT EXISTS member_blocks (
+    id SERIAL PRIMARY KEY,
+    member_id INT NOT NULL REFERENCES members(id),
+    kind TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    created_by TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP,
+    lifted_at TIMESTAMP,
+    lifted_by TEXT
+);
+CREATE INDEX IF NOT EXISTS member_blocks_member_id_idx ON member_blocks (member_id);
+-- Soft delete and archival
+ALTER TABLE books ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE members ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE members ADD COLUMN IF NOT EXISTS anonymized_at TIMESTAMP;
+-- Loan history retention
+ALTER TABLE members ADD COLUMN IF NOT EXISTS keep_history BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE borrowings ADD COLUMN IF NOT EXISTS cohort TEXT;
+-- Erasure requests
+CREATE TABLE IF NOT EXISTS erasures (
+    id SERIAL PRIMARY KEY,
+    member_id INT NOT NULL REFERENCES members(id),
+    requested_by TEXT NOT NULL,
+    reason TEXT,
+    loans_anonymized INT NOT NULL,
+    erased_at TIMESTAMP NOT NULL
+);
+-- Patron portal: PINs, sessions, holds and fines
+ALTER TABLE members ADD COLUMN IF NOT EXISTS pin_hash TEXT;
+CREATE TABLE IF NOT EXISTS patron_sessions (
+    token_hash TEXT PRIMARY KEY,
+    member_id INT NOT NULL REFERENCES members(id),
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+CREATE TABLE IF NOT EXISTS holds (
+    id SERIAL PRIMARY KEY,
+    book_id INT NOT NULL REFERENCES books(id),
+    member_id INT NOT NULL REFERENCES members(id),
+    status TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    closed_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS holds_book_id_idx ON holds (book_id) WHERE status = 'waiting';
+CREATE TABLE IF NOT EXISTS fines (
+    id SERIAL PRIMARY KEY,
+    member_id INT REFERENCES members(id),
+    borrowing_id INT REFERENCES borrowings(id),
+    amount_cents INT NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    paid_at TIMESTAMP
+);
+-- fines of anonymized loans keep no member
+ALTER TABLE fines ALTER COLUMN member_id DROP NOT NULL;
+-- Staff users, roles and sessions
+CREATE TABLE IF NOT EXISTS staff_users (
+    id SERIAL PRIMARY KEY,
+    username TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    role TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    disabled BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP NOT NULL,
+    last_login_at TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS staff_sessions (
+    token_hash TEXT PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES staff_users(id),
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+-- Nonces of single sign-ons in progress, each accepted once
+CREATE TABLE IF NOT EXISTS oidc_nonces (
+    nonce_hash TEXT PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL
+);
+-- API keys for machine clients
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL,
+    created_by TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+-- staff users provisioned by single sign-on
+ALTER TABLE staff_users ADD COLUMN IF NOT EXISTS oidc_subject TEXT UNIQUE;
+-- append-only audit log of every change
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    at TIMESTAMP NOT NULL,
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    entity TEXT NOT NULL,
+    entity_id TEXT NOT NULL,
+    book_id INT,
+    member_id INT,
+    before_data JSONB,
+    after_data JSONB,
+    request_id TEXT,
+    redacted_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS audit_log_entity ON audit_log (entity, entity_id);
+CREATE INDEX IF NOT EXISTS audit_log_book ON audit_log (book_id);
+CREATE INDEX IF NOT EXISTS audit_log_member ON audit_log (member_id);
+CREATE INDEX IF NOT EXISTS audit_log_at ON audit_log (at);
+-- entries are never deleted; the only update allowed is redacting the
+-- personal data of an anonymized member
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.before_data IS NULL AND NEW.after_data IS NULL AND NEW.redacted_at IS NOT NULL
+        AND NEW.id = OLD.id AND NEW.at = OLD.at AND NEW.action = OLD.action AND NEW.entity = OLD.entity
+        AND NEW.entity_id = OLD.entity_id AND NEW.book_id IS NOT DISTINCT FROM OLD.book_id
+        AND NEW.request_id IS NOT DISTINCT FROM OLD.request_id THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+-- record versions for optimistic concurrency, bumped by every update
+ALTER TABLE books ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+ALTER TABLE members ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+CREATE OR REPLACE FUNCTION bump_version() RETURNS trigger AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS books_version ON books;
+CREATE TRIGGER books_version BEFORE UPDATE ON books
+    FOR EACH ROW EXECUTE FUNCTION bump_version();
+DROP TRIGGER IF EXISTS members_version ON members;
+CREATE TRIGGER members_version BEFORE UPDATE ON members
+    FOR EACH ROW EXECUTE FUNCTION bump_version();
+-- checksums of the migration scripts run, for the readiness check
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    checksum TEXT PRIMARY KEY,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
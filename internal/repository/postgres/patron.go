@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+func (s *Store) SetMemberPIN(ctx context.Context, memberID int, hash string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, "UPDATE members SET pin_hash=$1 WHERE id=$2 AND deleted_at IS NULL", hash, memberID)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return repository.ErrNotFound
+	}
+
+	// a new PIN ends all sessions opened with the old one
+	_, err = s.db.ExecContext(ctx, "DELETE FROM patron_sessions WHERE member_id=$1", memberID)
+
+	return err
+}
+
+func (s *Store) GetMemberPIN(ctx context.Context, memberID int) (string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var hash sql.NullString
+
+	err := s.db.QueryRowContext(ctx, "SELECT pin_hash FROM members WHERE id=$1 AND deleted_at IS NULL", memberID).Scan(&hash)
+	if err == sql.ErrNoRows || (err == nil && !hash.Valid) {
+		return "", repository.ErrNotFound
+	}
+
+	return hash.String, err
+}
+
+func (s *Store) AddPatronSession(ctx context.Context, tokenHash string, memberID int, expires time.Time) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO patron_sessions (token_hash, member_id, created_at, expires_at) VALUES ($1, $2, $3, $4)`,
+		tokenHash, memberID, time.Now(), expires)
+
+	return err
+}
+
+func (s *Store) GetPatronSession(ctx context.Context, tokenHash string) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var memberID int
+
+	err := s.db.QueryRowContext(ctx, `SELECT ps.member_id FROM patron_sessions ps
+	JOIN members m ON m.id = ps.member_id
+	WHERE ps.token_hash=$1 AND ps.expires_at > now() AND m.deleted_at IS NULL`, tokenHash).Scan(&memberID)
+	if err == sql.ErrNoRows {
+		return 0, repository.ErrNotFound
+	}
+
+	return memberID, err
+}
+
+func (s *Store) DeletePatronSession(ctx context.Context, tokenHash string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "DELETE FROM patron_sessions WHERE token_hash=$1 OR expires_at < now()", tokenHash)
+
+	return err
+}
@@ -0,0 +1,214 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+var bookColumns = map[repository.BookField]string{
+	repository.BookFieldTitle:  "title",
+	repository.BookFieldAuthor: "author",
+	repository.BookFieldISBN:   "isbn",
+	repository.BookFieldYear:   "publication_year",
+}
+
+func (s *Store) QueryBooks(ctx context.Context, q *repository.BookQuery, offset, limit int) ([]model.Book, int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var args []interface{}
+
+	where, err := buildBookWhere(q, &args)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where = "deleted_at IS NULL AND (" + where + ")"
+
+	var total int
+
+	err = s.db.QueryRowContext(ctx, "SELECT count(*) FROM books WHERE "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if limit <= 0 || offset >= total {
+		return nil, total, nil
+	}
+
+	args = append(args, limit, offset)
+	query := fmt.Sprintf(`SELECT id, title, author, isbn, publication_year, copies_total, copies_available FROM books WHERE %s ORDER BY title, id LIMIT $%d OFFSET $%d`, where, len(args)-1, len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	var books []model.Book
+
+	for rows.Next() {
+		var b model.Book
+		if err := rows.Scan(&b.ID, &b.Title, &b.Author, &b.ISBN, &b.PublicationYear, &b.CopiesTotal, &b.CopiesAvailable); err != nil {
+			slog.ErrorContext(ctx, "skip unreadable row", "err", err)
+			continue
+		}
+
+		books = append(books, b)
+	}
+
+	return books, total, rows.Err()
+}
+
+func (s *Store) ScanBooks(ctx context.Context, field repository.BookField, from string, limit int) ([]repository.ScanTerm, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	column, ok := bookColumns[field]
+	if !ok {
+		return nil, fmt.Errorf("unsupported scan field %q", field)
+	}
+
+	var (
+		query string
+		arg   interface{} = from
+	)
+
+	if field == repository.BookFieldYear {
+		year, err := strconv.Atoi(from)
+		if err != nil && from != "" {
+			return nil, fmt.Errorf("invalid year %q", from)
+		}
+
+		arg = year
+		query = fmt.Sprintf(`SELECT %[1]s::text, count(*) FROM books WHERE deleted_at IS NULL AND %[1]s >= $1 GROUP BY %[1]s ORDER BY %[1]s LIMIT $2`, column)
+	} else {
+		query = fmt.Sprintf(`SELECT lower(%[1]s), count(*) FROM books WHERE deleted_at IS NULL AND lower(%[1]s) >= lower($1) GROUP BY lower(%[1]s) ORDER BY lower(%[1]s) LIMIT $2`, column)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, arg, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var terms []repository.ScanTerm
+
+	for rows.Next() {
+		var t repository.ScanTerm
+		if err := rows.Scan(&t.Value, &t.Count); err != nil {
+			slog.ErrorContext(ctx, "skip unreadable row", "err", err)
+			continue
+		}
+
+		terms = append(terms, t)
+	}
+
+	return terms, rows.Err()
+}
+
+// buildBookWhere translates q into a SQL boolean expression, appending the
+// bind parameters to args.
+func buildBookWhere(q *repository.BookQuery, args *[]interface{}) (string, error) {
+	if q == nil {
+		return "TRUE", nil
+	}
+
+	if !q.IsLeaf() {
+		left, err := buildBookWhere(q.Left, args)
+		if err != nil {
+			return "", err
+		}
+
+		right, err := buildBookWhere(q.Right, args)
+		if err != nil {
+			return "", err
+		}
+
+		switch q.Op {
+		case repository.BoolAnd:
+			return "(" + left + " AND " + right + ")", nil
+		case repository.BoolOr:
+			return "(" + left + " OR " + right + ")", nil
+		case repository.BoolNot:
+			return "(" + left + " AND NOT " + right + ")", nil
+		default:
+			return "", fmt.Errorf("unsupported boolean operator %q", q.Op)
+		}
+	}
+
+	if q.Field == repository.BookFieldAny {
+		var parts []string
+
+		for _, f := range []repository.BookField{repository.BookFieldTitle, repository.BookFieldAuthor, repository.BookFieldISBN} {
+			part, err := buildBookWhere(&repository.BookQuery{Field: f, Relation: q.Relation, Value: q.Value}, args)
+			if err != nil {
+				return "", err
+			}
+
+			parts = append(parts, part)
+		}
+
+		return "(" + strings.Join(parts, " OR ") + ")", nil
+	}
+
+	column, ok := bookColumns[q.Field]
+	if !ok {
+		return "", fmt.Errorf("unsupported field %q", q.Field)
+	}
+
+	if q.Field == repository.BookFieldYear {
+		return yearCondition(column, q, args)
+	}
+
+	switch q.Relation {
+	case repository.RelationContains:
+		*args = append(*args, likePattern(q.Value))
+		return fmt.Sprintf("%s ILIKE $%d", column, len(*args)), nil
+	case repository.RelationExact:
+		*args = append(*args, q.Value)
+		return fmt.Sprintf("lower(%s) = lower($%d)", column, len(*args)), nil
+	case repository.RelationLT, repository.RelationLTE, repository.RelationGT, repository.RelationGTE, repository.RelationNE:
+		*args = append(*args, q.Value)
+		return fmt.Sprintf("lower(%s) %s lower($%d)", column, q.Relation, len(*args)), nil
+	default:
+		return "", fmt.Errorf("unsupported relation %q", q.Relation)
+	}
+}
+
+func yearCondition(column string, q *repository.BookQuery, args *[]interface{}) (string, error) {
+	year, err := strconv.Atoi(strings.TrimSpace(q.Value))
+	if err != nil {
+		return "", fmt.Errorf("invalid year %q", q.Value)
+	}
+
+	op := string(q.Relation)
+	if q.Relation == repository.RelationContains || q.Relation == repository.RelationExact {
+		op = "="
+	}
+
+	*args = append(*args, year)
+
+	return fmt.Sprintf("%s %s $%d", column, op, len(*args)), nil
+}
+
+// likePattern turns a search term into an ILIKE pattern. Terms without
+// wildcards match anywhere in the column, terms with * or ? are anchored.
+func likePattern(v string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	v = r.Replace(v)
+
+	if !strings.ContainsAny(v, "*?") {
+		return "%" + v + "%"
+	}
+
+	return strings.NewReplacer("*", "%", "?", "_").Replace(v)
+}
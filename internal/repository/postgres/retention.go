@@ -0,0 +1,126 @@
+package postgres
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/tliefheid/go-ils/internal/model"
+)
+
+// cohortExpr names the anonymized cohort of a borrowing's member: the
+// membership category and an age band, e.g. adult/30-44.
+const cohortExpr = `m.category || '/' || CASE
+		WHEN m.date_of_birth IS NULL THEN 'unknown'
+		WHEN date_part('year', age(m.date_of_birth)) < 13 THEN '0-12'
+		WHEN date_part('year', age(m.date_of_birth)) < 18 THEN '13-17'
+		WHEN date_part('year', age(m.date_of_birth)) < 30 THEN '18-29'
+		WHEN date_part('year', age(m.date_of_birth)) < 45 THEN '30-44'
+		WHEN date_part('year', age(m.date_of_birth)) < 65 THEN '45-64'
+		ELSE '65+'
+	END`
+
+// expiredLoans is the condition for borrowings past the retention period
+// whose member has not opted in to keeping the history. Loans with an
+// unpaid fine stay linked until it is paid.
+const expiredLoans = `br.member_id = m.id AND br.return_date < $1 AND NOT m.keep_history
+	AND NOT EXISTS (SELECT true FROM fines uf WHERE uf.borrowing_id = br.id AND uf.paid_at IS NULL)`
+
+// expiredFines is the condition for the fines of expired loans.
+const expiredFines = `f.borrowing_id = br.id AND ` + expiredLoans
+
+// expiredHolds is the condition for holds closed before the retention period
+// whose member has not opted in to keeping the history.
+const expiredHolds = `h.member_id = m.id AND h.closed_at < $1 AND NOT m.keep_history`
+
+// anonymizedFineReason replaces the reason of retained fines, which names
+// the title.
+const anonymizedFineReason = "Late return"
+
+func (s *Store) AnonymizeLoanHistory(ctx context.Context, before time.Time, dryRun bool) (*model.RetentionReport, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	report := &model.RetentionReport{DryRun: dryRun, ReturnedBefore: before, Cohorts: map[string]int{}}
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+cohortExpr+`, count(*) FROM borrowings br, members m
+	WHERE `+expiredLoans+` GROUP BY 1 ORDER BY 1`, before)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var (
+			cohort string
+			n      int
+		)
+
+		if err := rows.Scan(&cohort, &n); err != nil {
+			slog.ErrorContext(ctx, "skip unreadable row", "err", err)
+			continue
+		}
+
+		report.Cohorts[cohort] = n
+		report.Loans += n
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(ctx, `SELECT count(*) FROM fines f, borrowings br, members m WHERE `+expiredFines, before).Scan(&report.Fines)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(ctx, `SELECT count(*) FROM holds h, members m WHERE `+expiredHolds, before).Scan(&report.Holds)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	err = redactAudit(ctx, tx, `entity = 'loan' AND entity_id IN (SELECT br.id::text FROM borrowings br, members m WHERE `+expiredLoans+`)
+	OR entity = 'fine' AND entity_id IN (SELECT f.id::text FROM fines f, borrowings br, members m WHERE `+expiredFines+`)
+	OR entity = 'hold' AND entity_id IN (SELECT h.id::text FROM holds h, members m WHERE `+expiredHolds+`)`, true, before)
+	if err != nil {
+		return nil, err
+	}
+
+	// fines first, they are found through the loans' members
+	_, err = tx.ExecContext(ctx, `UPDATE fines f SET member_id = NULL, reason = $2
+	FROM borrowings br, members m WHERE `+expiredFines, before, anonymizedFineReason)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM holds h USING members m WHERE `+expiredHolds, before)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE borrowings br SET cohort = `+cohortExpr+`, member_id = NULL
+	FROM members m WHERE `+expiredLoans, before)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
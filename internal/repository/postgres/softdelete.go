@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+// anonymizedName replaces the name of archived members.
+const anonymizedName = "Anonymized member"
+
+// deletedScanner scans a trailing deleted_at column after the columns of the
+// wrapped scan function.
+type deletedScanner struct {
+	rowScanner
+	deletedAt *time.Time
+}
+
+func (d deletedScanner) Scan(dest ...interface{}) error {
+	return d.rowScanner.Scan(append(dest, d.deletedAt)...)
+}
+
+// softDelete marks row id of table as deleted. It is refused with
+// ErrOpenLoans while a borrowing referencing the row through loanColumn is
+// not returned, and with ErrConflict when version is not 0 and the row is
+// at another version.
+func (s *Store) softDelete(ctx context.Context, table, loanColumn string, id, version int) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE `+table+` SET deleted_at=now() WHERE id=$1 AND deleted_at IS NULL AND ($2=0 OR version=$2)
+	AND NOT EXISTS (SELECT 1 FROM borrowings WHERE `+loanColumn+`=$1 AND return_date IS NULL)`, id, version)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	if err := s.checkVersion(ctx, table, id, version); err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+
+	var open int
+
+	err = s.db.QueryRowContext(ctx, "SELECT count(*) FROM borrowings WHERE "+loanColumn+"=$1 AND return_date IS NULL", id).Scan(&open)
+	if err != nil {
+		return err
+	}
+
+	if open > 0 {
+		return fmt.Errorf("%d open loans: %w", open, repository.ErrOpenLoans)
+	}
+
+	return repository.ErrNotFound
+}
+
+// checkVersion reports whether row id of table exists and, when version
+// is not 0, is at that version: ErrNotFound for a missing or deleted row
+// and ErrConflict when it moved on.
+func (s *Store) checkVersion(ctx context.Context, table string, id, version int) error {
+	var current int
+
+	err := s.db.QueryRowContext(ctx, "SELECT version FROM "+table+" WHERE id=$1 AND deleted_at IS NULL", id).Scan(&current)
+	if err == sql.ErrNoRows {
+		return repository.ErrNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if version != 0 && version != current {
+		return repository.ErrConflict
+	}
+
+	return nil
+}
+
+// restore clears the deleted mark of row id of table. Anonymized members
+// cannot be restored.
+func (s *Store) restore(ctx context.Context, table string, id int) error {
+	query := "UPDATE " + table + " SET deleted_at=NULL WHERE id=$1 AND deleted_at IS NOT NULL"
+	if table == "members" {
+		query += " AND anonymized_at IS NULL"
+	}
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return repository.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/tliefheid/go-ils/internal/model"
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+const staffColumns = `id, username, name, role, disabled, oidc_subject IS NOT NULL, created_at, last_login_at`
+
+func scanStaffUser(row rowScanner) (*model.StaffUser, error) {
+	var (
+		u         model.StaffUser
+		lastLogin sql.NullTime
+	)
+
+	err := row.Scan(&u.ID, &u.Username, &u.Name, &u.Role, &u.Disabled, &u.SSO, &u.CreatedAt, &lastLogin)
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if lastLogin.Valid {
+		u.LastLoginAt = &lastLogin.Time
+	}
+
+	return &u, nil
+}
+
+func (s *Store) AddStaffUser(ctx context.Context, u model.StaffUser, passwordHash string) (*model.StaffUser, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	created, err := scanStaffUser(s.db.QueryRowContext(ctx, `INSERT INTO staff_users (username, name, role, password_hash, disabled, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (username) DO NOTHING RETURNING `+staffColumns,
+		u.Username, u.Name, u.Role, passwordHash, u.Disabled, time.Now()))
+	if err == repository.ErrNotFound {
+		return nil, repository.ErrDuplicate
+	}
+
+	return created, err
+}
+
+func (s *Store) GetStaffUser(ctx context.Context, id int) (*model.StaffUser, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return scanStaffUser(s.db.QueryRowContext(ctx, "SELECT "+staffColumns+" FROM staff_users WHERE id=$1", id))
+}
+
+func (s *Store) GetStaffLogin(ctx context.Context, username string) (*model.StaffUser, string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var hash string
+
+	u, err := scanStaffUser(s.db.QueryRowContext(ctx, "SELECT "+staffColumns+" FROM staff_users WHERE username=$1 AND NOT disabled", username))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := s.db.QueryRowContext(ctx, "SELECT password_hash FROM staff_users WHERE id=$1", u.ID).Scan(&hash); err != nil {
+		return nil, "", err
+	}
+
+	return u, hash, nil
+}
+
+func (s *Store) ListStaffUsers(ctx context.Context) ([]model.StaffUser, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+staffColumns+" FROM staff_users ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var users []model.StaffUser
+
+	for rows.Next() {
+		u, err := scanStaffUser(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, *u)
+	}
+
+	return users, rows.Err()
+}
+
+func (s *Store) CountStaffUsers(ctx context.Context) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var n int
+
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM staff_users").Scan(&n)
+
+	return n, err
+}
+
+func (s *Store) UpdateStaffUser(ctx context.Context, u model.StaffUser) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, "UPDATE staff_users SET name=$1, role=$2, disabled=$3 WHERE id=$4", u.Name, u.Role, u.Disabled, u.ID)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return repository.ErrNotFound
+	}
+
+	if !u.Disabled {
+		return nil
+	}
+
+	_, err = s.db.ExecContext(ctx, "DELETE FROM staff_sessions WHERE user_id=$1", u.ID)
+
+	return err
+}
+
+func (s *Store) SetStaffPassword(ctx context.Context, id int, passwordHash string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, "UPDATE staff_users SET password_hash=$1 WHERE id=$2", passwordHash, id)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return repository.ErrNotFound
+	}
+
+	_, err = s.db.ExecContext(ctx, "DELETE FROM staff_sessions WHERE user_id=$1", id)
+
+	return err
+}
+
+func (s *Store) AddStaffSession(ctx context.Context, tokenHash string, userID int, expires time.Time) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now()
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO staff_sessions (token_hash, user_id, created_at, expires_at) VALUES ($1, $2, $3, $4)`,
+		tokenHash, userID, now, expires)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, "UPDATE staff_users SET last_login_at=$1 WHERE id=$2", now, userID)
+
+	return err
+}
+
+func (s *Store) GetStaffSession(ctx context.Context, tokenHash string) (*model.StaffUser, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return scanStaffUser(s.db.QueryRowContext(ctx, `SELECT u.id, u.username, u.name, u.role, u.disabled, u.oidc_subject IS NOT NULL, u.created_at, u.last_login_at
+	FROM staff_sessions ss
+	JOIN staff_users u ON u.id = ss.user_id
+	WHERE ss.token_hash=$1 AND ss.expires_at > now() AND NOT u.disabled`, tokenHash))
+}
+
+func (s *Store) DeleteStaffSession(ctx context.Context, tokenHash string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "DELETE FROM staff_sessions WHERE token_hash=$1 OR expires_at < now()", tokenHash)
+
+	return err
+}
+
+func (s *Store) AddOIDCNonce(ctx context.Context, nonceHash string, expires time.Time) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM oidc_nonces WHERE expires_at < now()"); err != nil {
+		return err
+	}
+
+	_, err := s.db.ExecContext(ctx, "INSERT INTO oidc_nonces (nonce_hash, expires_at) VALUES ($1, $2)", nonceHash, expires)
+
+	return err
+}
+
+func (s *Store) ConsumeOIDCNonce(ctx context.Context, nonceHash string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM oidc_nonces WHERE nonce_hash=$1 AND expires_at > now()", nonceHash)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return repository.ErrNotFound
+	}
+
+	return nil
+}
+
+// ProvisionStaffUser keeps a disabled user disabled, and leaves the
+// username alone once created.
+func (s *Store) ProvisionStaffUser(ctx context.Context, u model.StaffUser, subject string) (*model.StaffUser, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	user, err := scanStaffUser(s.db.QueryRowContext(ctx, `INSERT INTO staff_users (username, name, role, password_hash, disabled, created_at, oidc_subject)
+	VALUES ($1, $2, $3, '', false, $4, $5)
+	ON CONFLICT (oidc_subject) DO UPDATE SET name=EXCLUDED.name, role=EXCLUDED.role
+	RETURNING `+staffColumns, u.Username, u.Name, u.Role, time.Now(), subject))
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return nil, repository.ErrDuplicate
+	}
+
+	return user, err
+}
@@ -1,40 +1,135 @@
 package postgres
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
-	"os"
+	_ "embed"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
 
+	"github.com/XSAM/otelsql"
 	"github.com/tliefheid/go-ils/internal/repository"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
 )
 
 type Store struct {
 	db *sql.DB
+	// queryTimeout bounds every store call on top of the caller's
+	// deadline, zero for none.
+	queryTimeout time.Duration
+	// migrated is the checksum of the migration script run, nil before
+	// Migrate.
+	migrated atomic.Pointer[string]
 }
 
-func NewStore(dsn string) (repository.Store, error) {
-	db, err := sql.Open("postgres", dsn)
+// migrations is the schema script, idempotent so it runs on every start.
+//
+//go:embed migrations.sql
+var migrations string
+
+// Config holds the connection and pool settings of the store.
+type Config struct {
+	DSN string
+	// QueryTimeout cancels every store call after it, zero leaves it to
+	// the caller's context.
+	QueryTimeout time.Duration
+	// MaxOpenConns and MaxIdleConns size the connection pool, zero for no
+	// limit and the database/sql default.
+	MaxOpenConns int
+	MaxIdleConns int
+	// ConnMaxLifetime and ConnMaxIdleTime close connections used or idle
+	// that long, zero for never.
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// NewStore connects to the database of cfg. Every query is traced as a span
+// of the caller's trace.
+func NewStore(ctx context.Context, cfg Config) (repository.Store, error) {
+	db, err := otelsql.Open("postgres", cfg.DSN, otelsql.WithAttributes(semconv.DBSystemNamePostgreSQL))
 	if err != nil {
 		return nil, err
 	}
 
-	if err := db.Ping(); err != nil {
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
 		return nil, err
 	}
 
-	return &Store{db: db}, nil
+	return &Store{db: db, queryTimeout: cfg.QueryTimeout}, nil
+}
+
+func (s *Store) Stats() sql.DBStats {
+	return s.db.Stats()
 }
 
 func (s *Store) Close() error {
 	return s.db.Close()
 }
 
-func (s *Store) Migrate(fn string) error {
-	data, err := os.ReadFile(fn)
+// withTimeout applies the query timeout to ctx.
+func (s *Store) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, s.queryTimeout)
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.db.PingContext(ctx)
+}
+
+// Migrate runs the schema script and records its checksum. It is not bound
+// by the query timeout, migrations may take longer than any request.
+func (s *Store) Migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, migrations); err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256([]byte(migrations))
+	checksum := hex.EncodeToString(sum[:])
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO schema_migrations (checksum) VALUES ($1) ON CONFLICT DO NOTHING`, checksum)
 	if err != nil {
 		return err
 	}
 
-	_, err = s.db.Exec(string(data))
+	s.migrated.Store(&checksum)
+
+	return nil
+}
+
+// MigrationsApplied looks the checksum of the script Migrate ran up in the
+// database, which is missing when the database was replaced or restored
+// from before the migration.
+func (s *Store) MigrationsApplied(ctx context.Context) (bool, error) {
+	checksum := s.migrated.Load()
+	if checksum == nil {
+		return false, nil
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var applied bool
+
+	err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE checksum = $1)`, *checksum).Scan(&applied)
+	if err != nil {
+		return false, err
+	}
 
-	return err
+	return applied, nil
 }
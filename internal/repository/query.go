@@ -0,0 +1,58 @@
+package repository
+
+// BookField identifies a searchable book attribute.
+type BookField string
+
+const (
+	BookFieldAny    BookField = "any"
+	BookFieldTitle  BookField = "title"
+	BookFieldAuthor BookField = "author"
+	BookFieldISBN   BookField = "isbn"
+	BookFieldYear   BookField = "year"
+)
+
+// Relation is the comparison applied between a field and a value.
+type Relation string
+
+const (
+	RelationContains Relation = "contains" // substring match, * and ? are wildcards
+	RelationExact    Relation = "exact"    // case-insensitive equality
+	RelationLT       Relation = "<"
+	RelationLTE      Relation = "<="
+	RelationGT       Relation = ">"
+	RelationGTE      Relation = ">="
+	RelationNE       Relation = "<>"
+)
+
+// BoolOp combines two sub queries.
+type BoolOp string
+
+const (
+	BoolAnd BoolOp = "and"
+	BoolOr  BoolOp = "or"
+	BoolNot BoolOp = "not" // left AND NOT right
+)
+
+// BookQuery is a boolean search tree over books. A node is either a leaf
+// (Field, Relation, Value) or a boolean node (Op, Left, Right).
+type BookQuery struct {
+	Field    BookField
+	Relation Relation
+	Value    string
+
+	Op    BoolOp
+	Left  *BookQuery
+	Right *BookQuery
+}
+
+// IsLeaf reports whether q is a single field condition.
+func (q *BookQuery) IsLeaf() bool {
+	return q.Op == ""
+}
+
+// ScanTerm is a single entry of an index browse, with the number of books
+// carrying that term.
+type ScanTerm struct {
+	Value string
+	Count int
+}
@@ -1,48 +1,252 @@
 package repository
 
 import (
+	"context"
+	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/tliefheid/go-ils/internal/model"
 )
 
 var (
 	ErrNotFound = errors.New("not found")
+	// ErrUnavailable is returned when a book has no copy left to lend.
+	ErrUnavailable = errors.New("no copies available")
+	// ErrLoanLimit is returned when a member already has as many open
+	// borrowings as allowed.
+	ErrLoanLimit = errors.New("loan limit reached")
+	// ErrOpenLoans is returned when a book or member with borrowings that
+	// are not returned is deleted.
+	ErrOpenLoans = errors.New("open loans exist")
+	// ErrUnpaidFines is returned when a member with unpaid fines is erased.
+	ErrUnpaidFines = errors.New("unpaid fines exist")
+	// ErrDuplicate is returned when a unique name is already taken.
+	ErrDuplicate = errors.New("already exists")
+	// ErrConflict is returned when a record changed since the version a
+	// change was based on.
+	ErrConflict = errors.New("changed concurrently")
 )
 
 type Store interface {
 	BookStore
 	MemberStore
 	BorrowingStore
+	CardStore
+	CategoryStore
+	BlockStore
+	PatronStore
+	HoldStore
+	FineStore
+	StaffStore
+	APIKeyStore
+	AuditStore
 
-	Migrate(fn string) error
+	// Migrate brings the database schema up to date.
+	Migrate(ctx context.Context) error
+	// MigrationsApplied reports whether the database holds the migrations
+	// this store ran, false before Migrate.
+	MigrationsApplied(ctx context.Context) (bool, error)
+	// Ping checks the database can be reached.
+	Ping(ctx context.Context) error
+	// Stats returns the statistics of the database connection pool.
+	Stats() sql.DBStats
 	Close() error
 }
 
 type BookStore interface {
-	ListBooks() ([]model.Book, error)
-	SearchBookByISBN(isbn string) (*model.Book, error)
-	SearchBooks(search string) ([]model.Book, error)
-	AddBook(book model.Book) error
-	GetBook(id int) (*model.Book, error)
-	UpdateBook(book model.Book) error
-	DeleteBook(id int) error
+	ListBooks(ctx context.Context) ([]model.Book, error)
+	SearchBookByISBN(ctx context.Context, isbn string) (*model.Book, error)
+	SearchBooks(ctx context.Context, search string) ([]model.Book, error)
+	// QueryBooks returns one page of books matching q together with the
+	// total number of matches.
+	QueryBooks(ctx context.Context, q *BookQuery, offset, limit int) ([]model.Book, int, error)
+	// ScanBooks browses the distinct values of field starting at from.
+	ScanBooks(ctx context.Context, field BookField, from string, limit int) ([]ScanTerm, error)
+	// AddBook returns the ID of the new book.
+	AddBook(ctx context.Context, book model.Book) (int, error)
+	GetBook(ctx context.Context, id int) (*model.Book, error)
+	// UpdateBook saves the catalogue fields of a book; the available copies
+	// follow the change of the total. With a Version the book must still be
+	// at that version, or ErrConflict.
+	UpdateBook(ctx context.Context, book model.Book) error
+	// DeleteBook soft deletes a book, refused with ErrOpenLoans while
+	// copies are lent out and with ErrConflict when version is not 0 and
+	// the book moved on.
+	DeleteBook(ctx context.Context, id, version int) error
+	RestoreBook(ctx context.Context, id int) error
+	ListDeletedBooks(ctx context.Context) ([]model.Book, error)
 }
 type MemberStore interface {
-	ListMemberss() ([]model.Member, error)
-	SearchMembers(search string) ([]model.Member, error)
-	AddMember(member model.Member) error
-	GetMember(id int) (*model.Member, error)
-	UpdateMember(member model.Member) error
-	DeleteMember(id int) error
+	ListMemberss(ctx context.Context) ([]model.Member, error)
+	SearchMembers(ctx context.Context, search string) ([]model.Member, error)
+	// AddMember returns the ID of the new member.
+	AddMember(ctx context.Context, member model.Member) (int, error)
+	GetMember(ctx context.Context, id int) (*model.Member, error)
+	// UpdateMember saves the profile of a member, leaving the membership
+	// expiry to RenewMembership. With a Version the member must still be at
+	// that version, or ErrConflict.
+	UpdateMember(ctx context.Context, member model.Member) error
+	// DeleteMember soft deletes a member, refused with ErrOpenLoans while
+	// the member has borrowings that are not returned and with ErrConflict
+	// when version is not 0 and the member moved on.
+	DeleteMember(ctx context.Context, id, version int) error
+	RestoreMember(ctx context.Context, id int) error
+	// ListDeletedMembers lists deleted members that are not anonymized yet.
+	ListDeletedMembers(ctx context.Context) ([]model.Member, error)
+	// AnonymizeDeletedMembers strips the personal data of members deleted
+	// before the given time, keeping their borrowings for statistics.
+	AnonymizeDeletedMembers(ctx context.Context, before time.Time) (int, error)
+	// EraseMember anonymizes a member and their loan history for an
+	// erasure request and records it, refused with ErrOpenLoans while the
+	// member has borrowings that are not returned.
+	EraseMember(ctx context.Context, id int, requestedBy, reason string) (*model.ErasureRecord, error)
+	ListErasures(ctx context.Context) ([]model.ErasureRecord, error)
+	// RenewMembership sets the date through which the membership is valid.
+	RenewMembership(ctx context.Context, id int, expires time.Time) error
 	// ListMembers lists all members in the store.
 }
 
 type BorrowingStore interface {
-	ListBorrowings() ([]model.BorrowingDetail, error)
-	AddBorrowing(borrowing model.Borrowing) error
-	GetBorrowing(id int) (*model.BorrowingDetail, error)
-	ReturnBorrowing(id int) error
+	ListBorrowings(ctx context.Context) ([]model.BorrowingDetail, error)
+	// AddBorrowing lends a copy of the book and returns the ID of the new
+	// borrowing. It fails with ErrUnavailable when no copy is left and with
+	// ErrLoanLimit when the member already has maxLoans open borrowings.
+	AddBorrowing(ctx context.Context, borrowing model.Borrowing, maxLoans int) (int, error)
+	GetBorrowing(ctx context.Context, id int) (*model.BorrowingDetail, error)
+	// ListMemberBorrowings lists the open borrowings of a member.
+	ListMemberBorrowings(ctx context.Context, memberID int) ([]model.BorrowingDetail, error)
+	// ListMemberLoanHistory lists all borrowings of a member, returned ones
+	// included, that are not anonymized.
+	ListMemberLoanHistory(ctx context.Context, memberID int) ([]model.BorrowingDetail, error)
+	// FindOpenBorrowing returns the oldest open borrowing of a book.
+	FindOpenBorrowing(ctx context.Context, bookID int) (*model.BorrowingDetail, error)
+	// ReturnBorrowing closes an open borrowing and puts the copy back,
+	// ErrConflict when it was returned already.
+	ReturnBorrowing(ctx context.Context, id int) error
+	// RenewBorrowing closes an open borrowing and opens renewal for the
+	// same book in one transaction, returning the ID of the renewal.
+	RenewBorrowing(ctx context.Context, id int, renewal model.Borrowing) (int, error)
+	// CountOpenBorrowings counts the borrowings that are not returned, and
+	// of those the ones due before now.
+	CountOpenBorrowings(ctx context.Context, now time.Time) (open, overdue int, err error)
 	// UpdateBorrowing(borrowing model.Borrowing) error
-	DeleteBorrowing(id int) error
+	// AnonymizeLoanHistory replaces the member of borrowings returned before
+	// the given time by a cohort, unless the member keeps the history or a
+	// fine of the loan is unpaid. Their fines lose the member and the title,
+	// holds closed before then are deleted and the audit entries of all
+	// three are redacted. A dry run only reports what would change.
+	AnonymizeLoanHistory(ctx context.Context, before time.Time, dryRun bool) (*model.RetentionReport, error)
+}
+
+type CardStore interface {
+	// NextCardSequence returns a new unique sequence number for card numbers.
+	NextCardSequence(ctx context.Context) (int64, error)
+	AddCard(ctx context.Context, card model.Card) (*model.Card, error)
+	ListMemberCards(ctx context.Context, memberID int) ([]model.Card, error)
+	GetCardByNumber(ctx context.Context, number string) (*model.Card, error)
+	// ReplaceCard retires card id with the given status and issues the
+	// replacement in one transaction.
+	ReplaceCard(ctx context.Context, id int, status model.CardStatus, replacement model.Card) (*model.Card, error)
+}
+
+type CategoryStore interface {
+	ListCategories(ctx context.Context) ([]model.MembershipCategory, error)
+	GetCategory(ctx context.Context, code string) (*model.MembershipCategory, error)
+	UpdateCategory(ctx context.Context, category model.MembershipCategory) error
+}
+
+type BlockStore interface {
+	AddBlock(ctx context.Context, block model.MemberBlock) (*model.MemberBlock, error)
+	// ListMemberBlocks lists all blocks of a member, lifted ones included,
+	// newest first.
+	ListMemberBlocks(ctx context.Context, memberID int) ([]model.MemberBlock, error)
+	GetBlock(ctx context.Context, id int) (*model.MemberBlock, error)
+	// LiftBlock lifts an active block, by is the staff user lifting it.
+	LiftBlock(ctx context.Context, id int, by string) error
+}
+
+type PatronStore interface {
+	// SetMemberPIN stores the hashed patron portal PIN and ends the
+	// member's open sessions.
+	SetMemberPIN(ctx context.Context, memberID int, hash string) error
+	// GetMemberPIN returns the PIN hash, ErrNotFound when none is set.
+	GetMemberPIN(ctx context.Context, memberID int) (string, error)
+	AddPatronSession(ctx context.Context, tokenHash string, memberID int, expires time.Time) error
+	// GetPatronSession returns the member of a session that has not expired.
+	GetPatronSession(ctx context.Context, tokenHash string) (int, error)
+	DeletePatronSession(ctx context.Context, tokenHash string) error
+}
+
+type HoldStore interface {
+	AddHold(ctx context.Context, hold model.Hold) (*model.Hold, error)
+	GetHold(ctx context.Context, id int) (*model.Hold, error)
+	ListMemberHolds(ctx context.Context, memberID int) ([]model.Hold, error)
+	// CountWaitingHolds counts the waiting holds on a book by other members.
+	CountWaitingHolds(ctx context.Context, bookID, exceptMemberID int) (int, error)
+	// CloseHold ends a waiting hold with the given status.
+	CloseHold(ctx context.Context, id int, status model.HoldStatus) error
+	// FulfillHold closes the member's waiting hold on a book they borrowed.
+	FulfillHold(ctx context.Context, memberID, bookID int) error
+}
+
+type FineStore interface {
+	// AddFine returns the ID of the new fine.
+	AddFine(ctx context.Context, fine model.Fine) (int, error)
+	GetFine(ctx context.Context, id int) (*model.Fine, error)
+	ListMemberFines(ctx context.Context, memberID int) ([]model.Fine, error)
+	PayFine(ctx context.Context, id int) error
+}
+
+type StaffStore interface {
+	// AddStaffUser creates a staff user, ErrDuplicate when the username is
+	// taken.
+	AddStaffUser(ctx context.Context, u model.StaffUser, passwordHash string) (*model.StaffUser, error)
+	GetStaffUser(ctx context.Context, id int) (*model.StaffUser, error)
+	// GetStaffLogin returns an enabled staff user and their password hash.
+	GetStaffLogin(ctx context.Context, username string) (*model.StaffUser, string, error)
+	ListStaffUsers(ctx context.Context) ([]model.StaffUser, error)
+	CountStaffUsers(ctx context.Context) (int, error)
+	// UpdateStaffUser changes name, role and disabled; disabling a user ends
+	// their sessions.
+	UpdateStaffUser(ctx context.Context, u model.StaffUser) error
+	// SetStaffPassword stores a new password hash and ends the user's
+	// sessions.
+	SetStaffPassword(ctx context.Context, id int, passwordHash string) error
+	// AddStaffSession opens a session and records the login.
+	AddStaffSession(ctx context.Context, tokenHash string, userID int, expires time.Time) error
+	// GetStaffSession returns the enabled user of a session that has not
+	// expired.
+	GetStaffSession(ctx context.Context, tokenHash string) (*model.StaffUser, error)
+	DeleteStaffSession(ctx context.Context, tokenHash string) error
+	// ProvisionStaffUser creates the staff user signed in by an OpenID
+	// subject, or updates their name and role on later logins.
+	// ErrDuplicate when a new user's username is taken.
+	ProvisionStaffUser(ctx context.Context, u model.StaffUser, subject string) (*model.StaffUser, error)
+	// AddOIDCNonce stores the nonce of a single sign-on until it expires.
+	AddOIDCNonce(ctx context.Context, nonceHash string, expires time.Time) error
+	// ConsumeOIDCNonce deletes a nonce that has not expired, ErrNotFound
+	// when there is none, so each nonce logs in once.
+	ConsumeOIDCNonce(ctx context.Context, nonceHash string) error
+}
+
+type APIKeyStore interface {
+	AddAPIKey(ctx context.Context, k model.APIKey, keyHash string) (*model.APIKey, error)
+	GetAPIKey(ctx context.Context, id int) (*model.APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]model.APIKey, error)
+	// UseAPIKey returns the active key with the hash and records its use.
+	UseAPIKey(ctx context.Context, keyHash string) (*model.APIKey, error)
+	// RevokeAPIKey revokes an active key, ErrNotFound when there is none.
+	RevokeAPIKey(ctx context.Context, id int) error
+	// RotateAPIKey replaces the secret of an active key.
+	RotateAPIKey(ctx context.Context, id int, prefix, keyHash string) (*model.APIKey, error)
+}
+
+type AuditStore interface {
+	// AddAuditEntry appends to the audit log; entries cannot be changed
+	// afterwards, only redacted when the member is anonymized.
+	AddAuditEntry(ctx context.Context, e model.AuditEntry) error
+	// ListAuditEntries returns one page of the entries matching f, newest
+	// first, together with the total number of matches.
+	ListAuditEntries(ctx context.Context, f AuditFilter, offset, limit int) ([]model.AuditEntry, int, error)
 }
@@ -0,0 +1,246 @@
+// Package server runs the HTTP server of a service and shuts it down
+// gracefully: readiness fails first so load balancers move traffic away,
+// in-flight requests finish, background workers stop and the shutdown
+// hooks close what the service opened. With a certificate it serves TLS,
+// reloading the certificate when its files change.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Defaults of the timeouts left zero in Config.
+const (
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultIdleTimeout       = 2 * time.Minute
+	DefaultShutdownTimeout   = 15 * time.Second
+	DefaultTLSReload         = time.Minute
+)
+
+// Config holds the settings of a server.
+type Config struct {
+	Addr string
+	// ReadHeaderTimeout, ReadTimeout, WriteTimeout and IdleTimeout are
+	// those of http.Server. ReadHeaderTimeout and IdleTimeout use the
+	// defaults above when zero, the others are unlimited.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// DrainDelay is how long the server keeps serving after the drain
+	// hooks ran, so load balancers notice the failing readiness.
+	DrainDelay time.Duration
+	// ShutdownTimeout bounds the wait for in-flight requests, background
+	// workers and shutdown hooks, DefaultShutdownTimeout when zero.
+	ShutdownTimeout time.Duration
+	// TLSCertFile and TLSKeyFile serve HTTPS when set. The files are
+	// checked for changes every TLSReload, DefaultTLSReload when zero.
+	TLSCertFile string
+	TLSKeyFile  string
+	TLSReload   time.Duration
+}
+
+// Runner runs a server with its background workers.
+type Runner struct {
+	cfg  Config
+	srv  *http.Server
+	cert *certificate
+
+	drain    []func()
+	workers  []func(context.Context)
+	shutdown []func(context.Context) error
+}
+
+// New returns a runner for cfg, loading the TLS certificate when set.
+func New(cfg Config) (*Runner, error) {
+	if cfg.ReadHeaderTimeout == 0 {
+		cfg.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	}
+
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = DefaultIdleTimeout
+	}
+
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = DefaultShutdownTimeout
+	}
+
+	if cfg.TLSReload == 0 {
+		cfg.TLSReload = DefaultTLSReload
+	}
+
+	r := &Runner{cfg: cfg}
+	r.srv = &http.Server{
+		Addr:              cfg.Addr,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		cert, err := loadCertificate(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		r.cert = cert
+		r.srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: cert.get}
+	}
+
+	return r, nil
+}
+
+// OnDrain registers fn to run as soon as shutdown starts, such as failing
+// the readiness probe.
+func (r *Runner) OnDrain(fn func()) {
+	r.drain = append(r.drain, fn)
+}
+
+// Go runs fn in the background while the server runs. Its context is
+// cancelled once the server stopped taking requests, and shutdown waits for
+// fn to return.
+func (r *Runner) Go(fn func(ctx context.Context)) {
+	r.workers = append(r.workers, fn)
+}
+
+// OnShutdown registers fn to run after the server and the workers stopped,
+// such as closing the database. Hooks run in the reverse order of
+// registration, like deferred calls.
+func (r *Runner) OnShutdown(fn func(ctx context.Context) error) {
+	r.shutdown = append(r.shutdown, fn)
+}
+
+// Run serves h until ctx is done or the server fails, then shuts down
+// gracefully. The shutdown hooks run either way; the error is the one that
+// stopped the server, nil after ctx was done.
+func (r *Runner) Run(ctx context.Context, h http.Handler) error {
+	r.srv.Handler = h
+
+	l, err := net.Listen("tcp", r.cfg.Addr)
+	if err != nil {
+		r.runShutdownHooks(context.Background())
+		return err
+	}
+
+	workCtx, stopWork := context.WithCancel(context.Background())
+	defer stopWork()
+
+	var workers sync.WaitGroup
+
+	for _, fn := range r.workers {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			fn(workCtx)
+		}()
+	}
+
+	if r.cert != nil {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			r.cert.watch(workCtx, r.cfg.TLSReload)
+		}()
+	}
+
+	serveErr := make(chan error, 1)
+
+	go func() {
+		slog.Info("starting server", "addr", l.Addr().String(), "tls", r.cert != nil)
+
+		if r.cert != nil {
+			// the certificate comes from TLSConfig, and ServeTLS sets up
+			// HTTP/2
+			serveErr <- r.srv.ServeTLS(l, "", "")
+			return
+		}
+
+		serveErr <- r.srv.Serve(l)
+	}()
+
+	select {
+	case <-ctx.Done():
+		err = nil
+
+		for _, fn := range r.drain {
+			fn()
+		}
+
+		if r.cfg.DrainDelay > 0 {
+			slog.Info("draining", "delay", r.cfg.DrainDelay)
+			time.Sleep(r.cfg.DrainDelay)
+		}
+	case err = <-serveErr:
+	}
+
+	slog.Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), r.cfg.ShutdownTimeout)
+	defer cancel()
+
+	r.srv.SetKeepAlivesEnabled(false)
+
+	if err := r.srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("shutting down server failed", "err", err)
+	}
+
+	stopWork()
+
+	done := make(chan struct{})
+
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		slog.Error("background workers did not stop in time", "err", shutdownCtx.Err())
+	}
+
+	r.runShutdownHooks(shutdownCtx)
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// ShutdownTimeout is the bound of a graceful shutdown, for servers the
+// workers run next to this one.
+func (r *Runner) ShutdownTimeout() time.Duration {
+	return r.cfg.ShutdownTimeout
+}
+
+// Close runs the shutdown hooks of a runner that does not run, because
+// setting up the service failed after registering them.
+func (r *Runner) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.ShutdownTimeout)
+	defer cancel()
+
+	r.runShutdownHooks(ctx)
+}
+
+// runShutdownHooks runs the hooks last registered first.
+func (r *Runner) runShutdownHooks(ctx context.Context) {
+	for i := len(r.shutdown) - 1; i >= 0; i-- {
+		if err := r.shutdown[i](ctx); err != nil {
+			slog.Error("shutdown hook failed", "err", err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// certificate is a TLS certificate reloaded when its files change, so a
+// renewed certificate is served without a restart.
+type certificate struct {
+	certFile, keyFile string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func loadCertificate(certFile, keyFile string) (*certificate, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("TLS needs both a certificate and a key file")
+	}
+
+	c := &certificate{certFile: certFile, keyFile: keyFile}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// load reads the key pair, keeping the one served so far when it fails.
+func (c *certificate) load() error {
+	modTime, err := c.lastModified()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS certificate: %w", err)
+	}
+
+	c.mu.Lock()
+	c.cert, c.modTime = &cert, modTime
+	c.mu.Unlock()
+
+	return nil
+}
+
+// lastModified is the latest change to the certificate or the key file.
+func (c *certificate) lastModified() (time.Time, error) {
+	var latest time.Time
+
+	for _, fn := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(fn)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+func (c *certificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cert, nil
+}
+
+// watch reloads the certificate every interval its files changed, until
+// ctx is done.
+func (c *certificate) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		modTime, err := c.lastModified()
+		if err != nil {
+			slog.Error("checking TLS certificate failed", "err", err)
+			continue
+		}
+
+		c.mu.RLock()
+		changed := modTime.After(c.modTime)
+		c.mu.RUnlock()
+
+		if !changed {
+			continue
+		}
+
+		if err := c.load(); err != nil {
+			slog.Error("reloading TLS certificate failed", "err", err)
+			continue
+		}
+
+		slog.Info("reloaded TLS certificate", "file", c.certFile)
+	}
+}
@@ -0,0 +1,61 @@
+package sip2
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Client is a minimal SIP2 self check client, used for scripting and
+// checking a running server.
+type Client struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	seq     int
+	timeout time.Duration
+}
+
+// Dial connects to a SIP2 server.
+func Dial(addr string, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{conn: conn, r: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Send writes req with the next sequence number and waits for the response.
+// The response checksum and sequence number are verified.
+func (c *Client) Send(req *Message) (*Message, error) {
+	seq := c.seq
+	c.seq = (c.seq + 1) % 10
+
+	_ = c.conn.SetDeadline(time.Now().Add(c.timeout))
+
+	if _, err := c.conn.Write([]byte(req.Encode(seq) + string(messageTerminator))); err != nil {
+		return nil, err
+	}
+
+	line, err := c.r.ReadString(messageTerminator)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := Parse(line)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Code != CodeSCResend && resp.Sequence != seq {
+		return resp, fmt.Errorf("sequence mismatch: sent %d, got %d", seq, resp.Sequence)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,245 @@
+package sip2
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message codes sent by the self check (SC) and the automated circulation
+// system (ACS).
+const (
+	CodePatronStatus      = "23"
+	CodePatronStatusResp  = "24"
+	CodeCheckin           = "09"
+	CodeCheckinResp       = "10"
+	CodeCheckout          = "11"
+	CodeCheckoutResp      = "12"
+	CodeItemInfo          = "17"
+	CodeItemInfoResp      = "18"
+	CodeRenew             = "29"
+	CodeRenewResp         = "30"
+	CodeEndSession        = "35"
+	CodeEndSessionResp    = "36"
+	CodePatronInfo        = "63"
+	CodePatronInfoResp    = "64"
+	CodeLogin             = "93"
+	CodeLoginResp         = "94"
+	CodeSCResend          = "96"
+	CodeACSResend         = "97"
+	CodeACSStatus         = "98"
+	CodeSCStatus          = "99"
+	messageTerminator     = '\r'
+	timestampLayout       = "20060102    150405"
+	errorDetectionPattern = `AY(\d)AZ([0-9A-Fa-f]{4})$`
+)
+
+// Variable length field identifiers used by this server.
+const (
+	FieldPatronID          = "AA"
+	FieldItemID            = "AB"
+	FieldTerminalPassword  = "AC"
+	FieldPatronPassword    = "AD"
+	FieldPersonalName      = "AE"
+	FieldScreenMessage     = "AF"
+	FieldDueDate           = "AH"
+	FieldTitle             = "AJ"
+	FieldLibraryName       = "AM"
+	FieldTerminalLocation  = "AN"
+	FieldInstitutionID     = "AO"
+	FieldCurrentLocation   = "AP"
+	FieldPermanentLocation = "AQ"
+	FieldChargedItems      = "AU"
+	FieldValidPatron       = "BL"
+	FieldSupportedMessages = "BX"
+	FieldLoginUserID       = "CN"
+	FieldLoginPassword     = "CO"
+	FieldLocationCode      = "CP"
+	FieldValidPatronPwd    = "CQ"
+)
+
+// fixedLengths is the size of the fixed part of each message.
+var fixedLengths = map[string]int{
+	CodeLogin:            2,
+	CodeLoginResp:        1,
+	CodeSCStatus:         8,
+	CodeACSStatus:        34,
+	CodePatronStatus:     21,
+	CodePatronStatusResp: 35,
+	CodePatronInfo:       31,
+	CodePatronInfoResp:   59,
+	CodeItemInfo:         18,
+	CodeItemInfoResp:     24,
+	CodeCheckout:         38,
+	CodeCheckoutResp:     22,
+	CodeCheckin:          37,
+	CodeCheckinResp:      22,
+	CodeRenew:            38,
+	CodeRenewResp:        22,
+	CodeEndSession:       18,
+	CodeEndSessionResp:   19,
+	CodeACSResend:        0,
+	CodeSCResend:         0,
+}
+
+var errorDetection = regexp.MustCompile(errorDetectionPattern)
+
+// Field is a variable length message field.
+type Field struct {
+	ID    string
+	Value string
+}
+
+// Message is a single SIP2 message.
+type Message struct {
+	Code   string
+	Fixed  string
+	Fields []Field
+
+	// Sequence is the AY sequence number, or -1 when the message carries no
+	// error detection.
+	Sequence int
+}
+
+// NewMessage creates a message with the given code and fixed part.
+func NewMessage(code string, fixed ...string) *Message {
+	return &Message{Code: code, Fixed: strings.Join(fixed, ""), Sequence: -1}
+}
+
+// Add appends a variable field and returns m for chaining.
+func (m *Message) Add(id, value string) *Message {
+	m.Fields = append(m.Fields, Field{ID: id, Value: value})
+	return m
+}
+
+// Get returns the first field with the given identifier.
+func (m *Message) Get(id string) string {
+	for _, f := range m.Fields {
+		if f.ID == id {
+			return f.Value
+		}
+	}
+
+	return ""
+}
+
+// FixedAt returns length characters of the fixed part starting at offset.
+func (m *Message) FixedAt(offset, length int) string {
+	if offset+length > len(m.Fixed) {
+		return ""
+	}
+
+	return m.Fixed[offset : offset+length]
+}
+
+// Encode serializes the message. When seq is not negative the AY/AZ error
+// detection fields are appended.
+func (m *Message) Encode(seq int) string {
+	var b strings.Builder
+
+	b.WriteString(m.Code)
+	b.WriteString(m.Fixed)
+
+	for _, f := range m.Fields {
+		b.WriteString(f.ID)
+		b.WriteString(sanitize(f.Value))
+		b.WriteByte('|')
+	}
+
+	if seq >= 0 {
+		b.WriteString("AY" + strconv.Itoa(seq%10) + "AZ")
+		b.WriteString(Checksum(b.String()))
+	}
+
+	return b.String()
+}
+
+// Parse decodes a single message without its terminator. A checksum
+// mismatch is reported as ErrChecksum.
+func Parse(raw string) (*Message, error) {
+	raw = strings.TrimRight(raw, "\r\n")
+	if len(raw) < 2 {
+		return nil, fmt.Errorf("message too short: %q", raw)
+	}
+
+	m := &Message{Code: raw[:2], Sequence: -1}
+
+	if loc := errorDetection.FindStringSubmatchIndex(raw); loc != nil {
+		if !strings.EqualFold(Checksum(raw[:loc[4]]), raw[loc[4]:]) {
+			return nil, ErrChecksum
+		}
+
+		m.Sequence, _ = strconv.Atoi(raw[loc[2]:loc[3]])
+		raw = raw[:loc[0]]
+	}
+
+	fixed, ok := fixedLengths[m.Code]
+	if !ok {
+		return nil, fmt.Errorf("unsupported message %q", m.Code)
+	}
+
+	if len(raw) < 2+fixed {
+		return nil, fmt.Errorf("message %s: fixed part too short", m.Code)
+	}
+
+	m.Fixed = raw[2 : 2+fixed]
+
+	for _, part := range strings.Split(raw[2+fixed:], "|") {
+		if len(part) < 2 {
+			continue
+		}
+
+		m.Fields = append(m.Fields, Field{ID: part[:2], Value: part[2:]})
+	}
+
+	return m, nil
+}
+
+// Checksum computes the SIP2 checksum: the two's complement of the sum of
+// all characters, as four uppercase hex digits.
+func Checksum(s string) string {
+	var sum uint16
+	for i := 0; i < len(s); i++ {
+		sum += uint16(s[i])
+	}
+
+	return fmt.Sprintf("%04X", -sum)
+}
+
+// Timestamp formats t as the 18 character SIP2 date.
+func Timestamp(t time.Time) string {
+	return t.Format(timestampLayout)
+}
+
+// Bool formats a SIP2 Y/N flag.
+func Bool(v bool) string {
+	if v {
+		return "Y"
+	}
+
+	return "N"
+}
+
+// Digit formats a SIP2 1/0 flag.
+func Digit(v bool) string {
+	if v {
+		return "1"
+	}
+
+	return "0"
+}
+
+// Count formats a four digit counter.
+func Count(n int) string {
+	if n > 9999 {
+		n = 9999
+	}
+
+	return fmt.Sprintf("%04d", n)
+}
+
+func sanitize(v string) string {
+	return strings.NewReplacer("|", " ", "\r", " ", "\n", " ").Replace(v)
+}
@@ -0,0 +1,355 @@
+package sip2
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrChecksum is returned by Parse when the AZ checksum does not match.
+var ErrChecksum = errors.New("sip2: checksum mismatch")
+
+// maxMessageLength bounds a request, so a client cannot make the server
+// buffer an endless line. Self check requests are far shorter.
+const maxMessageLength = 4096
+
+// Failed logins allowed from one address within loginWindow. Past the limit
+// logins from it are refused and the connection closed, whether the
+// credentials are right or not, until the window of the first failure passed.
+const (
+	loginWindow      = 15 * time.Minute
+	maxLoginFailures = 5
+)
+
+type remoteAddrKey struct{}
+
+// RemoteAddr returns the host the connection of a handler's context comes
+// from, empty outside of a connection.
+func RemoteAddr(ctx context.Context) string {
+	addr, _ := ctx.Value(remoteAddrKey{}).(string)
+	return addr
+}
+
+// Handler answers circulation requests. Login, resend and status handling is
+// done by the server itself. The context belongs to the connection and is
+// cancelled when it closes or Shutdown stops waiting for it.
+type Handler interface {
+	SCStatus(ctx context.Context, req *Message) *Message
+	PatronStatus(ctx context.Context, req *Message) *Message
+	PatronInfo(ctx context.Context, req *Message) *Message
+	ItemInfo(ctx context.Context, req *Message) *Message
+	Checkout(ctx context.Context, req *Message) *Message
+	Checkin(ctx context.Context, req *Message) *Message
+	Renew(ctx context.Context, req *Message) *Message
+	EndSession(ctx context.Context, req *Message) *Message
+}
+
+// Config configures a SIP2 server.
+type Config struct {
+	Addr string
+	// Username and Password are the credentials the self check has to send
+	// in its login message before anything but a status request.
+	Username    string
+	Password    string
+	Handler     Handler
+	IdleTimeout time.Duration
+}
+
+// Server is a SIP2 TCP server.
+type Server struct {
+	cfg Config
+
+	// ctx is the parent of the connections' contexts, cancel aborts the
+	// requests still running when Shutdown gives up
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	failures map[string]*failedLogins
+	wg       sync.WaitGroup
+}
+
+type failedLogins struct {
+	count int
+	first time.Time
+}
+
+// NewServer creates a server, it does not start listening.
+func NewServer(cfg Config) (*Server, error) {
+	if cfg.Handler == nil {
+		return nil, errors.New("sip2: handler is required")
+	}
+
+	if cfg.Username == "" || cfg.Password == "" {
+		return nil, errors.New("sip2: login user and password are required")
+	}
+
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = 10 * time.Minute
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Server{cfg: cfg, ctx: ctx, cancel: cancel, conns: map[net.Conn]struct{}{}, failures: map[string]*failedLogins{}}, nil
+}
+
+// ListenAndServe accepts connections until Shutdown is called.
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until Shutdown is called.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+
+		go s.serveConn(conn)
+	}
+}
+
+// Shutdown stops accepting connections and closes open sessions, waiting
+// for running requests until ctx is done and then cancelling them.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if s.listener != nil {
+		_ = s.listener.Close()
+	}
+
+	for c := range s.conns {
+		_ = c.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		return ctx.Err()
+	}
+}
+
+type session struct {
+	loggedIn bool
+	last     string
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+
+		_ = conn.Close()
+	}()
+
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		host = conn.RemoteAddr().String()
+	}
+
+	ctx, cancel := context.WithCancel(context.WithValue(s.ctx, remoteAddrKey{}, host))
+	defer cancel()
+
+	sess := &session{}
+	r := bufio.NewReaderSize(conn, maxMessageLength)
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(s.cfg.IdleTimeout))
+
+		raw, err := r.ReadSlice(messageTerminator)
+		if errors.Is(err, bufio.ErrBufferFull) {
+			slog.Warn("sip2 message too long, closing connection", "remote", conn.RemoteAddr().String())
+			return
+		}
+
+		if err != nil {
+			return
+		}
+
+		line := strings.TrimLeft(string(raw), "\r\n")
+		if line == "\r" || line == "" {
+			continue
+		}
+
+		resp := s.handle(ctx, sess, line)
+		if resp == "" {
+			return
+		}
+
+		if _, err := conn.Write([]byte(resp + string(messageTerminator))); err != nil {
+			return
+		}
+	}
+}
+
+// handle processes one raw message and returns the encoded response. An
+// empty response closes the connection.
+func (s *Server) handle(ctx context.Context, sess *session, line string) string {
+	req, err := Parse(line)
+	if errors.Is(err, ErrChecksum) {
+		return NewMessage(CodeSCResend).Encode(-1)
+	}
+
+	if err != nil {
+		slog.Warn("sip2 message rejected", "err", err)
+		return NewMessage(CodeSCResend).Encode(-1)
+	}
+
+	if req.Code == CodeACSResend {
+		return sess.last
+	}
+
+	var resp *Message
+
+	switch {
+	case req.Code == CodeLogin:
+		addr := RemoteAddr(ctx)
+		if s.loginThrottled(addr, time.Now()) {
+			slog.Warn("sip2 login refused after failed logins, closing connection", "remote", addr)
+			return ""
+		}
+
+		ok := s.validLogin(req.Get(FieldLoginUserID), req.Get(FieldLoginPassword))
+		if ok {
+			s.loginSucceeded(addr)
+		} else {
+			slog.Warn("sip2 login failed", "remote", addr, "user", req.Get(FieldLoginUserID))
+			s.loginFailed(addr, time.Now())
+		}
+
+		sess.loggedIn = sess.loggedIn || ok
+		resp = NewMessage(CodeLoginResp, Digit(ok))
+	case !sess.loggedIn && req.Code != CodeSCStatus:
+		// the self check has to log in before it can circulate
+		return ""
+	default:
+		resp = s.dispatch(ctx, req)
+	}
+
+	if resp == nil {
+		return NewMessage(CodeSCResend).Encode(-1)
+	}
+
+	sess.last = resp.Encode(req.Sequence)
+
+	return sess.last
+}
+
+// validLogin checks the self check's credentials in constant time, so the
+// time taken does not tell how much of them matched.
+func (s *Server) validLogin(user, password string) bool {
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(s.cfg.Username))
+	passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(s.cfg.Password))
+
+	return userOK&passwordOK == 1
+}
+
+// loginThrottled reports whether logins from addr are refused.
+func (s *Server) loginThrottled(addr string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.failures[addr]
+
+	return ok && f.count >= maxLoginFailures && now.Sub(f.first) < loginWindow
+}
+
+// loginFailed counts a failed login from addr.
+func (s *Server) loginFailed(addr string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for a, f := range s.failures {
+		if now.Sub(f.first) >= loginWindow {
+			delete(s.failures, a)
+		}
+	}
+
+	f, ok := s.failures[addr]
+	if !ok {
+		f = &failedLogins{first: now}
+		s.failures[addr] = f
+	}
+
+	f.count++
+}
+
+// loginSucceeded forgets the failed logins from addr.
+func (s *Server) loginSucceeded(addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, addr)
+}
+
+func (s *Server) dispatch(ctx context.Context, req *Message) *Message {
+	h := s.cfg.Handler
+
+	switch req.Code {
+	case CodeSCStatus:
+		return h.SCStatus(ctx, req)
+	case CodePatronStatus:
+		return h.PatronStatus(ctx, req)
+	case CodePatronInfo:
+		return h.PatronInfo(ctx, req)
+	case CodeItemInfo:
+		return h.ItemInfo(ctx, req)
+	case CodeCheckout:
+		return h.Checkout(ctx, req)
+	case CodeCheckin:
+		return h.Checkin(ctx, req)
+	case CodeRenew:
+		return h.Renew(ctx, req)
+	case CodeEndSession:
+		return h.EndSession(ctx, req)
+	default:
+		slog.Warn("sip2 message not handled", "code", req.Code)
+		return nil
+	}
+}
+
+// String implements fmt.Stringer for debugging output.
+func (m *Message) String() string {
+	return fmt.Sprintf("%s%s %v", m.Code, m.Fixed, m.Fields)
+}
@@ -0,0 +1,300 @@
+package sip2
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// library is a Handler lending one copy of each item to any patron.
+type library struct {
+	mu     sync.Mutex
+	onLoan map[string]string
+}
+
+func (l *library) SCStatus(context.Context, *Message) *Message {
+	return NewMessage(CodeACSStatus, "Y", "Y", "Y", "Y", "N", "N", "999", "999", Timestamp(time.Now()), "2.00")
+}
+
+func (l *library) PatronStatus(context.Context, *Message) *Message { return nil }
+func (l *library) PatronInfo(context.Context, *Message) *Message   { return nil }
+func (l *library) ItemInfo(context.Context, *Message) *Message     { return nil }
+func (l *library) Renew(context.Context, *Message) *Message        { return nil }
+
+func (l *library) Checkout(_ context.Context, req *Message) *Message {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	item := req.Get(FieldItemID)
+	_, lent := l.onLoan[item]
+
+	if !lent {
+		l.onLoan[item] = req.Get(FieldPatronID)
+	}
+
+	return NewMessage(CodeCheckoutResp, Digit(!lent), "N", "U", "N", Timestamp(time.Now())).
+		Add(FieldItemID, item)
+}
+
+func (l *library) Checkin(_ context.Context, req *Message) *Message {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	item := req.Get(FieldItemID)
+	_, lent := l.onLoan[item]
+	delete(l.onLoan, item)
+
+	return NewMessage(CodeCheckinResp, Digit(lent), Bool(lent), "U", "N", Timestamp(time.Now())).
+		Add(FieldItemID, item)
+}
+
+func (l *library) EndSession(context.Context, *Message) *Message {
+	return NewMessage(CodeEndSessionResp, "Y", Timestamp(time.Now()))
+}
+
+// startServer runs a server for lib on a free port until the test ends.
+func startServer(t *testing.T, lib *library) string {
+	t.Helper()
+
+	srv, err := NewServer(Config{Username: "kiosk", Password: "secret", Handler: lib})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() { _ = srv.Serve(l) }()
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		if err := srv.Shutdown(ctx); err != nil {
+			t.Errorf("shutdown: %v", err)
+		}
+	})
+
+	return l.Addr().String()
+}
+
+func dial(t *testing.T, addr string) *Client {
+	t.Helper()
+
+	c, err := Dial(addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = c.Close() })
+
+	return c
+}
+
+func login(user, password string) *Message {
+	return NewMessage(CodeLogin, "00").
+		Add(FieldLoginUserID, user).
+		Add(FieldLoginPassword, password).
+		Add(FieldLocationCode, "lobby")
+}
+
+func checkout(patron, item string) *Message {
+	return NewMessage(CodeCheckout, "N", "N", Timestamp(time.Now()), strings.Repeat(" ", 18)).
+		Add(FieldInstitutionID, "library").
+		Add(FieldPatronID, patron).
+		Add(FieldItemID, item)
+}
+
+func checkin(item string) *Message {
+	now := Timestamp(time.Now())
+
+	return NewMessage(CodeCheckin, "N", now, now).
+		Add(FieldCurrentLocation, "lobby").
+		Add(FieldInstitutionID, "library").
+		Add(FieldItemID, item)
+}
+
+func TestServerSession(t *testing.T) {
+	lib := &library{onLoan: map[string]string{}}
+	c := dial(t, startServer(t, lib))
+
+	steps := []struct {
+		name string
+		req  *Message
+		code string
+		ok   string
+	}{
+		{"login", login("kiosk", "secret"), CodeLoginResp, "1"},
+		{"status", NewMessage(CodeSCStatus, "0", "080", "2.00"), CodeACSStatus, "Y"},
+		{"checkout", checkout("1000001", "9780131103627"), CodeCheckoutResp, "1"},
+		{"checkout lent item", checkout("1000002", "9780131103627"), CodeCheckoutResp, "0"},
+		{"checkin", checkin("9780131103627"), CodeCheckinResp, "1"},
+		{"checkin again", checkin("9780131103627"), CodeCheckinResp, "0"},
+		{"end session", NewMessage(CodeEndSession, Timestamp(time.Now())), CodeEndSessionResp, "Y"},
+	}
+
+	for _, st := range steps {
+		resp, err := c.Send(st.req)
+		if err != nil {
+			t.Fatalf("%s: %v", st.name, err)
+		}
+
+		if resp.Code != st.code || resp.FixedAt(0, 1) != st.ok {
+			t.Errorf("%s: got %s, want code %s with %s", st.name, resp, st.code, st.ok)
+		}
+	}
+
+	if len(lib.onLoan) != 0 {
+		t.Errorf("items still on loan: %v", lib.onLoan)
+	}
+}
+
+func TestServerRequiresLogin(t *testing.T) {
+	lib := &library{onLoan: map[string]string{}}
+	addr := startServer(t, lib)
+
+	t.Run("wrong password", func(t *testing.T) {
+		c := dial(t, addr)
+
+		resp, err := c.Send(login("kiosk", "guess"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.FixedAt(0, 1) != "0" {
+			t.Errorf("login accepted: %s", resp)
+		}
+
+		if _, err := c.Send(checkout("1000001", "9780131103627")); err == nil {
+			t.Error("checkout answered without a login")
+		}
+	})
+
+	t.Run("no login", func(t *testing.T) {
+		c := dial(t, addr)
+
+		if _, err := c.Send(checkout("1000001", "9780131103627")); err == nil {
+			t.Error("checkout answered without a login")
+		}
+	})
+
+	if len(lib.onLoan) != 0 {
+		t.Errorf("items lent without a login: %v", lib.onLoan)
+	}
+}
+
+func TestServerRefusesLoginsAfterFailures(t *testing.T) {
+	addr := startServer(t, &library{onLoan: map[string]string{}})
+	c := dial(t, addr)
+
+	for i := range maxLoginFailures {
+		resp, err := c.Send(login("kiosk", "guess"))
+		if err != nil {
+			t.Fatalf("login %d: %v", i+1, err)
+		}
+
+		if resp.FixedAt(0, 1) != "0" {
+			t.Fatalf("login %d accepted: %s", i+1, resp)
+		}
+	}
+
+	// the right credentials are refused too, on any connection
+	if _, err := dial(t, addr).Send(login("kiosk", "secret")); err == nil {
+		t.Error("login answered after too many failures")
+	}
+}
+
+func TestServerClosesLongMessage(t *testing.T) {
+	addr := startServer(t, &library{onLoan: map[string]string{}})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+
+	// the server stops reading once the buffer is full, so the write may
+	// fail or block until the connection is closed
+	go func() { _, _ = conn.Write([]byte(strings.Repeat("9", 2*maxMessageLength))) }()
+
+	_, err = conn.Read(make([]byte, 1))
+
+	var netErr net.Error
+	if err == nil || errors.As(err, &netErr) && netErr.Timeout() {
+		t.Errorf("connection still open after an oversized message: %v", err)
+	}
+}
+
+func TestNewServerRequiresCredentials(t *testing.T) {
+	for _, cfg := range []Config{
+		{Handler: &library{}},
+		{Handler: &library{}, Username: "kiosk"},
+		{Handler: &library{}, Password: "secret"},
+	} {
+		if _, err := NewServer(cfg); err == nil {
+			t.Errorf("NewServer(%q, %q) accepted missing credentials", cfg.Username, cfg.Password)
+		}
+	}
+}
+
+// stalled is a library whose checkouts wait until their context is done.
+type stalled struct {
+	*library
+	started   chan struct{}
+	cancelled chan struct{}
+}
+
+func (l *stalled) Checkout(ctx context.Context, _ *Message) *Message {
+	close(l.started)
+	<-ctx.Done()
+	close(l.cancelled)
+
+	return nil
+}
+
+func TestShutdownCancelsRunningRequests(t *testing.T) {
+	lib := &stalled{library: &library{onLoan: map[string]string{}}, started: make(chan struct{}), cancelled: make(chan struct{})}
+
+	srv, err := NewServer(Config{Username: "kiosk", Password: "secret", Handler: lib})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() { _ = srv.Serve(l) }()
+
+	c := dial(t, l.Addr().String())
+
+	if _, err := c.Send(login("kiosk", "secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() { _, _ = c.Send(checkout("1000001", "9780131103627")) }()
+
+	<-lib.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("shutdown: got %v, want the deadline while the checkout runs", err)
+	}
+
+	select {
+	case <-lib.cancelled:
+	case <-time.After(time.Second):
+		t.Error("running checkout not cancelled by the shutdown")
+	}
+}
@@ -0,0 +1,292 @@
+package sru
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/tliefheid/go-ils/internal/repository"
+)
+
+// indexes maps the CQL index names we understand onto book fields.
+var indexes = map[string]repository.BookField{
+	"cql.serverchoice": repository.BookFieldAny,
+	"cql.anywhere":     repository.BookFieldAny,
+	"title":            repository.BookFieldTitle,
+	"dc.title":         repository.BookFieldTitle,
+	"author":           repository.BookFieldAuthor,
+	"creator":          repository.BookFieldAuthor,
+	"dc.creator":       repository.BookFieldAuthor,
+	"isbn":             repository.BookFieldISBN,
+	"bath.isbn":        repository.BookFieldISBN,
+	"dc.identifier":    repository.BookFieldISBN,
+	"year":             repository.BookFieldYear,
+	"date":             repository.BookFieldYear,
+	"dc.date":          repository.BookFieldYear,
+}
+
+// ParseCQL parses a CQL query into a book query tree. Supported are the
+// indexes title, author, isbn and year (plain, dc. and bath. prefixed), the
+// relations =, ==, exact, any, all, adj, <, <=, >, >=, <> and the boolean
+// operators and, or and not. Booleans bind left to right as CQL requires.
+func ParseCQL(query string) (*repository.BookQuery, error) {
+	toks, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{toks: toks}
+
+	q, err := p.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.toks) {
+		return nil, Diag(DiagQuerySyntax, fmt.Sprintf("unexpected %q", p.toks[p.pos].val))
+	}
+
+	return q, nil
+}
+
+// ParseScanClause parses a scan clause such as `title=har` into the field to
+// browse and the starting term.
+func ParseScanClause(clause string) (repository.BookField, string, error) {
+	toks, err := tokenize(clause)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch len(toks) {
+	case 1:
+		return repository.BookFieldTitle, toks[0].val, nil
+	case 3:
+		field, ok := indexes[strings.ToLower(toks[0].val)]
+		if !ok || field == repository.BookFieldAny {
+			return "", "", Diag(DiagUnsupportedIndex, toks[0].val)
+		}
+
+		if toks[1].val != "=" {
+			return "", "", Diag(DiagUnsupportedRelation, toks[1].val)
+		}
+
+		return field, toks[2].val, nil
+	default:
+		return "", "", Diag(DiagQuerySyntax, clause)
+	}
+}
+
+type token struct {
+	val    string
+	quoted bool
+}
+
+func tokenize(s string) ([]token, error) {
+	var toks []token
+
+	rs := []rune(s)
+
+	for i := 0; i < len(rs); {
+		c := rs[i]
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(' || c == ')':
+			toks = append(toks, token{val: string(c)})
+			i++
+		case c == '"':
+			var b strings.Builder
+
+			i++
+			for i < len(rs) && rs[i] != '"' {
+				if rs[i] == '\\' && i+1 < len(rs) {
+					i++
+				}
+
+				b.WriteRune(rs[i])
+				i++
+			}
+
+			if i >= len(rs) {
+				return nil, Diag(DiagQuerySyntax, "unterminated quoted string")
+			}
+
+			i++
+
+			toks = append(toks, token{val: b.String(), quoted: true})
+		case c == '=' || c == '<' || c == '>':
+			j := i + 1
+			if j < len(rs) && (rs[j] == '=' || (c == '<' && rs[j] == '>')) {
+				j++
+			}
+
+			toks = append(toks, token{val: string(rs[i:j])})
+			i = j
+		default:
+			j := i
+			for j < len(rs) && !unicode.IsSpace(rs[j]) && !strings.ContainsRune(`()"=<>`, rs[j]) {
+				j++
+			}
+
+			toks = append(toks, token{val: string(rs[i:j])})
+			i = j
+		}
+	}
+
+	if len(toks) == 0 {
+		return nil, Diag(DiagQuerySyntax, "empty query")
+	}
+
+	return toks, nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.toks) {
+		return token{}, false
+	}
+
+	return p.toks[p.pos], true
+}
+
+func (p *parser) next() (token, bool) {
+	t, ok := p.peek()
+	if ok {
+		p.pos++
+	}
+
+	return t, ok
+}
+
+func (p *parser) parseQuery() (*repository.BookQuery, error) {
+	left, err := p.parseClause()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t, ok := p.peek()
+		if !ok || t.quoted || t.val == ")" {
+			return left, nil
+		}
+
+		op := repository.BoolOp(strings.ToLower(t.val))
+		switch op {
+		case repository.BoolAnd, repository.BoolOr, repository.BoolNot:
+		case "prox":
+			return nil, Diag(DiagUnsupportedBoolean, t.val)
+		default:
+			return nil, Diag(DiagQuerySyntax, fmt.Sprintf("expected boolean operator, got %q", t.val))
+		}
+
+		p.pos++
+
+		right, err := p.parseClause()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &repository.BookQuery{Op: op, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseClause() (*repository.BookQuery, error) {
+	t, ok := p.next()
+	if !ok {
+		return nil, Diag(DiagQuerySyntax, "unexpected end of query")
+	}
+
+	if t.val == "(" && !t.quoted {
+		q, err := p.parseQuery()
+		if err != nil {
+			return nil, err
+		}
+
+		if c, ok := p.next(); !ok || c.val != ")" {
+			return nil, Diag(DiagQuerySyntax, "missing closing parenthesis")
+		}
+
+		return q, nil
+	}
+
+	// index relation term, or a bare term searched with cql.serverChoice
+	rel, ok := p.peek()
+	if !ok || rel.quoted || !isRelation(rel.val) {
+		return &repository.BookQuery{Field: repository.BookFieldAny, Relation: repository.RelationContains, Value: t.val}, nil
+	}
+
+	p.pos++
+
+	term, ok := p.next()
+	if !ok {
+		return nil, Diag(DiagQuerySyntax, "missing search term")
+	}
+
+	field, ok := indexes[strings.ToLower(t.val)]
+	if !ok {
+		return nil, Diag(DiagUnsupportedIndex, t.val)
+	}
+
+	return buildLeaf(field, strings.ToLower(rel.val), term.val)
+}
+
+func isRelation(v string) bool {
+	switch strings.ToLower(v) {
+	case "=", "==", "exact", "any", "all", "adj", "<", "<=", ">", ">=", "<>":
+		return true
+	}
+
+	return false
+}
+
+// buildLeaf expands the word-oriented relations (any, all) into a boolean
+// tree of contains conditions.
+func buildLeaf(field repository.BookField, rel, value string) (*repository.BookQuery, error) {
+	if field == repository.BookFieldYear {
+		if rel == "any" || rel == "all" || rel == "adj" {
+			return nil, Diag(DiagUnsupportedRelation, rel)
+		}
+
+		if _, err := strconv.Atoi(value); err != nil {
+			return nil, Diag(DiagInvalidTerm, value)
+		}
+	}
+
+	leaf := func(r repository.Relation, v string) *repository.BookQuery {
+		return &repository.BookQuery{Field: field, Relation: r, Value: v}
+	}
+
+	switch rel {
+	case "=", "adj":
+		return leaf(repository.RelationContains, value), nil
+	case "==", "exact":
+		return leaf(repository.RelationExact, value), nil
+	case "<", "<=", ">", ">=", "<>":
+		return leaf(repository.Relation(rel), value), nil
+	case "any", "all":
+		words := strings.Fields(value)
+		if len(words) == 0 {
+			return nil, Diag(DiagQuerySyntax, "empty search term")
+		}
+
+		op := repository.BoolOr
+		if rel == "all" {
+			op = repository.BoolAnd
+		}
+
+		q := leaf(repository.RelationContains, words[0])
+		for _, w := range words[1:] {
+			q = &repository.BookQuery{Op: op, Left: q, Right: leaf(repository.RelationContains, w)}
+		}
+
+		return q, nil
+	default:
+		return nil, Diag(DiagUnsupportedRelation, rel)
+	}
+}
@@ -0,0 +1,41 @@
+package sru
+
+import "fmt"
+
+// Diagnostic codes from the SRU diagnostics list
+// (info:srw/diagnostic/1/<code>).
+const (
+	DiagGeneral             = 1
+	DiagUnsupportedOp       = 4
+	DiagUnsupportedVersion  = 5
+	DiagUnsupportedParam    = 6
+	DiagMissingParam        = 7
+	DiagQuerySyntax         = 10
+	DiagUnsupportedIndex    = 16
+	DiagUnsupportedRelation = 19
+	DiagInvalidTerm         = 36
+	DiagUnsupportedBoolean  = 37
+	DiagFirstRecordRange    = 61
+	DiagUnsupportedSchema   = 66
+	DiagUnsupportedPacking  = 71
+)
+
+// Diagnostic is an SRU error that is reported inside a normal response.
+type Diagnostic struct {
+	Code    int
+	Details string
+}
+
+// Diag creates a diagnostic error.
+func Diag(code int, details string) *Diagnostic {
+	return &Diagnostic{Code: code, Details: details}
+}
+
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("sru diagnostic %d: %s", d.Code, d.Details)
+}
+
+// URI returns the diagnostic identifier.
+func (d *Diagnostic) URI() string {
+	return fmt.Sprintf("info:srw/diagnostic/1/%d", d.Code)
+}
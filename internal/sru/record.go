@@ -0,0 +1,95 @@
+package sru
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+	"strings"
+
+	"github.com/tliefheid/go-ils/internal/model"
+)
+
+// Schema describes a record schema we can produce.
+type Schema struct {
+	Name   string
+	URI    string
+	Title  string
+	Encode func(model.Book) string
+}
+
+// Schemas are the supported record schemas, the first one is the default.
+var Schemas = []Schema{
+	{Name: "dc", URI: "info:srw/schema/1/dc-v1.1", Title: "Dublin Core", Encode: DublinCore},
+	{Name: "marcxml", URI: "info:srw/schema/1/marcxml-v1.1", Title: "MARCXML", Encode: MARCXML},
+}
+
+// LookupSchema finds a schema by short name or URI. An empty name selects the
+// default schema.
+func LookupSchema(name string) (Schema, bool) {
+	if name == "" {
+		return Schemas[0], true
+	}
+
+	for _, s := range Schemas {
+		if strings.EqualFold(s.Name, name) || s.URI == name {
+			return s, true
+		}
+	}
+
+	return Schema{}, false
+}
+
+// DublinCore renders a book as an oai_dc record.
+func DublinCore(b model.Book) string {
+	var buf bytes.Buffer
+
+	buf.WriteString(`<oai_dc:dc xmlns:oai_dc="http://www.openarchives.org/OAI/2.0/oai_dc/" xmlns:dc="http://purl.org/dc/elements/1.1/">`)
+	writeElem(&buf, "dc:title", b.Title)
+	writeElem(&buf, "dc:creator", b.Author)
+	writeElem(&buf, "dc:type", "Text")
+	writeElem(&buf, "dc:identifier", "URN:ISBN:"+b.ISBN)
+
+	if b.PublicationYear > 0 {
+		writeElem(&buf, "dc:date", strconv.Itoa(b.PublicationYear))
+	}
+
+	buf.WriteString(`</oai_dc:dc>`)
+
+	return buf.String()
+}
+
+// MARCXML renders a minimal MARC21 bibliographic record for a book.
+func MARCXML(b model.Book) string {
+	var buf bytes.Buffer
+
+	buf.WriteString(`<record xmlns="http://www.loc.gov/MARC21/slim">`)
+	writeElem(&buf, "leader", "00000nam a2200000 a 4500")
+	buf.WriteString(`<controlfield tag="001">` + strconv.Itoa(b.ID) + `</controlfield>`)
+	writeDatafield(&buf, "020", "a", b.ISBN)
+	writeDatafield(&buf, "100", "a", b.Author)
+	writeDatafield(&buf, "245", "a", b.Title)
+
+	if b.PublicationYear > 0 {
+		writeDatafield(&buf, "260", "c", strconv.Itoa(b.PublicationYear))
+	}
+
+	buf.WriteString(`</record>`)
+
+	return buf.String()
+}
+
+func writeElem(buf *bytes.Buffer, name, value string) {
+	buf.WriteString("<" + name + ">")
+	_ = xml.EscapeText(buf, []byte(value))
+	buf.WriteString("</" + name + ">")
+}
+
+func writeDatafield(buf *bytes.Buffer, tag, code, value string) {
+	if value == "" {
+		return
+	}
+
+	buf.WriteString(`<datafield tag="` + tag + `" ind1=" " ind2=" "><subfield code="` + code + `">`)
+	_ = xml.EscapeText(buf, []byte(value))
+	buf.WriteString(`</subfield></datafield>`)
+}
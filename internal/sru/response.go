@@ -0,0 +1,263 @@
+package sru
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// Supported protocol versions.
+const (
+	Version12 = "1.2"
+	Version20 = "2.0"
+)
+
+// namespaces per protocol version: response and diagnostic namespace.
+var namespaces = map[string][2]string{
+	Version12: {"http://www.loc.gov/zing/srw/", "http://www.loc.gov/zing/srw/diagnostic/"},
+	Version20: {"http://docs.oasis-open.org/ns/search-ws/sruResponse", "http://docs.oasis-open.org/ns/search-ws/diagnostic"},
+}
+
+// SupportedVersion reports whether v is a version this server speaks.
+func SupportedVersion(v string) bool {
+	_, ok := namespaces[v]
+	return ok
+}
+
+// Record is a single record in a searchRetrieve or explain response.
+type Record struct {
+	Schema   string
+	Data     string // serialized XML
+	Position int
+}
+
+// SearchRetrieveResponse holds the result of a searchRetrieve operation.
+type SearchRetrieveResponse struct {
+	Version            string
+	NumberOfRecords    int
+	Records            []Record
+	NextRecordPosition int
+	Escaped            bool // records are packed as escaped strings
+	Diagnostics        []*Diagnostic
+}
+
+// ScanResponse holds the result of a scan operation.
+type ScanResponse struct {
+	Version     string
+	Terms       []ScanTerm
+	Diagnostics []*Diagnostic
+}
+
+// ScanTerm is a single scan result.
+type ScanTerm struct {
+	Value           string
+	NumberOfRecords int
+}
+
+// ExplainResponse holds the result of an explain operation.
+type ExplainResponse struct {
+	Version     string
+	Host        string
+	Port        string
+	Database    string
+	Diagnostics []*Diagnostic
+}
+
+type xmlRecord struct {
+	XMLName        xml.Name `xml:"srw:record"`
+	RecordSchema   string   `xml:"srw:recordSchema"`
+	RecordPacking  string   `xml:"srw:recordPacking,omitempty"`
+	RecordEscaping string   `xml:"srw:recordXMLEscaping,omitempty"`
+	RecordData     struct {
+		Inner string `xml:",innerxml"`
+	} `xml:"srw:recordData"`
+	RecordPosition int `xml:"srw:recordPosition,omitempty"`
+}
+
+type xmlDiagnostic struct {
+	XMLName xml.Name `xml:"diag:diagnostic"`
+	URI     string   `xml:"diag:uri"`
+	Details string   `xml:"diag:details,omitempty"`
+}
+
+type xmlDiagnostics struct {
+	XMLNSDiag string          `xml:"xmlns:diag,attr"`
+	Items     []xmlDiagnostic `xml:"diag:diagnostic"`
+}
+
+type xmlSearchRetrieve struct {
+	XMLName            xml.Name        `xml:"srw:searchRetrieveResponse"`
+	XMLNS              string          `xml:"xmlns:srw,attr"`
+	Version            string          `xml:"srw:version"`
+	NumberOfRecords    int             `xml:"srw:numberOfRecords"`
+	Records            *[]xmlRecord    `xml:"srw:records>srw:record,omitempty"`
+	NextRecordPosition int             `xml:"srw:nextRecordPosition,omitempty"`
+	Diagnostics        *xmlDiagnostics `xml:"srw:diagnostics,omitempty"`
+}
+
+type xmlTerm struct {
+	Value           string `xml:"srw:value"`
+	NumberOfRecords int    `xml:"srw:numberOfRecords"`
+}
+
+type xmlScan struct {
+	XMLName     xml.Name        `xml:"srw:scanResponse"`
+	XMLNS       string          `xml:"xmlns:srw,attr"`
+	Version     string          `xml:"srw:version"`
+	Terms       *[]xmlTerm      `xml:"srw:terms>srw:term,omitempty"`
+	Diagnostics *xmlDiagnostics `xml:"srw:diagnostics,omitempty"`
+}
+
+type xmlExplain struct {
+	XMLName     xml.Name        `xml:"srw:explainResponse"`
+	XMLNS       string          `xml:"xmlns:srw,attr"`
+	Version     string          `xml:"srw:version"`
+	Record      xmlRecord       `xml:"srw:record"`
+	Diagnostics *xmlDiagnostics `xml:"srw:diagnostics,omitempty"`
+}
+
+// WriteSearchRetrieve serializes a searchRetrieve response.
+func WriteSearchRetrieve(w io.Writer, r SearchRetrieveResponse) error {
+	out := xmlSearchRetrieve{
+		XMLNS:              namespaces[r.Version][0],
+		Version:            r.Version,
+		NumberOfRecords:    r.NumberOfRecords,
+		NextRecordPosition: r.NextRecordPosition,
+		Diagnostics:        diagnostics(r.Version, r.Diagnostics),
+	}
+
+	if len(r.Records) > 0 {
+		records := make([]xmlRecord, 0, len(r.Records))
+		for _, rec := range r.Records {
+			records = append(records, packRecord(r.Version, rec, r.Escaped))
+		}
+
+		out.Records = &records
+	}
+
+	return encode(w, out)
+}
+
+// WriteScan serializes a scan response.
+func WriteScan(w io.Writer, r ScanResponse) error {
+	out := xmlScan{
+		XMLNS:       namespaces[r.Version][0],
+		Version:     r.Version,
+		Diagnostics: diagnostics(r.Version, r.Diagnostics),
+	}
+
+	if len(r.Terms) > 0 {
+		terms := make([]xmlTerm, 0, len(r.Terms))
+		for _, t := range r.Terms {
+			terms = append(terms, xmlTerm(t))
+		}
+
+		out.Terms = &terms
+	}
+
+	return encode(w, out)
+}
+
+// WriteExplain serializes an explain response describing the catalog.
+func WriteExplain(w io.Writer, r ExplainResponse) error {
+	out := xmlExplain{
+		XMLNS:       namespaces[r.Version][0],
+		Version:     r.Version,
+		Record:      packRecord(r.Version, Record{Schema: "http://explain.z3950.org/dtd/2.0/", Data: explainRecord(r)}, false),
+		Diagnostics: diagnostics(r.Version, r.Diagnostics),
+	}
+
+	return encode(w, out)
+}
+
+func packRecord(version string, rec Record, escaped bool) xmlRecord {
+	out := xmlRecord{
+		RecordSchema:   rec.Schema,
+		RecordPosition: rec.Position,
+	}
+
+	packing := "xml"
+	if escaped {
+		packing = "string"
+
+		var buf bytes.Buffer
+
+		_ = xml.EscapeText(&buf, []byte(rec.Data))
+		out.RecordData.Inner = buf.String()
+	} else {
+		out.RecordData.Inner = rec.Data
+	}
+
+	if version == Version20 {
+		out.RecordEscaping = packing
+	} else {
+		out.RecordPacking = packing
+	}
+
+	return out
+}
+
+func diagnostics(version string, diags []*Diagnostic) *xmlDiagnostics {
+	if len(diags) == 0 {
+		return nil
+	}
+
+	out := &xmlDiagnostics{XMLNSDiag: namespaces[version][1]}
+	for _, d := range diags {
+		out.Items = append(out.Items, xmlDiagnostic{URI: d.URI(), Details: d.Details})
+	}
+
+	return out
+}
+
+func explainRecord(r ExplainResponse) string {
+	var buf bytes.Buffer
+
+	buf.WriteString(`<explain xmlns="http://explain.z3950.org/dtd/2.0/">`)
+	buf.WriteString(`<serverInfo protocol="SRU" version="` + r.Version + `">`)
+	writeElem(&buf, "host", r.Host)
+	writeElem(&buf, "port", r.Port)
+	writeElem(&buf, "database", r.Database)
+	buf.WriteString(`</serverInfo>`)
+	buf.WriteString(`<databaseInfo><title lang="en" primary="true">Library ILS catalog</title></databaseInfo>`)
+
+	buf.WriteString(`<indexInfo>`)
+	buf.WriteString(`<set name="cql" identifier="info:srw/cql-context-set/1/cql-v1.2"/>`)
+	buf.WriteString(`<set name="dc" identifier="info:srw/cql-context-set/1/dc-v1.1"/>`)
+	buf.WriteString(`<set name="bath" identifier="http://zing.z3950.org/cql/bath/2.0/"/>`)
+
+	for _, idx := range []struct{ set, name, title string }{
+		{"cql", "serverChoice", "Title, author or ISBN"},
+		{"dc", "title", "Title"},
+		{"dc", "creator", "Author"},
+		{"bath", "isbn", "ISBN"},
+		{"dc", "date", "Publication year"},
+	} {
+		buf.WriteString(`<index><title>` + idx.title + `</title><map><name set="` + idx.set + `">` + idx.name + `</name></map></index>`)
+	}
+
+	buf.WriteString(`</indexInfo>`)
+
+	buf.WriteString(`<schemaInfo>`)
+
+	for _, s := range Schemas {
+		buf.WriteString(`<schema identifier="` + s.URI + `" name="` + s.Name + `"><title>` + s.Title + `</title></schema>`)
+	}
+
+	buf.WriteString(`</schemaInfo>`)
+	buf.WriteString(`<configInfo><default type="numberOfRecords">10</default><setting type="maximumRecords">100</setting>`)
+	buf.WriteString(`<supports type="relation">` + strings.Join([]string{"=", "==", "exact", "any", "all", "adj", "&lt;", "&lt;=", "&gt;", "&gt;=", "&lt;&gt;"}, `</supports><supports type="relation">`) + `</supports>`)
+	buf.WriteString(`</configInfo>`)
+	buf.WriteString(`</explain>`)
+
+	return buf.String()
+}
+
+func encode(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	return xml.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,119 @@
+// Package tracing sets up OpenTelemetry tracing for the services: spans for
+// incoming requests per chi route, for outgoing HTTP calls with the trace
+// context passed on, and an exporter sending them over OTLP or printing
+// them.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters the spans can be sent to.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Config selects where the spans of a service go.
+type Config struct {
+	// ServiceName names the service in the traces.
+	ServiceName string
+	// Exporter is ExporterOTLP, ExporterStdout or ExporterNone; empty is
+	// none.
+	Exporter string
+	// Endpoint is the OTLP/HTTP collector URL, such as
+	// http://localhost:4318. Empty uses the OTEL_EXPORTER_OTLP_ENDPOINT
+	// environment variable or the exporter's default.
+	Endpoint string
+}
+
+// Setup installs the tracer provider and the W3C trace context propagator
+// of cfg. The returned shutdown flushes the spans not exported yet.
+func Setup(ctx context.Context, cfg Config) (shutdown func(context.Context) error, err error) {
+	// propagate the trace context even when this service does not export,
+	// so the traces of the others stay whole
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+
+	switch cfg.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		}
+
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("invalid trace exporter %q, want %s, %s or %s", cfg.Exporter, ExporterOTLP, ExporterStdout, ExporterNone)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("create %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of a package, named by its import path.
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// Middleware starts a span for every request, continuing the trace of the
+// caller. The span is named by the chi route pattern the request matched,
+// such as "GET /books/{id}".
+func Middleware(next http.Handler) http.Handler {
+	named := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		rctx := chi.RouteContext(r.Context())
+		if rctx == nil || rctx.RoutePattern() == "" {
+			return
+		}
+
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(r.Method + " " + rctx.RoutePattern())
+		span.SetAttributes(semconv.HTTPRoute(rctx.RoutePattern()))
+	})
+
+	return otelhttp.NewHandler(named, "http.server",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string { return r.Method }))
+}
+
+// Transport wraps base, http.DefaultTransport when nil, to trace the calls
+// it makes and pass the trace context on to the service called.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return otelhttp.NewTransport(base)
+}